@@ -0,0 +1,302 @@
+package main
+
+import (
+	"aegis/internal/agent"
+
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxIncomingMessage bounds a message from the extension. Lookups and fills
+// are tiny, so anything bigger is a broken or hostile sender.
+const maxIncomingMessage = 64 * 1024
+
+// maxOutgoingMessage is the largest message Chromium and Firefox accept from
+// a native host.
+const maxOutgoingMessage = 1024 * 1024
+
+// errNoAgent is reported when the vault is not unlocked in an agent.
+var errNoAgent = errors.New("the vault is locked; run \"aegis agent start\" to use autofill")
+
+// message is a request from the browser extension.
+type message struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	Type     string          `json:"type"`
+	URL      string          `json:"url,omitempty"`
+	Username string          `json:"username,omitempty"`
+}
+
+// login describes a stored entry offered for a page, without its password.
+type login struct {
+	Username string `json:"username"`
+	Login    string `json:"login,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// reply is the answer to one message. The id of the message is echoed back.
+type reply struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Denied   bool            `json:"denied,omitempty"`
+	Origin   string          `json:"origin,omitempty"`
+	Logins   []login         `json:"logins,omitempty"`
+	Login    string          `json:"login,omitempty"`
+	Password string          `json:"password,omitempty"`
+}
+
+// main is the entry point for the native messaging host. The browser starts
+// it with the caller's extension origin (Chromium) or the manifest path and
+// extension id (Firefox) as arguments and talks to it over stdin and stdout
+// until it closes the port.
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("aegis-native-host: ")
+	log.SetOutput(os.Stderr)
+
+	if err := serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve answers messages until the browser closes stdin.
+//
+// Args:
+//
+//	r: The browser's end of the port, usually stdin.
+//	w: Where replies are written, usually stdout.
+//
+// Returns:
+//
+//	An error if the framing broke or a reply could not be written.
+func serve(r io.Reader, w io.Writer) error {
+	for {
+		raw, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var request message
+		var response reply
+		if err := json.Unmarshal(raw, &request); err != nil {
+			response = reply{Error: fmt.Sprintf("invalid message: %s", err)}
+		} else {
+			response = handle(request)
+			response.ID = request.ID
+		}
+
+		if err := writeMessage(w, response); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers one message from the extension.
+//
+// Args:
+//
+//	request: The decoded message.
+//
+// Returns:
+//
+//	The reply to send.
+func handle(request message) reply {
+	switch request.Type {
+	case "ping":
+		client, err := agent.Dial()
+		if err != nil {
+			return failure(errNoAgent)
+		}
+		defer client.Close()
+		if _, err := client.Ping(); err != nil {
+			return failure(err)
+		}
+		return reply{OK: true}
+
+	case "lookup":
+		origin, err := pageOrigin(request.URL)
+		if err != nil {
+			return failure(err)
+		}
+		logins, err := lookup(origin)
+		if err != nil {
+			return failure(err)
+		}
+		return reply{OK: true, Origin: origin.String(), Logins: logins}
+
+	case "fill":
+		if request.Username == "" {
+			return failure(errors.New("username is required"))
+		}
+		origin, err := pageOrigin(request.URL)
+		if err != nil {
+			return failure(err)
+		}
+		return fill(origin, request.Username)
+	}
+
+	return failure(fmt.Errorf("unknown message type %q", request.Type))
+}
+
+// lookup lists the entries stored for an origin.
+//
+// Args:
+//
+//	origin: The origin of the page.
+//
+// Returns:
+//
+//	The matching entries sorted by name and an error if one occurred.
+func lookup(origin origin) ([]login, error) {
+	entries, err := agentEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	logins := []login{}
+	for _, entry := range entries {
+		if entryMatches(entry, origin) {
+			logins = append(logins, login{Username: entry.Username, Login: entry.Login, URL: entry.URL})
+		}
+	}
+	sort.Slice(logins, func(i, j int) bool {
+		return strings.ToLower(logins[i].Username) < strings.ToLower(logins[j].Username)
+	})
+
+	return logins, nil
+}
+
+// fill asks the agent for an entry's password once the user approves. The
+// entry has to belong to the origin, so a page cannot ask for the password
+// of another site.
+//
+// Args:
+//
+//	origin: The origin of the page.
+//	username: The entry to fill.
+//
+// Returns:
+//
+//	The reply to send.
+func fill(origin origin, username string) reply {
+	entries, err := agentEntries()
+	if err != nil {
+		return failure(err)
+	}
+
+	found := false
+	for _, entry := range entries {
+		if entry.Username == username && entryMatches(entry, origin) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return failure(fmt.Errorf("no entry %s for %s", username, origin))
+	}
+
+	client, err := agent.Dial()
+	if err != nil {
+		return failure(errNoAgent)
+	}
+	defer client.Close()
+
+	entry, password, err := client.Fill(username, origin.String())
+	if err != nil {
+		response := failure(err)
+		response.Denied = errors.Is(err, agent.ErrDenied)
+		return response
+	}
+
+	return reply{OK: true, Origin: origin.String(), Login: entry.Login, Password: password}
+}
+
+// agentEntries lists every entry held by the running agent.
+//
+// Returns:
+//
+//	The entries and errNoAgent or another error if one occurred.
+func agentEntries() ([]agent.Entry, error) {
+	client, err := agent.Dial()
+	if err != nil {
+		return nil, errNoAgent
+	}
+	defer client.Close()
+
+	return client.List()
+}
+
+// failure builds a failed reply.
+//
+// Args:
+//
+//	err: The error to report.
+//
+// Returns:
+//
+//	The reply.
+func failure(err error) reply {
+	return reply{Error: err.Error()}
+}
+
+// readMessage reads one native messaging frame: a 32-bit length in native
+// byte order followed by that many bytes of JSON.
+//
+// Args:
+//
+//	r: The reader to read from.
+//
+// Returns:
+//
+//	The JSON message and io.EOF when the browser closed the port.
+func readMessage(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.NativeEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > maxIncomingMessage {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+
+	raw := make([]byte, length)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("truncated message: %w", err)
+	}
+
+	return raw, nil
+}
+
+// writeMessage writes one native messaging frame.
+//
+// Args:
+//
+//	w: The writer to write to.
+//	v: The value to send as JSON.
+//
+// Returns:
+//
+//	An error if the value is too large or could not be written.
+func writeMessage(w io.Writer, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(raw) > maxOutgoingMessage {
+		return fmt.Errorf("reply of %d bytes is too large", len(raw))
+	}
+
+	frame := make([]byte, 4, 4+len(raw))
+	binary.NativeEndian.PutUint32(frame, uint32(len(raw)))
+	_, err = w.Write(append(frame, raw...))
+	return err
+}
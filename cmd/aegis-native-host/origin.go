@@ -0,0 +1,141 @@
+package main
+
+import (
+	"aegis/internal/agent"
+
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// origin is the scheme, host and port of a web page.
+type origin struct {
+	scheme string
+	host   string
+	port   string
+}
+
+// String returns the origin in its usual form, such as "https://github.com".
+//
+// Returns:
+//
+//	The origin.
+func (o origin) String() string {
+	if o.port == defaultPort(o.scheme) {
+		return o.scheme + "://" + o.host
+	}
+	return o.scheme + "://" + net.JoinHostPort(o.host, o.port)
+}
+
+// pageOrigin parses the URL of the page the extension wants to fill. Only
+// http and https pages can be filled.
+//
+// Args:
+//
+//	raw: The page URL.
+//
+// Returns:
+//
+//	The page's origin and an error if the URL cannot be filled.
+func pageOrigin(raw string) (origin, error) {
+	if raw == "" {
+		return origin{}, errors.New("url is required")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return origin{}, err
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return origin{}, fmt.Errorf("cannot fill %s: only http and https pages are supported", raw)
+	}
+
+	return parseOrigin(raw)
+}
+
+// parseOrigin extracts the origin of a URL. A URL without a scheme, as often
+// stored in entries, is taken to be https.
+//
+// Args:
+//
+//	raw: The URL.
+//
+// Returns:
+//
+//	The origin and an error if the URL has no host.
+func parseOrigin(raw string) (origin, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return origin{}, err
+	}
+	if u.Hostname() == "" {
+		return origin{}, fmt.Errorf("%s has no host", raw)
+	}
+
+	o := origin{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.TrimSuffix(strings.ToLower(u.Hostname()), "."),
+		port:   u.Port(),
+	}
+	if o.port == "" {
+		o.port = defaultPort(o.scheme)
+	}
+
+	return o, nil
+}
+
+// entryMatches reports whether an entry belongs to a page origin. The host
+// must match exactly, so an entry for example.com is not offered on
+// login.example.com, and the scheme and port must match too. An entry
+// without a URL matches when its name is the host.
+//
+// Args:
+//
+//	entry: The stored entry.
+//	page: The origin of the page.
+//
+// Returns:
+//
+//	True if the entry may be offered on the page.
+func entryMatches(entry agent.Entry, page origin) bool {
+	raw := entry.URL
+	if raw == "" {
+		raw = entry.Username
+		if strings.ContainsAny(raw, "/@: ") {
+			return false
+		}
+	}
+
+	stored, err := parseOrigin(raw)
+	if err != nil {
+		return false
+	}
+
+	return stored == page
+}
+
+// defaultPort returns the port a scheme uses when none is given.
+//
+// Args:
+//
+//	scheme: The lower-case URL scheme.
+//
+// Returns:
+//
+//	The port, or "" for schemes without a default.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"aegis/internal/ageshare"
+	"aegis/internal/queries"
+
+	"fmt"
+	"os"
+)
+
+// runAge implements "aegis age", which manages the vault's own age
+// identity. Others encrypt shares to its public recipient with
+// "aegis export --format age", and "aegis import" opens them with it.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runAge(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected keygen or recipient", errUsage)
+	}
+
+	switch args[0] {
+	case "keygen":
+		return ageKeygen(args[1:])
+	case "recipient":
+		return ageRecipient(args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprintln(os.Stderr, "Usage: aegis age keygen|recipient [flags]")
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown age command %q", errUsage, args[0])
+}
+
+// ageKeygen implements "aegis age keygen". The identity is stored in the
+// vault, encrypted with the master password, and its recipient printed.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	ageshare.ErrIdentityExists without --force if the vault has an identity,
+//	or another error if one occurred.
+func ageKeygen(args []string) error {
+	fs := newFlagSet("age keygen", "[--force]")
+	force := fs.Bool("force", false, "replace the existing identity; shares sent to it can no longer be opened")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	recipient, err := ageshare.GenerateIdentity(*force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Created an age identity; give this recipient to the people who share entries with you:")
+	fmt.Println(recipient)
+	return nil
+}
+
+// ageRecipient implements "aegis age recipient", which prints the public
+// recipient of the vault's identity.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	queries.ErrNoAgeIdentity if the vault has none, or another error if one
+//	occurred.
+func ageRecipient(args []string) error {
+	fs := newFlagSet("age recipient", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	recipient, err := queries.FetchAgeRecipient()
+	if err != nil {
+		return err
+	}
+	fmt.Println(recipient)
+	return nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"aegis/internal/agent"
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// agentStartTimeout bounds how long "aegis agent start" waits for the socket.
+const agentStartTimeout = 10 * time.Second
+
+// runAgent implements "aegis agent", which manages the background agent.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runAgent(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected start, run, stop, status or approve", errUsage)
+	}
+
+	switch args[0] {
+	case "start":
+		return agentStart(args[1:])
+	case "run":
+		return agentRun(args[1:])
+	case "stop":
+		return agentStop(args[1:])
+	case "status":
+		return agentStatus(args[1:])
+	case "approve":
+		return agentApprove(args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprintln(os.Stderr, "Usage: aegis agent start|run|stop|status|approve [flags]")
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown agent command %q", errUsage, args[0])
+}
+
+// agentStart implements "aegis agent start": it checks the master password
+// and starts "aegis agent run" in the background, handing it the password
+// over a pipe.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func agentStart(args []string) error {
+	fs := newFlagSet("agent start", "[--timeout DURATION]")
+	timeout := fs.Duration("timeout", agent.DefaultIdleTimeout, "lock and exit after this long without requests")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *timeout <= 0 {
+		return fmt.Errorf("%w: expected only a positive --timeout", errUsage)
+	}
+
+	if client, err := agent.Dial(); err == nil {
+		client.Close()
+		return agent.ErrAlreadyRunning
+	}
+
+	password, err := readMasterPass()
+	if err != nil {
+		return err
+	}
+	if err := unlockWith(password); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, "agent", "run", "--password-stdin", "--timeout", timeout.String())
+	cmd.Env = withoutEnv(os.Environ(), mpass.EnvVar)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	if _, err := fmt.Fprintf(stdin, "%s\n", password); err != nil {
+		return err
+	}
+	stdin.Close()
+
+	deadline := time.Now().Add(agentStartTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("agent exited during start-up: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		client, err := agent.Dial()
+		if err != nil {
+			continue
+		}
+		status, err := client.Ping()
+		client.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Agent started (pid %d), locks after %s without requests\n", status.PID, status.IdleTimeout)
+		return nil
+	}
+
+	cmd.Process.Kill()
+	return errors.New("agent did not start in time")
+}
+
+// agentRun implements "aegis agent run", which serves the vault in the
+// foreground until the idle timeout, "aegis agent stop" or a signal.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func agentRun(args []string) error {
+	fs := newFlagSet("agent run", "[--timeout DURATION] [--password-stdin]")
+	timeout := fs.Duration("timeout", agent.DefaultIdleTimeout, "lock and exit after this long without requests")
+	passwordStdin := fs.Bool("password-stdin", false, "read the master password from the first line of standard input")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *timeout <= 0 {
+		return fmt.Errorf("%w: expected only a positive --timeout", errUsage)
+	}
+
+	var password []byte
+	var err error
+	if *passwordStdin {
+		password, err = readPasswordLine(os.Stdin)
+	} else {
+		password, err = readMasterPass()
+	}
+	if err != nil {
+		return err
+	}
+	if err := unlockWith(password); err != nil {
+		return err
+	}
+	defer queries.ClearMasterPass()
+
+	server, err := agent.Listen(agent.SocketPath(), *timeout)
+	if err != nil {
+		return err
+	}
+	go snapshot.RunScheduled(queries.DB)
+
+	// The agent outlives the terminal it was started from.
+	signal.Ignore(syscall.SIGHUP)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Stop()
+	}()
+
+	return server.Serve()
+}
+
+// agentStop implements "aegis agent stop".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	agent.ErrNotRunning or another error if one occurred.
+func agentStop(args []string) error {
+	fs := newFlagSet("agent stop", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, err := agent.Dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Lock()
+}
+
+// agentStatus implements "aegis agent status".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	agent.ErrNotRunning or another error if one occurred.
+func agentStatus(args []string) error {
+	fs := newFlagSet("agent status", "[--json]")
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, err := agent.Dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	status, err := client.Ping()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, status)
+	}
+
+	fmt.Printf("Agent running (pid %d) on %s\n", status.PID, agent.SocketPath())
+	fmt.Printf("Locks at %s unless used (idle timeout %s)\n", status.LocksAt.Local().Format("15:04:05"), status.IdleTimeout)
+	return nil
+}
+
+// agentApprove implements "aegis agent approve", which asks on the terminal
+// whether to allow each browser fill request until interrupted.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	agent.ErrNotRunning or another error if one occurred.
+func agentApprove(args []string) error {
+	fs := newFlagSet("agent approve", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: agent approve takes no arguments", errUsage)
+	}
+
+	client, err := agent.Dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fmt.Fprintln(os.Stderr, "Waiting for fill requests, press Ctrl-C to stop")
+	for {
+		approvals, err := client.Approvals()
+		if err != nil {
+			return err
+		}
+
+		for _, approval := range approvals {
+			answer, err := mpass.ReadLine(fmt.Sprintf("Allow %s to fill %s? [y/N] ", approval.Origin, approval.Username))
+			if err != nil {
+				return err
+			}
+			approve := strings.EqualFold(strings.TrimSpace(answer), "y") || strings.EqualFold(strings.TrimSpace(answer), "yes")
+
+			if err := client.Decide(approval.ID, approve); errors.Is(err, queries.ErrNotFound) {
+				fmt.Fprintln(os.Stderr, "The request expired before it was answered")
+			} else if err != nil {
+				return err
+			}
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// readPasswordLine reads a password or master password from the first line of r.
+//
+// Args:
+//
+//	r: The reader to read from.
+//
+// Returns:
+//
+//	The password and an error if none was read.
+func readPasswordLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return nil, errors.New("no password on standard input")
+	}
+
+	return []byte(password), nil
+}
+
+// withoutEnv removes a variable from an environment list.
+//
+// Args:
+//
+//	env: The environment in "KEY=value" form.
+//	key: The variable to remove.
+//
+// Returns:
+//
+//	The environment without key.
+func withoutEnv(env []string, key string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			filtered = append(filtered, kv)
+		}
+	}
+
+	return filtered
+}
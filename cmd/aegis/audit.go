@@ -0,0 +1,100 @@
+package main
+
+import (
+	"aegis/internal/audit"
+	"aegis/internal/hibp"
+
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runAudit implements "aegis audit".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runAudit(args []string) error {
+	fs := newFlagSet("audit", "[--months N] [--hibp FILE] [--json]")
+	months := fs.Int("months", audit.DefaultMaxAgeMonths, "flag passwords unchanged for more than `N` months")
+	hibpFile := fs.String("hibp", "", "check passwords against this Pwned Passwords `FILE` instead of the configured one")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *months < 1 {
+		return fmt.Errorf("%w: --months must be at least 1", errUsage)
+	}
+
+	var corpus *hibp.Corpus
+	var err error
+	if *hibpFile != "" {
+		corpus, err = hibp.Open(*hibpFile)
+	} else {
+		corpus, err = hibp.OpenConfigured()
+	}
+	if err != nil {
+		return err
+	}
+	if corpus != nil {
+		defer corpus.Close()
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	report, err := audit.Run(*months, corpus)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, report)
+	}
+
+	fmt.Printf("Scanned %d entries, %d issues found\n", report.TotalEntries, report.IssueCount())
+
+	if len(report.Unreadable) > 0 {
+		fmt.Printf("\nUnreadable entries, not checked for strength or breaches (%d); run 'aegis doctor'\n", len(report.Unreadable))
+		for _, entry := range report.Unreadable {
+			fmt.Printf("  %s: %s\n", entry.Username, entry.Error)
+		}
+	}
+
+	fmt.Printf("\nReused passwords (%d groups)\n", len(report.Reused))
+	for _, group := range report.Reused {
+		fmt.Printf("  %s\n", strings.Join(group.Usernames, ", "))
+	}
+
+	fmt.Printf("\nWeak passwords (%d)\n", len(report.Weak))
+	for _, entry := range report.Weak {
+		if entry.Warning != "" {
+			fmt.Printf("  %s: %s (%s)\n", entry.Username, entry.Label, entry.Warning)
+		} else {
+			fmt.Printf("  %s: %s\n", entry.Username, entry.Label)
+		}
+	}
+
+	fmt.Printf("\nUnchanged for more than %d months (%d)\n", report.MaxAgeMonths, len(report.Old))
+	for _, entry := range report.Old {
+		fmt.Printf("  %s: last changed %s (%d days ago)\n",
+			entry.Username, entry.UpdatedOn.Format("2006-01-02"), entry.AgeDays)
+	}
+
+	if !report.BreachCheck {
+		fmt.Println("\nBreached passwords: skipped, no Pwned Passwords file configured")
+		return nil
+	}
+
+	fmt.Printf("\nBreached passwords (%d)\n", len(report.Breached))
+	for _, entry := range report.Breached {
+		fmt.Printf("  %s: seen %d times in known breaches\n", entry.Username, entry.Count)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"aegis/internal/config"
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// runBackup implements "aegis backup", which takes, lists and restores
+// snapshots of the vault and sets how they are scheduled and kept.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runBackup(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected now, list, restore or config", errUsage)
+	}
+
+	switch args[0] {
+	case "now":
+		return backupNow(args[1:])
+	case "list":
+		return backupList(args[1:])
+	case "restore":
+		return backupRestore(args[1:])
+	case "config":
+		return backupConfig(args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprintln(os.Stderr, "Usage: aegis backup now|list|restore|config [flags]")
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown backup command %q", errUsage, args[0])
+}
+
+// backupNow implements "aegis backup now", which takes a snapshot whether or
+// not one is due.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func backupNow(args []string) error {
+	fs := newFlagSet("backup now", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	taken, err := snapshot.Take(queries.DB, snapshot.ReasonManual)
+	if err != nil {
+		return err
+	}
+	fmt.Println(taken.Path)
+	return nil
+}
+
+// backupList implements "aegis backup list", newest first.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func backupList(args []string) error {
+	fs := newFlagSet("backup list", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	snapshots, err := snapshot.List()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Fprintln(os.Stderr, "No backups yet")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTAKEN\tREASON\tSIZE")
+	for _, s := range snapshots {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.TakenOn.Local().Format("2006-01-02 15:04"), s.Reason, s.HumanSize())
+	}
+	return tw.Flush()
+}
+
+// backupRestore implements "aegis backup restore". The vault as it was is
+// snapshotted first, so a restore can itself be undone. The restored vault
+// opens with the master password it had when the snapshot was taken.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	snapshot.ErrNotFound or another error if one occurred.
+func backupRestore(args []string) error {
+	fs := newFlagSet("backup restore", "[--force] NAME")
+	force := fs.Bool("force", false, "restore without asking for confirmation")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one NAME, as shown by aegis backup list", errUsage)
+	}
+	name := filepath.Base(fs.Arg(0))
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	if !*force {
+		answer, err := mpass.ReadLine(fmt.Sprintf("Replace every entry of the vault with %s? [y/N] ", name))
+		if errors.Is(err, mpass.ErrNoTerminal) {
+			return fmt.Errorf("%w: no terminal to confirm on, use --force", errUsage)
+		}
+		if err != nil {
+			return err
+		}
+		if answer := strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("cancelled")
+		}
+	}
+
+	if err := snapshot.Restore(queries.DB, name); err != nil {
+		return err
+	}
+	// A snapshot taken before a migration needs it again.
+	queries.CreatePasswordsTable()
+	fmt.Fprintf(os.Stderr, "Restored %s; the vault as it was is kept as a restore backup\n", name)
+	return nil
+}
+
+// backupConfig implements "aegis backup config", which changes the given
+// settings and prints them all.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func backupConfig(args []string) error {
+	fs := newFlagSet("backup config", "[--dir DIR] [--interval DURATION] [--keep-daily N] [--keep-weekly N] [--enable|--disable]")
+	dir := fs.String("dir", "", "the directory to write backups to")
+	interval := fs.Duration("interval", snapshot.DefaultInterval, "the time between scheduled backups")
+	keepDaily := fs.Int("keep-daily", snapshot.DefaultKeepDaily, "how many days keep their newest backup")
+	keepWeekly := fs.Int("keep-weekly", snapshot.DefaultKeepWeekly, "how many weeks keep their newest backup")
+	enable := fs.Bool("enable", false, "take scheduled backups and backups before migrations and imports")
+	disable := fs.Bool("disable", false, "stop taking automatic backups")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || (*enable && *disable) {
+		return fmt.Errorf("%w: expected only flags, and not both --enable and --disable", errUsage)
+	}
+	if *interval <= 0 || *keepDaily <= 0 || *keepWeekly <= 0 {
+		return fmt.Errorf("%w: --interval, --keep-daily and --keep-weekly must be positive", errUsage)
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		return err
+	}
+	var pathErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dir":
+			settings.Backups.Dir, pathErr = filepath.Abs(*dir)
+		case "interval":
+			settings.Backups.Interval = snapshot.FormatInterval(*interval)
+		case "keep-daily":
+			settings.Backups.KeepDaily = *keepDaily
+		case "keep-weekly":
+			settings.Backups.KeepWeekly = *keepWeekly
+		case "enable", "disable":
+			settings.Backups.Disabled = *disable
+		}
+	})
+	if pathErr != nil {
+		return pathErr
+	}
+	if fs.NFlag() > 0 {
+		if err := config.Save(settings); err != nil {
+			return err
+		}
+	}
+
+	backups, backupDir, every, err := snapshot.Settings()
+	if err != nil {
+		return err
+	}
+	state := "on"
+	if backups.Disabled {
+		state = "off"
+	}
+	fmt.Printf("Automatic backups: %s\n", state)
+	fmt.Printf("Directory:         %s\n", backupDir)
+	fmt.Printf("Interval:          %s\n", snapshot.FormatInterval(every))
+	fmt.Printf("Keep daily:        %d\n", backups.KeepDaily)
+	fmt.Printf("Keep weekly:       %d\n", backups.KeepWeekly)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"aegis/internal/doctor"
+	"aegis/internal/queries"
+
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runDoctor implements "aegis doctor", which checks that the whole vault can
+// be read and optionally repairs what it finds.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred or if problems remain unrepaired.
+func runDoctor(args []string) error {
+	fs := newFlagSet("doctor", "[--quarantine] [--remove-orphans] [--json] | --release ID")
+	quarantine := fs.Bool("quarantine", false, "move the entries that cannot be read to the quarantine table")
+	removeOrphans := fs.Bool("remove-orphans", false, "delete orphaned meta rows")
+	release := fs.Int64("release", 0, "move the quarantined entry with this `ID` back into the vault")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+	if *release != 0 && (*quarantine || *removeOrphans || *asJSON) {
+		return fmt.Errorf("%w: --release cannot be combined with other flags", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	if *release != 0 {
+		if err := queries.ReleaseQuarantined(*release); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Moved quarantined entry %d back into the vault\n", *release)
+		return nil
+	}
+
+	report, err := doctor.Run(nil)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		printDoctorReport(report)
+	}
+
+	options := doctor.RepairOptions{Quarantine: *quarantine, RemoveOrphans: *removeOrphans}
+	quarantined, removed, err := doctor.Repair(report, options)
+	if err != nil {
+		return err
+	}
+	if quarantined > 0 {
+		fmt.Fprintf(os.Stderr, "Quarantined %d entries; \"aegis doctor --release ID\" moves one back\n", quarantined)
+	}
+	if removed > 0 {
+		fmt.Fprintf(os.Stderr, "Removed %d orphaned meta rows\n", removed)
+	}
+
+	remaining := len(report.Integrity)
+	if !*quarantine {
+		remaining += len(report.Entries)
+	}
+	if !*removeOrphans {
+		remaining += len(report.OrphanedMeta)
+	}
+	if remaining == 0 {
+		return nil
+	}
+	if len(report.Integrity) > 0 {
+		return fmt.Errorf("%d problems remain; the database file is damaged, restore a snapshot with \"aegis backup restore\"", remaining)
+	}
+	return fmt.Errorf("%d problems remain; --quarantine and --remove-orphans repair them", remaining)
+}
+
+// printDoctorReport writes a vault check report for people to read.
+//
+// Args:
+//
+//	report: The report.
+func printDoctorReport(report doctor.Report) {
+	fmt.Printf("Checked %d entries, %d problems found\n", report.TotalEntries, report.IssueCount())
+
+	if len(report.Integrity) == 0 {
+		fmt.Println("\nDatabase file: ok")
+	} else {
+		fmt.Printf("\nDatabase file (%d problems)\n", len(report.Integrity))
+		for _, problem := range report.Integrity {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\nEntries that cannot be read (%d)\n", len(report.Entries))
+	for _, entry := range report.Entries {
+		name := entry.Username
+		if name == "" {
+			name = fmt.Sprintf("(row %d)", entry.RowID)
+		}
+		fmt.Printf("  %s: %s\n", name, strings.Join(entry.Problems, "; "))
+	}
+
+	fmt.Printf("\nOrphaned meta rows (%d)\n", len(report.OrphanedMeta))
+	for _, key := range report.OrphanedMeta {
+		fmt.Printf("  %s\n", key)
+	}
+
+	if len(report.Quarantined) > 0 {
+		fmt.Printf("\nIn quarantine (%d)\n", len(report.Quarantined))
+		for _, entry := range report.Quarantined {
+			fmt.Printf("  %d  %s: quarantined %s, %s\n", entry.ID, entry.Username, entry.QuarantinedOn.Local().Format("2006-01-02"), entry.Reason)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"aegis/internal/strength"
+
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// entryJSON is the JSON form of a vault entry.
+type entryJSON struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Login     string    `json:"login,omitempty"`
+	Folder    string    `json:"folder,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// details returns the descriptive fields of an entry.
+//
+// Returns:
+//
+//	The URL, login, folder and tags.
+func (e entryJSON) details() queries.EntryDetails {
+	return queries.EntryDetails{URL: e.URL, Login: e.Login, Folder: e.Folder, Tags: e.Tags}
+}
+
+// savedJSON is the JSON result of adding or changing a password.
+type savedJSON struct {
+	Username    string `json:"username"`
+	Generated   bool   `json:"generated"`
+	Password    string `json:"password,omitempty"`
+	Score       int    `json:"score"`
+	BreachCount int    `json:"breach_count"`
+}
+
+// runAdd implements "aegis add".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runAdd(args []string) error {
+	fs := newFlagSet("add", "[--stdin | --generate [--length N]] [--url URL] [--login LOGIN] [--folder FOLDER] [--tag TAG]... [--json] NAME")
+	url := fs.String("url", "", "the site or repository URL the password is for")
+	login := fs.String("login", "", "the login name on that site")
+	folder := fs.String("folder", "", "the folder to file the entry in, such as work/ci")
+	var tags stringsFlag
+	fs.Var(&tags, "tag", "a tag for the entry; may be repeated")
+
+	return savePassword(fs, args, func(v vault, username, password string) error {
+		entry := entryJSON{Username: username, URL: *url, Login: *login, Folder: *folder, Tags: tags}
+		return v.add(entry, password)
+	})
+}
+
+// runEdit implements "aegis edit".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runEdit(args []string) error {
+	fs := newFlagSet("edit", "[--stdin | --generate [--length N]] [--json] NAME")
+
+	return savePassword(fs, args, func(v vault, username, password string) error {
+		return v.edit(username, password)
+	})
+}
+
+// savePassword runs the shared flow of "aegis add" and "aegis edit": read the
+// new password, warn about weak or breached passwords and store it.
+//
+// Args:
+//
+//	fs: The subcommand's flag set, with any flags of its own registered.
+//	args: The subcommand arguments.
+//	save: The function that stores the password for the username.
+//
+// Returns:
+//
+//	An error if one occurred.
+func savePassword(fs *flag.FlagSet, args []string, save func(v vault, username, password string) error) error {
+	name := fs.Name()
+	source := addPasswordSourceFlags(fs)
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one NAME", errUsage)
+	}
+	username := fs.Arg(0)
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	_, err = v.entry(username)
+	switch {
+	case name == "add" && err == nil:
+		return fmt.Errorf("%w: %s", queries.ErrEntryExists, username)
+	case name == "edit" && err != nil:
+		return err
+	case err != nil && !errors.Is(err, queries.ErrNotFound):
+		return err
+	}
+
+	password, err := readEntryPassword(source, username)
+	if err != nil {
+		return err
+	}
+
+	if !source.generate {
+		warnIfWeak(password, username)
+	}
+	breaches := warnIfBreached(password)
+
+	if err := save(v, username, password); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		result := savedJSON{
+			Username:    username,
+			Generated:   source.generate,
+			Score:       strength.Estimate(password, username).Score,
+			BreachCount: breaches,
+		}
+		if source.generate {
+			result.Password = password
+		}
+		return writeJSON(os.Stdout, result)
+	}
+
+	if source.generate {
+		fmt.Println(password)
+	}
+	return nil
+}
+
+// runGet implements "aegis get".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runGet(args []string) error {
+	fs := newFlagSet("get", "[--json] NAME")
+	asJSON := fs.Bool("json", false, "print the entry as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one NAME", errUsage)
+	}
+	username := fs.Arg(0)
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	entry, err := v.get(username)
+	if err != nil {
+		return err
+	}
+
+	if !*asJSON {
+		fmt.Println(entry.Password)
+		return nil
+	}
+
+	return writeJSON(os.Stdout, entry)
+}
+
+// runList implements "aegis list".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runList(args []string) error {
+	fs := newFlagSet("list", "[--json]")
+	asJSON := fs.Bool("json", false, "print the entries as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: list takes no arguments", errUsage)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	entries, err := v.list()
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Username) < strings.ToLower(entries[j].Username)
+	})
+
+	if *asJSON {
+		return writeJSON(os.Stdout, entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tUPDATED")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\n", entry.Username, entry.UpdatedOn.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+// runRm implements "aegis rm".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runRm(args []string) error {
+	fs := newFlagSet("rm", "[--force] NAME")
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one NAME", errUsage)
+	}
+	username := fs.Arg(0)
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	if _, err := v.entry(username); err != nil {
+		return err
+	}
+
+	if !*force {
+		answer, err := mpass.ReadLine(fmt.Sprintf("Delete %s? [y/N] ", username))
+		if errors.Is(err, mpass.ErrNoTerminal) {
+			return fmt.Errorf("%w: no terminal to confirm on, use --force", errUsage)
+		}
+		if err != nil {
+			return err
+		}
+		if answer := strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("cancelled")
+		}
+	}
+
+	return v.remove(username)
+}
+
+// newEntryJSON converts an entry read from the database into its JSON form.
+//
+// Args:
+//
+//	user: The entry as returned by the queries package.
+//
+// Returns:
+//
+//	The JSON entry and an error if a timestamp could not be parsed.
+func newEntryJSON(user map[string]string) (entryJSON, error) {
+	createdOn, err := queries.ParseTimestamp(user["created_on"])
+	if err != nil {
+		return entryJSON{}, err
+	}
+	updatedOn, err := queries.ParseTimestamp(user["updated_on"])
+	if err != nil {
+		return entryJSON{}, err
+	}
+
+	return entryJSON{
+		Username:  user["username"],
+		URL:       user["url"],
+		Login:     user["login"],
+		Folder:    user["folder"],
+		Tags:      queries.SplitTags(user["tags"]),
+		CreatedOn: createdOn,
+		UpdatedOn: updatedOn,
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// execCommand runs a command as a child process and waits for it, since the
+// process cannot be replaced on this platform.
+//
+// Args:
+//
+//	path: The resolved path of the command.
+//	argv: The command and its arguments.
+//	env: The environment of the command.
+//
+// Returns:
+//
+//	childExitError if the command failed, or another error if it could not
+//	be started.
+func execCommand(path string, argv, env []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// The console delivers Ctrl-C to the child as well; aegis waits for it.
+	signal.Ignore(os.Interrupt)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return childExitError{code: exitErr.ExitCode()}
+	}
+
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// execCommand replaces the aegis process with a command, so it receives
+// signals and its exit status goes straight to the caller.
+//
+// Args:
+//
+//	path: The resolved path of the command.
+//	argv: The command and its arguments.
+//	env: The environment of the command.
+//
+// Returns:
+//
+//	An error if the command could not be started.
+func execCommand(path string, argv, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"aegis/internal/generator"
+	"aegis/internal/strength"
+
+	"fmt"
+	"os"
+)
+
+// generatedJSON is the JSON result of "aegis generate".
+type generatedJSON struct {
+	Password string `json:"password"`
+	Score    int    `json:"score"`
+	Label    string `json:"label"`
+}
+
+// runGenerate implements "aegis generate". It does not touch the vault.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runGenerate(args []string) error {
+	fs := newFlagSet("generate", "[--length N] [--no-lower] [--no-upper] [--no-digits] [--no-symbols] [--exclude-ambiguous] [--json]")
+	length := fs.Int("length", generator.DefaultLength, "password length")
+	noLower := fs.Bool("no-lower", false, "leave out lowercase letters")
+	noUpper := fs.Bool("no-upper", false, "leave out uppercase letters")
+	noDigits := fs.Bool("no-digits", false, "leave out digits")
+	noSymbols := fs.Bool("no-symbols", false, "leave out symbols")
+	excludeAmbiguous := fs.Bool("exclude-ambiguous", false, "leave out look-alike characters such as l, 1, O and 0")
+	asJSON := fs.Bool("json", false, "print the password and its strength as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: generate takes no arguments", errUsage)
+	}
+
+	password, err := generator.Password(generator.Options{
+		Length:           *length,
+		Lower:            !*noLower,
+		Upper:            !*noUpper,
+		Digits:           !*noDigits,
+		Symbols:          !*noSymbols,
+		ExcludeAmbiguous: *excludeAmbiguous,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+
+	if *asJSON {
+		result := strength.Estimate(password)
+		return writeJSON(os.Stdout, generatedJSON{
+			Password: password,
+			Score:    result.Score,
+			Label:    result.Label(),
+		})
+	}
+
+	fmt.Println(password)
+	return nil
+}
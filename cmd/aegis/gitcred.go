@@ -0,0 +1,278 @@
+package main
+
+import (
+	"aegis/internal/gitcred"
+	"aegis/internal/queries"
+
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// gitMatch is a vault entry that applies to a Git credential request.
+type gitMatch struct {
+	entry entryJSON
+	score int
+	// exact is set when the entry is for the request's protocol, host, path
+	// and login themselves.
+	exact bool
+	// tagged is set when the entry has gitcred.Tag, so the helper may change
+	// or delete it.
+	tagged bool
+}
+
+// maxGitEntryNames bounds the numbered names tried for a new entry.
+const maxGitEntryNames = 100
+
+// runGitCredential implements "aegis git-credential", a Git credential helper.
+// Enable it with:
+//
+//	git config --global credential.helper '!aegis git-credential'
+//
+// Args:
+//
+//	args: The subcommand arguments; Git passes get, store or erase.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runGitCredential(args []string) error {
+	fs := newFlagSet("git-credential", "get|store|erase")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected get, store or erase", errUsage)
+	}
+
+	request, err := gitcred.Read(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if request.Host == "" {
+		return nil
+	}
+
+	// Git expects helpers to ignore actions they do not know.
+	switch fs.Arg(0) {
+	case "get":
+		return gitCredentialGet(request)
+	case "store":
+		return gitCredentialStore(request)
+	case "erase":
+		return gitCredentialErase(request)
+	}
+
+	return nil
+}
+
+// gitCredentialGet answers Git with the best matching entry. When nothing
+// matches it prints nothing so Git falls back to its other helpers.
+//
+// Args:
+//
+//	request: The credential Git asked for.
+//
+// Returns:
+//
+//	An error if one occurred.
+func gitCredentialGet(request gitcred.Credential) error {
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	matches, err := findGitEntries(v, request)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	entry, err := v.get(matches[0].entry.Username)
+	if err != nil {
+		return err
+	}
+
+	username := request.Username
+	if username == "" {
+		username = entry.Login
+	}
+
+	return gitcred.Write(os.Stdout, gitcred.Credential{Username: username, Password: entry.Password})
+}
+
+// gitCredentialStore saves a credential Git has just used successfully.
+// Nothing changes if the entry Git was given already holds the password. A
+// matching entry tagged gitcred.Tag with a different password is updated;
+// otherwise a new tagged entry named "login@host/path" is added, with a
+// number appended if another entry has that name. Entries without the tag
+// are never changed.
+//
+// Args:
+//
+//	request: The credential to store.
+//
+// Returns:
+//
+//	An error if one occurred.
+func gitCredentialStore(request gitcred.Credential) error {
+	if request.Username == "" || request.Password == "" {
+		return nil
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	matches, err := findGitEntries(v, request)
+	if err != nil {
+		return err
+	}
+
+	if len(matches) > 0 {
+		best, err := v.get(matches[0].entry.Username)
+		if err != nil {
+			return err
+		}
+		if best.Password == request.Password {
+			return nil
+		}
+	}
+	for _, match := range matches {
+		if match.tagged {
+			return v.edit(match.entry.Username, request.Password)
+		}
+	}
+
+	base := request.Username + "@" + request.Host
+	if request.Path != "" {
+		base += "/" + strings.Trim(request.Path, "/")
+	}
+
+	entry := entryJSON{Username: base, URL: request.URL(), Login: request.Username, Tags: []string{gitcred.Tag}}
+	for i := 2; i <= maxGitEntryNames; i++ {
+		err := v.add(entry, request.Password)
+		if !errors.Is(err, queries.ErrEntryExists) {
+			return err
+		}
+		entry.Username = fmt.Sprintf("%s (%d)", base, i)
+	}
+
+	return fmt.Errorf("%w: %s and the numbered names after it", queries.ErrEntryExists, base)
+}
+
+// gitCredentialErase deletes the entry for a credential Git reports as
+// rejected. Only an entry tagged gitcred.Tag for exactly the request's
+// protocol, host, path and login is deleted, and only if it is the single
+// one; when Git sends the rejected password, the entry must also hold it, so
+// a token that was already rotated is kept. Otherwise nothing is deleted.
+//
+// Args:
+//
+//	request: The credential to erase.
+//
+// Returns:
+//
+//	An error if one occurred.
+func gitCredentialErase(request gitcred.Credential) error {
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	matches, err := findGitEntries(v, request)
+	if err != nil {
+		return err
+	}
+
+	var exact []entryJSON
+	for _, match := range matches {
+		if match.exact && match.tagged {
+			exact = append(exact, match.entry)
+		}
+	}
+	if len(exact) != 1 {
+		return nil
+	}
+
+	if request.Password != "" {
+		entry, err := v.get(exact[0].Username)
+		if err != nil {
+			return err
+		}
+		if entry.Password != request.Password {
+			return nil
+		}
+	}
+
+	return v.remove(exact[0].Username)
+}
+
+// findGitEntries lists the entries that apply to a Git credential request,
+// most specific first, and entries tagged gitcred.Tag before others that are
+// as specific. An entry applies when its URL matches the request, or, for
+// entries without a URL, when its name is the host (such as "github.com").
+// If the request names a user, entries for other logins are skipped.
+//
+// Args:
+//
+//	v: The vault to search.
+//	request: The credential Git asked about.
+//
+// Returns:
+//
+//	The matching entries and an error if one occurred.
+func findGitEntries(v vault, request gitcred.Credential) ([]gitMatch, error) {
+	entries, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []gitMatch
+	for _, entry := range entries {
+		if request.Username != "" && entry.Login != "" && entry.Login != request.Username {
+			continue
+		}
+
+		location := entry.URL
+		if location == "" {
+			location = entry.Username
+		}
+		target, err := gitcred.ParseURL(location)
+		if err != nil {
+			continue
+		}
+		if entry.URL == "" && (target.Protocol != "" || target.Path != "") {
+			continue
+		}
+
+		score, ok := target.Match(request)
+		if !ok {
+			continue
+		}
+		if request.Username != "" && entry.Login == request.Username {
+			score++
+		}
+		exact := entry.URL != "" && target.Exact(request) && entry.Login == request.Username
+		tagged := slices.Contains(entry.Tags, gitcred.Tag)
+		matches = append(matches, gitMatch{entry: entry, score: score, exact: exact, tagged: tagged})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if matches[i].tagged != matches[j].tagged {
+			return matches[i].tagged
+		}
+		return matches[i].entry.Username < matches[j].entry.Username
+	})
+
+	return matches, nil
+}
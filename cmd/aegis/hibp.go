@@ -0,0 +1,67 @@
+package main
+
+import (
+	"aegis/internal/config"
+	"aegis/internal/hibp"
+
+	"fmt"
+	"path/filepath"
+)
+
+// runHIBP implements "aegis hibp", which shows or sets the Pwned Passwords
+// file used for breach checks.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runHIBP(args []string) error {
+	fs := newFlagSet("hibp", "[--clear] [FILE]")
+	clearFile := fs.Bool("clear", false, "stop checking passwords against a breach file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || (*clearFile && fs.NArg() > 0) {
+		return fmt.Errorf("%w: expected at most one FILE, or --clear", errUsage)
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *clearFile:
+		settings.HIBPFile = ""
+		return config.Save(settings)
+
+	case fs.NArg() == 1:
+		path, err := filepath.Abs(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		corpus, err := hibp.Open(path)
+		if err != nil {
+			return err
+		}
+		defer corpus.Close()
+
+		settings.HIBPFile = path
+		if err := config.Save(settings); err != nil {
+			return err
+		}
+		fmt.Printf("Using %s corpus %s\n", corpus.HashType(), path)
+		return nil
+	}
+
+	if settings.HIBPFile == "" {
+		fmt.Println("No Pwned Passwords file configured")
+		return nil
+	}
+	fmt.Println(settings.HIBPFile)
+	return nil
+}
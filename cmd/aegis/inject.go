@@ -0,0 +1,222 @@
+package main
+
+import (
+	"aegis/internal/config"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+)
+
+// runInject implements "aegis inject", which fills in a template such as
+//
+//	password: {{ aegis "prod-db" "password" }}
+//
+// with values from the vault. Output files are written with mode 0600, and
+// files aegis did not create are only overwritten with --force.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runInject(args []string) error {
+	fs := newFlagSet("inject", "[-i TEMPLATE] [-o OUTPUT] [--force]")
+	in := fs.String("i", "-", "read the template from this file, - for standard input")
+	out := fs.String("o", "-", "write the result to this file, - for standard output")
+	force := fs.Bool("force", false, "overwrite an output file aegis did not create")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: inject takes no arguments", errUsage)
+	}
+
+	source, err := readTemplate(*in)
+	if err != nil {
+		return err
+	}
+
+	var outPath string
+	if *out != "-" {
+		outPath, err = filepath.Abs(*out)
+		if err != nil {
+			return err
+		}
+		if err := checkInjectTarget(outPath, *force); err != nil {
+			return err
+		}
+	}
+
+	var resolver *secretResolver
+	lookup := func(entry string, field ...string) (string, error) {
+		var ref secretRef
+		var err error
+		switch len(field) {
+		case 0:
+			ref, err = parseSecretRef(entry)
+		case 1:
+			ref, err = newSecretRef(entry, field[0])
+		default:
+			err = errors.New("aegis takes an entry and at most one field")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// The vault is only unlocked once the template needs a value.
+		if resolver == nil {
+			v, err := openVault()
+			if err != nil {
+				return "", err
+			}
+			resolver = newSecretResolver(v)
+		}
+		return resolver.resolve(ref)
+	}
+
+	tmpl, err := template.New(*in).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"aegis": lookup}).
+		Parse(source)
+	if err != nil {
+		return err
+	}
+
+	// Render fully before writing, so a failed lookup leaves no partial file.
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, nil); err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		_, err := os.Stdout.Write(rendered.Bytes())
+		return err
+	}
+
+	if err := writePrivateFile(outPath, rendered.Bytes()); err != nil {
+		return err
+	}
+	return rememberInjectedFile(outPath)
+}
+
+// readTemplate reads a template from a file or standard input.
+//
+// Args:
+//
+//	path: The file to read, or "-" for standard input.
+//
+// Returns:
+//
+//	The template text and an error if one occurred.
+func readTemplate(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+
+	return string(data), err
+}
+
+// checkInjectTarget refuses to overwrite a file that "aegis inject" did not
+// write itself, unless forced.
+//
+// Args:
+//
+//	path: The absolute output path.
+//	force: Whether --force was given.
+//
+// Returns:
+//
+//	An error if the file must not be overwritten.
+func checkInjectTarget(path string, force bool) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if force {
+		return nil
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(settings.InjectedFiles, path) {
+		return fmt.Errorf("%s exists and was not created by aegis inject, use --force to overwrite it", path)
+	}
+
+	return nil
+}
+
+// writePrivateFile atomically replaces a file with data, readable only by
+// the current user.
+//
+// Args:
+//
+//	path: The file to write.
+//	data: The contents.
+//
+// Returns:
+//
+//	An error if one occurred.
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// rememberInjectedFile records that "aegis inject" wrote a file, so later
+// runs may overwrite it.
+//
+// Args:
+//
+//	path: The absolute path of the file.
+//
+// Returns:
+//
+//	An error if one occurred.
+func rememberInjectedFile(path string) error {
+	settings, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(settings.InjectedFiles, path) {
+		return nil
+	}
+
+	settings.InjectedFiles = append(settings.InjectedFiles, path)
+	return config.Save(settings)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"aegis/internal/agent"
+	"aegis/internal/ageshare"
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes returned by the CLI.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitWrongMaster = 4
+	exitExists      = 5
+)
+
+// errUsage marks errors caused by invalid command-line arguments.
+var errUsage = errors.New("invalid usage")
+
+// command is a single aegis subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists every subcommand in the order shown by the help output.
+//
+// Returns:
+//
+//	The available subcommands.
+func commands() []command {
+	return []command{
+		{name: "init", summary: "Create the vault and set its master password", run: runInit},
+		{name: "add", summary: "Add a password", run: runAdd},
+		{name: "get", summary: "Print a password", run: runGet},
+		{name: "list", summary: "List the stored entries", run: runList},
+		{name: "edit", summary: "Change a password", run: runEdit},
+		{name: "rm", summary: "Delete an entry", run: runRm},
+		{name: "generate", summary: "Generate a random password", run: runGenerate},
+		{name: "import", summary: "Import entries from a CSV, Bitwarden, KeePass, Aegis backup or age file, or a pass store", run: runImport},
+		{name: "export", summary: "Export the entries to CSV, Bitwarden, KeePass, an Aegis backup, an age share or a pass store", run: runExport},
+		{name: "backup", summary: "Take, list and restore snapshots of the vault", run: runBackup},
+		{name: "age", summary: "Create or show the vault's age identity for receiving shares", run: runAge},
+		{name: "run", summary: "Run a command with vault values in its environment", run: runRun},
+		{name: "inject", summary: "Fill in a config file template with vault values", run: runInject},
+		{name: "git-credential", summary: "Git credential helper (get, store, erase)", run: runGitCredential},
+		{name: "serve", summary: "Serve the local REST API", run: runServe},
+		{name: "token", summary: "Create, list and revoke API tokens", run: runToken},
+		{name: "agent", summary: "Keep the vault unlocked in a background agent", run: runAgent},
+		{name: "tui", summary: "Open the full-screen terminal interface", run: runTUI},
+		{name: "audit", summary: "Report reused, weak, old and breached passwords", run: runAudit},
+		{name: "doctor", summary: "Check that every entry can be read and quarantine those that cannot", run: runDoctor},
+		{name: "hibp", summary: "Show or set the local Pwned Passwords file", run: runHIBP},
+	}
+}
+
+// main is the entry point for the Aegis command-line interface.
+// It dispatches to the requested subcommand and exits with its status.
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run dispatches the command line to a subcommand.
+//
+// Args:
+//
+//	args: The command-line arguments without the program name.
+//
+// Returns:
+//
+//	The process exit code.
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(os.Stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		err := cmd.run(args[1:])
+		if err == nil || errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		// The command started by "aegis run" has already reported its failure.
+		var childErr childExitError
+		if errors.As(err, &childErr) {
+			return childErr.code
+		}
+
+		fmt.Fprintf(os.Stderr, "aegis %s: %s\n", cmd.name, err)
+		return exitCode(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "aegis: unknown command %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+// exitCode maps a subcommand error to the exit code scripts can rely on.
+//
+// Args:
+//
+//	err: The non-nil error returned by a subcommand.
+//
+// Returns:
+//
+//	The process exit code.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, queries.ErrNotFound), errors.Is(err, agent.ErrNotRunning), errors.Is(err, queries.ErrNoAgeIdentity),
+		errors.Is(err, snapshot.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, queries.ErrWrongMasterPass):
+		return exitWrongMaster
+	case errors.Is(err, queries.ErrEntryExists), errors.Is(err, queries.ErrVaultInitialised),
+		errors.Is(err, agent.ErrAlreadyRunning), errors.Is(err, ageshare.ErrIdentityExists):
+		return exitExists
+	default:
+		return exitError
+	}
+}
+
+// printUsage writes the list of subcommands.
+//
+// Args:
+//
+//	w: The writer to print to.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: aegis <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes:")
+	fmt.Fprintf(w, "  %d  success\n", exitOK)
+	fmt.Fprintf(w, "  %d  error\n", exitError)
+	fmt.Fprintf(w, "  %d  invalid usage\n", exitUsage)
+	fmt.Fprintf(w, "  %d  entry not found, or no agent running\n", exitNotFound)
+	fmt.Fprintf(w, "  %d  wrong master password\n", exitWrongMaster)
+	fmt.Fprintf(w, "  %d  entry, vault or agent already exists\n", exitExists)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "The master password is read from %s or prompted for.\n", mpass.EnvVar)
+	fmt.Fprintln(w, "Run 'aegis <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors instead
+// of exiting.
+//
+// Args:
+//
+//	name: The subcommand name.
+//	usage: The argument synopsis shown in the help output.
+//
+// Returns:
+//
+//	The flag set.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: aegis %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses subcommand flags and wraps failures as usage errors.
+//
+// Args:
+//
+//	fs: The flag set to parse into.
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if the arguments are invalid.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+	return nil
+}
+
+// stringsFlag collects a flag that may be repeated.
+type stringsFlag []string
+
+// String returns the collected values.
+//
+// Returns:
+//
+//	The values separated by commas.
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds one value.
+//
+// Args:
+//
+//	value: The flag value.
+//
+// Returns:
+//
+//	Always nil.
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// writeJSON writes v as indented JSON followed by a newline.
+//
+// Args:
+//
+//	w: The writer to write to.
+//	v: The value to encode.
+//
+// Returns:
+//
+//	An error if one occurred.
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
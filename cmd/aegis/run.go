@@ -0,0 +1,206 @@
+package main
+
+import (
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// defaultEnvFile is read by "aegis run" when neither --env nor --env-file is given.
+const defaultEnvFile = ".aegis.env"
+
+// envNamePattern matches the variable names "aegis run" accepts.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envBinding sets an environment variable to a value from the vault.
+type envBinding struct {
+	name string
+	ref  secretRef
+}
+
+// envFlag collects repeated --env flags.
+type envFlag []envBinding
+
+// String returns the bindings in flag form.
+//
+// Returns:
+//
+//	The bindings separated by commas.
+func (f *envFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, binding := range *f {
+		parts[i] = binding.name + "=" + binding.ref.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses one --env flag.
+//
+// Args:
+//
+//	value: The flag value, NAME=ENTRY[:FIELD].
+//
+// Returns:
+//
+//	An error if the value is malformed.
+func (f *envFlag) Set(value string) error {
+	binding, err := parseEnvBinding(value)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, binding)
+	return nil
+}
+
+// childExitError reports that the command started by "aegis run" failed, so
+// aegis can exit with the same status.
+type childExitError struct {
+	code int
+}
+
+// Error describes the failure.
+//
+// Returns:
+//
+//	The error message.
+func (e childExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.code)
+}
+
+// runRun implements "aegis run", which starts a command with vault values in
+// its environment. The values are never written to disk or to the shell.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runRun(args []string) error {
+	fs := newFlagSet("run", "[--env NAME=ENTRY[:FIELD]]... [--env-file FILE] -- COMMAND [ARGS...]")
+	var bindings envFlag
+	fs.Var(&bindings, "env", "set NAME to the password, or FIELD (login, url or username), of ENTRY; may be repeated")
+	envFile := fs.String("env-file", "", "read NAME=ENTRY[:FIELD] lines from FILE (default "+defaultEnvFile+" when no --env is given)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("%w: expected a COMMAND to run", errUsage)
+	}
+
+	switch {
+	case *envFile != "":
+		fileBindings, err := readEnvFile(*envFile)
+		if err != nil {
+			return err
+		}
+		// Flags override the file.
+		bindings = append(fileBindings, bindings...)
+
+	case len(bindings) == 0:
+		fileBindings, err := readEnvFile(defaultEnvFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: no --env given and no %s file found", errUsage, defaultEnvFile)
+		}
+		if err != nil {
+			return err
+		}
+		bindings = fileBindings
+	}
+
+	path, err := exec.LookPath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	resolver := newSecretResolver(v)
+	env := withoutEnv(os.Environ(), mpass.EnvVar)
+	for _, binding := range bindings {
+		value, err := resolver.resolve(binding.ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", binding.name, err)
+		}
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("%s: value of %s contains a NUL byte", binding.name, binding.ref)
+		}
+
+		env = append(withoutEnv(env, binding.name), binding.name+"="+value)
+	}
+
+	queries.ClearMasterPass()
+	return execCommand(path, fs.Args(), env)
+}
+
+// parseEnvBinding parses NAME=ENTRY[:FIELD].
+//
+// Args:
+//
+//	s: The binding.
+//
+// Returns:
+//
+//	The binding and an error if it is malformed.
+func parseEnvBinding(s string) (envBinding, error) {
+	name, reference, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !envNamePattern.MatchString(name) {
+		return envBinding{}, fmt.Errorf("expected NAME=ENTRY[:FIELD], got %q", s)
+	}
+
+	ref, err := parseSecretRef(strings.TrimSpace(reference))
+	if err != nil {
+		return envBinding{}, err
+	}
+
+	return envBinding{name: name, ref: ref}, nil
+}
+
+// readEnvFile reads a reference file: one NAME=ENTRY[:FIELD] per line, with
+// blank lines and lines starting with # ignored. The file holds entry names
+// only, so it can be committed alongside a project.
+//
+// Args:
+//
+//	path: The file to read.
+//
+// Returns:
+//
+//	The bindings in file order and an error if one occurred.
+func readEnvFile(path string) ([]envBinding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var bindings []envBinding
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		binding, err := parseEnvBinding(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return bindings, scanner.Err()
+}
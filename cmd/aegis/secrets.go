@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fields of an entry a secret reference can name. The password is used when
+// no field is given.
+const (
+	fieldPassword = "password"
+	fieldLogin    = "login"
+	fieldURL      = "url"
+	fieldUsername = "username"
+)
+
+// secretRef names a value stored in the vault, written "ENTRY" or "ENTRY:FIELD".
+type secretRef struct {
+	entry string
+	field string
+}
+
+// parseSecretRef parses a secret reference. The text after the last colon is
+// only taken as the field when it names one, so entry names such as
+// "db.example.com:5432" keep working.
+//
+// Args:
+//
+//	s: The reference.
+//
+// Returns:
+//
+//	The reference and an error if it names no entry.
+func parseSecretRef(s string) (secretRef, error) {
+	ref := secretRef{entry: s, field: fieldPassword}
+
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		switch field := s[i+1:]; field {
+		case fieldPassword, fieldLogin, fieldURL, fieldUsername:
+			ref = secretRef{entry: s[:i], field: field}
+		}
+	}
+
+	if ref.entry == "" {
+		return secretRef{}, fmt.Errorf("secret reference %q names no entry", s)
+	}
+
+	return ref, nil
+}
+
+// newSecretRef creates a reference to a named field of an entry.
+//
+// Args:
+//
+//	entry: The entry name.
+//	field: The field: password, login, url or username.
+//
+// Returns:
+//
+//	The reference and an error if the entry is empty or the field unknown.
+func newSecretRef(entry, field string) (secretRef, error) {
+	switch field {
+	case fieldPassword, fieldLogin, fieldURL, fieldUsername:
+	default:
+		return secretRef{}, fmt.Errorf("unknown field %q, expected password, login, url or username", field)
+	}
+	if entry == "" {
+		return secretRef{}, errors.New("secret reference names no entry")
+	}
+
+	return secretRef{entry: entry, field: field}, nil
+}
+
+// String returns the reference in the form it is written in.
+//
+// Returns:
+//
+//	The reference.
+func (r secretRef) String() string {
+	if r.field == fieldPassword {
+		return r.entry
+	}
+	return r.entry + ":" + r.field
+}
+
+// secretResolver looks up secret references in a vault, fetching and
+// decrypting each entry at most once.
+type secretResolver struct {
+	vault   vault
+	entries map[string]entryJSON
+}
+
+// newSecretResolver creates a resolver for a vault.
+//
+// Args:
+//
+//	v: The vault to read from.
+//
+// Returns:
+//
+//	The resolver.
+func newSecretResolver(v vault) *secretResolver {
+	return &secretResolver{vault: v, entries: make(map[string]entryJSON)}
+}
+
+// resolve returns the value a reference names.
+//
+// Args:
+//
+//	ref: The reference.
+//
+// Returns:
+//
+//	The value and queries.ErrNotFound or another error if one occurred.
+func (r *secretResolver) resolve(ref secretRef) (string, error) {
+	entry, ok := r.entries[ref.entry]
+	if !ok {
+		var err error
+		entry, err = r.vault.get(ref.entry)
+		if err != nil {
+			return "", err
+		}
+		r.entries[ref.entry] = entry
+	}
+
+	switch ref.field {
+	case fieldLogin:
+		return entry.Login, nil
+	case fieldURL:
+		return entry.URL, nil
+	case fieldUsername:
+		return entry.Username, nil
+	default:
+		return entry.Password, nil
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"aegis/internal/api"
+	"aegis/internal/config"
+	"aegis/internal/queries"
+
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// defaultServeAddr is where "aegis serve" listens without --addr or --socket.
+const defaultServeAddr = "127.0.0.1:8787"
+
+// runServe implements "aegis serve", which serves the local REST API until
+// interrupted.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runServe(args []string) error {
+	fs := newFlagSet("serve", "[--addr HOST:PORT | --socket PATH]")
+	addr := fs.String("addr", defaultServeAddr, "the loopback address and port to listen on")
+	socket := fs.String("socket", "", "listen on a Unix socket instead of TCP")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: serve takes no arguments", errUsage)
+	}
+
+	listener, err := serveListener(*addr, *socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+	defer queries.ClearMasterPass()
+
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	auditPath := filepath.Join(dir, "api-audit.log")
+
+	handler, err := api.NewServer(auditPath)
+	if err != nil {
+		return err
+	}
+	defer handler.Close()
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving the API on %s, audit log %s\n", listener.Addr(), auditPath)
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveListener opens the TCP or Unix socket the API is served on. TCP is
+// limited to loopback addresses, and Unix sockets get mode 0600.
+//
+// Args:
+//
+//	addr: The TCP address.
+//	socket: The Unix socket path, which takes precedence when set.
+//
+// Returns:
+//
+//	The listener and an error if one occurred.
+func serveListener(addr, socket string) (net.Listener, error) {
+	if socket != "" {
+		if _, err := os.Lstat(socket); err == nil {
+			if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("%s is in use by another server", socket)
+			}
+			if err := os.Remove(socket); err != nil {
+				return nil, fmt.Errorf("could not remove stale socket: %w", err)
+			}
+		}
+
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(socket, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errUsage, err)
+	}
+	if !api.IsLoopback(host) {
+		return nil, fmt.Errorf("%w: %s is not a loopback address; the API is only served locally", errUsage, host)
+	}
+
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"aegis/internal/queries"
+
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultTokenExpiry is how long a new API token is valid without --expires.
+const defaultTokenExpiry = 30 * 24 * time.Hour
+
+// tokenJSON is the JSON form of an API token.
+type tokenJSON struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Folders    []string   `json:"folders,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	All        bool       `json:"all"`
+	Write      bool       `json:"write"`
+	ExpiresOn  *time.Time `json:"expires_on,omitempty"`
+	CreatedOn  time.Time  `json:"created_on"`
+	LastUsedOn *time.Time `json:"last_used_on,omitempty"`
+}
+
+// runToken implements "aegis token", which manages tokens for "aegis serve".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runToken(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected create, list or revoke", errUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return tokenCreate(args[1:])
+	case "list":
+		return tokenList(args[1:])
+	case "revoke":
+		return tokenRevoke(args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprintln(os.Stderr, "Usage: aegis token create|list|revoke [flags]")
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown token command %q", errUsage, args[0])
+}
+
+// tokenCreate implements "aegis token create". The token is printed once and
+// cannot be shown again.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func tokenCreate(args []string) error {
+	fs := newFlagSet("token create", "--folder FOLDER... | --tag TAG... | --all [--write] [--expires DURATION] [--json] NAME")
+	var folders, tags stringsFlag
+	fs.Var(&folders, "folder", "allow entries in this folder and below; may be repeated")
+	fs.Var(&tags, "tag", "allow entries with this tag; may be repeated")
+	all := fs.Bool("all", false, "allow every entry")
+	write := fs.Bool("write", false, "allow creating, changing and deleting entries")
+	expires := fs.Duration("expires", defaultTokenExpiry, "how long the token is valid, 0 for no expiry")
+	asJSON := fs.Bool("json", false, "print the token as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one NAME", errUsage)
+	}
+	if !*all && len(folders) == 0 && len(tags) == 0 {
+		return fmt.Errorf("%w: give the token a scope with --folder, --tag or --all", errUsage)
+	}
+	if *expires < 0 {
+		return fmt.Errorf("%w: --expires cannot be negative", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	request := queries.APIToken{Name: fs.Arg(0), Folders: folders, Tags: tags, All: *all, Write: *write}
+	if *expires > 0 {
+		request.ExpiresOn = time.Now().Add(*expires)
+	}
+
+	token, created, err := queries.CreateAPIToken(request)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		result := newTokenJSON(created)
+		result.Token = token
+		return writeJSON(os.Stdout, result)
+	}
+
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "Created token %s (%s, %s). It is shown only once.\n", created.ID, describeScope(created), describeAccess(created))
+	return nil
+}
+
+// tokenList implements "aegis token list".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func tokenList(args []string) error {
+	fs := newFlagSet("token list", "[--json]")
+	asJSON := fs.Bool("json", false, "print the tokens as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: token list takes no arguments", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	tokens, err := queries.FetchAPITokens()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		result := make([]tokenJSON, len(tokens))
+		for i, token := range tokens {
+			result[i] = newTokenJSON(token)
+		}
+		return writeJSON(os.Stdout, result)
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPE\tACCESS\tEXPIRES\tLAST USED")
+	for _, token := range tokens {
+		expires := "never"
+		switch {
+		case token.Expired(now):
+			expires = "expired"
+		case !token.ExpiresOn.IsZero():
+			expires = token.ExpiresOn.Local().Format("2006-01-02")
+		}
+		lastUsed := "never"
+		if !token.LastUsedOn.IsZero() {
+			lastUsed = token.LastUsedOn.Local().Format("2006-01-02 15:04")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, describeScope(token), describeAccess(token), expires, lastUsed)
+	}
+	return tw.Flush()
+}
+
+// tokenRevoke implements "aegis token revoke".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func tokenRevoke(args []string) error {
+	fs := newFlagSet("token revoke", "ID")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one token ID", errUsage)
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	return queries.RevokeAPIToken(fs.Arg(0))
+}
+
+// describeScope summarises which entries a token may see.
+//
+// Args:
+//
+//	token: The token.
+//
+// Returns:
+//
+//	A short description such as "folder work, tag ci".
+func describeScope(token queries.APIToken) string {
+	if token.All {
+		return "all entries"
+	}
+
+	var parts []string
+	for _, folder := range token.Folders {
+		parts = append(parts, "folder "+folder)
+	}
+	for _, tag := range token.Tags {
+		parts = append(parts, "tag "+tag)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeAccess names a token's permission.
+//
+// Args:
+//
+//	token: The token.
+//
+// Returns:
+//
+//	"read-write" or "read-only".
+func describeAccess(token queries.APIToken) string {
+	if token.Write {
+		return "read-write"
+	}
+	return "read-only"
+}
+
+// newTokenJSON converts a token into its JSON form.
+//
+// Args:
+//
+//	token: The token.
+//
+// Returns:
+//
+//	The JSON token, without the secret.
+func newTokenJSON(token queries.APIToken) tokenJSON {
+	result := tokenJSON{
+		ID:        token.ID,
+		Name:      token.Name,
+		Folders:   token.Folders,
+		Tags:      token.Tags,
+		All:       token.All,
+		Write:     token.Write,
+		CreatedOn: token.CreatedOn,
+	}
+	if !token.ExpiresOn.IsZero() {
+		result.ExpiresOn = &token.ExpiresOn
+	}
+	if !token.LastUsedOn.IsZero() {
+		result.LastUsedOn = &token.LastUsedOn
+	}
+
+	return result
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"aegis/internal/aegisbak"
+	"aegis/internal/ageshare"
+	"aegis/internal/bitwarden"
+	"aegis/internal/kdbx"
+	"aegis/internal/mpass"
+	"aegis/internal/pass_export"
+	"aegis/internal/pass_import"
+	"aegis/internal/passstore"
+	"aegis/internal/queries"
+
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+)
+
+// Import and export formats.
+const (
+	formatCSV       = "csv"
+	formatBitwarden = "bitwarden"
+	formatKeePass   = "kdbx"
+	formatBackup    = "aegisbak"
+	formatPass      = "pass"
+	formatAge       = "age"
+)
+
+// formats lists the formats import and export accept.
+var formats = []string{formatCSV, formatBitwarden, formatKeePass, formatBackup, formatPass, formatAge}
+
+// runImport implements "aegis import". An Aegis CSV export must be encrypted
+// with the same master password; the plaintext CSV exports of browsers and
+// other password managers are encrypted on the way in. A password-protected
+// Bitwarden export, a KeePass database and an Aegis backup ask for their
+// password. A password store is decrypted with an exported OpenPGP secret
+// key, whose passphrase is asked for, and an age share with an age identity
+// file or the vault's own identity. CSV rows whose name is taken by a different entry are handled
+// as --on-conflict says, and --dry-run shows what each row would do. Imports
+// are all or nothing, except that --lenient imports the rows or entries
+// that can be stored; every format reports what it did.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runImport(args []string) error {
+	fs := newFlagSet("import", "[--format csv [--profile PROFILE] [--on-conflict STRATEGY] [--dry-run]|bitwarden|kdbx [--key-file KEYFILE]|aegisbak|pass --key-file SECRETKEY|age [--identity IDENTITYFILE]] [--lenient] FILE|DIR")
+	format := fs.String("format", "", "the file format; guessed from the extension when not given")
+	profile := fs.String("profile", "", "the source of a CSV file, one of "+csvProfileIDs()+"; detected from the header when not given")
+	keyFile := fs.String("key-file", "", "the key file of a KeePass database, or the exported OpenPGP secret key of a password store")
+	identityFile := fs.String("identity", "", "the age identity file to open an age share with; the vault's own identity when not given")
+	onConflict := fs.String("on-conflict", "", "what to do with CSV rows whose name is taken by a different entry: "+strategyNames()+" (default skip)")
+	dryRun := fs.Bool("dry-run", false, "list what importing a CSV file would do without changing the vault")
+	lenient := fs.Bool("lenient", false, "import the other rows or entries when one cannot be stored, instead of nothing")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one FILE, or the DIR of a password store", errUsage)
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			*format = formatPass
+		}
+	}
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			*format = formatBitwarden
+		case ".kdbx":
+			*format = formatKeePass
+		case aegisbak.Extension:
+			*format = formatBackup
+		case ageshare.Extension:
+			*format = formatAge
+		default:
+			*format = formatCSV
+		}
+	}
+	if !slices.Contains(formats, *format) {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	if *keyFile != "" && *format != formatKeePass && *format != formatPass {
+		return fmt.Errorf("%w: --key-file only applies to --format kdbx or pass", errUsage)
+	}
+	if *identityFile != "" && *format != formatAge {
+		return fmt.Errorf("%w: --identity only applies to --format age", errUsage)
+	}
+	if *keyFile == "" && *format == formatPass {
+		return fmt.Errorf("%w: --format pass needs --key-file with the secret key, as written by gpg --export-secret-keys", errUsage)
+	}
+	if *profile != "" {
+		if *format != formatCSV {
+			return fmt.Errorf("%w: --profile only applies to --format csv", errUsage)
+		}
+		if _, ok := pass_import.CSVProfileByID(*profile); !ok {
+			return fmt.Errorf("%w: unknown profile %q; use one of %s", errUsage, *profile, csvProfileIDs())
+		}
+	}
+	strategy := pass_import.StrategySkip
+	if (*onConflict != "" || *dryRun) && *format != formatCSV {
+		return fmt.Errorf("%w: --on-conflict and --dry-run only apply to --format csv", errUsage)
+	}
+	mode := pass_import.ModeStrict
+	if *lenient {
+		mode = pass_import.ModeLenient
+	}
+	if *onConflict != "" {
+		var err error
+		if strategy, err = pass_import.ParseStrategy(*onConflict); err != nil {
+			return fmt.Errorf("%w: %v; use one of %s", errUsage, err, strategyNames())
+		}
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+
+	var report pass_import.Report
+	var err error
+	switch *format {
+	case formatCSV:
+		return importCsv(path, *profile, strategy, mode, *dryRun)
+	case formatKeePass:
+		key, keyErr := readKeePassKey("KeePass master password: ", *keyFile, false)
+		if keyErr != nil {
+			return keyErr
+		}
+		report, err = pass_import.ImportKeePassKDBX(path, key, mode, nil)
+	case formatBackup:
+		password, readErr := mpass.ReadSecret("Backup password: ")
+		if readErr != nil {
+			return readErr
+		}
+		report, err = pass_import.ImportAegisBackup(path, password, mode, nil)
+	case formatPass:
+		keys, keyErr := readPassStoreKeys(*keyFile)
+		if keyErr != nil {
+			return keyErr
+		}
+		report, err = pass_import.ImportPassStore(path, keys, mode, nil)
+	case formatAge:
+		identities, keyErr := readAgeIdentities(*identityFile)
+		if keyErr != nil {
+			return keyErr
+		}
+		report, err = pass_import.ImportAgeShare(path, identities, mode, nil)
+	default:
+		report, err = pass_import.ImportBitwardenJSON(path, nil, mode, nil)
+		if errors.Is(err, bitwarden.ErrPasswordRequired) {
+			password, readErr := mpass.ReadSecret("Bitwarden export password: ")
+			if readErr != nil {
+				return readErr
+			}
+			if len(password) == 0 {
+				return errors.New("no password given")
+			}
+			report, err = pass_import.ImportBitwardenJSON(path, password, mode, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	printImportReport(path, report)
+	return nil
+}
+
+// runExport implements "aegis export". The CSV format keeps passwords
+// encrypted; the Bitwarden format holds them in plaintext unless --encrypt
+// protects the file with a password. A KeePass database is always protected
+// by a new master password, a key file or both, and an Aegis backup by a
+// backup password. A password store is encrypted to the OpenPGP public
+// keys of a key file, and an age share to the public keys of its
+// recipients. --decrypt writes chosen fields as plaintext CSV or JSON
+// after the master password is typed again. The filter flags choose the
+// entries of any format.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runExport(args []string) error {
+	fs := newFlagSet("export", "[--format csv|bitwarden [--encrypt]|kdbx [--key-file KEYFILE]|aegisbak|pass --key-file PUBLICKEYS|age --recipient KEY... | --decrypt [--format csv|json] [--field FIELD]... [--passphrase]] [FILTER] FILE | DIR | -")
+	format := fs.String("format", formatCSV, "the file format, csv, bitwarden, kdbx, aegisbak, pass or age, or csv or json with --decrypt")
+	encrypt := fs.Bool("encrypt", false, "protect a Bitwarden export with a password")
+	keyFile := fs.String("key-file", "", "an existing key file to protect a KeePass database with, or the OpenPGP public keys to encrypt a password store to")
+	var recipients stringsFlag
+	fs.Var(&recipients, "recipient", "an age public key, or a file of them, to encrypt an age share to; may be repeated")
+	decrypt := fs.Bool("decrypt", false, "write the entries decrypted, in plaintext")
+	var fields stringsFlag
+	fs.Var(&fields, "field", "with --decrypt, a field to export besides the name: "+strings.Join(pass_export.PlaintextFields, ", ")+"; may be repeated")
+	passphrase := fs.Bool("passphrase", false, "with --decrypt, encrypt the export in an age envelope with a passphrase")
+	filterFlags := addExportFilterFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: expected exactly one FILE, or - for standard output", errUsage)
+	}
+	filter, err := filterFlags.filter()
+	if err != nil {
+		return err
+	}
+	if *decrypt {
+		if *format != pass_export.PlaintextCSV && *format != pass_export.PlaintextJSON {
+			return fmt.Errorf("%w: --decrypt only applies to --format csv or json", errUsage)
+		}
+		options := pass_export.PlaintextOptions{Format: *format}
+		for _, field := range fields {
+			for _, name := range strings.Split(field, ",") {
+				if !slices.Contains(pass_export.PlaintextFields, name) {
+					return fmt.Errorf("%w: unknown field %q", errUsage, name)
+				}
+				options.Fields = append(options.Fields, name)
+			}
+		}
+		return exportPlaintext(fs.Arg(0), options, *passphrase, filter)
+	}
+	if len(fields) > 0 || *passphrase {
+		return fmt.Errorf("%w: --field and --passphrase only apply to --decrypt", errUsage)
+	}
+	if !slices.Contains(formats, *format) {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	if *encrypt && *format != formatBitwarden {
+		return fmt.Errorf("%w: --encrypt only applies to --format bitwarden", errUsage)
+	}
+	if *keyFile != "" && *format != formatKeePass && *format != formatPass {
+		return fmt.Errorf("%w: --key-file only applies to --format kdbx or pass", errUsage)
+	}
+	if *format == formatPass && (*keyFile == "" || fs.Arg(0) == "-") {
+		return fmt.Errorf("%w: --format pass needs --key-file with the public keys and a DIR to create the store in", errUsage)
+	}
+	if (len(recipients) > 0) != (*format == formatAge) {
+		return fmt.Errorf("%w: --format age needs --recipient, which only applies to it", errUsage)
+	}
+	var ageRecipients []age.Recipient
+	if *format == formatAge {
+		if ageRecipients, err = ageshare.ParseRecipients(recipients); err != nil {
+			return err
+		}
+	}
+
+	if err := unlockVault(); err != nil {
+		return err
+	}
+	if err := reportFilter(filter); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	switch *format {
+	case formatCSV:
+		if path == "-" {
+			return pass_export.WritePasswordsCsv(os.Stdout, filter)
+		}
+		return pass_export.ExportPasswordsCsv(path, filter)
+	case formatKeePass:
+		key, err := readKeePassKey("New KeePass master password: ", *keyFile, true)
+		if err != nil {
+			return err
+		}
+		if path == "-" {
+			return pass_export.WriteKeePassKDBX(os.Stdout, key, filter)
+		}
+		return pass_export.ExportKeePassKDBX(path, key, filter)
+	case formatBackup:
+		password, err := mpass.ReadNewSecret("Backup password: ")
+		if err != nil {
+			return err
+		}
+		if len(password) == 0 {
+			return errors.New("the backup password cannot be empty")
+		}
+		if path == "-" {
+			return pass_export.WriteAegisBackup(os.Stdout, password, filter)
+		}
+		return pass_export.ExportAegisBackup(path, password, filter)
+	case formatPass:
+		keys, err := passstore.ReadKeyRing(*keyFile)
+		if err != nil {
+			return err
+		}
+		return pass_export.ExportPassStore(path, keys, filter)
+	case formatAge:
+		if path == "-" {
+			return pass_export.WriteAgeShare(os.Stdout, ageRecipients, filter)
+		}
+		return pass_export.ExportAgeShare(path, ageRecipients, filter)
+	}
+
+	var password []byte
+	if *encrypt {
+		password, err = mpass.ReadNewSecret("Export password: ")
+		if err != nil {
+			return err
+		}
+		if len(password) == 0 {
+			return errors.New("the export password cannot be empty")
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "warning: the export holds every password in plaintext; use --encrypt to protect it")
+	}
+
+	if path == "-" {
+		return pass_export.WriteBitwardenJSON(os.Stdout, password, filter)
+	}
+	return pass_export.ExportBitwardenJSON(path, password, filter)
+}
+
+// exportPlaintext writes a decrypted export after warning about it and
+// asking for the master password again at the terminal.
+//
+// Args:
+//
+//	path: The file to write, or - for standard output.
+//	options: What to export and how; the passphrase is asked for here.
+//	passphrase: Whether to wrap the export in an age envelope.
+//	filter: The entries to export.
+//
+// Returns:
+//
+//	queries.ErrWrongMasterPass if the password typed again is wrong, or
+//	another error if one occurred.
+func exportPlaintext(path string, options pass_export.PlaintextOptions, passphrase bool, filter pass_export.Filter) error {
+	if err := unlockVault(); err != nil {
+		return err
+	}
+	if err := reportFilter(filter); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "WARNING: this export holds your passwords and secrets DECRYPTED.")
+	fmt.Fprintln(os.Stderr, "Anyone who can read the file can read them. Delete it as soon as it has been imported elsewhere.")
+	password, err := mpass.ReadSecret("Master password, again, to confirm: ")
+	if errors.Is(err, mpass.ErrNoTerminal) {
+		return fmt.Errorf("a plaintext export must be confirmed at a terminal: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := queries.ConfirmMasterPass(password); err != nil {
+		return err
+	}
+
+	if passphrase {
+		options.Passphrase, err = mpass.ReadNewSecret("Envelope passphrase: ")
+		if err != nil {
+			return err
+		}
+		if len(options.Passphrase) == 0 {
+			return errors.New("the envelope passphrase cannot be empty")
+		}
+	}
+
+	if path == "-" {
+		return pass_export.WritePlaintext(os.Stdout, options, filter)
+	}
+	return pass_export.ExportPlaintext(path, options, filter)
+}
+
+// exportFilterFlags holds the export flags that choose the entries.
+type exportFilterFlags struct {
+	folders, tags               stringsFlag
+	createdAfter, createdBefore string
+	updatedAfter, updatedBefore string
+	query                       string
+}
+
+// addExportFilterFlags registers the flags that choose the entries of an
+// export.
+//
+// Args:
+//
+//	fs: The flag set to register the flags on.
+//
+// Returns:
+//
+//	The flags the values are parsed into.
+func addExportFilterFlags(fs *flag.FlagSet) *exportFilterFlags {
+	f := &exportFilterFlags{}
+	fs.Var(&f.folders, "folder", "export only the entries in this folder or below it; may be repeated")
+	fs.Var(&f.tags, "tag", "export only the entries with this tag; may be repeated to allow several")
+	fs.StringVar(&f.createdAfter, "created-after", "", "export only the entries created on or after this date, such as 2026-01-31")
+	fs.StringVar(&f.createdBefore, "created-before", "", "export only the entries created before this date")
+	fs.StringVar(&f.updatedAfter, "updated-after", "", "export only the entries changed on or after this date")
+	fs.StringVar(&f.updatedBefore, "updated-before", "", "export only the entries changed before this date")
+	fs.StringVar(&f.query, "query", "", "export only the entries whose name, URL, login, folder or tags contain this text")
+	return f
+}
+
+// filter builds the export filter from the flags.
+//
+// Returns:
+//
+//	The filter and a usage error if a date cannot be read.
+func (f *exportFilterFlags) filter() (pass_export.Filter, error) {
+	filter := pass_export.Filter{Folders: f.folders, Tags: f.tags, Query: f.query}
+
+	dates := []struct {
+		flag  string
+		value string
+		into  *time.Time
+	}{
+		{"created-after", f.createdAfter, &filter.CreatedAfter},
+		{"created-before", f.createdBefore, &filter.CreatedBefore},
+		{"updated-after", f.updatedAfter, &filter.UpdatedAfter},
+		{"updated-before", f.updatedBefore, &filter.UpdatedBefore},
+	}
+	for _, date := range dates {
+		if date.value == "" {
+			continue
+		}
+		t, err := queries.ParseTimestamp(date.value)
+		if err != nil {
+			return pass_export.Filter{}, fmt.Errorf("%w: --%s: %v", errUsage, date.flag, err)
+		}
+		*date.into = t
+	}
+
+	return filter, nil
+}
+
+// reportFilter prints how many entries a filter chooses, when one is set.
+//
+// Args:
+//
+//	filter: The export filter.
+//
+// Returns:
+//
+//	An error if the entries could not be read.
+func reportFilter(filter pass_export.Filter) error {
+	if filter.IsZero() {
+		return nil
+	}
+
+	matches, total, err := pass_export.CountMatches(filter)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exporting %d of %d entries\n", matches, total)
+	return nil
+}
+
+// importCsv imports a CSV file and prints what was done, or with dryRun
+// only prints what each row would do.
+//
+// Args:
+//
+//	path: The CSV file.
+//	profileID: The import profile, or "" to detect it.
+//	strategy: What to do with conflicting rows.
+//	mode: Whether a row that cannot be stored undoes the whole import.
+//	dryRun: Whether to leave the vault unchanged.
+//
+// Returns:
+//
+//	An error if one occurred.
+func importCsv(path, profileID string, strategy pass_import.Strategy, mode pass_import.ImportMode, dryRun bool) error {
+	preview, err := pass_import.PreviewCsv(path, profileID)
+	if err != nil {
+		return err
+	}
+	preview.SetStrategy(strategy)
+
+	if dryRun {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROW\tSTATUS\tNAME\tDETAILS")
+		for _, row := range preview.Rows {
+			details := row.Reason
+			if row.Status == pass_import.StatusConflict {
+				details = fmt.Sprintf("%s; %s", row.Reason, row.Strategy)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", row.Row, row.Status, row.Name, details)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d new, %d identical, %d conflicting, %d invalid\n",
+			preview.Count(pass_import.StatusNew), preview.Count(pass_import.StatusIdentical),
+			preview.Count(pass_import.StatusConflict), preview.Count(pass_import.StatusInvalid))
+		return nil
+	}
+
+	report, err := preview.Apply(mode, nil)
+	if err != nil {
+		return err
+	}
+	printImportReport(path, report)
+	return nil
+}
+
+// printImportReport prints what an import did, with a warning for each
+// entry that failed or was left out.
+//
+// Args:
+//
+//	path: The imported file or directory.
+//	report: The report of the import.
+func printImportReport(path string, report pass_import.Report) {
+	fmt.Printf("Imported %s: %s\n", path, report)
+	for _, failure := range report.Failures {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", failure)
+	}
+	for _, note := range report.Notes {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", note)
+	}
+}
+
+// strategyNames lists the names of the conflict strategies.
+//
+// Returns:
+//
+//	The names, comma-separated.
+func strategyNames() string {
+	names := make([]string, len(pass_import.Strategies))
+	for i, strategy := range pass_import.Strategies {
+		names[i] = strategy.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// csvProfileIDs lists the ids of the CSV import profiles.
+//
+// Returns:
+//
+//	The ids, comma-separated.
+func csvProfileIDs() string {
+	ids := make([]string, len(pass_import.CSVProfiles))
+	for i, profile := range pass_import.CSVProfiles {
+		ids[i] = profile.ID
+	}
+	return strings.Join(ids, ", ")
+}
+
+// readKeePassKey prompts for the master password of a KeePass database and
+// combines it with the key file. The password may be left empty when a key
+// file is given.
+//
+// Args:
+//
+//	prompt: The password prompt.
+//	keyFile: The path to the key file, or "".
+//	confirm: Whether to ask for the password twice, for a new database.
+//
+// Returns:
+//
+//	The key and an error if neither a password nor a key file was given.
+func readKeePassKey(prompt, keyFile string, confirm bool) (kdbx.Key, error) {
+	read := mpass.ReadSecret
+	if confirm {
+		read = mpass.ReadNewSecret
+	}
+
+	password, err := read(prompt)
+	if err != nil {
+		return kdbx.Key{}, err
+	}
+	if len(password) == 0 && keyFile == "" {
+		return kdbx.Key{}, kdbx.ErrNoKey
+	}
+
+	return kdbx.NewKey(password, keyFile)
+}
+
+// readPassStoreKeys reads the OpenPGP secret keys of a password store and
+// asks for their passphrase if they are protected by one.
+//
+// Args:
+//
+//	keyFile: The path to the keys, as written by gpg --export-secret-keys.
+//
+// Returns:
+//
+//	The unlocked keys and passstore.ErrWrongPassphrase or another error if
+//	one occurred.
+func readPassStoreKeys(keyFile string) (*passstore.KeyRing, error) {
+	keys, err := passstore.ReadKeyRing(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !keys.Locked() {
+		return keys, nil
+	}
+
+	passphrase, err := mpass.ReadSecret("OpenPGP key passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if err := keys.Unlock(passphrase); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// readAgeIdentities reads the identities to open an age share with.
+//
+// Args:
+//
+//	identityFile: The path to an age identity file, or "" for the vault's
+//	own identity.
+//
+// Returns:
+//
+//	The identities and queries.ErrNoAgeIdentity or another error if one
+//	occurred.
+func readAgeIdentities(identityFile string) ([]age.Identity, error) {
+	if identityFile != "" {
+		return ageshare.ReadIdentities(identityFile)
+	}
+
+	identity, err := ageshare.VaultIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{identity}, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"aegis/internal/tui"
+
+	"fmt"
+)
+
+// runTUI implements "aegis tui", the full-screen terminal interface.
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runTUI(args []string) error {
+	fs := newFlagSet("tui", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: tui takes no arguments", errUsage)
+	}
+
+	return tui.Run()
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"aegis/internal/agent"
+	"aegis/internal/audit"
+	"aegis/internal/generator"
+	"aegis/internal/hibp"
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+	"aegis/internal/strength"
+
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// passwordSource holds the flags that choose where a new entry password comes from.
+type passwordSource struct {
+	fromStdin bool
+	generate  bool
+	length    int
+}
+
+// addPasswordSourceFlags registers the --stdin, --generate and --length flags.
+//
+// Args:
+//
+//	fs: The flag set to register the flags on.
+//
+// Returns:
+//
+//	The source the flags are parsed into.
+func addPasswordSourceFlags(fs *flag.FlagSet) *passwordSource {
+	source := &passwordSource{}
+	fs.BoolVar(&source.fromStdin, "stdin", false, "read the password from the first line of standard input")
+	fs.BoolVar(&source.generate, "generate", false, "generate a random password")
+	fs.IntVar(&source.length, "length", generator.DefaultLength, "length of a generated password")
+	return source
+}
+
+// vault is the storage that entry commands work on: a running agent when
+// there is one, otherwise the database unlocked in this process.
+type vault interface {
+	// list returns every entry without passwords.
+	list() ([]entryJSON, error)
+	// entry returns one entry without its password.
+	entry(username string) (entryJSON, error)
+	// get returns one entry with its password.
+	get(username string) (entryJSON, error)
+	// add stores a new entry.
+	add(entry entryJSON, password string) error
+	// edit changes the password of an entry.
+	edit(username, password string) error
+	// remove deletes an entry.
+	remove(username string) error
+}
+
+// localVault reads and writes the database directly.
+type localVault struct{}
+
+// agentVault forwards requests to a running agent.
+type agentVault struct {
+	client *agent.Client
+}
+
+// openVault connects to the running agent, or unlocks the database locally
+// when no agent is running.
+//
+// Returns:
+//
+//	The vault and an error if one occurred.
+func openVault() (vault, error) {
+	client, err := agent.Dial()
+	if err == nil {
+		return agentVault{client: client}, nil
+	}
+
+	if err := unlockVault(); err != nil {
+		return nil, err
+	}
+	return localVault{}, nil
+}
+
+// list returns every entry without passwords.
+//
+// Returns:
+//
+//	The entries and an error if one occurred.
+func (localVault) list() ([]entryJSON, error) {
+	userData, err := queries.FetchUserData()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entryJSON, 0, len(userData))
+	for _, user := range userData {
+		entry, err := newEntryJSON(user)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// entry returns one entry without its password.
+//
+// Args:
+//
+//	username: The entry to fetch.
+//
+// Returns:
+//
+//	The entry and queries.ErrNotFound or another error if one occurred.
+func (localVault) entry(username string) (entryJSON, error) {
+	user, err := queries.FetchUserEntry(username)
+	if err != nil {
+		return entryJSON{}, err
+	}
+
+	return newEntryJSON(user)
+}
+
+// get returns one entry with its password.
+//
+// Args:
+//
+//	username: The entry to fetch.
+//
+// Returns:
+//
+//	The entry and queries.ErrNotFound or another error if one occurred.
+func (v localVault) get(username string) (entryJSON, error) {
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		return entryJSON{}, err
+	}
+
+	entry, err := v.entry(username)
+	if err != nil {
+		return entryJSON{}, err
+	}
+	entry.Password = password
+
+	return entry, nil
+}
+
+// add stores a new entry and its details in one transaction, so a failure
+// leaves no entry behind.
+//
+// Args:
+//
+//	entry: The entry to create. Its timestamps are ignored.
+//	password: The password to store.
+//
+// Returns:
+//
+//	queries.ErrEntryExists or another error if one occurred.
+func (localVault) add(entry entryJSON, password string) error {
+	return queries.WithTransaction(func(tx *queries.Tx) error {
+		if err := tx.AddNewPassword(entry.Username, password); err != nil {
+			return err
+		}
+		if entry.URL == "" && entry.Login == "" && entry.Folder == "" && len(entry.Tags) == 0 {
+			return nil
+		}
+
+		return tx.SetEntryDetails(entry.Username, entry.details())
+	})
+}
+
+// edit changes the password of an entry.
+//
+// Args:
+//
+//	username: The entry to change.
+//	password: The new password.
+//
+// Returns:
+//
+//	queries.ErrNotFound or another error if one occurred.
+func (localVault) edit(username, password string) error {
+	return queries.EditUserPassword(password, username)
+}
+
+// remove deletes an entry.
+//
+// Args:
+//
+//	username: The entry to delete.
+//
+// Returns:
+//
+//	queries.ErrNotFound or another error if one occurred.
+func (localVault) remove(username string) error {
+	return queries.DeleteUserByPasswordHash(username)
+}
+
+// list returns every entry without passwords.
+//
+// Returns:
+//
+//	The entries and an error if one occurred.
+func (v agentVault) list() ([]entryJSON, error) {
+	agentEntries, err := v.client.List()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entryJSON, len(agentEntries))
+	for i, entry := range agentEntries {
+		entries[i] = newEntryJSONFromAgent(entry)
+	}
+
+	return entries, nil
+}
+
+// entry returns one entry without its password. The agent has no lookup
+// without decryption, so the entry is found in the list.
+//
+// Args:
+//
+//	username: The entry to fetch.
+//
+// Returns:
+//
+//	The entry and queries.ErrNotFound or another error if one occurred.
+func (v agentVault) entry(username string) (entryJSON, error) {
+	entries, err := v.list()
+	if err != nil {
+		return entryJSON{}, err
+	}
+
+	for _, entry := range entries {
+		if entry.Username == username {
+			return entry, nil
+		}
+	}
+
+	return entryJSON{}, fmt.Errorf("%w: %s", queries.ErrNotFound, username)
+}
+
+// get returns one entry with its password.
+//
+// Args:
+//
+//	username: The entry to fetch.
+//
+// Returns:
+//
+//	The entry and queries.ErrNotFound or another error if one occurred.
+func (v agentVault) get(username string) (entryJSON, error) {
+	entry, password, err := v.client.Get(username)
+	if err != nil {
+		return entryJSON{}, err
+	}
+
+	result := newEntryJSONFromAgent(entry)
+	result.Password = password
+
+	return result, nil
+}
+
+// add stores a new entry.
+//
+// Args:
+//
+//	entry: The entry to create. Its timestamps are ignored.
+//	password: The password to store.
+//
+// Returns:
+//
+//	queries.ErrEntryExists or another error if one occurred.
+func (v agentVault) add(entry entryJSON, password string) error {
+	return v.client.Add(agent.Entry{
+		Username: entry.Username,
+		URL:      entry.URL,
+		Login:    entry.Login,
+		Folder:   entry.Folder,
+		Tags:     entry.Tags,
+	}, password)
+}
+
+// edit changes the password of an entry.
+//
+// Args:
+//
+//	username: The entry to change.
+//	password: The new password.
+//
+// Returns:
+//
+//	queries.ErrNotFound or another error if one occurred.
+func (v agentVault) edit(username, password string) error {
+	return v.client.Edit(username, password)
+}
+
+// remove deletes an entry.
+//
+// Args:
+//
+//	username: The entry to delete.
+//
+// Returns:
+//
+//	queries.ErrNotFound or another error if one occurred.
+func (v agentVault) remove(username string) error {
+	return v.client.Delete(username)
+}
+
+// newEntryJSONFromAgent converts an entry sent by the agent into its JSON form.
+//
+// Args:
+//
+//	entry: The entry as sent by the agent.
+//
+// Returns:
+//
+//	The JSON entry, without a password.
+func newEntryJSONFromAgent(entry agent.Entry) entryJSON {
+	return entryJSON{
+		Username:  entry.Username,
+		URL:       entry.URL,
+		Login:     entry.Login,
+		Folder:    entry.Folder,
+		Tags:      entry.Tags,
+		CreatedOn: entry.CreatedOn,
+		UpdatedOn: entry.UpdatedOn,
+	}
+}
+
+// unlockVault sets up the database and checks the master password, taken from
+// AEGIS_MASTER_PASS or prompted for without echo.
+//
+// Returns:
+//
+//	queries.ErrWrongMasterPass if the password is wrong, or another error if
+//	one occurred.
+func unlockVault() error {
+	password, err := readMasterPass()
+	if err != nil {
+		return err
+	}
+
+	return unlockWith(password)
+}
+
+// unlockWith sets up the database and checks the given master password,
+// then takes a scheduled snapshot of the vault if one is due.
+//
+// Args:
+//
+//	password: The master password.
+//
+// Returns:
+//
+//	queries.ErrWrongMasterPass if the password is wrong, or another error if
+//	one occurred.
+func unlockWith(password []byte) error {
+	queries.SetMasterPass(password)
+	queries.CreatePasswordsTable()
+
+	if err := queries.VerifyMasterPass(); err != nil {
+		return err
+	}
+
+	if _, err := snapshot.TakeIfDue(queries.DB); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: scheduled backup failed: %s\n", err)
+	}
+	return nil
+}
+
+// readMasterPass takes the master password from AEGIS_MASTER_PASS or prompts
+// for it without echo.
+//
+// Returns:
+//
+//	The master password and an error if one occurred.
+func readMasterPass() ([]byte, error) {
+	if password, ok := mpass.LookupMasterPass(); ok {
+		return password, nil
+	}
+
+	password, err := mpass.ReadSecret("Master password: ")
+	if errors.Is(err, mpass.ErrNoTerminal) {
+		return nil, fmt.Errorf("set %s or run from a terminal: %w", mpass.EnvVar, err)
+	}
+
+	return password, err
+}
+
+// runInit implements "aegis init".
+//
+// Args:
+//
+//	args: The subcommand arguments.
+//
+// Returns:
+//
+//	An error if one occurred.
+func runInit(args []string) error {
+	fs := newFlagSet("init", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: init takes no arguments", errUsage)
+	}
+
+	password, ok := mpass.LookupMasterPass()
+	if !ok {
+		var err error
+		password, err = mpass.ReadNewSecret("New master password: ")
+		if errors.Is(err, mpass.ErrNoTerminal) {
+			return fmt.Errorf("set %s or run from a terminal: %w", mpass.EnvVar, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(password) == 0 {
+		return fmt.Errorf("%w: the master password cannot be empty", errUsage)
+	}
+
+	queries.SetMasterPass(password)
+	queries.CreatePasswordsTable()
+	if err := queries.InitVault(); err != nil {
+		return err
+	}
+
+	warnIfWeak(string(password))
+
+	fmt.Fprintln(os.Stderr, "Vault initialised")
+	return nil
+}
+
+// readEntryPassword gets the password for an entry from the chosen source.
+//
+// Args:
+//
+//	source: The parsed source flags.
+//	username: The entry the password is for, used in the prompt.
+//
+// Returns:
+//
+//	The password and an error if one occurred.
+func readEntryPassword(source *passwordSource, username string) (string, error) {
+	switch {
+	case source.fromStdin && source.generate:
+		return "", fmt.Errorf("%w: --stdin and --generate cannot be combined", errUsage)
+
+	case source.generate:
+		opts := generator.DefaultOptions()
+		opts.Length = source.length
+		password, err := generator.Password(opts)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", errUsage, err)
+		}
+		return password, nil
+
+	case source.fromStdin:
+		password, err := readPasswordLine(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", errUsage, err)
+		}
+		return string(password), nil
+	}
+
+	password, err := mpass.ReadNewSecret(fmt.Sprintf("Password for %s: ", username))
+	if errors.Is(err, mpass.ErrNoTerminal) {
+		return "", fmt.Errorf("%w: no terminal to prompt on, use --stdin or --generate", errUsage)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(password) == 0 {
+		return "", fmt.Errorf("%w: the password cannot be empty", errUsage)
+	}
+
+	return string(password), nil
+}
+
+// warnIfWeak prints a warning to standard error when a password scores below
+// the audit threshold.
+//
+// Args:
+//
+//	password: The password to check.
+//	userInputs: Words such as the username that make a password easier to guess.
+func warnIfWeak(password string, userInputs ...string) {
+	result := strength.Estimate(password, userInputs...)
+	if result.Score >= audit.WeakScoreThreshold {
+		return
+	}
+
+	message := fmt.Sprintf("warning: password strength is %s", result.Label())
+	if result.Feedback.Warning != "" {
+		message += " (" + result.Feedback.Warning + ")"
+	}
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// warnIfBreached prints a warning to standard error when a password appears in
+// the configured Pwned Passwords file.
+//
+// Args:
+//
+//	password: The password to check.
+//
+// Returns:
+//
+//	How many times the password was seen in breaches, 0 if it was not found
+//	or no file is configured.
+func warnIfBreached(password string) int {
+	corpus, err := hibp.OpenConfigured()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: breach check skipped: %s\n", err)
+		return 0
+	}
+	if corpus == nil {
+		return 0
+	}
+	defer corpus.Close()
+
+	count, err := corpus.Count(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: breach check failed: %s\n", err)
+		return 0
+	}
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "warning: this password has appeared %d times in known data breaches\n", count)
+	}
+
+	return count
+}
@@ -0,0 +1,246 @@
+// Package aegisbak reads and writes .aegisbak files: portable, encrypted
+// backups of a whole vault, protected by a backup password that is
+// independent of the master password. The format is described in
+// docs/backup-format.md.
+package aegisbak
+
+import (
+	"aegis/internal/queries"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Extension is the file name extension of backups.
+const Extension = ".aegisbak"
+
+// Version is the format version written by Seal.
+const Version = 1
+
+// magic starts every backup file.
+const magic = "AEGISBAK"
+
+// kdfScrypt is the only key derivation function of version 1.
+const kdfScrypt = 1
+
+// Sizes of the header fields.
+const (
+	saltSize  = 32
+	nonceSize = 12
+	keySize   = 32
+)
+
+// scrypt settings for new backups: N = 2^17, which takes about half a
+// second and 128 MiB. A backup is opened rarely, so it can afford more than
+// the per-entry encryption.
+const (
+	newLogN = 17
+	newR    = 8
+	newP    = 1
+)
+
+// Upper bounds on the scrypt settings read from a file, so a crafted backup
+// cannot exhaust memory.
+const (
+	maxLogN = 20
+	maxR    = 16
+	maxP    = 16
+)
+
+var (
+	// ErrNotBackup is returned when the data is not an Aegis backup.
+	ErrNotBackup = errors.New("not an Aegis backup")
+	// ErrWrongPassword is returned when the password does not open the backup,
+	// or the backup was modified.
+	ErrWrongPassword = errors.New("wrong backup password, or the backup is damaged")
+)
+
+// Backup is the decrypted content of a backup file.
+type Backup struct {
+	Version   int       `json:"version"`
+	CreatedOn time.Time `json:"created_on"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Entry is one vault entry with its password and extras in plaintext.
+type Entry struct {
+	Name      string              `json:"name"`
+	Password  string              `json:"password"`
+	URL       string              `json:"url,omitempty"`
+	Login     string              `json:"login,omitempty"`
+	Folder    string              `json:"folder,omitempty"`
+	Tags      []string            `json:"tags,omitempty"`
+	CreatedOn time.Time           `json:"created_on"`
+	UpdatedOn time.Time           `json:"updated_on"`
+	Extras    queries.EntryExtras `json:"extras"`
+}
+
+// header is the unencrypted start of a backup file. Its encoded form is the
+// additional data of the payload encryption, so it cannot be changed
+// without the backup failing to open.
+type header struct {
+	version byte
+	kdf     byte
+	logN    byte
+	r       byte
+	p       byte
+	salt    []byte
+	nonce   []byte
+}
+
+// Seal encrypts a backup with a password.
+//
+// Args:
+//
+//	backup: The backup to write; its Version is set to Version.
+//	password: The backup password.
+//
+// Returns:
+//
+//	The file contents and an error if one occurred.
+func Seal(backup Backup, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("the backup password cannot be empty")
+	}
+
+	h := header{version: Version, kdf: kdfScrypt, logN: newLogN, r: newR, p: newP, salt: make([]byte, saltSize), nonce: make([]byte, nonceSize)}
+	if _, err := rand.Read(h.salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(h.nonce); err != nil {
+		return nil, err
+	}
+
+	backup.Version = Version
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := h.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	encoded := h.encode()
+	return aead.Seal(encoded, h.nonce, plaintext, encoded), nil
+}
+
+// Open decrypts a backup file.
+//
+// Args:
+//
+//	data: The file contents.
+//	password: The backup password.
+//
+// Returns:
+//
+//	The backup and ErrNotBackup, ErrWrongPassword or another error if one
+//	occurred.
+func Open(data, password []byte) (Backup, error) {
+	h, ciphertext, err := parseHeader(data)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	aead, err := h.aead(password)
+	if err != nil {
+		return Backup{}, err
+	}
+	plaintext, err := aead.Open(nil, h.nonce, ciphertext, data[:len(data)-len(ciphertext)])
+	if err != nil {
+		return Backup{}, ErrWrongPassword
+	}
+
+	var backup Backup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return Backup{}, fmt.Errorf("the backup payload is malformed: %w", err)
+	}
+	return backup, nil
+}
+
+// parseHeader reads and checks the header of a backup file.
+//
+// Args:
+//
+//	data: The file contents.
+//
+// Returns:
+//
+//	The header, the ciphertext following it and ErrNotBackup or another
+//	error if the header is invalid.
+func parseHeader(data []byte) (header, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return header{}, nil, ErrNotBackup
+	}
+	rest := data[len(magic):]
+	if len(rest) < 6 {
+		return header{}, nil, ErrNotBackup
+	}
+
+	h := header{version: rest[0], kdf: rest[1], logN: rest[2], r: rest[3], p: rest[4]}
+	if h.version != Version {
+		return header{}, nil, fmt.Errorf("unsupported backup version %d; a newer Aegis is needed", h.version)
+	}
+	if h.kdf != kdfScrypt {
+		return header{}, nil, fmt.Errorf("unsupported key derivation function %d", h.kdf)
+	}
+	if h.logN < 1 || h.logN > maxLogN || h.r < 1 || h.r > maxR || h.p < 1 || h.p > maxP {
+		return header{}, nil, errors.New("invalid scrypt parameters in the backup header")
+	}
+
+	rest = rest[5:]
+	for _, field := range []*[]byte{&h.salt, &h.nonce} {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return header{}, nil, ErrNotBackup
+		}
+		*field, rest = rest[1:1+int(rest[0])], rest[1+int(rest[0]):]
+	}
+	if len(h.salt) == 0 || len(h.nonce) != nonceSize {
+		return header{}, nil, ErrNotBackup
+	}
+
+	return h, rest, nil
+}
+
+// encode serializes the header.
+//
+// Returns:
+//
+//	The encoded header.
+func (h header) encode() []byte {
+	buf := []byte(magic)
+	buf = append(buf, h.version, h.kdf, h.logN, h.r, h.p)
+	buf = append(buf, byte(len(h.salt)))
+	buf = append(buf, h.salt...)
+	buf = append(buf, byte(len(h.nonce)))
+	return append(buf, h.nonce...)
+}
+
+// aead derives the payload key from the password and creates its cipher.
+//
+// Args:
+//
+//	password: The backup password.
+//
+// Returns:
+//
+//	The AES-256-GCM cipher and an error if one occurred.
+func (h header) aead(password []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(password, h.salt, 1<<h.logN, int(h.r), int(h.p), keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,199 @@
+// Package aegiscsv defines the CSV dialect of Aegis exports: the columns a
+// file holds, how binary and time values are written and how the header
+// records the format version. Columns are found by their header name, so
+// their order does not matter.
+package aegiscsv
+
+import (
+	"aegis/internal/queries"
+
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the format version written by Header.
+const Version = 2
+
+// legacyVersion is the version of files whose header records none. They
+// write binary values as Go formats a []byte, such as "[104 101 108]".
+const legacyVersion = 1
+
+// versionPrefix starts the header cell that records the format version, as
+// in "aegis_csv=2". Data rows leave that column empty.
+const versionPrefix = "aegis_csv="
+
+// Columns are the data columns of an export, in the order they are written.
+var Columns = []string{
+	"username",
+	"password_hash",
+	"password_ciphertext",
+	"nonce",
+	"salt",
+	"created_on",
+	"updated_on",
+	"url",
+	"login",
+	"folder",
+	"tags",
+	"extras_ciphertext",
+	"extras_nonce",
+	"extras_salt",
+}
+
+// binaryColumns hold bytes, written in base64.
+var binaryColumns = map[string]bool{
+	"password_hash":       true,
+	"password_ciphertext": true,
+	"nonce":               true,
+	"salt":                true,
+	"extras_ciphertext":   true,
+	"extras_nonce":        true,
+	"extras_salt":         true,
+}
+
+// timeColumns hold timestamps, written in RFC 3339 in UTC.
+var timeColumns = map[string]bool{
+	"created_on": true,
+	"updated_on": true,
+}
+
+// ErrNewerVersion is returned for files written by a newer version of Aegis.
+var ErrNewerVersion = errors.New("the CSV was written by a newer version of Aegis")
+
+// Header returns the header row of an export.
+//
+// Returns:
+//
+//	The column names followed by the format version cell.
+func Header() []string {
+	return append(append([]string(nil), Columns...), versionPrefix+strconv.Itoa(Version))
+}
+
+// HeaderVersion returns the format version recorded in a header.
+//
+// Args:
+//
+//	header: The header row, lowercased.
+//
+// Returns:
+//
+//	The version, 1 if the header records none, and ErrNewerVersion or
+//	another error if the file cannot be read.
+func HeaderVersion(header []string) (int, error) {
+	for _, column := range header {
+		value, ok := strings.CutPrefix(column, versionPrefix)
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(value)
+		if err != nil || version < legacyVersion {
+			return 0, fmt.Errorf("invalid CSV format version %q", value)
+		}
+		if version > Version {
+			return 0, fmt.Errorf("%w (format version %d)", ErrNewerVersion, version)
+		}
+		return version, nil
+	}
+	return legacyVersion, nil
+}
+
+// FormatValue writes a value read from the pwds table as a field of the
+// column it belongs to. Binary and time columns are accepted as the driver
+// returns them, whether as bytes, strings or times.
+//
+// Args:
+//
+//	column: The column name.
+//	value: The value, nil for NULL.
+//
+// Returns:
+//
+//	The field.
+func FormatValue(column string, value any) string {
+	if value == nil {
+		return ""
+	}
+
+	switch {
+	case binaryColumns[column]:
+		switch v := value.(type) {
+		case []byte:
+			return base64.StdEncoding.EncodeToString(v)
+		case string:
+			return base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	case timeColumns[column]:
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC().Format(time.RFC3339)
+		case string:
+			if t, err := queries.ParseTimestamp(v); err == nil {
+				return t.Format(time.RFC3339)
+			}
+			return v
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ParseBytes reads a binary field.
+//
+// Args:
+//
+//	version: The format version of the file.
+//	s: The field.
+//
+// Returns:
+//
+//	The bytes, empty for an empty field, and an error if the field is
+//	malformed.
+func ParseBytes(version int, s string) ([]byte, error) {
+	if version == legacyVersion {
+		return parseByteArray(s)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return b, nil
+}
+
+// parseByteArray parses a string representation of a byte array into a byte slice.
+//
+// Args:
+//
+//	s: The string to parse.
+//
+// Returns:
+//
+//	The parsed byte slice and an error if one occurred.
+func parseByteArray(s string) ([]byte, error) {
+	s = strings.Trim(s, "[]")
+	if s == "" {
+		return []byte{}, nil
+	}
+
+	parts := strings.Fields(s)
+	result := make([]byte, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte value %q: %w", part, err)
+		}
+		result[i] = byte(n)
+	}
+	return result, nil
+}
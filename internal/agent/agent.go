@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"aegis/internal/queries"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SocketEnvVar overrides the path of the agent socket.
+const SocketEnvVar = "AEGIS_AGENT_SOCK"
+
+// DefaultIdleTimeout is how long the agent stays unlocked without requests.
+const DefaultIdleTimeout = 15 * time.Minute
+
+// ApprovalTimeout is how long a fill request waits for the user to approve it.
+const ApprovalTimeout = time.Minute
+
+// Operations understood by the agent.
+const (
+	OpPing      = "ping"
+	OpList      = "list"
+	OpGet       = "get"
+	OpAdd       = "add"
+	OpEdit      = "edit"
+	OpDelete    = "delete"
+	OpLock      = "lock"
+	OpFill      = "fill"
+	OpApprovals = "approvals"
+	OpDecide    = "decide"
+)
+
+// Error codes returned in failed responses.
+const (
+	CodeBadRequest = "bad_request"
+	CodeNotFound   = "not_found"
+	CodeExists     = "exists"
+	CodeDenied     = "denied"
+	CodeInternal   = "internal"
+)
+
+var (
+	// ErrNotRunning is returned when no agent is listening on the socket.
+	ErrNotRunning = errors.New("agent is not running")
+	// ErrAlreadyRunning is returned when starting an agent while another one is listening.
+	ErrAlreadyRunning = errors.New("agent is already running")
+	// ErrDenied is returned when the user denies a fill request or does not answer in time.
+	ErrDenied = errors.New("request was denied")
+)
+
+// Request is one line sent by a client.
+type Request struct {
+	Op       string   `json:"op"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Login    string   `json:"login,omitempty"`
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Origin   string   `json:"origin,omitempty"`
+	ID       string   `json:"id,omitempty"`
+	Approve  bool     `json:"approve,omitempty"`
+}
+
+// Entry describes a stored entry without its password.
+type Entry struct {
+	Username  string    `json:"username"`
+	URL       string    `json:"url,omitempty"`
+	Login     string    `json:"login,omitempty"`
+	Folder    string    `json:"folder,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// Status describes the running agent.
+type Status struct {
+	PID         int       `json:"pid"`
+	IdleTimeout string    `json:"idle_timeout"`
+	LocksAt     time.Time `json:"locks_at"`
+}
+
+// Approval is a fill request waiting for the user to approve or deny it.
+type Approval struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Origin      string    `json:"origin"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// Response is one line sent back by the agent.
+type Response struct {
+	OK        bool       `json:"ok"`
+	Code      string     `json:"code,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Password  string     `json:"password,omitempty"`
+	Entry     *Entry     `json:"entry,omitempty"`
+	Entries   []Entry    `json:"entries,omitempty"`
+	Status    *Status    `json:"status,omitempty"`
+	Approvals []Approval `json:"approvals,omitempty"`
+}
+
+// Err converts a failed response back into an error. Not-found and
+// already-exists failures wrap the matching queries errors so callers can
+// handle them the same way as local lookups; denied fills wrap ErrDenied.
+//
+// Returns:
+//
+//	nil for a successful response, otherwise the error it describes.
+func (r Response) Err() error {
+	if r.OK {
+		return nil
+	}
+
+	switch r.Code {
+	case CodeNotFound:
+		return remoteError{message: r.Error, base: queries.ErrNotFound}
+	case CodeExists:
+		return remoteError{message: r.Error, base: queries.ErrEntryExists}
+	case CodeDenied:
+		return remoteError{message: r.Error, base: ErrDenied}
+	default:
+		return fmt.Errorf("agent: %s", r.Error)
+	}
+}
+
+// remoteError is an error reported by the agent that matches a local error
+// with errors.Is.
+type remoteError struct {
+	message string
+	base    error
+}
+
+// Error returns the message sent by the agent.
+//
+// Returns:
+//
+//	The error message.
+func (e remoteError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the local error the remote one corresponds to.
+//
+// Returns:
+//
+//	The local error.
+func (e remoteError) Unwrap() error {
+	return e.base
+}
+
+// SocketPath returns where the agent listens: AEGIS_AGENT_SOCK if set,
+// otherwise a directory private to the user under $XDG_RUNTIME_DIR or the
+// system temporary directory.
+//
+// Returns:
+//
+//	The socket path.
+func SocketPath() string {
+	if path := os.Getenv(SocketEnvVar); path != "" {
+		return path
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "aegis", "agent.sock")
+	}
+
+	return filepath.Join(os.TempDir(), "aegis-"+strconv.Itoa(os.Getuid()), "agent.sock")
+}
+
+// newEntry converts an entry read from the database into its protocol form.
+//
+// Args:
+//
+//	user: The entry as returned by the queries package.
+//
+// Returns:
+//
+//	The entry and an error if a timestamp could not be parsed.
+func newEntry(user map[string]string) (Entry, error) {
+	createdOn, err := queries.ParseTimestamp(user["created_on"])
+	if err != nil {
+		return Entry{}, err
+	}
+	updatedOn, err := queries.ParseTimestamp(user["updated_on"])
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		Username:  user["username"],
+		URL:       user["url"],
+		Login:     user["login"],
+		Folder:    user["folder"],
+		Tags:      queries.SplitTags(user["tags"]),
+		CreatedOn: createdOn,
+		UpdatedOn: updatedOn,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// pendingFill is a fill request waiting for a decision.
+type pendingFill struct {
+	approval Approval
+	decision chan bool
+}
+
+// fill waits for the user to approve releasing a password to a web origin,
+// then answers like a get request. The request is denied when the user says
+// no, nobody answers within ApprovalTimeout or the agent locks meanwhile.
+//
+// Args:
+//
+//	request: The fill request with the username and origin.
+//
+// Returns:
+//
+//	The response to send.
+func (s *Server) fill(request Request) Response {
+	if request.Username == "" || request.Origin == "" {
+		return failure(CodeBadRequest, errors.New("username and origin are required"))
+	}
+
+	id, err := newApprovalID()
+	if err != nil {
+		return failure(CodeInternal, err)
+	}
+	pending := &pendingFill{
+		approval: Approval{ID: id, Username: request.Username, Origin: request.Origin, RequestedAt: time.Now().UTC()},
+		decision: make(chan bool, 1),
+	}
+
+	s.approvalMu.Lock()
+	s.pending[id] = pending
+	s.approvalMu.Unlock()
+	defer func() {
+		s.approvalMu.Lock()
+		delete(s.pending, id)
+		s.approvalMu.Unlock()
+	}()
+
+	timeout := time.NewTimer(ApprovalTimeout)
+	defer timeout.Stop()
+
+	select {
+	case approved := <-pending.decision:
+		if !approved {
+			return failure(CodeDenied, fmt.Errorf("filling %s on %s was denied", request.Username, request.Origin))
+		}
+	case <-timeout.C:
+		return failure(CodeDenied, fmt.Errorf("filling %s on %s was not approved within %s", request.Username, request.Origin, ApprovalTimeout))
+	case <-s.done:
+		return failure(CodeInternal, errors.New("agent is locked"))
+	}
+
+	return s.handle(Request{Op: OpGet, Username: request.Username})
+}
+
+// listApprovals returns the fill requests waiting for a decision, oldest first.
+//
+// Returns:
+//
+//	The response to send.
+func (s *Server) listApprovals() Response {
+	s.approvalMu.Lock()
+	defer s.approvalMu.Unlock()
+
+	approvals := make([]Approval, 0, len(s.pending))
+	for _, pending := range s.pending {
+		approvals = append(approvals, pending.approval)
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].RequestedAt.Before(approvals[j].RequestedAt)
+	})
+
+	return Response{OK: true, Approvals: approvals}
+}
+
+// decide approves or denies a waiting fill request. The first decision wins.
+//
+// Args:
+//
+//	request: The decide request with the approval id.
+//
+// Returns:
+//
+//	The response to send.
+func (s *Server) decide(request Request) Response {
+	if request.ID == "" {
+		return failure(CodeBadRequest, errors.New("id is required"))
+	}
+
+	s.approvalMu.Lock()
+	pending, ok := s.pending[request.ID]
+	if ok {
+		delete(s.pending, request.ID)
+	}
+	s.approvalMu.Unlock()
+
+	if !ok {
+		return failure(CodeNotFound, fmt.Errorf("no pending request %s", request.ID))
+	}
+
+	pending.decision <- request.Approve
+	return Response{OK: true}
+}
+
+// newApprovalID returns a random id for a pending fill request.
+//
+// Returns:
+//
+//	The id and an error if the random source failed.
+func newApprovalID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// dialTimeout bounds how long a client waits to connect to the agent.
+const dialTimeout = 2 * time.Second
+
+// Client talks to a running agent over its socket.
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	encoder *json.Encoder
+}
+
+// Dial connects to the agent at SocketPath.
+//
+// Returns:
+//
+//	The client and ErrNotRunning if no agent is listening.
+func Dial() (*Client, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(), dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRunning, err)
+	}
+
+	return &Client{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		encoder: json.NewEncoder(conn),
+	}, nil
+}
+
+// Close closes the connection.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a request and waits for its response.
+//
+// Args:
+//
+//	request: The request to send.
+//
+// Returns:
+//
+//	The response and an error if the exchange failed or the agent reported one.
+func (c *Client) Do(request Request) (Response, error) {
+	if err := c.encoder.Encode(request); err != nil {
+		return Response{}, err
+	}
+
+	line, err := c.reader.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) == 0 {
+		return Response{}, errors.New("agent closed the connection")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Response{}, err
+	}
+
+	var response Response
+	if err := json.Unmarshal(line, &response); err != nil {
+		return Response{}, fmt.Errorf("invalid response from agent: %w", err)
+	}
+
+	return response, response.Err()
+}
+
+// Ping asks the agent for its status.
+//
+// Returns:
+//
+//	The agent status and an error if one occurred.
+func (c *Client) Ping() (Status, error) {
+	response, err := c.Do(Request{Op: OpPing})
+	if err != nil {
+		return Status{}, err
+	}
+	if response.Status == nil {
+		return Status{}, errors.New("agent sent no status")
+	}
+
+	return *response.Status, nil
+}
+
+// List returns every entry without passwords.
+//
+// Returns:
+//
+//	The entries and an error if one occurred.
+func (c *Client) List() ([]Entry, error) {
+	response, err := c.Do(Request{Op: OpList})
+	return response.Entries, err
+}
+
+// Get returns an entry and its password.
+//
+// Args:
+//
+//	username: The entry to fetch.
+//
+// Returns:
+//
+//	The entry, its password and an error if one occurred.
+func (c *Client) Get(username string) (Entry, string, error) {
+	response, err := c.Do(Request{Op: OpGet, Username: username})
+	if err != nil {
+		return Entry{}, "", err
+	}
+	if response.Entry == nil {
+		return Entry{}, "", errors.New("agent sent no entry")
+	}
+
+	return *response.Entry, response.Password, nil
+}
+
+// Add stores a new entry.
+//
+// Args:
+//
+//	entry: The entry to create. Its timestamps are ignored.
+//	password: The password to store.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Client) Add(entry Entry, password string) error {
+	_, err := c.Do(Request{
+		Op:       OpAdd,
+		Username: entry.Username,
+		Password: password,
+		URL:      entry.URL,
+		Login:    entry.Login,
+		Folder:   entry.Folder,
+		Tags:     entry.Tags,
+	})
+	return err
+}
+
+// Edit changes the password of an entry.
+//
+// Args:
+//
+//	username: The entry to change.
+//	password: The new password.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Client) Edit(username, password string) error {
+	_, err := c.Do(Request{Op: OpEdit, Username: username, Password: password})
+	return err
+}
+
+// Delete removes an entry.
+//
+// Args:
+//
+//	username: The entry to delete.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Client) Delete(username string) error {
+	_, err := c.Do(Request{Op: OpDelete, Username: username})
+	return err
+}
+
+// Fill asks the agent for an entry's password on behalf of a web origin. It
+// blocks until the user approves or denies the request.
+//
+// Args:
+//
+//	username: The entry to fill.
+//	origin: The origin of the page asking, such as "https://github.com".
+//
+// Returns:
+//
+//	The entry, its password and ErrDenied or another error if one occurred.
+func (c *Client) Fill(username, origin string) (Entry, string, error) {
+	c.conn.SetDeadline(time.Now().Add(ApprovalTimeout + 10*time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	response, err := c.Do(Request{Op: OpFill, Username: username, Origin: origin})
+	if err != nil {
+		return Entry{}, "", err
+	}
+	if response.Entry == nil {
+		return Entry{}, "", errors.New("agent sent no entry")
+	}
+
+	return *response.Entry, response.Password, nil
+}
+
+// Approvals returns the fill requests waiting for a decision.
+//
+// Returns:
+//
+//	The pending requests, oldest first, and an error if one occurred.
+func (c *Client) Approvals() ([]Approval, error) {
+	response, err := c.Do(Request{Op: OpApprovals})
+	return response.Approvals, err
+}
+
+// Decide approves or denies a waiting fill request.
+//
+// Args:
+//
+//	id: The id of the pending request.
+//	approve: True to release the password.
+//
+// Returns:
+//
+//	An error wrapping queries.ErrNotFound if the request is no longer waiting.
+func (c *Client) Decide(id string, approve bool) error {
+	_, err := c.Do(Request{Op: OpDecide, ID: id, Approve: approve})
+	return err
+}
+
+// Lock tells the agent to forget the master password and exit.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Client) Lock() error {
+	_, err := c.Do(Request{Op: OpLock})
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd
+
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID is not supported on this platform, so every client is rejected.
+//
+// Args:
+//
+//	conn: The client connection.
+//
+// Returns:
+//
+//	An error explaining that peer credentials are unavailable.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
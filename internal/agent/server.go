@@ -0,0 +1,372 @@
+package agent
+
+import (
+	"aegis/internal/queries"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxRequestSize bounds a single request line.
+const maxRequestSize = 64 * 1024
+
+// Server serves vault requests on a Unix socket while the vault is unlocked.
+type Server struct {
+	listener    *net.UnixListener
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	locksAt  time.Time
+	stopOnce sync.Once
+	done     chan struct{}
+
+	connMu sync.Mutex
+	conns  map[*net.UnixConn]struct{}
+
+	approvalMu sync.Mutex
+	pending    map[string]*pendingFill
+}
+
+// Listen creates the agent socket with mode 0600 inside a directory only the
+// current user can enter. A stale socket left by a crashed agent is removed.
+//
+// Args:
+//
+//	path: The socket path.
+//	idleTimeout: How long to stay unlocked without requests.
+//
+// Returns:
+//
+//	The server and ErrAlreadyRunning or another error if one occurred.
+func Listen(path string, idleTimeout time.Duration) (*Server, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, ErrAlreadyRunning
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &Server{
+		listener:    listener,
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+		conns:       make(map[*net.UnixConn]struct{}),
+		pending:     make(map[string]*pendingFill),
+	}, nil
+}
+
+// Serve accepts connections until the idle timeout passes or Stop is called.
+// The master password must already be set in the queries package.
+//
+// Returns:
+//
+//	An error if accepting connections failed.
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	s.timer = time.AfterFunc(s.idleTimeout, s.Stop)
+	s.locksAt = time.Now().Add(s.idleTimeout)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+// Stop closes the socket and every client connection so Serve returns. It is
+// safe to call more than once.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.listener.Close()
+
+		s.connMu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.connMu.Unlock()
+	})
+}
+
+// trackConn registers a client connection so Stop can close it.
+//
+// Args:
+//
+//	conn: The client connection.
+//
+// Returns:
+//
+//	False if the server is already stopping and the connection was not registered.
+func (s *Server) trackConn(conn *net.UnixConn) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn forgets a closed client connection.
+//
+// Args:
+//
+//	conn: The client connection.
+func (s *Server) untrackConn(conn *net.UnixConn) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+// handleConn serves the requests of one client, one JSON object per line.
+//
+// Args:
+//
+//	conn: The client connection.
+func (s *Server) handleConn(conn *net.UnixConn) {
+	defer conn.Close()
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
+
+	uid, err := peerUID(conn)
+	if err != nil {
+		log.Printf("Rejected agent client: %s", err)
+		return
+	}
+	if uid != os.Getuid() {
+		log.Printf("Rejected agent client running as uid %d", uid)
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var request Request
+		var response Response
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response = failure(CodeBadRequest, fmt.Errorf("invalid request: %w", err))
+		} else {
+			response = s.handle(request)
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			return
+		}
+		if request.Op == OpLock && response.OK {
+			s.Stop()
+			return
+		}
+	}
+}
+
+// handle runs a single request against the vault. Fill requests wait for
+// approval without holding the vault lock, and approval requests do not
+// restart the idle timer so a polling approver cannot keep the agent unlocked.
+//
+// Args:
+//
+//	request: The decoded request.
+//
+// Returns:
+//
+//	The response to send.
+func (s *Server) handle(request Request) Response {
+	switch request.Op {
+	case OpFill:
+		return s.fill(request)
+	case OpApprovals:
+		return s.listApprovals()
+	case OpDecide:
+		return s.decide(request)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return failure(CodeInternal, errors.New("agent is locked"))
+	default:
+	}
+
+	s.timer.Reset(s.idleTimeout)
+	s.locksAt = time.Now().Add(s.idleTimeout)
+
+	switch request.Op {
+	case OpPing:
+		return Response{OK: true, Status: &Status{
+			PID:         os.Getpid(),
+			IdleTimeout: s.idleTimeout.String(),
+			LocksAt:     s.locksAt,
+		}}
+
+	case OpList:
+		userData, err := queries.FetchUserData()
+		if err != nil {
+			return failure(CodeInternal, err)
+		}
+
+		entries := make([]Entry, 0, len(userData))
+		for _, user := range userData {
+			entry, err := newEntry(user)
+			if err != nil {
+				return failure(CodeInternal, err)
+			}
+			entries = append(entries, entry)
+		}
+		return Response{OK: true, Entries: entries}
+
+	case OpGet:
+		if request.Username == "" {
+			return failure(CodeBadRequest, errors.New("username is required"))
+		}
+
+		password, err := queries.FetchPassword(request.Username)
+		if err != nil {
+			return failure(codeFor(err), err)
+		}
+		user, err := queries.FetchUserEntry(request.Username)
+		if err != nil {
+			return failure(codeFor(err), err)
+		}
+		entry, err := newEntry(user)
+		if err != nil {
+			return failure(CodeInternal, err)
+		}
+		return Response{OK: true, Password: password, Entry: &entry}
+
+	case OpAdd:
+		if request.Username == "" || request.Password == "" {
+			return failure(CodeBadRequest, errors.New("username and password are required"))
+		}
+
+		// The entry and its details are stored together, so a failure leaves
+		// no entry behind.
+		details := queries.EntryDetails{URL: request.URL, Login: request.Login, Folder: request.Folder, Tags: request.Tags}
+		err := queries.WithTransaction(func(tx *queries.Tx) error {
+			if err := tx.AddNewPassword(request.Username, request.Password); err != nil {
+				return err
+			}
+			if details.URL == "" && details.Login == "" && details.Folder == "" && len(details.Tags) == 0 {
+				return nil
+			}
+			return tx.SetEntryDetails(request.Username, details)
+		})
+		if err != nil {
+			return failure(codeFor(err), err)
+		}
+		return Response{OK: true}
+
+	case OpEdit:
+		if request.Username == "" || request.Password == "" {
+			return failure(CodeBadRequest, errors.New("username and password are required"))
+		}
+
+		if err := queries.EditUserPassword(request.Password, request.Username); err != nil {
+			return failure(codeFor(err), err)
+		}
+		return Response{OK: true}
+
+	case OpDelete:
+		if request.Username == "" {
+			return failure(CodeBadRequest, errors.New("username is required"))
+		}
+
+		if err := queries.DeleteUserByPasswordHash(request.Username); err != nil {
+			return failure(codeFor(err), err)
+		}
+		return Response{OK: true}
+
+	case OpLock:
+		return Response{OK: true}
+	}
+
+	return failure(CodeBadRequest, fmt.Errorf("unknown op %q", request.Op))
+}
+
+// codeFor picks the protocol error code for a repository error.
+//
+// Args:
+//
+//	err: The error returned by the queries package.
+//
+// Returns:
+//
+//	The error code.
+func codeFor(err error) string {
+	switch {
+	case errors.Is(err, queries.ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, queries.ErrEntryExists):
+		return CodeExists
+	default:
+		return CodeInternal
+	}
+}
+
+// failure builds a failed response.
+//
+// Args:
+//
+//	code: The error code.
+//	err: The error to report.
+//
+// Returns:
+//
+//	The response.
+func failure(code string, err error) Response {
+	return Response{OK: false, Code: code, Error: err.Error()}
+}
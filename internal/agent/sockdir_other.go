@@ -0,0 +1,19 @@
+//go:build !unix
+
+package agent
+
+import "errors"
+
+// checkSocketDir refuses to run the agent where socket directories cannot be
+// checked for ownership.
+//
+// Args:
+//
+//	dir: The directory holding the socket.
+//
+// Returns:
+//
+//	An error explaining that the agent is unsupported.
+func checkSocketDir(dir string) error {
+	return errors.New("the agent is not supported on this platform")
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkSocketDir makes sure the socket directory belongs to the current user
+// and nobody else can enter it.
+//
+// Args:
+//
+//	dir: The directory holding the socket.
+//
+// Returns:
+//
+//	An error if the directory is unsafe.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the current user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s must not be accessible by other users (mode %o)", dir, info.Mode().Perm())
+	}
+
+	return nil
+}
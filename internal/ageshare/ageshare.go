@@ -0,0 +1,209 @@
+// Package ageshare reads and writes age shares: chosen entries encrypted
+// with age to the X25519 public keys of one or more recipients, so
+// credentials can be handed to a teammate without agreeing on a password.
+// The payload is the JSON document of an Aegis backup, so a share keeps
+// everything a backup does. The vault can hold an age identity of its own
+// to receive shares with.
+package ageshare
+
+import (
+	"aegis/internal/aegisbak"
+	"aegis/internal/queries"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Extension is the file name extension of shares.
+const Extension = ".age"
+
+var (
+	// ErrNoRecipients is returned when a share would be encrypted to nobody.
+	ErrNoRecipients = errors.New("at least one age recipient is required")
+	// ErrNoMatchingIdentity is returned when a share is not encrypted to any of the given identities.
+	ErrNoMatchingIdentity = errors.New("the share is not encrypted to the given age identity")
+	// ErrIdentityExists is returned when the vault already has an age identity.
+	ErrIdentityExists = errors.New("the vault already has an age identity")
+)
+
+// ParseRecipients reads the recipients of a share. Each value is either an
+// age public key such as "age1..." or the path to a recipients file with one
+// public key per line, where empty lines and lines starting with # are
+// ignored.
+//
+// Args:
+//
+//	values: The public keys and recipients files.
+//
+// Returns:
+//
+//	The recipients and ErrNoRecipients or another error if a value cannot
+//	be read.
+func ParseRecipients(values []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range values {
+		if strings.HasPrefix(value, "age1") {
+			recipient, err := age.ParseX25519Recipient(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient %q: %w", value, err)
+			}
+			recipients = append(recipients, recipient)
+			continue
+		}
+
+		file, err := os.Open(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open recipients file: %w", err)
+		}
+		parsed, err := age.ParseRecipients(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipients file %s: %w", value, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return recipients, nil
+}
+
+// ReadIdentities reads an age identity file, as written by age-keygen.
+//
+// Args:
+//
+//	filePath: The path to the identity file.
+//
+// Returns:
+//
+//	The identities and an error if the file cannot be read.
+func ReadIdentities(filePath string) ([]age.Identity, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", filePath, err)
+	}
+	return identities, nil
+}
+
+// Seal encrypts entries to the recipients of a share.
+//
+// Args:
+//
+//	w: The writer to write the share to.
+//	backup: The entries; its Version is set to aegisbak.Version.
+//	recipients: The recipients who can open the share.
+//
+// Returns:
+//
+//	ErrNoRecipients or another error if one occurred.
+func Seal(w io.Writer, backup aegisbak.Backup, recipients []age.Recipient) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	encrypted, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("error encrypting share: %w", err)
+	}
+	backup.Version = aegisbak.Version
+	if err := json.NewEncoder(encrypted).Encode(backup); err != nil {
+		return fmt.Errorf("error encrypting share: %w", err)
+	}
+	return encrypted.Close()
+}
+
+// Open decrypts a share with the identities of one of its recipients.
+//
+// Args:
+//
+//	r: The reader holding the share.
+//	identities: The identities to try.
+//
+// Returns:
+//
+//	The entries, and ErrNoMatchingIdentity or another error if one occurred.
+func Open(r io.Reader, identities []age.Identity) (aegisbak.Backup, error) {
+	decrypted, err := age.Decrypt(r, identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return aegisbak.Backup{}, ErrNoMatchingIdentity
+	}
+	if err != nil {
+		return aegisbak.Backup{}, fmt.Errorf("cannot open share: %w", err)
+	}
+
+	var backup aegisbak.Backup
+	if err := json.NewDecoder(decrypted).Decode(&backup); err != nil {
+		return aegisbak.Backup{}, fmt.Errorf("the share payload is malformed: %w", err)
+	}
+	if backup.Version > aegisbak.Version {
+		return aegisbak.Backup{}, fmt.Errorf("the share was written by a newer version of Aegis (version %d)", backup.Version)
+	}
+	return backup, nil
+}
+
+// GenerateIdentity creates a new age identity for the vault and stores it,
+// encrypted with the master password.
+//
+// Args:
+//
+//	replace: Whether to replace an existing identity. Shares sent to the
+//	old one can no longer be opened.
+//
+// Returns:
+//
+//	The public recipient to give to others, and ErrIdentityExists or another
+//	error if one occurred.
+func GenerateIdentity(replace bool) (string, error) {
+	if !replace {
+		_, err := queries.FetchAgeRecipient()
+		if err == nil {
+			return "", ErrIdentityExists
+		}
+		if !errors.Is(err, queries.ErrNoAgeIdentity) {
+			return "", err
+		}
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", fmt.Errorf("error generating identity: %w", err)
+	}
+	recipient := identity.Recipient().String()
+	if err := queries.SetAgeIdentity(identity.String(), recipient); err != nil {
+		return "", err
+	}
+	return recipient, nil
+}
+
+// VaultIdentity decrypts the vault's own age identity.
+//
+// Returns:
+//
+//	The identity, and queries.ErrNoAgeIdentity or another error if one
+//	occurred.
+func VaultIdentity() (age.Identity, error) {
+	secret, err := queries.FetchAgeIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := age.ParseX25519Identity(secret)
+	if err != nil {
+		return nil, fmt.Errorf("the stored age identity is invalid: %w", err)
+	}
+	return identity, nil
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"aegis/internal/queries"
+	_ "embed"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPISpec is the OpenAPI 3 description of the API, served at
+// /v1/openapi.yaml.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+// Entry is the JSON form of a vault entry.
+type Entry struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password,omitempty"`
+	URL       string    `json:"url"`
+	Login     string    `json:"login"`
+	Folder    string    `json:"folder"`
+	Tags      []string  `json:"tags"`
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// createRequest is the body of POST /v1/entries.
+type createRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	URL      string   `json:"url"`
+	Login    string   `json:"login"`
+	Folder   string   `json:"folder"`
+	Tags     []string `json:"tags"`
+}
+
+// updateRequest is the body of PUT /v1/entries/{name}. Fields left out are
+// not changed.
+type updateRequest struct {
+	Password *string   `json:"password"`
+	URL      *string   `json:"url"`
+	Login    *string   `json:"login"`
+	Folder   *string   `json:"folder"`
+	Tags     *[]string `json:"tags"`
+}
+
+// errorResponse is the body of every failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// auditRecord is one line of the audit log. It never holds passwords.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Remote   string    `json:"remote"`
+	TokenID  string    `json:"token_id,omitempty"`
+	Token    string    `json:"token_name,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Entry    string    `json:"entry,omitempty"`
+	Status   int       `json:"status"`
+	Duration string    `json:"duration"`
+}
+
+// auditLog appends audit records to a file as JSON lines.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openAuditLog opens the audit log for appending, readable only by the
+// current user.
+//
+// Args:
+//
+//	path: The log file.
+//
+// Returns:
+//
+//	The log and an error if one occurred.
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLog{file: file}, nil
+}
+
+// write appends one record.
+//
+// Args:
+//
+//	record: The record to log.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (l *auditLog) write(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// close closes the log file.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (l *auditLog) close() error {
+	return l.file.Close()
+}
+
+// inScope reports whether a token may see an entry: the token covers every
+// entry, the entry is in one of its folders or below, or the entry carries
+// one of its tags.
+//
+// Args:
+//
+//	token: The authenticated token.
+//	folder: The entry's folder.
+//	tags: The entry's tags.
+//
+// Returns:
+//
+//	True if the entry is in scope.
+func inScope(token queries.APIToken, folder string, tags []string) bool {
+	if token.All {
+		return true
+	}
+
+	for _, scope := range token.Folders {
+		if inFolder(folder, scope) {
+			return true
+		}
+	}
+	for _, tag := range tags {
+		for _, scope := range token.Tags {
+			if tag == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inFolder reports whether a folder is another folder or below it.
+//
+// Args:
+//
+//	folder: The folder to check.
+//	parent: The folder it may be in.
+//
+// Returns:
+//
+//	True if folder is parent or one of its subfolders.
+func inFolder(folder, parent string) bool {
+	return folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+// IsLoopback reports whether a host name or address only reaches this machine.
+//
+// Args:
+//
+//	host: A host name or IP address, without a port.
+//
+// Returns:
+//
+//	True for "localhost" and loopback addresses.
+func IsLoopback(host string) bool {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,527 @@
+package api
+
+import (
+	"aegis/internal/queries"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize bounds the JSON body of a request.
+const maxBodySize = 64 * 1024
+
+// Server serves the vault over HTTP to clients holding an API token. The
+// master password must already be set in the queries package.
+type Server struct {
+	// mu serialises vault access, as the agent does.
+	mu    sync.Mutex
+	audit *auditLog
+	mux   *http.ServeMux
+}
+
+// handlerFunc handles a request made with a valid token.
+type handlerFunc func(w http.ResponseWriter, r *http.Request, token queries.APIToken)
+
+// statusRecorder remembers what the audit log needs about a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	token  queries.APIToken
+}
+
+// WriteHeader records the status code and writes it.
+//
+// Args:
+//
+//	status: The HTTP status code.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// NewServer creates the API server.
+//
+// Args:
+//
+//	auditPath: The file every request is logged to.
+//
+// Returns:
+//
+//	The server and an error if the audit log could not be opened.
+func NewServer(auditPath string) (*Server, error) {
+	audit, err := openAuditLog(auditPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{audit: audit, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(OpenAPISpec)
+	})
+	s.mux.Handle("GET /v1/entries", s.authenticated(s.listEntries))
+	s.mux.Handle("POST /v1/entries", s.authenticated(s.createEntry))
+	s.mux.Handle("GET /v1/entries/{name...}", s.authenticated(s.getEntry))
+	s.mux.Handle("PUT /v1/entries/{name...}", s.authenticated(s.updateEntry))
+	s.mux.Handle("DELETE /v1/entries/{name...}", s.authenticated(s.deleteEntry))
+
+	return s, nil
+}
+
+// ServeHTTP checks the Host header, routes the request and writes it to the
+// audit log.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	defer func() {
+		record := auditRecord{
+			Time:     start.UTC(),
+			Remote:   r.RemoteAddr,
+			TokenID:  recorder.token.ID,
+			Token:    recorder.token.Name,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Entry:    r.PathValue("name"),
+			Status:   recorder.status,
+			Duration: time.Since(start).Round(time.Microsecond).String(),
+		}
+		if err := s.audit.write(record); err != nil {
+			log.Printf("Could not write audit log: %s", err)
+		}
+	}()
+
+	// Browsers send the name they resolved, so this stops DNS rebinding.
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !IsLoopback(host) {
+		writeError(recorder, http.StatusMisdirectedRequest, "the API only answers requests for localhost")
+		return
+	}
+
+	s.mux.ServeHTTP(recorder, r)
+}
+
+// Close closes the audit log.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (s *Server) Close() error {
+	return s.audit.close()
+}
+
+// authenticated wraps a handler with bearer token authentication.
+//
+// Args:
+//
+//	handler: The handler to wrap.
+//
+// Returns:
+//
+//	The wrapped handler.
+func (s *Server) authenticated(handler handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="aegis"`)
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		token, err := queries.AuthenticateAPIToken(strings.TrimSpace(bearer))
+		if errors.Is(err, queries.ErrTokenInvalid) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="aegis", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+
+		if recorder, ok := w.(*statusRecorder); ok {
+			recorder.token = token
+		}
+		handler(w, r, token)
+	})
+}
+
+// listEntries handles GET /v1/entries. The folder and tag query parameters
+// narrow the list further.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+//	token: The authenticated token.
+func (s *Server) listEntries(w http.ResponseWriter, r *http.Request, token queries.APIToken) {
+	folder := queries.NormaliseFolder(r.URL.Query().Get("folder"))
+	tag := r.URL.Query().Get("tag")
+
+	userData, err := queries.FetchUserData()
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	entries := []Entry{}
+	for _, user := range userData {
+		entry, err := newEntry(user)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		if !inScope(token, entry.Folder, entry.Tags) {
+			continue
+		}
+		if folder != "" && !inFolder(entry.Folder, folder) {
+			continue
+		}
+		if tag != "" && !slices.Contains(entry.Tags, tag) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+	})
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// getEntry handles GET /v1/entries/{name}, which includes the password.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+//	token: The authenticated token.
+func (s *Server) getEntry(w http.ResponseWriter, r *http.Request, token queries.APIToken) {
+	entry, ok := s.scopedEntry(w, r.PathValue("name"), token)
+	if !ok {
+		return
+	}
+
+	password, err := queries.FetchPassword(entry.Username)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	entry.Password = password
+
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// createEntry handles POST /v1/entries.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+//	token: The authenticated token.
+func (s *Server) createEntry(w http.ResponseWriter, r *http.Request, token queries.APIToken) {
+	if !token.Write {
+		writeError(w, http.StatusForbidden, "token is read-only")
+		return
+	}
+
+	var request createRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	if request.Username == "" || request.Password == "" {
+		writeError(w, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	details := queries.EntryDetails{
+		URL:    request.URL,
+		Login:  request.Login,
+		Folder: queries.NormaliseFolder(request.Folder),
+		Tags:   queries.SplitTags(queries.JoinTags(request.Tags)),
+	}
+	if !inScope(token, details.Folder, details.Tags) {
+		writeError(w, http.StatusForbidden, "the entry's folder and tags are outside the token's scope")
+		return
+	}
+
+	// The entry and its details are stored together, so a failure leaves no
+	// entry behind that the token cannot see.
+	err := queries.WithTransaction(func(tx *queries.Tx) error {
+		if err := tx.AddNewPassword(request.Username, request.Password); err != nil {
+			return err
+		}
+		return tx.SetEntryDetails(request.Username, details)
+	})
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	entry, err := fetchEntry(request.Username)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.Header().Set("Location", (&url.URL{Path: "/v1/entries/" + request.Username}).EscapedPath())
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// updateEntry handles PUT /v1/entries/{name}. The entry must stay in the
+// token's scope after the change.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+//	token: The authenticated token.
+func (s *Server) updateEntry(w http.ResponseWriter, r *http.Request, token queries.APIToken) {
+	if !token.Write {
+		writeError(w, http.StatusForbidden, "token is read-only")
+		return
+	}
+
+	entry, ok := s.scopedEntry(w, r.PathValue("name"), token)
+	if !ok {
+		return
+	}
+
+	var request updateRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	details := queries.EntryDetails{URL: entry.URL, Login: entry.Login, Folder: entry.Folder, Tags: entry.Tags}
+	if request.URL != nil {
+		details.URL = *request.URL
+	}
+	if request.Login != nil {
+		details.Login = *request.Login
+	}
+	if request.Folder != nil {
+		details.Folder = queries.NormaliseFolder(*request.Folder)
+	}
+	if request.Tags != nil {
+		details.Tags = queries.SplitTags(queries.JoinTags(*request.Tags))
+	}
+	if !inScope(token, details.Folder, details.Tags) {
+		writeError(w, http.StatusForbidden, "the entry's new folder and tags are outside the token's scope")
+		return
+	}
+
+	if request.Password != nil && *request.Password == "" {
+		writeError(w, http.StatusBadRequest, "password cannot be empty")
+		return
+	}
+
+	// The password and details change together or not at all.
+	err := queries.WithTransaction(func(tx *queries.Tx) error {
+		if request.Password != nil {
+			if err := tx.EditUserPassword(*request.Password, entry.Username); err != nil {
+				return err
+			}
+		}
+		return tx.SetEntryDetails(entry.Username, details)
+	})
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	updated, err := fetchEntry(entry.Username)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteEntry handles DELETE /v1/entries/{name}.
+//
+// Args:
+//
+//	w: The response writer.
+//	r: The request.
+//	token: The authenticated token.
+func (s *Server) deleteEntry(w http.ResponseWriter, r *http.Request, token queries.APIToken) {
+	if !token.Write {
+		writeError(w, http.StatusForbidden, "token is read-only")
+		return
+	}
+
+	entry, ok := s.scopedEntry(w, r.PathValue("name"), token)
+	if !ok {
+		return
+	}
+
+	if err := queries.DeleteUserByPasswordHash(entry.Username); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scopedEntry fetches an entry the token may see. Entries outside the scope
+// are reported as missing so a token cannot probe for them.
+//
+// Args:
+//
+//	w: The response writer, used to report failures.
+//	username: The entry name.
+//	token: The authenticated token.
+//
+// Returns:
+//
+//	The entry, and false if a failure was already written.
+func (s *Server) scopedEntry(w http.ResponseWriter, username string, token queries.APIToken) (Entry, bool) {
+	entry, err := fetchEntry(username)
+	if err == nil && !inScope(token, entry.Folder, entry.Tags) {
+		err = queries.ErrNotFound
+	}
+	if err != nil {
+		writeFailure(w, err)
+		return Entry{}, false
+	}
+
+	return entry, true
+}
+
+// fetchEntry reads an entry without its password.
+//
+// Args:
+//
+//	username: The entry name.
+//
+// Returns:
+//
+//	The entry and queries.ErrNotFound or another error if one occurred.
+func fetchEntry(username string) (Entry, error) {
+	user, err := queries.FetchUserEntry(username)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return newEntry(user)
+}
+
+// newEntry converts an entry read from the database into its JSON form.
+//
+// Args:
+//
+//	user: The entry as returned by the queries package.
+//
+// Returns:
+//
+//	The entry and an error if a timestamp could not be parsed.
+func newEntry(user map[string]string) (Entry, error) {
+	createdOn, err := queries.ParseTimestamp(user["created_on"])
+	if err != nil {
+		return Entry{}, err
+	}
+	updatedOn, err := queries.ParseTimestamp(user["updated_on"])
+	if err != nil {
+		return Entry{}, err
+	}
+
+	tags := queries.SplitTags(user["tags"])
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return Entry{
+		Username:  user["username"],
+		URL:       user["url"],
+		Login:     user["login"],
+		Folder:    user["folder"],
+		Tags:      tags,
+		CreatedOn: createdOn,
+		UpdatedOn: updatedOn,
+	}, nil
+}
+
+// decodeBody reads a JSON request body, rejecting unknown fields.
+//
+// Args:
+//
+//	w: The response writer, used to report failures.
+//	r: The request.
+//	v: The value to decode into.
+//
+// Returns:
+//
+//	False if a failure was already written.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+// writeFailure reports a repository error with the matching status code.
+//
+// Args:
+//
+//	w: The response writer.
+//	err: The error.
+func writeFailure(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queries.ErrNotFound):
+		writeError(w, http.StatusNotFound, "entry not found")
+	case errors.Is(err, queries.ErrEntryExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("API request failed: %s", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// writeError writes an error response.
+//
+// Args:
+//
+//	w: The response writer.
+//	status: The HTTP status code.
+//	message: The error message.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// writeJSON writes a JSON response.
+//
+// Args:
+//
+//	w: The response writer.
+//	status: The HTTP status code.
+//	v: The value to encode.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,209 @@
+// Package audit scans the vault for reused, weak, old and breached passwords.
+package audit
+
+import (
+	"aegis/internal/hibp"
+	"aegis/internal/queries"
+	"aegis/internal/strength"
+
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultMaxAgeMonths is how long a password may stay unchanged before the
+// report flags it, unless the caller asks for something else.
+const DefaultMaxAgeMonths = 12
+
+// WeakScoreThreshold is the strength score below which a password is weak.
+const WeakScoreThreshold = 3
+
+// Report is the result of a vault health scan.
+type Report struct {
+	GeneratedOn  time.Time         `json:"generated_on"`
+	TotalEntries int               `json:"total_entries"`
+	MaxAgeMonths int               `json:"max_age_months"`
+	Reused       []ReusedGroup     `json:"reused"`
+	Weak         []WeakEntry       `json:"weak"`
+	Old          []OldEntry        `json:"old"`
+	BreachCheck  bool              `json:"breach_check"`
+	Breached     []BreachedEntry   `json:"breached"`
+	Unreadable   []UnreadableEntry `json:"unreadable"`
+}
+
+// ReusedGroup lists entries that share the same password.
+type ReusedGroup struct {
+	Usernames []string `json:"usernames"`
+}
+
+// WeakEntry is an entry whose password scored below WeakScoreThreshold.
+type WeakEntry struct {
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+	Label    string `json:"label"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// OldEntry is an entry whose password hasn't changed for too long.
+type OldEntry struct {
+	Username  string    `json:"username"`
+	UpdatedOn time.Time `json:"updated_on"`
+	AgeDays   int       `json:"age_days"`
+}
+
+// BreachedEntry is an entry whose password appears in the breach corpus.
+type BreachedEntry struct {
+	Username string `json:"username"`
+	Count    int    `json:"count"`
+}
+
+// UnreadableEntry is an entry whose password could not be decrypted, so
+// its strength and breaches were not checked.
+type UnreadableEntry struct {
+	Username string `json:"username"`
+	Error    string `json:"error"`
+}
+
+// IssueCount returns the number of findings in the report.
+//
+// Returns:
+//
+//	The number of reused groups, weak, old, breached and unreadable entries
+//	combined.
+func (r Report) IssueCount() int {
+	return len(r.Reused) + len(r.Weak) + len(r.Old) + len(r.Breached) + len(r.Unreadable)
+}
+
+// Run scans every entry in the vault. An entry whose password cannot be
+// decrypted is listed as unreadable and the rest are still scanned.
+//
+// Args:
+//
+//	maxAgeMonths: Passwords not updated for more than this many months are
+//	  reported as old. Values below 1 use DefaultMaxAgeMonths.
+//	corpus: The breach corpus to check passwords against, or nil to skip
+//	  the breach check.
+//
+// Returns:
+//
+//	The health report and an error if one occurred.
+func Run(maxAgeMonths int, corpus *hibp.Corpus) (Report, error) {
+	if maxAgeMonths < 1 {
+		maxAgeMonths = DefaultMaxAgeMonths
+	}
+
+	userData, err := queries.FetchUserData()
+	if err != nil {
+		return Report{}, fmt.Errorf("could not fetch user data: %w", err)
+	}
+
+	now := time.Now()
+	cutoff := now.AddDate(0, -maxAgeMonths, 0)
+
+	report := Report{
+		GeneratedOn:  now,
+		TotalEntries: len(userData),
+		MaxAgeMonths: maxAgeMonths,
+		Reused:       []ReusedGroup{},
+		Weak:         []WeakEntry{},
+		Old:          []OldEntry{},
+		BreachCheck:  corpus != nil,
+		Breached:     []BreachedEntry{},
+		Unreadable:   []UnreadableEntry{},
+	}
+
+	byHash := make(map[string][]string)
+
+	for _, user := range userData {
+		username := user["username"]
+		byHash[user["password_hash"]] = append(byHash[user["password_hash"]], username)
+
+		if err := checkPassword(&report, username, corpus); err != nil {
+			return Report{}, err
+		}
+
+		updatedOn, err := queries.ParseTimestamp(user["updated_on"])
+		if err != nil {
+			return Report{}, fmt.Errorf("invalid updated_on for %q: %w", username, err)
+		}
+		if updatedOn.Before(cutoff) {
+			report.Old = append(report.Old, OldEntry{
+				Username:  username,
+				UpdatedOn: updatedOn,
+				AgeDays:   int(now.Sub(updatedOn).Hours() / 24),
+			})
+		}
+	}
+
+	for _, usernames := range byHash {
+		if len(usernames) < 2 {
+			continue
+		}
+		sort.Strings(usernames)
+		report.Reused = append(report.Reused, ReusedGroup{Usernames: usernames})
+	}
+
+	sort.Slice(report.Reused, func(i, j int) bool {
+		return report.Reused[i].Usernames[0] < report.Reused[j].Usernames[0]
+	})
+	sort.Slice(report.Weak, func(i, j int) bool {
+		if report.Weak[i].Score != report.Weak[j].Score {
+			return report.Weak[i].Score < report.Weak[j].Score
+		}
+		return report.Weak[i].Username < report.Weak[j].Username
+	})
+	sort.Slice(report.Old, func(i, j int) bool {
+		return report.Old[i].UpdatedOn.Before(report.Old[j].UpdatedOn)
+	})
+	sort.Slice(report.Breached, func(i, j int) bool {
+		if report.Breached[i].Count != report.Breached[j].Count {
+			return report.Breached[i].Count > report.Breached[j].Count
+		}
+		return report.Breached[i].Username < report.Breached[j].Username
+	})
+
+	return report, nil
+}
+
+// checkPassword decrypts the password of an entry and checks its strength
+// and, with a corpus, whether it was breached. An entry that cannot be
+// decrypted is listed as unreadable instead.
+//
+// Args:
+//
+//	report: The report to add findings to.
+//	username: The entry to check.
+//	corpus: The breach corpus, or nil to skip the breach check.
+//
+// Returns:
+//
+//	An error if the breach check failed.
+func checkPassword(report *Report, username string, corpus *hibp.Corpus) error {
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		report.Unreadable = append(report.Unreadable, UnreadableEntry{Username: username, Error: err.Error()})
+		return nil
+	}
+
+	result := strength.Estimate(password, username)
+	if result.Score < WeakScoreThreshold {
+		report.Weak = append(report.Weak, WeakEntry{
+			Username: username,
+			Score:    result.Score,
+			Label:    result.Label(),
+			Warning:  result.Feedback.Warning,
+		})
+	}
+
+	if corpus != nil {
+		count, err := corpus.Count(password)
+		if err != nil {
+			return fmt.Errorf("breach check failed for %q: %w", username, err)
+		}
+		if count > 0 {
+			report.Breached = append(report.Breached, BreachedEntry{Username: username, Count: count})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package bitwarden
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Item types used by Bitwarden.
+const (
+	TypeLogin      = 1
+	TypeSecureNote = 2
+	TypeCard       = 3
+	TypeIdentity   = 4
+	TypeSSHKey     = 5
+)
+
+// Custom field types used by Bitwarden.
+const (
+	FieldText    = 0
+	FieldHidden  = 1
+	FieldBoolean = 2
+	FieldLinked  = 3
+)
+
+// FavoriteTag is the Aegis tag that stands for Bitwarden's favourite flag.
+const FavoriteTag = "favorite"
+
+// ExtraURLField names the custom fields that hold a login's second and
+// later URIs, since an Aegis entry has a single URL.
+const ExtraURLField = "URL"
+
+var (
+	// ErrPasswordRequired is returned when decoding a password-protected export without a password.
+	ErrPasswordRequired = errors.New("the Bitwarden export is password protected")
+	// ErrWrongPassword is returned when the password does not open a password-protected export.
+	ErrWrongPassword = errors.New("wrong password for the Bitwarden export")
+	// ErrAccountEncrypted is returned for exports encrypted with a Bitwarden account key,
+	// which can only be opened by Bitwarden itself.
+	ErrAccountEncrypted = errors.New("the Bitwarden export is encrypted with the account key; export it again as unencrypted or password protected")
+)
+
+// Export is an unencrypted Bitwarden JSON export.
+type Export struct {
+	Encrypted bool     `json:"encrypted"`
+	Folders   []Folder `json:"folders"`
+	Items     []Item   `json:"items"`
+}
+
+// Folder is a Bitwarden folder. Nested folders use "/" in their name.
+type Folder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Item is a vault item: a login, secure note, card, identity or SSH key.
+type Item struct {
+	ID             string      `json:"id"`
+	OrganizationID *string     `json:"organizationId"`
+	FolderID       *string     `json:"folderId"`
+	Type           int         `json:"type"`
+	Reprompt       int         `json:"reprompt"`
+	Name           string      `json:"name"`
+	Notes          string      `json:"notes,omitempty"`
+	Favorite       bool        `json:"favorite"`
+	Fields         []Field     `json:"fields,omitempty"`
+	Login          *Login      `json:"login,omitempty"`
+	SecureNote     *SecureNote `json:"secureNote,omitempty"`
+	CollectionIDs  []string    `json:"collectionIds"`
+	CreationDate   *time.Time  `json:"creationDate,omitempty"`
+	RevisionDate   *time.Time  `json:"revisionDate,omitempty"`
+}
+
+// Field is a custom field of an item.
+type Field struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Type     int    `json:"type"`
+	LinkedID *int   `json:"linkedId"`
+}
+
+// Login holds the login details of a login item.
+type Login struct {
+	URIs     []URI  `json:"uris,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TOTP     string `json:"totp,omitempty"`
+}
+
+// URI is one website of a login item.
+type URI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// SecureNote marks an item as a secure note.
+type SecureNote struct {
+	Type int `json:"type"`
+}
+
+// header holds the fields that tell the kinds of export apart.
+type header struct {
+	Encrypted         bool `json:"encrypted"`
+	PasswordProtected bool `json:"passwordProtected"`
+}
+
+// Decode parses a Bitwarden JSON export, decrypting it first if it is
+// password protected.
+//
+// Args:
+//
+//	raw: The contents of the export file.
+//	password: The export password, or nil if none is known yet.
+//
+// Returns:
+//
+//	The export and ErrPasswordRequired, ErrWrongPassword, ErrAccountEncrypted
+//	or another error if one occurred.
+func Decode(raw []byte, password []byte) (Export, error) {
+	var h header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return Export{}, fmt.Errorf("not a Bitwarden JSON export: %w", err)
+	}
+
+	if h.Encrypted {
+		if !h.PasswordProtected {
+			return Export{}, ErrAccountEncrypted
+		}
+		if password == nil {
+			return Export{}, ErrPasswordRequired
+		}
+
+		var encrypted encryptedExport
+		if err := json.Unmarshal(raw, &encrypted); err != nil {
+			return Export{}, fmt.Errorf("not a Bitwarden JSON export: %w", err)
+		}
+
+		var err error
+		raw, err = encrypted.open(password)
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	var export Export
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return Export{}, fmt.Errorf("not a Bitwarden JSON export: %w", err)
+	}
+
+	return export, nil
+}
+
+// Encode writes an export as Bitwarden JSON. With a password the export is
+// password protected, so Bitwarden asks for that password on import.
+//
+// Args:
+//
+//	export: The export to write.
+//	password: The export password, or nil for a plaintext export.
+//
+// Returns:
+//
+//	The file contents and an error if one occurred.
+func Encode(export Export, password []byte) ([]byte, error) {
+	export.Encrypted = false
+	raw, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if password == nil {
+		return raw, nil
+	}
+
+	encrypted, err := sealExport(raw, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(encrypted, "", "  ")
+}
+
+// NewID returns a random version 4 UUID, the form Bitwarden uses for ids.
+//
+// Returns:
+//
+//	The id and an error if the random source failed.
+func NewID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	raw[6] = raw[6]&0x0f | 0x40
+	raw[8] = raw[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:16]), nil
+}
@@ -0,0 +1,278 @@
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Key derivation functions used by password-protected exports.
+const (
+	kdfPBKDF2   = 0
+	kdfArgon2id = 1
+)
+
+// exportIterations is the PBKDF2 iteration count for new exports, the same
+// as Bitwarden's default.
+const exportIterations = 600000
+
+// Upper bounds on the KDF settings read from a file, so a crafted export
+// cannot make the import run for hours or exhaust memory.
+const (
+	maxIterations    = 10000000
+	maxArgon2MiB     = 1024
+	maxArgon2Threads = 16
+	maxArgon2Passes  = 100
+)
+
+// encTypeAESCBCHMAC is the "2." encrypted string type: AES-256-CBC with an
+// HMAC-SHA256 over the IV and ciphertext.
+const encTypeAESCBCHMAC = "2"
+
+// encryptedExport is a password-protected Bitwarden JSON export.
+type encryptedExport struct {
+	Encrypted         bool   `json:"encrypted"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	Salt              string `json:"salt"`
+	KdfType           int    `json:"kdfType"`
+	KdfIterations     int    `json:"kdfIterations"`
+	KdfMemory         *int   `json:"kdfMemory"`
+	KdfParallelism    *int   `json:"kdfParallelism"`
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string `json:"data"`
+}
+
+// symmetricKey is a stretched Bitwarden key: one half encrypts, the other
+// authenticates.
+type symmetricKey struct {
+	enc []byte
+	mac []byte
+}
+
+// open checks the password against the validation string and decrypts the
+// export.
+//
+// Args:
+//
+//	password: The export password.
+//
+// Returns:
+//
+//	The plaintext export JSON and ErrWrongPassword or another error if one occurred.
+func (e encryptedExport) open(password []byte) ([]byte, error) {
+	key, err := e.key(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decryptString(e.EncKeyValidation, key); err != nil {
+		return nil, err
+	}
+
+	return decryptString(e.Data, key)
+}
+
+// key derives the export key from the password with the export's KDF.
+//
+// Args:
+//
+//	password: The export password.
+//
+// Returns:
+//
+//	The key and an error if the KDF settings are not supported.
+func (e encryptedExport) key(password []byte) (symmetricKey, error) {
+	var master []byte
+	var err error
+
+	switch e.KdfType {
+	case kdfPBKDF2:
+		if e.KdfIterations <= 0 || e.KdfIterations > maxIterations {
+			return symmetricKey{}, errors.New("invalid PBKDF2 iteration count")
+		}
+		master, err = pbkdf2.Key(sha256.New, string(password), []byte(e.Salt), e.KdfIterations, 32)
+		if err != nil {
+			return symmetricKey{}, err
+		}
+	case kdfArgon2id:
+		if e.KdfIterations <= 0 || e.KdfIterations > maxArgon2Passes ||
+			e.KdfMemory == nil || *e.KdfMemory <= 0 || *e.KdfMemory > maxArgon2MiB ||
+			e.KdfParallelism == nil || *e.KdfParallelism <= 0 || *e.KdfParallelism > maxArgon2Threads {
+			return symmetricKey{}, errors.New("invalid Argon2id parameters")
+		}
+		salt := sha256.Sum256([]byte(e.Salt))
+		master = argon2.IDKey(password, salt[:], uint32(e.KdfIterations), uint32(*e.KdfMemory)*1024, uint8(*e.KdfParallelism), 32)
+	default:
+		return symmetricKey{}, fmt.Errorf("unsupported key derivation function %d", e.KdfType)
+	}
+
+	return stretchKey(master)
+}
+
+// sealExport encrypts a plaintext export with a password.
+//
+// Args:
+//
+//	plaintext: The unencrypted export JSON.
+//	password: The export password.
+//
+// Returns:
+//
+//	The password-protected export and an error if one occurred.
+func sealExport(plaintext, password []byte) (encryptedExport, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return encryptedExport{}, err
+	}
+
+	export := encryptedExport{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              base64.StdEncoding.EncodeToString(salt),
+		KdfType:           kdfPBKDF2,
+		KdfIterations:     exportIterations,
+	}
+	key, err := export.key(password)
+	if err != nil {
+		return encryptedExport{}, err
+	}
+
+	validation, err := NewID()
+	if err != nil {
+		return encryptedExport{}, err
+	}
+	if export.EncKeyValidation, err = encryptString([]byte(validation), key); err != nil {
+		return encryptedExport{}, err
+	}
+	if export.Data, err = encryptString(plaintext, key); err != nil {
+		return encryptedExport{}, err
+	}
+
+	return export, nil
+}
+
+// stretchKey expands a 32-byte master key into encryption and MAC keys with
+// HKDF, as Bitwarden does.
+//
+// Args:
+//
+//	master: The key derived from the password.
+//
+// Returns:
+//
+//	The stretched key and an error if one occurred.
+func stretchKey(master []byte) (symmetricKey, error) {
+	enc, err := hkdf.Expand(sha256.New, master, "enc", 32)
+	if err != nil {
+		return symmetricKey{}, err
+	}
+	mac, err := hkdf.Expand(sha256.New, master, "mac", 32)
+	if err != nil {
+		return symmetricKey{}, err
+	}
+
+	return symmetricKey{enc: enc, mac: mac}, nil
+}
+
+// encryptString encrypts data as a Bitwarden "2.iv|data|mac" string.
+//
+// Args:
+//
+//	plaintext: The data to encrypt.
+//	key: The key to encrypt with.
+//
+// Returns:
+//
+//	The encrypted string and an error if one occurred.
+func encryptString(plaintext []byte, key symmetricKey) (string, error) {
+	block, err := aes.NewCipher(key.enc)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, key.mac)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+
+	return encTypeAESCBCHMAC + "." + strings.Join([]string{
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(ciphertext),
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}, "|"), nil
+}
+
+// decryptString decrypts a Bitwarden "2.iv|data|mac" string.
+//
+// Args:
+//
+//	encrypted: The encrypted string.
+//	key: The key to decrypt with.
+//
+// Returns:
+//
+//	The plaintext and ErrWrongPassword if the MAC does not match.
+func decryptString(encrypted string, key symmetricKey) ([]byte, error) {
+	encType, rest, ok := strings.Cut(encrypted, ".")
+	if !ok || encType != encTypeAESCBCHMAC {
+		return nil, errors.New("unsupported encrypted string in the Bitwarden export")
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed encrypted string in the Bitwarden export")
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("malformed encrypted string in the Bitwarden export: %w", err)
+		}
+	}
+	iv, ciphertext, sum := decoded[0], decoded[1], decoded[2]
+
+	mac := hmac.New(sha256.New, key.mac)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, ErrWrongPassword
+	}
+
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed encrypted string in the Bitwarden export")
+	}
+
+	block, err := aes.NewCipher(key.enc)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.HasSuffix(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("invalid padding in the Bitwarden export")
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -0,0 +1,134 @@
+// Package config loads and saves Aegis settings stored next to the vault.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds user settings that are not part of the vault itself.
+type Config struct {
+	// HIBPFile is the path to a locally downloaded, sorted Have I Been Pwned
+	// Pwned Passwords file. Breach checks are skipped when it is empty.
+	HIBPFile string `json:"hibp_file,omitempty"`
+
+	// InjectedFiles lists the absolute paths "aegis inject" has written, which
+	// it may overwrite without --force.
+	InjectedFiles []string `json:"injected_files,omitempty"`
+
+	// Backups configures the automatic snapshots of the vault.
+	Backups BackupSettings `json:"backups"`
+}
+
+// BackupSettings configures the automatic snapshots of the vault. Zero
+// values stand for the defaults.
+type BackupSettings struct {
+	// Dir is the directory snapshots are written to; the backups directory
+	// next to the vault when empty.
+	Dir string `json:"dir,omitempty"`
+
+	// Interval is the time between scheduled snapshots, such as "24h"; one
+	// day when empty.
+	Interval string `json:"interval,omitempty"`
+
+	// KeepDaily is how many days keep their newest snapshot; 7 when 0.
+	KeepDaily int `json:"keep_daily,omitempty"`
+
+	// KeepWeekly is how many weeks keep their newest snapshot; 4 when 0.
+	KeepWeekly int `json:"keep_weekly,omitempty"`
+
+	// Disabled turns off the scheduled snapshots and those taken before
+	// migrations and imports.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Dir returns the Aegis configuration directory, creating it if needed.
+//
+// Returns:
+//
+//	The directory path and an error if one occurred.
+func Dir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get user config dir: %w", err)
+	}
+
+	aegisConfigDir := filepath.Join(configDir, "aegis")
+	if err := os.MkdirAll(aegisConfigDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	return aegisConfigDir, nil
+}
+
+// path returns the location of the settings file.
+//
+// Returns:
+//
+//	The settings file path and an error if one occurred.
+func path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// Load reads the settings file. A missing file yields the default settings.
+//
+// Returns:
+//
+//	The settings and an error if one occurred.
+func Load() (Config, error) {
+	var c Config
+
+	p, err := path()
+	if err != nil {
+		return c, err
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid config %s: %w", p, err)
+	}
+
+	return c, nil
+}
+
+// Save writes the settings file, readable only by the current user.
+//
+// Args:
+//
+//	c: The settings to save.
+//
+// Returns:
+//
+//	An error if one occurred.
+func Save(c Config) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return os.Rename(tmp, p)
+}
@@ -4,10 +4,17 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"golang.org/x/crypto/scrypt"
 	"io"
 )
 
+// Sizes of the salt and nonce stored with every encrypted value.
+const (
+	SaltSize  = 16
+	NonceSize = 12
+)
+
 type PasswordEncryption interface {
 	EncryptPassword() ([]byte, []byte, []byte, error)
 	DecryptPassword(ciphertext, nonce, salt []byte) ([]byte, error)
@@ -55,7 +62,7 @@ func deriveKey(password, salt []byte) ([]byte, error) {
 //
 //	The ciphertext, nonce, salt, and an error if one occurred.
 func (p PasswordManager) encrypt() ([]byte, []byte, []byte, error) {
-	salt := make([]byte, 16)
+	salt := make([]byte, SaltSize)
 	if _, err := rand.Read(salt); err != nil {
 		return nil, nil, nil, err
 	}
@@ -111,6 +118,11 @@ func (p PasswordManager) decrypt(ciphertext, nonce, salt []byte) ([]byte, error)
 		return nil, err
 	}
 
+	// Open panics on a nonce of the wrong size, which a damaged import can hold.
+	if len(nonce) != aesGCM.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
 	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,220 @@
+// Package doctor checks that every part of the vault can still be read, so a
+// damaged file or a bad import is found before an entry is needed, and
+// repairs what can be repaired without losing data.
+package doctor
+
+import (
+	"aegis/internal/crypto"
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report is the result of a vault check.
+type Report struct {
+	CheckedOn    time.Time `json:"checked_on"`
+	TotalEntries int       `json:"total_entries"`
+	// Integrity holds the problems SQLite found in the database file.
+	Integrity    []string                   `json:"integrity"`
+	Entries      []EntryProblem             `json:"entries"`
+	OrphanedMeta []string                   `json:"orphaned_meta"`
+	Quarantined  []queries.QuarantinedEntry `json:"quarantined"`
+}
+
+// EntryProblem is an entry that cannot be read in full.
+type EntryProblem struct {
+	RowID    int64    `json:"row_id"`
+	Username string   `json:"username"`
+	Problems []string `json:"problems"`
+}
+
+// RepairOptions chooses the repairs Repair makes.
+type RepairOptions struct {
+	// Quarantine moves the entries with problems to the quarantine table.
+	Quarantine bool
+	// RemoveOrphans deletes the orphaned meta rows.
+	RemoveOrphans bool
+}
+
+// IssueCount returns the number of findings in the report.
+//
+// Returns:
+//
+//	The number of integrity problems, damaged entries and orphaned rows.
+func (r Report) IssueCount() int {
+	return len(r.Integrity) + len(r.Entries) + len(r.OrphanedMeta)
+}
+
+// Run checks the database file with SQLite's integrity check, decrypts the
+// password and extras of every entry, checks their nonce and salt lengths
+// and looks for orphaned meta rows. The vault must be unlocked.
+//
+// Args:
+//
+//	progress: Called after each entry with the number checked and the
+//	  total, or nil.
+//
+// Returns:
+//
+//	The report and an error if the check could not run.
+func Run(progress func(done, total int)) (Report, error) {
+	report := Report{CheckedOn: time.Now().UTC()}
+
+	integrity, err := queries.CheckIntegrity()
+	if err != nil {
+		return Report{}, err
+	}
+	report.Integrity = integrity
+
+	entries, err := queries.FetchStoredEntries()
+	if err != nil {
+		return Report{}, fmt.Errorf("could not read the entries: %w", err)
+	}
+	report.TotalEntries = len(entries)
+
+	for i, entry := range entries {
+		if problems := checkEntry(entry); len(problems) > 0 {
+			report.Entries = append(report.Entries, EntryProblem{RowID: entry.RowID, Username: entry.Username, Problems: problems})
+		}
+		if progress != nil {
+			progress(i+1, len(entries))
+		}
+	}
+
+	if report.OrphanedMeta, err = queries.FindOrphanedMeta(); err != nil {
+		return Report{}, err
+	}
+	if report.Quarantined, err = queries.FetchQuarantine(); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// checkEntry checks that one entry can be read.
+//
+// Args:
+//
+//	entry: The entry as stored.
+//
+// Returns:
+//
+//	The problems found, none if the entry is sound.
+func checkEntry(entry queries.StoredEntry) []string {
+	var problems []string
+	if strings.TrimSpace(entry.Username) == "" {
+		problems = append(problems, "the entry has no name")
+	}
+
+	_, passwordProblems := decrypt("password", entry.PasswordCiphertext, entry.Nonce, entry.Salt)
+	problems = append(problems, passwordProblems...)
+
+	set := 0
+	for _, column := range [][]byte{entry.ExtrasCiphertext, entry.ExtrasNonce, entry.ExtrasSalt} {
+		if column != nil {
+			set++
+		}
+	}
+	switch set {
+	case 0:
+	case 3:
+		plaintext, extrasProblems := decrypt("extras", entry.ExtrasCiphertext, entry.ExtrasNonce, entry.ExtrasSalt)
+		if len(extrasProblems) == 0 {
+			var extras queries.EntryExtras
+			if err := json.Unmarshal(plaintext, &extras); err != nil {
+				extrasProblems = append(extrasProblems, fmt.Sprintf("the extras are not valid JSON: %s", err))
+			}
+		}
+		problems = append(problems, extrasProblems...)
+	default:
+		problems = append(problems, "the extras are incomplete: some of their ciphertext, nonce and salt are missing")
+	}
+
+	return problems
+}
+
+// decrypt checks the lengths of an encrypted value's nonce and salt and, if
+// they are right, decrypts it with the master password.
+//
+// Args:
+//
+//	what: The name of the value in problem descriptions.
+//	cipherText: The encrypted value.
+//	nonce: Its nonce.
+//	salt: Its salt.
+//
+// Returns:
+//
+//	The plaintext, and the problems found, none if the value decrypts.
+func decrypt(what string, cipherText, nonce, salt []byte) ([]byte, []string) {
+	var problems []string
+	if len(nonce) != crypto.NonceSize {
+		problems = append(problems, fmt.Sprintf("the %s nonce is %d bytes instead of %d", what, len(nonce), crypto.NonceSize))
+	}
+	if len(salt) != crypto.SaltSize {
+		problems = append(problems, fmt.Sprintf("the %s salt is %d bytes instead of %d", what, len(salt), crypto.SaltSize))
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	plaintext, err := queries.DecryptWithMasterPass(cipherText, nonce, salt)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("the %s does not decrypt with the master password", what)}
+	}
+	return plaintext, nil
+}
+
+// Repair makes the chosen repairs for the problems in a report, in one
+// transaction, after taking a snapshot of the vault. Problems in the
+// database file itself cannot be repaired here; restoring a snapshot is the
+// way out of those.
+//
+// Args:
+//
+//	report: The report of Run.
+//	options: The repairs to make.
+//
+// Returns:
+//
+//	The number of entries quarantined and of meta rows removed, and an
+//	error if one occurred.
+func Repair(report Report, options RepairOptions) (int, int, error) {
+	quarantine := options.Quarantine && len(report.Entries) > 0
+	removeOrphans := options.RemoveOrphans && len(report.OrphanedMeta) > 0
+	if !quarantine && !removeOrphans {
+		return 0, 0, nil
+	}
+
+	if err := snapshot.TakeBefore(queries.DB, snapshot.ReasonRepair); err != nil {
+		return 0, 0, fmt.Errorf("could not back up the vault before repairing it: %w", err)
+	}
+
+	quarantined, removed := 0, 0
+	err := queries.WithTransaction(func(tx *queries.Tx) error {
+		if quarantine {
+			for _, entry := range report.Entries {
+				if err := tx.QuarantineEntry(entry.RowID, strings.Join(entry.Problems, "; ")); err != nil {
+					return fmt.Errorf("could not quarantine %q: %w", entry.Username, err)
+				}
+				quarantined++
+			}
+		}
+		if removeOrphans {
+			if err := tx.DeleteMeta(report.OrphanedMeta); err != nil {
+				return err
+			}
+			removed = len(report.OrphanedMeta)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return quarantined, removed, nil
+}
@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Character sets used to build passwords.
+const (
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz"
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars  = "0123456789"
+	symbolChars = "!@#$%^&*()-_=+[]{};:,.<>/?~"
+
+	// ambiguousChars are characters that are easily confused when read aloud or copied by hand.
+	ambiguousChars = "Il1O0o|`'\";:,."
+)
+
+// DefaultLength is the length of generated passwords when none is given.
+const DefaultLength = 20
+
+// Options controls which characters a generated password may contain.
+type Options struct {
+	Length           int
+	Lower            bool
+	Upper            bool
+	Digits           bool
+	Symbols          bool
+	ExcludeAmbiguous bool
+}
+
+// DefaultOptions returns options for a password using every character class.
+//
+// Returns:
+//
+//	The default generator options.
+func DefaultOptions() Options {
+	return Options{
+		Length:  DefaultLength,
+		Lower:   true,
+		Upper:   true,
+		Digits:  true,
+		Symbols: true,
+	}
+}
+
+// Password generates a random password from a cryptographically secure source.
+// Every enabled character class appears at least once.
+//
+// Args:
+//
+//	opts: The generator options.
+//
+// Returns:
+//
+//	The generated password and an error if the options are invalid or the
+//	random source failed.
+func Password(opts Options) (string, error) {
+	var classes []string
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{opts.Lower, lowerChars},
+		{opts.Upper, upperChars},
+		{opts.Digits, digitChars},
+		{opts.Symbols, symbolChars},
+	} {
+		if !class.enabled {
+			continue
+		}
+
+		chars := class.chars
+		if opts.ExcludeAmbiguous {
+			chars = removeChars(chars, ambiguousChars)
+		}
+		classes = append(classes, chars)
+	}
+
+	if len(classes) == 0 {
+		return "", errors.New("at least one character class must be enabled")
+	}
+	if opts.Length < len(classes) {
+		return "", errors.New("length is too short to include every character class")
+	}
+
+	alphabet := strings.Join(classes, "")
+	password := make([]byte, opts.Length)
+
+	for i, chars := range classes {
+		c, err := randomChar(chars)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+	for i := len(classes); i < opts.Length; i++ {
+		c, err := randomChar(alphabet)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	if err := shuffle(password); err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+// randomChar picks a uniformly random character from chars.
+//
+// Args:
+//
+//	chars: The characters to choose from.
+//
+// Returns:
+//
+//	The chosen character and an error if the random source failed.
+func randomChar(chars string) (byte, error) {
+	n, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n], nil
+}
+
+// randomInt returns a uniformly random integer in [0, max).
+//
+// Args:
+//
+//	max: The exclusive upper bound.
+//
+// Returns:
+//
+//	The random integer and an error if the random source failed.
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+// shuffle randomly permutes b in place with a Fisher-Yates shuffle.
+//
+// Args:
+//
+//	b: The bytes to shuffle.
+//
+// Returns:
+//
+//	An error if the random source failed.
+func shuffle(b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return err
+		}
+		b[i], b[j] = b[j], b[i]
+	}
+	return nil
+}
+
+// removeChars returns s without any of the characters in remove.
+//
+// Args:
+//
+//	s: The string to filter.
+//	remove: The characters to drop.
+//
+// Returns:
+//
+//	The filtered string.
+func removeChars(s, remove string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(remove, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
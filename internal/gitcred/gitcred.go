@@ -0,0 +1,225 @@
+package gitcred
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Tag marks the vault entries the credential helper stored. Only those are
+// given to Git or erased, so a website login for the same host is never
+// touched.
+const Tag = "git-credential"
+
+// Credential holds the attributes Git sends to and reads from a credential
+// helper. Attributes Aegis does not use, such as wwwauth[], are dropped.
+type Credential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Target is the normalised location an entry's URL points at. An empty
+// Protocol or Path matches any protocol or path.
+type Target struct {
+	Protocol string
+	Host     string
+	Path     string
+}
+
+// Read parses a credential description: "key=value" lines ending with a
+// blank line or the end of input. A url attribute is split into its parts.
+//
+// Args:
+//
+//	r: The reader Git writes the description to.
+//
+// Returns:
+//
+//	The credential and an error if a line could not be parsed.
+func Read(r io.Reader) (Credential, error) {
+	var c Credential
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return Credential{}, fmt.Errorf("invalid credential line %q", line)
+		}
+
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		case "url":
+			target, err := ParseURL(value)
+			if err != nil {
+				return Credential{}, err
+			}
+			c.Protocol, c.Host, c.Path = target.Protocol, target.Host, target.Path
+		}
+	}
+
+	return c, scanner.Err()
+}
+
+// Write sends a username and password back to Git. Empty values are left out.
+//
+// Args:
+//
+//	w: The writer Git reads the answer from.
+//	c: The credential to send.
+//
+// Returns:
+//
+//	An error if a value contains a newline or writing failed.
+func Write(w io.Writer, c Credential) error {
+	if strings.ContainsAny(c.Username+c.Password, "\n\x00") {
+		return errors.New("credential contains a newline or NUL byte and cannot be passed to Git")
+	}
+
+	if c.Username != "" {
+		if _, err := fmt.Fprintf(w, "username=%s\n", c.Username); err != nil {
+			return err
+		}
+	}
+	if c.Password != "" {
+		if _, err := fmt.Fprintf(w, "password=%s\n", c.Password); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// URL returns the location a credential is for, such as
+// "https://github.com/org/repo.git".
+//
+// Returns:
+//
+//	The URL.
+func (c Credential) URL() string {
+	u := c.Protocol + "://" + c.Host
+	if c.Path != "" {
+		u += "/" + strings.TrimPrefix(c.Path, "/")
+	}
+	return u
+}
+
+// ParseURL normalises an entry URL. A URL without a scheme, such as
+// "github.com/org", matches every protocol.
+//
+// Args:
+//
+//	raw: The URL to parse.
+//
+// Returns:
+//
+//	The target and an error if the URL has no host or cannot be parsed.
+func ParseURL(raw string) (Target, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Target{}, err
+	}
+	if u.Host == "" {
+		return Target{}, fmt.Errorf("URL %q has no host", raw)
+	}
+
+	return Target{
+		Protocol: strings.ToLower(u.Scheme),
+		Host:     strings.ToLower(u.Host),
+		Path:     normalisePath(u.Path),
+	}, nil
+}
+
+// Match reports whether an entry's target applies to a credential request
+// and how specific the match is. The host must be equal; a protocol or path
+// on the target must agree with the request, where a target path also covers
+// the repositories below it.
+//
+// Args:
+//
+//	t: The target of the entry.
+//	c: The credential Git asked about.
+//
+// Returns:
+//
+//	A score that is higher for more specific targets, and whether they match.
+func (t Target) Match(c Credential) (int, bool) {
+	if t.Host != strings.ToLower(c.Host) {
+		return 0, false
+	}
+
+	score := 1
+	if t.Protocol != "" {
+		if t.Protocol != strings.ToLower(c.Protocol) {
+			return 0, false
+		}
+		score++
+	}
+
+	if t.Path != "" {
+		path := normalisePath(c.Path)
+		if path != t.Path && !strings.HasPrefix(path, t.Path+"/") {
+			return 0, false
+		}
+		score += 10 * (strings.Count(t.Path, "/") + 1)
+	}
+
+	return score, true
+}
+
+// Exact reports whether an entry's target is the location of a credential
+// request itself, with the same protocol, host and path, rather than one
+// that covers it.
+//
+// Args:
+//
+//	t: The target of the entry.
+//	c: The credential Git sent.
+//
+// Returns:
+//
+//	True if the locations are the same.
+func (t Target) Exact(c Credential) bool {
+	return t.Protocol == strings.ToLower(c.Protocol) &&
+		t.Host == strings.ToLower(c.Host) &&
+		t.Path == normalisePath(c.Path)
+}
+
+// normalisePath strips the slashes and ".git" suffix that differ between
+// clone URLs of the same repository.
+//
+// Args:
+//
+//	path: The path part of a URL.
+//
+// Returns:
+//
+//	The normalised path.
+func normalisePath(path string) string {
+	path = strings.Trim(path, "/")
+	return strings.TrimSuffix(path, ".git")
+}
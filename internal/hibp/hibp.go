@@ -0,0 +1,330 @@
+// Package hibp checks passwords against a locally downloaded copy of the
+// Have I Been Pwned Pwned Passwords corpus.
+//
+// The corpus is a text file with one "HASH:COUNT" line per password, sorted
+// by hash, as produced by the official downloader. Both the SHA-1 and the
+// NTLM editions are supported. Lookups binary-search the file on disk, so
+// nothing is loaded into memory and no hash ever leaves the machine.
+package hibp
+
+import (
+	"aegis/internal/config"
+
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	// MD4 is broken, but it is what NTLM hashes are made of.
+	"golang.org/x/crypto/md4"
+)
+
+// HashType identifies which edition of the corpus a file contains.
+type HashType int
+
+const (
+	SHA1 HashType = iota
+	NTLM
+)
+
+// String returns the name of the hash type.
+//
+// Returns:
+//
+//	"SHA-1" or "NTLM".
+func (h HashType) String() string {
+	if h == NTLM {
+		return "NTLM"
+	}
+	return "SHA-1"
+}
+
+// maxLineLength bounds a single "HASH:COUNT" line; real lines are under 60 bytes.
+const maxLineLength = 128
+
+// Corpus is an open Pwned Passwords file.
+type Corpus struct {
+	file     *os.File
+	size     int64
+	hashType HashType
+}
+
+// Open opens a Pwned Passwords file and detects its hash type from the
+// first line.
+//
+// Args:
+//
+//	path: The path to the sorted corpus file.
+//
+// Returns:
+//
+//	The opened corpus and an error if one occurred.
+func Open(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open breach corpus: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	c := &Corpus{file: file, size: info.Size()}
+
+	first, err := c.readLine(0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read breach corpus: %w", err)
+	}
+
+	hash, _, err := parseLine(first)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	switch len(hash) {
+	case 2 * sha1.Size:
+		c.hashType = SHA1
+	case 2 * md4.Size:
+		c.hashType = NTLM
+	default:
+		file.Close()
+		return nil, fmt.Errorf("unrecognised hash length %d in breach corpus", len(hash))
+	}
+
+	return c, nil
+}
+
+// OpenConfigured opens the corpus file chosen in the Aegis settings.
+//
+// Returns:
+//
+//	The opened corpus, or nil if no corpus is configured, and an error if
+//	one occurred.
+func OpenConfigured() (*Corpus, error) {
+	c, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	if c.HIBPFile == "" {
+		return nil, nil
+	}
+
+	return Open(c.HIBPFile)
+}
+
+// HashType returns the hash type of the corpus.
+//
+// Returns:
+//
+//	The detected hash type.
+func (c *Corpus) HashType() HashType {
+	return c.hashType
+}
+
+// Close closes the corpus file.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (c *Corpus) Close() error {
+	return c.file.Close()
+}
+
+// Count looks a password up in the corpus.
+//
+// Args:
+//
+//	password: The plaintext password to check.
+//
+// Returns:
+//
+//	How many times the password appears in known breaches (0 when it was not
+//	found) and an error if one occurred.
+func (c *Corpus) Count(password string) (int, error) {
+	var hash string
+	if c.hashType == NTLM {
+		hash = NTLMHash(password)
+	} else {
+		hash = SHA1Hash(password)
+	}
+
+	return c.lookup([]byte(hash))
+}
+
+// lookup binary-searches the corpus for a hash.
+//
+// Args:
+//
+//	target: The upper case hex hash to search for.
+//
+// Returns:
+//
+//	The breach count for the hash, 0 if absent, and an error if one occurred.
+func (c *Corpus) lookup(target []byte) (int, error) {
+	// Invariant: lo is the start of a line and, if the target is present, its
+	// line starts somewhere in [lo, hi).
+	lo, hi := int64(0), c.size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := c.lineStartAtOrAfter(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, err := c.readLine(start)
+		if err != nil {
+			return 0, err
+		}
+
+		hash, count, err := parseLine(line)
+		if err != nil {
+			return 0, err
+		}
+
+		switch cmp := bytes.Compare(bytes.ToUpper(hash), target); {
+		case cmp == 0:
+			return count, nil
+		case cmp < 0:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return 0, nil
+}
+
+// lineStartAtOrAfter finds the first line that starts at or after pos.
+//
+// Args:
+//
+//	pos: The byte offset to search from.
+//
+// Returns:
+//
+//	The offset of the line start, or the file size if there is none, and an
+//	error if one occurred.
+func (c *Corpus) lineStartAtOrAfter(pos int64) (int64, error) {
+	if pos == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, maxLineLength)
+	for offset := pos - 1; offset < c.size; offset += int64(len(buf)) {
+		n, err := c.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return c.size, nil
+}
+
+// readLine reads the line starting at offset, without its line ending.
+//
+// Args:
+//
+//	offset: The byte offset of the line start.
+//
+// Returns:
+//
+//	The line contents and an error if one occurred.
+func (c *Corpus) readLine(offset int64) ([]byte, error) {
+	buf := make([]byte, maxLineLength)
+	n, err := c.file.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	} else if n == maxLineLength {
+		return nil, fmt.Errorf("line at offset %d is too long", offset)
+	}
+
+	return bytes.TrimSuffix(buf, []byte{'\r'}), nil
+}
+
+// parseLine splits a "HASH:COUNT" line.
+//
+// Args:
+//
+//	line: The line to parse.
+//
+// Returns:
+//
+//	The hash, the breach count and an error if the line is malformed.
+func parseLine(line []byte) ([]byte, int, error) {
+	hash, countStr, ok := bytes.Cut(line, []byte{':'})
+	if !ok {
+		return nil, 0, fmt.Errorf("malformed breach corpus line %q", line)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(countStr)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed breach count in line %q", line)
+	}
+
+	return hash, count, nil
+}
+
+// SHA1Hash returns the upper case hex SHA-1 of a password, as used by the
+// SHA-1 edition of the corpus.
+//
+// Args:
+//
+//	password: The plaintext password.
+//
+// Returns:
+//
+//	The hex encoded hash.
+func SHA1Hash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// NTLMHash returns the upper case hex NTLM hash of a password (MD4 over the
+// UTF-16LE encoding), as used by the NTLM edition of the corpus.
+//
+// Args:
+//
+//	password: The plaintext password.
+//
+// Returns:
+//
+//	The hex encoded hash.
+func NTLMHash(password string) string {
+	units := utf16.Encode([]rune(password))
+	encoded := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(encoded[2*i:], u)
+	}
+
+	h := md4.New()
+	h.Write(encoded)
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
@@ -0,0 +1,473 @@
+package kdbx
+
+import (
+	"aegis/internal/kdbx/argon2d"
+
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/twofish"
+)
+
+// File signature and the version written by Write, 4.0.
+const (
+	signature1   = 0x9AA2D903
+	signature2   = 0xB54BFB67
+	majorVersion = 4
+	fileVersion  = majorVersion << 16
+)
+
+// Outer header field ids.
+const (
+	headerEnd           = 0
+	headerCipherID      = 2
+	headerCompression   = 3
+	headerMasterSeed    = 4
+	headerEncryptionIV  = 7
+	headerKDFParameters = 11
+)
+
+// Cipher and key derivation function UUIDs, in hex.
+const (
+	cipherAES256   = "31c1f2e6bf714350be5805216afc5aff"
+	cipherChaCha20 = "d6038a2b8b6f4cb5a524339a31dbb59a"
+	cipherTwofish  = "ad68f29f576f4bb9a36ad47af965346c"
+	kdfAES         = "c9d9f39a628a4460bf740d08c18a4fea"
+	kdfArgon2d     = "ef636ddf8c29444b91f7a9a403e30a0c"
+	kdfArgon2id    = "9e298b1956db4773b23dfc3ec6f0a1e6"
+)
+
+// Argon2d settings for new databases: KeePass's defaults of 64 MiB, two
+// lanes and enough passes to take about a second.
+const (
+	newArgon2Memory = 64 << 20
+	newArgon2Passes = 10
+	newArgon2Lanes  = 2
+)
+
+// Upper bounds on the KDF settings read from a file, so a crafted database
+// cannot make the import run for hours or exhaust memory.
+const (
+	maxAESRounds    = 1000000000
+	maxArgon2Memory = 2 << 30
+	maxArgon2Passes = 1000
+)
+
+// Types of the values in a variant dictionary.
+const (
+	variantUInt32    = 0x04
+	variantUInt64    = 0x05
+	variantBool      = 0x08
+	variantInt32     = 0x0C
+	variantInt64     = 0x0D
+	variantString    = 0x18
+	variantByteArray = 0x42
+)
+
+// variantDictVersion is the only supported variant dictionary format.
+const variantDictVersion = 0x0100
+
+// header is the unencrypted outer header of a KDBX 4 file.
+type header struct {
+	cipherID   string
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDict
+	raw        []byte
+}
+
+// variant is one typed value of a variant dictionary, kept little-endian.
+type variant struct {
+	kind  byte
+	value []byte
+}
+
+// variantDict is the typed key-value map KDBX 4 uses for KDF parameters.
+type variantDict struct {
+	keys   []string
+	values map[string]variant
+}
+
+// parseHeader reads the outer header at the start of a file.
+//
+// Args:
+//
+//	data: The whole file.
+//
+// Returns:
+//
+//	The header, the data following it and ErrNotKDBX, ErrCorrupt or another
+//	error if one occurred.
+func parseHeader(data []byte) (*header, []byte, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data[0:4]) != signature1 || binary.LittleEndian.Uint32(data[4:8]) != signature2 {
+		return nil, nil, ErrNotKDBX
+	}
+	if version := binary.LittleEndian.Uint32(data[8:12]); version>>16 != majorVersion {
+		return nil, nil, fmt.Errorf("unsupported KeePass database version %d.%d; only KDBX 4 can be read", version>>16, version&0xFFFF)
+	}
+
+	h := &header{}
+	pos := 12
+	for {
+		if len(data)-pos < 5 {
+			return nil, nil, ErrCorrupt
+		}
+		id := data[pos]
+		size := int(binary.LittleEndian.Uint32(data[pos+1 : pos+5]))
+		pos += 5
+		if size < 0 || size > len(data)-pos {
+			return nil, nil, ErrCorrupt
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch id {
+		case headerEnd:
+			h.raw = data[:pos]
+			if h.cipherID == "" || len(h.masterSeed) != 32 || h.kdf.values == nil {
+				return nil, nil, ErrCorrupt
+			}
+			return h, data[pos:], nil
+		case headerCipherID:
+			h.cipherID = hex.EncodeToString(value)
+		case headerCompression:
+			h.compressed = len(value) == 4 && binary.LittleEndian.Uint32(value) == 1
+		case headerMasterSeed:
+			h.masterSeed = value
+		case headerEncryptionIV:
+			h.iv = value
+		case headerKDFParameters:
+			kdf, err := parseVariantDict(value)
+			if err != nil {
+				return nil, nil, err
+			}
+			h.kdf = kdf
+		}
+	}
+}
+
+// newHeader creates the header of a new database with fresh random seeds.
+//
+// Returns:
+//
+//	The header, encoded in raw, and an error if the random source failed.
+func newHeader() (*header, error) {
+	h := &header{cipherID: cipherAES256, compressed: true, masterSeed: make([]byte, 32), iv: make([]byte, aes.BlockSize)}
+	salt := make([]byte, 32)
+	for _, b := range [][]byte{h.masterSeed, h.iv, salt} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+
+	uuid, _ := hex.DecodeString(kdfArgon2d)
+	h.kdf.set("$UUID", variantByteArray, uuid)
+	h.kdf.set("S", variantByteArray, salt)
+	h.kdf.set("P", variantUInt32, binary.LittleEndian.AppendUint32(nil, newArgon2Lanes))
+	h.kdf.set("M", variantUInt64, binary.LittleEndian.AppendUint64(nil, newArgon2Memory))
+	h.kdf.set("I", variantUInt64, binary.LittleEndian.AppendUint64(nil, newArgon2Passes))
+	h.kdf.set("V", variantUInt32, binary.LittleEndian.AppendUint32(nil, argon2d.Version))
+
+	cipherID, _ := hex.DecodeString(h.cipherID)
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, []uint32{signature1, signature2, fileVersion})
+	writeHeaderField(&raw, headerCipherID, cipherID)
+	writeHeaderField(&raw, headerCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	writeHeaderField(&raw, headerMasterSeed, h.masterSeed)
+	writeHeaderField(&raw, headerEncryptionIV, h.iv)
+	writeHeaderField(&raw, headerKDFParameters, h.kdf.encode())
+	writeHeaderField(&raw, headerEnd, []byte("\r\n\r\n"))
+	h.raw = raw.Bytes()
+
+	return h, nil
+}
+
+// writeHeaderField appends one outer header field.
+//
+// Args:
+//
+//	buf: The buffer to append to.
+//	id: The field id.
+//	value: The field value.
+func writeHeaderField(buf *bytes.Buffer, id byte, value []byte) {
+	buf.WriteByte(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+// parseVariantDict decodes a variant dictionary.
+//
+// Args:
+//
+//	data: The encoded dictionary.
+//
+// Returns:
+//
+//	The dictionary and ErrCorrupt if it is malformed.
+func parseVariantDict(data []byte) (variantDict, error) {
+	if len(data) < 2 || binary.LittleEndian.Uint16(data)&0xFF00 != variantDictVersion&0xFF00 {
+		return variantDict{}, ErrCorrupt
+	}
+
+	var dict variantDict
+	pos := 2
+	for {
+		if pos >= len(data) {
+			return variantDict{}, ErrCorrupt
+		}
+		kind := data[pos]
+		pos++
+		if kind == 0 {
+			if dict.values == nil {
+				dict.values = map[string]variant{}
+			}
+			return dict, nil
+		}
+
+		var fields [2][]byte
+		for i := range fields {
+			if len(data)-pos < 4 {
+				return variantDict{}, ErrCorrupt
+			}
+			size := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if size < 0 || size > len(data)-pos {
+				return variantDict{}, ErrCorrupt
+			}
+			fields[i] = data[pos : pos+size]
+			pos += size
+		}
+		dict.set(string(fields[0]), kind, fields[1])
+	}
+}
+
+// set adds or replaces a value.
+//
+// Args:
+//
+//	key: The key.
+//	kind: The value type, one of the variant constants.
+//	value: The little-endian value.
+func (d *variantDict) set(key string, kind byte, value []byte) {
+	if d.values == nil {
+		d.values = map[string]variant{}
+	}
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = variant{kind: kind, value: value}
+}
+
+// bytes returns a byte array value.
+//
+// Args:
+//
+//	key: The key.
+//
+// Returns:
+//
+//	The value, or nil if it is missing.
+func (d variantDict) bytes(key string) []byte {
+	return d.values[key].value
+}
+
+// uint returns an unsigned integer value of either width.
+//
+// Args:
+//
+//	key: The key.
+//
+// Returns:
+//
+//	The value and false if it is missing or not an integer.
+func (d variantDict) uint(key string) (uint64, bool) {
+	switch v := d.values[key]; {
+	case v.kind == variantUInt32 && len(v.value) == 4:
+		return uint64(binary.LittleEndian.Uint32(v.value)), true
+	case v.kind == variantUInt64 && len(v.value) == 8:
+		return binary.LittleEndian.Uint64(v.value), true
+	}
+	return 0, false
+}
+
+// encode serializes the dictionary.
+//
+// Returns:
+//
+//	The encoded dictionary.
+func (d variantDict) encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(variantDictVersion))
+	for _, key := range d.keys {
+		v := d.values[key]
+		buf.WriteByte(v.kind)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(key)))
+		buf.WriteString(key)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(v.value)))
+		buf.Write(v.value)
+	}
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+// transformKey stretches the composite key with the database's key
+// derivation function: AES-KDF, Argon2d or Argon2id.
+//
+// Args:
+//
+//	composite: The composite key.
+//	kdf: The KDF parameters from the header.
+//
+// Returns:
+//
+//	The 32-byte transformed key and an error if the parameters are invalid
+//	or not supported.
+func transformKey(composite []byte, kdf variantDict) ([]byte, error) {
+	switch uuid := hex.EncodeToString(kdf.bytes("$UUID")); uuid {
+	case kdfAES:
+		seed := kdf.bytes("S")
+		rounds, ok := kdf.uint("R")
+		if len(seed) != 32 || !ok || rounds > maxAESRounds {
+			return nil, errors.New("invalid AES-KDF parameters")
+		}
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, err
+		}
+		key := bytes.Clone(composite)
+		for range rounds {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+
+	case kdfArgon2d, kdfArgon2id:
+		salt := kdf.bytes("S")
+		lanes, okLanes := kdf.uint("P")
+		memory, okMemory := kdf.uint("M")
+		passes, okPasses := kdf.uint("I")
+		version, okVersion := kdf.uint("V")
+		if len(salt) < 8 || !okLanes || !okMemory || !okPasses || !okVersion ||
+			lanes < 1 || lanes > 255 || memory < 8*1024*lanes || memory > maxArgon2Memory || passes < 1 || passes > maxArgon2Passes {
+			return nil, errors.New("invalid Argon2 parameters")
+		}
+		if version != argon2d.Version || len(kdf.bytes("K")) > 0 || len(kdf.bytes("A")) > 0 {
+			return nil, errors.New("unsupported Argon2 parameters; only version 1.3 without a secret key is supported")
+		}
+		if uuid == kdfArgon2d {
+			return argon2d.Key(composite, salt, uint32(passes), uint32(memory/1024), uint8(lanes), 32), nil
+		}
+		return argon2.IDKey(composite, salt, uint32(passes), uint32(memory/1024), uint8(lanes), 32), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %s", uuid)
+	}
+}
+
+// decryptPayload decrypts the payload with the database's cipher.
+//
+// Args:
+//
+//	cipherID: The cipher UUID in hex.
+//	key: The 32-byte master key.
+//	iv: The encryption IV from the header.
+//	data: The encrypted payload.
+//
+// Returns:
+//
+//	The plaintext and ErrCorrupt or another error if one occurred.
+func decryptPayload(cipherID string, key, iv, data []byte) ([]byte, error) {
+	if cipherID == cipherChaCha20 {
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		plaintext := make([]byte, len(data))
+		stream.XORKeyStream(plaintext, data)
+		return plaintext, nil
+	}
+
+	block, err := newBlockCipher(cipherID, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrCorrupt
+	}
+
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.HasSuffix(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrCorrupt
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// encryptPayload encrypts the payload with the database's cipher.
+//
+// Args:
+//
+//	cipherID: The cipher UUID in hex.
+//	key: The 32-byte master key.
+//	iv: The encryption IV from the header.
+//	data: The plaintext payload.
+//
+// Returns:
+//
+//	The ciphertext and an error if one occurred.
+func encryptPayload(cipherID string, key, iv, data []byte) ([]byte, error) {
+	if cipherID == cipherChaCha20 {
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext := make([]byte, len(data))
+		stream.XORKeyStream(ciphertext, data)
+		return ciphertext, nil
+	}
+
+	block, err := newBlockCipher(cipherID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	padded := append(bytes.Clone(data), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return ciphertext, nil
+}
+
+// newBlockCipher creates the block cipher of a CBC-mode database cipher.
+//
+// Args:
+//
+//	cipherID: The cipher UUID in hex.
+//	key: The 32-byte master key.
+//
+// Returns:
+//
+//	The block cipher and an error if the cipher is not supported.
+func newBlockCipher(cipherID string, key []byte) (cipher.Block, error) {
+	switch cipherID {
+	case cipherAES256:
+		return aes.NewCipher(key)
+	case cipherTwofish:
+		return twofish.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", cipherID)
+	}
+}
@@ -0,0 +1,298 @@
+// Package kdbx reads and writes KeePass KDBX 4 databases, the format used by
+// KeePass 2 and KeePassXC.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Names of the standard string fields of an entry. KeePassXC keeps the TOTP
+// settings in the "otp" field as an otpauth:// URI, and additional URLs in
+// fields named KP2A_URL, KP2A_URL_1 and so on.
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+	FieldOTP      = "otp"
+	FieldExtraURL = "KP2A_URL"
+)
+
+var (
+	// ErrNotKDBX is returned when the data is not a KeePass database.
+	ErrNotKDBX = errors.New("not a KeePass database")
+	// ErrWrongKey is returned when the master password or key file does not open the database.
+	ErrWrongKey = errors.New("wrong master password or key file for the KeePass database")
+	// ErrCorrupt is returned when the database fails an integrity check.
+	ErrCorrupt = errors.New("the KeePass database is corrupt")
+	// ErrNoKey is returned when neither a master password nor a key file is given.
+	ErrNoKey = errors.New("a master password or key file is required")
+)
+
+// Key is the composite master key of a database: a password, a key file or both.
+type Key struct {
+	Password []byte
+	KeyFile  []byte
+}
+
+// Database is the content of a KDBX file.
+type Database struct {
+	Name string
+	Root *Group
+}
+
+// Group is a folder of entries and further groups.
+type Group struct {
+	Name    string
+	Groups  []*Group
+	Entries []*Entry
+}
+
+// Entry is one record of a database.
+type Entry struct {
+	Fields               []Field
+	Tags                 []string
+	Attachments          []Attachment
+	History              []*Entry
+	CreationTime         time.Time
+	LastModificationTime time.Time
+}
+
+// Field is a string field of an entry. Protected fields are hidden by
+// KeePass and encrypted again inside the file.
+type Field struct {
+	Name      string
+	Value     string
+	Protected bool
+}
+
+// Attachment is a file attached to an entry.
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Get returns the value of a string field.
+//
+// Args:
+//
+//	name: The field name, such as FieldPassword.
+//
+// Returns:
+//
+//	The value, or "" if the entry has no such field.
+func (e *Entry) Get(name string) string {
+	for _, field := range e.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Read decrypts and parses a KDBX 4 database. The recycle bin is left out.
+//
+// Args:
+//
+//	r: The reader holding the database file.
+//	key: The master password and key file of the database.
+//
+// Returns:
+//
+//	The database and ErrNotKDBX, ErrWrongKey, ErrCorrupt or another error if
+//	one occurred.
+func Read(r io.Reader, key Key) (*Database, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h, rest, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < 2*sha256.Size {
+		return nil, ErrCorrupt
+	}
+	if sum := sha256.Sum256(h.raw); !hmac.Equal(sum[:], rest[:sha256.Size]) {
+		return nil, ErrCorrupt
+	}
+
+	masterKey, hmacKey, err := h.deriveKeys(key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(blockHMAC(hmacKey, headerBlockIndex, h.raw), rest[sha256.Size:2*sha256.Size]) {
+		return nil, ErrWrongKey
+	}
+
+	payload, err := readBlocks(rest[2*sha256.Size:], hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	payload, err = decryptPayload(h.cipherID, masterKey, h.iv, payload)
+	if err != nil {
+		return nil, err
+	}
+	if h.compressed {
+		gz, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if payload, err = io.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	}
+
+	inner, document, err := parseInnerHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newInnerStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return nil, err
+	}
+	if document, err = transformProtected(document, stream, true); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	var file xmlFile
+	if err := xml.Unmarshal(document, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return file.database(inner.binaries)
+}
+
+// Write encrypts a database as KDBX 4 with AES-256 and Argon2d, the
+// defaults of KeePassXC, and protects its hidden fields with ChaCha20.
+//
+// Args:
+//
+//	w: The writer to write the database file to.
+//	db: The database to write.
+//	key: The master password and key file to protect it with.
+//
+// Returns:
+//
+//	ErrNoKey or another error if one occurred.
+func Write(w io.Writer, db *Database, key Key) error {
+	h, err := newHeader()
+	if err != nil {
+		return err
+	}
+	masterKey, hmacKey, err := h.deriveKeys(key)
+	if err != nil {
+		return err
+	}
+
+	inner := innerHeader{streamID: innerStreamChaCha20, streamKey: make([]byte, 64)}
+	if _, err := rand.Read(inner.streamKey); err != nil {
+		return err
+	}
+
+	file, binaries, err := newXMLFile(db)
+	if err != nil {
+		return err
+	}
+	inner.binaries = binaries
+
+	document, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	stream, err := newInnerStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return err
+	}
+	if document, err = transformProtected(document, stream, false); err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	gz := gzip.NewWriter(&payload)
+	gz.Write(inner.encode())
+	io.WriteString(gz, xml.Header)
+	gz.Write(document)
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	encrypted, err := encryptPayload(h.cipherID, masterKey, h.iv, payload.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(h.raw)
+	sum := sha256.Sum256(h.raw)
+	out.Write(sum[:])
+	out.Write(blockHMAC(hmacKey, headerBlockIndex, h.raw))
+	writeBlocks(&out, encrypted, hmacKey)
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// deriveKeys turns the composite key into the payload encryption key and
+// the HMAC key, using the header's seed and key derivation function.
+//
+// Args:
+//
+//	key: The master password and key file.
+//
+// Returns:
+//
+//	The encryption key, the HMAC key and an error if one occurred.
+func (h *header) deriveKeys(key Key) ([]byte, []byte, error) {
+	composite, err := key.composite()
+	if err != nil {
+		return nil, nil, err
+	}
+	transformed, err := transformKey(composite, h.kdf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	masterKey := sha256.New()
+	masterKey.Write(h.masterSeed)
+	masterKey.Write(transformed)
+
+	hmacKey := sha512.New()
+	hmacKey.Write(h.masterSeed)
+	hmacKey.Write(transformed)
+	hmacKey.Write([]byte{1})
+
+	return masterKey.Sum(nil), hmacKey.Sum(nil), nil
+}
+
+// splitTags splits a KeePass tag list, separated by semicolons or commas.
+//
+// Args:
+//
+//	tags: The tag list.
+//
+// Returns:
+//
+//	The non-empty tags.
+func splitTags(tags string) []string {
+	var split []string
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			split = append(split, tag)
+		}
+	}
+	return split
+}
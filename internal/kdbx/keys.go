@@ -0,0 +1,139 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// keyFileXML is an XML key file as written by KeePass 2 and KeePassXC.
+// Version 1.0 holds the key in base64, version 2.0 in hex with a checksum.
+type keyFileXML struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// NewKey creates a key from a master password and the path to a key file.
+//
+// Args:
+//
+//	password: The master password, or nil if the database has none.
+//	keyFilePath: The path to the key file, or "" if the database has none.
+//
+// Returns:
+//
+//	The key and an error if the key file could not be read.
+func NewKey(password []byte, keyFilePath string) (Key, error) {
+	key := Key{Password: password}
+	if keyFilePath == "" {
+		return key, nil
+	}
+
+	keyFile, err := os.ReadFile(keyFilePath)
+	if err != nil {
+		return Key{}, fmt.Errorf("cannot read key file: %w", err)
+	}
+	if len(keyFile) == 0 {
+		return Key{}, errors.New("the key file is empty")
+	}
+	key.KeyFile = keyFile
+
+	return key, nil
+}
+
+// composite combines the password and key file into the composite key the
+// key derivation function stretches.
+//
+// Returns:
+//
+//	The 32-byte composite key and ErrNoKey or another error if one occurred.
+func (k Key) composite() ([]byte, error) {
+	if len(k.Password) == 0 && len(k.KeyFile) == 0 {
+		return nil, ErrNoKey
+	}
+
+	composite := sha256.New()
+	if len(k.Password) > 0 {
+		password := sha256.Sum256(k.Password)
+		composite.Write(password[:])
+	}
+	if len(k.KeyFile) > 0 {
+		keyFile, err := keyFileKey(k.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		composite.Write(keyFile)
+	}
+
+	return composite.Sum(nil), nil
+}
+
+// keyFileKey extracts the key from a key file. XML key files and files of
+// exactly 32 bytes or 64 hex digits hold the key itself; any other file is
+// hashed.
+//
+// Args:
+//
+//	data: The contents of the key file.
+//
+// Returns:
+//
+//	The 32-byte key and an error if an XML key file is malformed.
+func keyFileKey(data []byte) ([]byte, error) {
+	var file keyFileXML
+	if bytes.Contains(data, []byte("<KeyFile")) && xml.Unmarshal(data, &file) == nil {
+		return file.key()
+	}
+
+	if len(data) == 32 {
+		return data, nil
+	}
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// key decodes the key of an XML key file.
+//
+// Returns:
+//
+//	The 32-byte key and an error if the file is malformed.
+func (f keyFileXML) key() ([]byte, error) {
+	var key []byte
+	var err error
+
+	switch strings.TrimSpace(f.Version) {
+	case "1.0", "1.00":
+		key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(f.Data.Value))
+	case "2.0":
+		key, err = hex.DecodeString(strings.Join(strings.Fields(f.Data.Value), ""))
+		if err == nil && f.Data.Hash != "" {
+			sum := sha256.Sum256(key)
+			if !strings.EqualFold(hex.EncodeToString(sum[:4]), f.Data.Hash) {
+				return nil, errors.New("the key file checksum does not match")
+			}
+		}
+	default:
+		return nil, errors.New("unsupported key file version " + f.Version)
+	}
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("the key file is malformed")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,258 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// headerBlockIndex is the block index whose HMAC key authenticates the header.
+const headerBlockIndex = ^uint64(0)
+
+// blockSize is the payload size of the HMAC blocks Write produces.
+const blockSize = 1 << 20
+
+// Inner header field ids.
+const (
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+	innerBinary    = 3
+)
+
+// Inner random stream ids, the ciphers that protect hidden fields.
+const (
+	innerStreamSalsa20  = 2
+	innerStreamChaCha20 = 3
+)
+
+// binaryProtected is the inner header flag of attachments KeePass keeps
+// protected in memory.
+const binaryProtected = 0x01
+
+// salsa20Nonce is the fixed nonce of the Salsa20 inner stream.
+var salsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+
+// innerHeader is the encrypted header in front of the XML document.
+type innerHeader struct {
+	streamID  uint32
+	streamKey []byte
+	binaries  [][]byte
+}
+
+// salsa20Stream is a Salsa20 keystream that, unlike the stateless
+// golang.org/x/crypto/salsa20 API, carries on across calls.
+type salsa20Stream struct {
+	key     [32]byte
+	counter [16]byte
+	buf     []byte
+}
+
+// blockHMAC computes the HMAC of one payload block, or of the header.
+//
+// Args:
+//
+//	hmacKey: The 64-byte HMAC key derived from the master key.
+//	index: The block index, or headerBlockIndex.
+//	data: The block data.
+//
+// Returns:
+//
+//	The HMAC-SHA256. Payload blocks include their length; the header does not.
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	blockKey := sha512.New()
+	binary.Write(blockKey, binary.LittleEndian, index)
+	blockKey.Write(hmacKey)
+
+	mac := hmac.New(sha256.New, blockKey.Sum(nil))
+	if index == headerBlockIndex {
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+	binary.Write(mac, binary.LittleEndian, index)
+	binary.Write(mac, binary.LittleEndian, uint32(len(data)))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks checks and joins the HMAC blocks of the payload.
+//
+// Args:
+//
+//	data: The data following the header hashes.
+//	hmacKey: The 64-byte HMAC key.
+//
+// Returns:
+//
+//	The encrypted payload and ErrCorrupt if a block fails its check.
+func readBlocks(data []byte, hmacKey []byte) ([]byte, error) {
+	var payload []byte
+	for index := uint64(0); ; index++ {
+		if len(data) < sha256.Size+4 {
+			return nil, ErrCorrupt
+		}
+		sum := data[:sha256.Size]
+		size := int(binary.LittleEndian.Uint32(data[sha256.Size:]))
+		data = data[sha256.Size+4:]
+		if size < 0 || size > len(data) {
+			return nil, ErrCorrupt
+		}
+
+		block := data[:size]
+		data = data[size:]
+		if !hmac.Equal(blockHMAC(hmacKey, index, block), sum) {
+			return nil, fmt.Errorf("%w: block %d failed its integrity check", ErrCorrupt, index)
+		}
+		if size == 0 {
+			return payload, nil
+		}
+		payload = append(payload, block...)
+	}
+}
+
+// writeBlocks splits the encrypted payload into HMAC blocks, ending with an
+// empty one.
+//
+// Args:
+//
+//	buf: The buffer to append to.
+//	payload: The encrypted payload.
+//	hmacKey: The 64-byte HMAC key.
+func writeBlocks(buf *bytes.Buffer, payload []byte, hmacKey []byte) {
+	for index := uint64(0); ; index++ {
+		block := payload[:min(len(payload), blockSize)]
+		payload = payload[len(block):]
+
+		buf.Write(blockHMAC(hmacKey, index, block))
+		binary.Write(buf, binary.LittleEndian, uint32(len(block)))
+		buf.Write(block)
+		if len(block) == 0 {
+			return
+		}
+	}
+}
+
+// parseInnerHeader reads the inner header at the start of the decrypted
+// payload.
+//
+// Args:
+//
+//	data: The decrypted, decompressed payload.
+//
+// Returns:
+//
+//	The inner header, the XML document following it and ErrCorrupt if the
+//	header is malformed.
+func parseInnerHeader(data []byte) (innerHeader, []byte, error) {
+	var inner innerHeader
+	for {
+		if len(data) < 5 {
+			return innerHeader{}, nil, ErrCorrupt
+		}
+		id := data[0]
+		size := int(binary.LittleEndian.Uint32(data[1:5]))
+		data = data[5:]
+		if size < 0 || size > len(data) {
+			return innerHeader{}, nil, ErrCorrupt
+		}
+		value := data[:size]
+		data = data[size:]
+
+		switch id {
+		case innerEnd:
+			return inner, data, nil
+		case innerStreamID:
+			if len(value) != 4 {
+				return innerHeader{}, nil, ErrCorrupt
+			}
+			inner.streamID = binary.LittleEndian.Uint32(value)
+		case innerStreamKey:
+			inner.streamKey = value
+		case innerBinary:
+			if len(value) == 0 {
+				return innerHeader{}, nil, ErrCorrupt
+			}
+			inner.binaries = append(inner.binaries, value[1:])
+		}
+	}
+}
+
+// encode serializes the inner header. Attachments are flagged as protected,
+// as KeePassXC does.
+//
+// Returns:
+//
+//	The encoded inner header.
+func (h innerHeader) encode() []byte {
+	var buf bytes.Buffer
+	writeInnerField(&buf, innerStreamID, binary.LittleEndian.AppendUint32(nil, h.streamID))
+	writeInnerField(&buf, innerStreamKey, h.streamKey)
+	for _, data := range h.binaries {
+		writeInnerField(&buf, innerBinary, append([]byte{binaryProtected}, data...))
+	}
+	writeInnerField(&buf, innerEnd, nil)
+	return buf.Bytes()
+}
+
+// writeInnerField appends one inner header field.
+//
+// Args:
+//
+//	buf: The buffer to append to.
+//	id: The field id.
+//	value: The field value.
+func writeInnerField(buf *bytes.Buffer, id byte, value []byte) {
+	buf.WriteByte(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+// newInnerStream creates the keystream that protects hidden fields.
+//
+// Args:
+//
+//	id: The stream id from the inner header.
+//	key: The stream key from the inner header.
+//
+// Returns:
+//
+//	The keystream and an error if the stream is not supported.
+func newInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case innerStreamChaCha20:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:32+chacha20.NonceSize])
+	case innerStreamSalsa20:
+		stream := &salsa20Stream{key: sha256.Sum256(key)}
+		copy(stream.counter[:], salsa20Nonce)
+		return stream, nil
+	default:
+		return nil, fmt.Errorf("unsupported inner stream %d", id)
+	}
+}
+
+// XORKeyStream XORs src with the keystream into dst.
+//
+// Args:
+//
+//	dst: The destination, at least as long as src.
+//	src: The data to encrypt or decrypt.
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if len(s.buf) == 0 {
+			var block [64]byte
+			salsa.XORKeyStream(block[:], block[:], &s.counter, &s.key)
+			s.buf = block[:]
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+		}
+		dst[i] = src[i] ^ s.buf[0]
+		s.buf = s.buf[1:]
+	}
+}
@@ -0,0 +1,450 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// epochOffset is the number of seconds between 0001-01-01, the epoch of
+// KDBX 4 timestamps, and the Unix epoch.
+const epochOffset = 62135596800
+
+// generator names Aegis as the writer of a database.
+const generator = "Aegis"
+
+// xmlTrue is the spelling of true KeePass uses.
+const xmlTrue = "True"
+
+// xmlFile is the XML document inside a database.
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    xmlRoot  `xml:"Root"`
+}
+
+// xmlMeta holds the database settings Aegis reads or writes.
+type xmlMeta struct {
+	Generator         string `xml:"Generator"`
+	DatabaseName      string `xml:"DatabaseName"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled,omitempty"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID,omitempty"`
+}
+
+// xmlRoot holds the root group.
+type xmlRoot struct {
+	Group xmlGroup `xml:"Group"`
+}
+
+// xmlGroup is a group with its entries and subgroups.
+type xmlGroup struct {
+	UUID    string     `xml:"UUID"`
+	Name    string     `xml:"Name"`
+	Times   xmlTimes   `xml:"Times"`
+	Entries []xmlEntry `xml:"Entry"`
+	Groups  []xmlGroup `xml:"Group"`
+}
+
+// xmlEntry is an entry, or an earlier version of one inside History.
+type xmlEntry struct {
+	UUID     string      `xml:"UUID"`
+	Tags     string      `xml:"Tags,omitempty"`
+	Times    xmlTimes    `xml:"Times"`
+	Strings  []xmlString `xml:"String"`
+	Binaries []xmlBinary `xml:"Binary"`
+	History  *xmlHistory `xml:"History,omitempty"`
+}
+
+// xmlHistory holds the earlier versions of an entry, oldest first.
+type xmlHistory struct {
+	Entries []xmlEntry `xml:"Entry"`
+}
+
+// xmlTimes holds the timestamps of a group or entry.
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+// xmlString is a string field of an entry.
+type xmlString struct {
+	Key   string   `xml:"Key"`
+	Value xmlValue `xml:"Value"`
+}
+
+// xmlValue is a string field value, encrypted with the inner stream in the
+// file when Protected is set.
+type xmlValue struct {
+	Protected string `xml:"Protected,attr,omitempty"`
+	Text      string `xml:",chardata"`
+}
+
+// xmlBinary attaches an inner header binary to an entry.
+type xmlBinary struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref int `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// transformProtected encrypts or decrypts the values marked Protected with
+// the inner stream. The stream runs through the values in document order,
+// so this walks the raw tokens rather than the parsed structure.
+//
+// Args:
+//
+//	document: The XML document.
+//	stream: The inner stream, fresh for each document.
+//	decrypt: Whether the protected values are to be decrypted rather than
+//	encrypted.
+//
+// Returns:
+//
+//	The document with the protected values transformed and an error if the
+//	document is malformed.
+func transformProtected(document []byte, stream cipher.Stream, decrypt bool) ([]byte, error) {
+	var out bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	encoder := xml.NewEncoder(&out)
+
+	var protected *bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst, xml.Directive, xml.Comment:
+			continue
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, xmlTrue) {
+					protected = &bytes.Buffer{}
+				}
+			}
+		case xml.CharData:
+			if protected != nil {
+				protected.Write(t)
+				continue
+			}
+		case xml.EndElement:
+			if protected != nil {
+				value, err := applyStream(protected.Bytes(), stream, decrypt)
+				if err != nil {
+					return nil, err
+				}
+				protected = nil
+				if err := encoder.EncodeToken(xml.CharData(value)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// applyStream encrypts a value into base64 or decrypts a base64 value.
+//
+// Args:
+//
+//	value: The value text.
+//	stream: The inner stream.
+//	decrypt: Whether value is base64 ciphertext rather than plaintext.
+//
+// Returns:
+//
+//	The transformed value and an error if the ciphertext is not base64.
+func applyStream(value []byte, stream cipher.Stream, decrypt bool) ([]byte, error) {
+	if !decrypt {
+		ciphertext := make([]byte, len(value))
+		stream.XORKeyStream(ciphertext, value)
+		return base64.StdEncoding.AppendEncode(nil, ciphertext), nil
+	}
+
+	ciphertext, err := base64.StdEncoding.AppendDecode(nil, bytes.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("protected value: %w", err)
+	}
+	stream.XORKeyStream(ciphertext, ciphertext)
+	return ciphertext, nil
+}
+
+// database converts the parsed document into a Database, resolving
+// attachment references against the inner header binaries.
+//
+// Args:
+//
+//	binaries: The binaries from the inner header.
+//
+// Returns:
+//
+//	The database and ErrCorrupt if an attachment reference is invalid.
+func (f *xmlFile) database(binaries [][]byte) (*Database, error) {
+	recycleBin := ""
+	if uuid, err := base64.StdEncoding.DecodeString(f.Meta.RecycleBinUUID); err == nil && !bytes.Equal(uuid, make([]byte, len(uuid))) {
+		recycleBin = f.Meta.RecycleBinUUID
+	}
+
+	var convertGroup func(g xmlGroup) (*Group, error)
+	convertGroup = func(g xmlGroup) (*Group, error) {
+		group := &Group{Name: g.Name}
+		for _, e := range g.Entries {
+			entry, err := e.entry(binaries)
+			if err != nil {
+				return nil, err
+			}
+			group.Entries = append(group.Entries, entry)
+		}
+		for _, sub := range g.Groups {
+			if recycleBin != "" && sub.UUID == recycleBin {
+				continue
+			}
+			child, err := convertGroup(sub)
+			if err != nil {
+				return nil, err
+			}
+			group.Groups = append(group.Groups, child)
+		}
+		return group, nil
+	}
+
+	root, err := convertGroup(f.Root.Group)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{Name: f.Meta.DatabaseName, Root: root}, nil
+}
+
+// entry converts a parsed entry and its history.
+//
+// Args:
+//
+//	binaries: The binaries from the inner header.
+//
+// Returns:
+//
+//	The entry and ErrCorrupt if an attachment reference is invalid.
+func (e xmlEntry) entry(binaries [][]byte) (*Entry, error) {
+	entry := &Entry{
+		Tags:                 splitTags(e.Tags),
+		CreationTime:         parseTime(e.Times.CreationTime),
+		LastModificationTime: parseTime(e.Times.LastModificationTime),
+	}
+	for _, s := range e.Strings {
+		entry.Fields = append(entry.Fields, Field{Name: s.Key, Value: s.Value.Text, Protected: strings.EqualFold(s.Value.Protected, xmlTrue)})
+	}
+	for _, b := range e.Binaries {
+		if b.Value.Ref < 0 || b.Value.Ref >= len(binaries) {
+			return nil, fmt.Errorf("%w: attachment %q refers to a missing binary", ErrCorrupt, b.Key)
+		}
+		entry.Attachments = append(entry.Attachments, Attachment{Name: b.Key, Data: binaries[b.Value.Ref]})
+	}
+	if e.History != nil {
+		for _, h := range e.History.Entries {
+			version, err := h.entry(binaries)
+			if err != nil {
+				return nil, err
+			}
+			entry.History = append(entry.History, version)
+		}
+	}
+	return entry, nil
+}
+
+// newXMLFile converts a Database into its XML document, collecting the
+// attachments as inner header binaries.
+//
+// Args:
+//
+//	db: The database.
+//
+// Returns:
+//
+//	The document, the binaries and an error if the random source failed.
+func newXMLFile(db *Database) (*xmlFile, [][]byte, error) {
+	if db.Root == nil {
+		return nil, nil, errors.New("the database has no root group")
+	}
+
+	var binaries [][]byte
+	now := time.Now()
+
+	var convertGroup func(g *Group) (xmlGroup, error)
+	convertGroup = func(g *Group) (xmlGroup, error) {
+		uuid, err := newUUID()
+		if err != nil {
+			return xmlGroup{}, err
+		}
+		group := xmlGroup{UUID: uuid, Name: g.Name, Times: newTimes(now, now)}
+
+		for _, e := range g.Entries {
+			uuid, err := newUUID()
+			if err != nil {
+				return xmlGroup{}, err
+			}
+			entry := newXMLEntry(uuid, e, &binaries)
+			if len(e.History) > 0 {
+				entry.History = &xmlHistory{}
+				for _, version := range e.History {
+					entry.History.Entries = append(entry.History.Entries, newXMLEntry(uuid, version, &binaries))
+				}
+			}
+			group.Entries = append(group.Entries, entry)
+		}
+
+		for _, sub := range g.Groups {
+			child, err := convertGroup(sub)
+			if err != nil {
+				return xmlGroup{}, err
+			}
+			group.Groups = append(group.Groups, child)
+		}
+		return group, nil
+	}
+
+	root, err := convertGroup(db.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := &xmlFile{
+		Meta: xmlMeta{Generator: generator, DatabaseName: db.Name},
+		Root: xmlRoot{Group: root},
+	}
+	return file, binaries, nil
+}
+
+// newXMLEntry converts one entry, without its history. The password and
+// fields marked Protected are written protected.
+//
+// Args:
+//
+//	uuid: The entry UUID, shared with its earlier versions.
+//	e: The entry.
+//	binaries: The binaries collected so far, appended to.
+//
+// Returns:
+//
+//	The entry.
+func newXMLEntry(uuid string, e *Entry, binaries *[][]byte) xmlEntry {
+	entry := xmlEntry{
+		UUID:  uuid,
+		Tags:  strings.Join(e.Tags, ";"),
+		Times: newTimes(e.CreationTime, e.LastModificationTime),
+	}
+	for _, field := range e.Fields {
+		value := xmlValue{Text: field.Value}
+		if field.Protected || field.Name == FieldPassword {
+			value.Protected = xmlTrue
+		}
+		entry.Strings = append(entry.Strings, xmlString{Key: field.Name, Value: value})
+	}
+	for _, attachment := range e.Attachments {
+		binary := xmlBinary{Key: attachment.Name}
+		binary.Value.Ref = len(*binaries)
+		*binaries = append(*binaries, attachment.Data)
+		entry.Binaries = append(entry.Binaries, binary)
+	}
+	return entry
+}
+
+// newTimes creates the timestamps of a group or entry. Zero times are
+// replaced by the current time.
+//
+// Args:
+//
+//	created: The creation time.
+//	modified: The last modification time.
+//
+// Returns:
+//
+//	The timestamps.
+func newTimes(created, modified time.Time) xmlTimes {
+	now := time.Now()
+	if created.IsZero() {
+		created = now
+	}
+	if modified.IsZero() {
+		modified = created
+	}
+	return xmlTimes{
+		CreationTime:         formatTime(created),
+		LastModificationTime: formatTime(modified),
+		LastAccessTime:       formatTime(modified),
+		ExpiryTime:           formatTime(modified),
+		Expires:              "False",
+		LocationChanged:      formatTime(modified),
+	}
+}
+
+// newUUID returns a random UUID in the base64 form KeePass uses.
+//
+// Returns:
+//
+//	The UUID and an error if the random source failed.
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(uuid), nil
+}
+
+// formatTime encodes a timestamp as KDBX 4 does: base64 of the little-endian
+// seconds since 0001-01-01 UTC.
+//
+// Args:
+//
+//	t: The time.
+//
+// Returns:
+//
+//	The encoded time.
+func formatTime(t time.Time) string {
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(t.Unix()+epochOffset)))
+}
+
+// parseTime decodes a KDBX 4 timestamp, or the ISO 8601 form older versions
+// used.
+//
+// Args:
+//
+//	s: The encoded time.
+//
+// Returns:
+//
+//	The time, or the zero time if it cannot be parsed.
+func parseTime(s string) time.Time {
+	if raw, err := base64.StdEncoding.DecodeString(s); err == nil && len(raw) == 8 {
+		return time.Unix(int64(binary.LittleEndian.Uint64(raw))-epochOffset, 0).UTC()
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -1,10 +1,23 @@
 package mpass
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+
+	"golang.org/x/term"
 )
 
+// EnvVar is the environment variable holding the master password.
+const EnvVar = "AEGIS_MASTER_PASS"
+
+// ErrNoTerminal is returned when a secret must be prompted for but there is no
+// terminal to read it from.
+var ErrNoTerminal = errors.New("no terminal available to prompt for a secret")
+
 // GetMasterPass retrieves the master password from the environment variable AEGIS_MASTER_PASS.
 // It terminates the application if the environment variable is not set.
 //
@@ -12,11 +25,144 @@ import (
 //
 //	The master password as a byte slice.
 func GetMasterPass() []byte {
-	aegisMasterPass := os.Getenv("AEGIS_MASTER_PASS")
+	aegisMasterPass, ok := LookupMasterPass()
 
-	if aegisMasterPass == "" {
+	if !ok {
 		log.Fatalln("AEGIS_MASTER_PASS env variable is missing. Please make sure to set it up")
 	}
 
-	return []byte(aegisMasterPass)
+	return aegisMasterPass
+}
+
+// LookupMasterPass retrieves the master password from the environment
+// variable AEGIS_MASTER_PASS without terminating the application.
+//
+// Returns:
+//
+//	The master password and whether the variable was set.
+func LookupMasterPass() ([]byte, bool) {
+	aegisMasterPass := os.Getenv(EnvVar)
+	if aegisMasterPass == "" {
+		return nil, false
+	}
+
+	return []byte(aegisMasterPass), true
+}
+
+// ReadSecret prompts on the terminal and reads a line without echoing it.
+// The controlling terminal is used even when stdin is redirected, so secrets
+// can be prompted for while data is piped in.
+//
+// Args:
+//
+//	prompt: The prompt to show.
+//
+// Returns:
+//
+//	The secret and an error if one occurred.
+func ReadSecret(prompt string) ([]byte, error) {
+	in, out, closeTTY, err := openTerminal()
+	if err != nil {
+		return nil, err
+	}
+	defer closeTTY()
+
+	fmt.Fprint(out, prompt)
+	secret, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// ReadNewSecret prompts for a secret twice and checks that both match.
+//
+// Args:
+//
+//	prompt: The prompt to show for the first entry.
+//
+// Returns:
+//
+//	The secret and an error if one occurred or the entries differ.
+func ReadNewSecret(prompt string) ([]byte, error) {
+	secret, err := ReadSecret(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	confirm, err := ReadSecret("Repeat to confirm: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if string(secret) != string(confirm) {
+		return nil, errors.New("the entries do not match")
+	}
+
+	return secret, nil
+}
+
+// ReadLine prompts on the terminal and reads a line with echo, for questions
+// that are not secret.
+//
+// Args:
+//
+//	prompt: The prompt to show.
+//
+// Returns:
+//
+//	The line without its line ending and an error if one occurred.
+func ReadLine(prompt string) (string, error) {
+	in, out, closeTTY, err := openTerminal()
+	if err != nil {
+		return "", err
+	}
+	defer closeTTY()
+
+	fmt.Fprint(out, prompt)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("could not read answer: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// IsTerminal reports whether a terminal is available for prompts.
+//
+// Returns:
+//
+//	True if ReadSecret can prompt the user.
+func IsTerminal() bool {
+	_, _, closeTTY, err := openTerminal()
+	if err != nil {
+		return false
+	}
+	closeTTY()
+	return true
+}
+
+// openTerminal finds a terminal to prompt on: stdin/stderr when they are
+// terminals, otherwise the process's controlling terminal.
+//
+// Returns:
+//
+//	The terminal to read from, the terminal to write prompts to, a function
+//	that releases them and an error if no terminal is available.
+func openTerminal() (*os.File, *os.File, func(), error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return os.Stdin, os.Stderr, func() {}, nil
+	}
+
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil || !term.IsTerminal(int(tty.Fd())) {
+		if tty != nil {
+			tty.Close()
+		}
+		return nil, nil, nil, ErrNoTerminal
+	}
+
+	return tty, tty, func() { tty.Close() }, nil
 }
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package mpass
+
+// ttyPath is the controlling terminal of the process.
+const ttyPath = "/dev/tty"
@@ -0,0 +1,6 @@
+//go:build windows
+
+package mpass
+
+// ttyPath is the console input of the process.
+const ttyPath = "CONIN$"
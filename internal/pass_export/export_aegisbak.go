@@ -0,0 +1,112 @@
+package pass_export
+
+import (
+	"aegis/internal/aegisbak"
+	"aegis/internal/queries"
+
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ExportAegisBackup writes the chosen entries to an encrypted .aegisbak
+// backup, readable only by the current user.
+//
+// Args:
+//
+//	filePath: The path to the file to be created.
+//	password: The backup password.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportAegisBackup(filePath string, password []byte, filter Filter) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := WriteAegisBackup(file, password, filter); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteAegisBackup writes the chosen entries as an encrypted .aegisbak
+// backup. The backup holds the passwords, details, timestamps and extras,
+// encrypted with the backup password rather than the master password, so it
+// can be restored into any vault.
+//
+// Args:
+//
+//	w: The writer to write the backup to.
+//	password: The backup password.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func WriteAegisBackup(w io.Writer, password []byte, filter Filter) error {
+	backup, err := buildAegisBackup(filter)
+	if err != nil {
+		return err
+	}
+
+	data, err := aegisbak.Seal(backup, password)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// buildAegisBackup decrypts the chosen entries into a backup.
+//
+// Args:
+//
+//	filter: The entries to export.
+//
+// Returns:
+//
+//	The backup and an error if an entry could not be read.
+func buildAegisBackup(filter Filter) (aegisbak.Backup, error) {
+	users, err := filterUsers(filter)
+	if err != nil {
+		return aegisbak.Backup{}, fmt.Errorf("error fetching entries: %w", err)
+	}
+
+	backup := aegisbak.Backup{CreatedOn: time.Now().UTC(), Entries: make([]aegisbak.Entry, 0, len(users))}
+	for _, user := range users {
+		username := user["username"]
+
+		password, err := queries.FetchPassword(username)
+		if err != nil {
+			return aegisbak.Backup{}, err
+		}
+		extras, err := queries.FetchEntryExtras(username)
+		if err != nil {
+			return aegisbak.Backup{}, err
+		}
+
+		entry := aegisbak.Entry{
+			Name:     username,
+			Password: password,
+			URL:      user["url"],
+			Login:    user["login"],
+			Folder:   user["folder"],
+			Tags:     queries.SplitTags(user["tags"]),
+			Extras:   extras,
+		}
+		entry.CreatedOn, _ = queries.ParseTimestamp(user["created_on"])
+		entry.UpdatedOn, _ = queries.ParseTimestamp(user["updated_on"])
+
+		backup.Entries = append(backup.Entries, entry)
+	}
+
+	return backup, nil
+}
@@ -0,0 +1,63 @@
+package pass_export
+
+import (
+	"aegis/internal/ageshare"
+
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// ExportAgeShare writes the chosen entries to an age share, readable only
+// by the current user.
+//
+// Args:
+//
+//	filePath: The path to the file to be created.
+//	recipients: The recipients who can open the share.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportAgeShare(filePath string, recipients []age.Recipient, filter Filter) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := WriteAgeShare(file, recipients, filter); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteAgeShare writes the chosen entries as an age share. The share holds
+// what a backup does, encrypted to the X25519 public keys of the recipients
+// instead of a password, so only their identities can open it.
+//
+// Args:
+//
+//	w: The writer to write the share to.
+//	recipients: The recipients who can open the share.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	ageshare.ErrNoRecipients or another error if one occurred.
+func WriteAgeShare(w io.Writer, recipients []age.Recipient, filter Filter) error {
+	if len(recipients) == 0 {
+		return ageshare.ErrNoRecipients
+	}
+
+	backup, err := buildAegisBackup(filter)
+	if err != nil {
+		return err
+	}
+
+	return ageshare.Seal(w, backup, recipients)
+}
@@ -0,0 +1,176 @@
+package pass_export
+
+import (
+	"aegis/internal/bitwarden"
+	"aegis/internal/queries"
+
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ExportBitwardenJSON writes the chosen entries to a Bitwarden JSON export,
+// readable only by the current user.
+//
+// Args:
+//
+//	filePath: The path to the file to be created.
+//	password: The export password, or nil for an unencrypted export.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportBitwardenJSON(filePath string, password []byte, filter Filter) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := WriteBitwardenJSON(file, password, filter); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteBitwardenJSON writes the chosen entries as a Bitwarden JSON export.
+// Entries become logins, or secure notes when they only hold notes. Folders,
+// the URLs, login, notes, TOTP secret and custom fields are kept, and the
+// "favorite" tag marks favourites; other tags have no Bitwarden equivalent.
+//
+// Args:
+//
+//	w: The writer to write the export to.
+//	password: The export password, or nil for an unencrypted export.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func WriteBitwardenJSON(w io.Writer, password []byte, filter Filter) error {
+	export, err := buildBitwardenExport(filter)
+	if err != nil {
+		return err
+	}
+
+	raw, err := bitwarden.Encode(export, password)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(raw, '\n'))
+	return err
+}
+
+// buildBitwardenExport converts the chosen entries into a Bitwarden export.
+//
+// Args:
+//
+//	filter: The entries to export.
+//
+// Returns:
+//
+//	The export and an error if an entry could not be read.
+func buildBitwardenExport(filter Filter) (bitwarden.Export, error) {
+	users, err := filterUsers(filter)
+	if err != nil {
+		return bitwarden.Export{}, fmt.Errorf("error fetching entries: %w", err)
+	}
+
+	export := bitwarden.Export{Folders: []bitwarden.Folder{}, Items: []bitwarden.Item{}}
+	folderIDs := make(map[string]string)
+
+	for _, user := range users {
+		item, err := newBitwardenItem(user)
+		if err != nil {
+			return bitwarden.Export{}, err
+		}
+
+		if folder := user["folder"]; folder != "" {
+			id, ok := folderIDs[folder]
+			if !ok {
+				if id, err = bitwarden.NewID(); err != nil {
+					return bitwarden.Export{}, err
+				}
+				folderIDs[folder] = id
+				export.Folders = append(export.Folders, bitwarden.Folder{ID: id, Name: folder})
+			}
+			item.FolderID = &id
+		}
+
+		export.Items = append(export.Items, item)
+	}
+
+	return export, nil
+}
+
+// newBitwardenItem converts one entry into a Bitwarden item.
+//
+// Args:
+//
+//	user: The entry as returned by queries.FetchUserData.
+//
+// Returns:
+//
+//	The item, without its folder, and an error if one occurred.
+func newBitwardenItem(user map[string]string) (bitwarden.Item, error) {
+	username := user["username"]
+
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		return bitwarden.Item{}, err
+	}
+	extras, err := queries.FetchEntryExtras(username)
+	if err != nil {
+		return bitwarden.Item{}, err
+	}
+	id, err := bitwarden.NewID()
+	if err != nil {
+		return bitwarden.Item{}, err
+	}
+
+	item := bitwarden.Item{
+		ID:       id,
+		Type:     bitwarden.TypeLogin,
+		Name:     username,
+		Notes:    extras.Notes,
+		Favorite: slices.Contains(queries.SplitTags(user["tags"]), bitwarden.FavoriteTag),
+	}
+	if createdOn, err := queries.ParseTimestamp(user["created_on"]); err == nil {
+		item.CreationDate = &createdOn
+	}
+	if updatedOn, err := queries.ParseTimestamp(user["updated_on"]); err == nil {
+		item.RevisionDate = &updatedOn
+	}
+
+	var extraURLs []bitwarden.URI
+	for _, field := range extras.Fields {
+		if field.Name == bitwarden.ExtraURLField && !field.Hidden {
+			extraURLs = append(extraURLs, bitwarden.URI{URI: field.Value})
+			continue
+		}
+		fieldType := bitwarden.FieldText
+		if field.Hidden {
+			fieldType = bitwarden.FieldHidden
+		}
+		item.Fields = append(item.Fields, bitwarden.Field{Name: field.Name, Value: field.Value, Type: fieldType})
+	}
+
+	if password == "" && user["login"] == "" && user["url"] == "" && extras.TOTP == "" && strings.TrimSpace(extras.Notes) != "" {
+		item.Type = bitwarden.TypeSecureNote
+		item.SecureNote = &bitwarden.SecureNote{}
+		return item, nil
+	}
+
+	item.Login = &bitwarden.Login{Username: user["login"], Password: password, TOTP: extras.TOTP}
+	if url := user["url"]; url != "" {
+		item.Login.URIs = append(item.Login.URIs, bitwarden.URI{URI: url})
+	}
+	item.Login.URIs = append(item.Login.URIs, extraURLs...)
+
+	return item, nil
+}
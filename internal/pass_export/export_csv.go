@@ -1,73 +1,139 @@
 package pass_export
 
 import (
+	"aegis/internal/aegiscsv"
 	"aegis/internal/queries"
 
 	"encoding/csv"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"slices"
 )
 
-// ExportPasswordsCsv exports all passwords from the database to a CSV file.
+// ExportPasswordsCsv exports the chosen passwords from the database to a CSV
+// file.
 //
 // Args:
 //
 //	filePath: The path to the CSV file to be created.
-func ExportPasswordsCsv(filePath string) {
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportPasswordsCsv(filePath string, filter Filter) error {
 	csvExport, err := os.Create(filePath)
 	if err != nil {
-		log.Fatalf("Error creating file: %s", err)
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := WritePasswordsCsv(csvExport, filter); err != nil {
+		csvExport.Close()
+		return err
 	}
-	defer csvExport.Close()
 
-	writer := csv.NewWriter(csvExport)
-	defer writer.Flush()
+	return csvExport.Close()
+}
+
+// WritePasswordsCsv writes the chosen passwords from the database as CSV.
+//
+// Args:
+//
+//	w: The writer to write the CSV data to.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func WritePasswordsCsv(w io.Writer, filter Filter) error {
+	writer := csv.NewWriter(w)
+
+	if err := writeDataCsv(writer, filter); err != nil {
+		return err
+	}
 
-	writeDataCsv(writer)
+	writer.Flush()
+	return writer.Error()
 }
 
-// writeDataCsv writes all password data to a CSV file.
+// writeDataCsv writes the chosen password data to a CSV file, one row at a
+// time, so an export needs the same memory whatever the size of the vault.
+// The columns and their encoding are those of the aegiscsv dialect.
 //
 // Args:
 //
 //	writer: The CSV writer to use for writing the data.
-func writeDataCsv(writer *csv.Writer) {
-	rows := queries.FetchAllUsers()
+//	filter: The entries to export.
+//
+// Returns:
+//
+//	An error if one occurred.
+func writeDataCsv(writer *csv.Writer, filter Filter) error {
+	rows, err := queries.FetchAllUsers()
+	if err != nil {
+		return fmt.Errorf("error fetching entries: %w", err)
+	}
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		log.Fatalf("Error getting columns: %s", err)
+		return fmt.Errorf("error getting columns: %w", err)
 	}
-	if err := writer.Write(columns); err != nil {
-		log.Fatalf("Writer error: %s", err)
+	header := aegiscsv.Header()
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("writer error: %w", err)
 	}
 
 	values := make([]any, len(columns))
 	valuePtrs := make([]any, len(columns))
+	record := make([]string, len(header))
+	// positions maps each table column to its CSV column, -1 if not exported.
+	positions := make([]int, len(columns))
 
 	for i := range values {
 		valuePtrs[i] = &values[i]
+		positions[i] = slices.Index(aegiscsv.Columns, columns[i])
 	}
 
 	for rows.Next() {
 		err := rows.Scan(valuePtrs...)
 		if err != nil {
-			log.Fatalf("Error copying columns from rows: %s", err)
+			return fmt.Errorf("error copying columns from rows: %w", err)
 		}
 
-		record := make([]string, len(columns))
-		for i, val := range values {
-			if val == nil {
-				record[i] = ""
-			} else {
-				record[i] = fmt.Sprintf("%v", val)
+		clear(record)
+		for i, column := range columns {
+			if positions[i] >= 0 {
+				record[positions[i]] = aegiscsv.FormatValue(column, values[i])
 			}
 		}
+		if !filter.IsZero() && !filter.Matches(csvUser(record)) {
+			continue
+		}
 
 		if err := writer.Write(record); err != nil {
-			log.Fatalf("Error writing record to CSV: %s", err)
+			return fmt.Errorf("error writing record to CSV: %w", err)
 		}
 	}
+
+	return rows.Err()
+}
+
+// csvUser returns the details of a CSV record the way queries.FetchUserData
+// does, for filtering.
+//
+// Args:
+//
+//	record: The record, in aegiscsv.Columns order.
+//
+// Returns:
+//
+//	The entry's name, details and timestamps by column name.
+func csvUser(record []string) map[string]string {
+	user := make(map[string]string)
+	for _, column := range []string{"username", "url", "login", "folder", "tags", "created_on", "updated_on"} {
+		user[column] = record[slices.Index(aegiscsv.Columns, column)]
+	}
+	return user
 }
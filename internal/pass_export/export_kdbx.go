@@ -0,0 +1,248 @@
+package pass_export
+
+import (
+	"aegis/internal/bitwarden"
+	"aegis/internal/kdbx"
+	"aegis/internal/queries"
+
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// keePassDatabaseName is the name of exported KeePass databases and their
+// root group.
+const keePassDatabaseName = "Aegis"
+
+// ExportKeePassKDBX writes the chosen entries to a KeePass KDBX 4 database,
+// readable only by the current user.
+//
+// Args:
+//
+//	filePath: The path to the file to be created.
+//	key: The master password and key file to protect the database with.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportKeePassKDBX(filePath string, key kdbx.Key, filter Filter) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := WriteKeePassKDBX(file, key, filter); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteKeePassKDBX writes the chosen entries as a KeePass KDBX 4 database.
+// Folders become groups, and the URL, login, tags, notes, TOTP secret, custom
+// fields, password history and attachments are kept.
+//
+// Args:
+//
+//	w: The writer to write the database to.
+//	key: The master password and key file to protect the database with.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func WriteKeePassKDBX(w io.Writer, key kdbx.Key, filter Filter) error {
+	db, err := buildKeePassDatabase(filter)
+	if err != nil {
+		return err
+	}
+
+	return kdbx.Write(w, db, key)
+}
+
+// buildKeePassDatabase converts the chosen entries into a KeePass database.
+//
+// Args:
+//
+//	filter: The entries to export.
+//
+// Returns:
+//
+//	The database and an error if an entry could not be read.
+func buildKeePassDatabase(filter Filter) (*kdbx.Database, error) {
+	users, err := filterUsers(filter)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching entries: %w", err)
+	}
+
+	root := &kdbx.Group{Name: keePassDatabaseName}
+	groups := map[string]*kdbx.Group{"": root}
+
+	for _, user := range users {
+		entry, err := newKeePassEntry(user)
+		if err != nil {
+			return nil, err
+		}
+
+		group := keePassGroup(groups, user["folder"])
+		group.Entries = append(group.Entries, entry)
+	}
+
+	return &kdbx.Database{Name: keePassDatabaseName, Root: root}, nil
+}
+
+// keePassGroup finds the group for a folder, creating it and its parents
+// as needed.
+//
+// Args:
+//
+//	groups: The groups created so far by folder path, "" being the root.
+//	folder: The folder path.
+//
+// Returns:
+//
+//	The group.
+func keePassGroup(groups map[string]*kdbx.Group, folder string) *kdbx.Group {
+	folder = queries.NormaliseFolder(folder)
+	if group, ok := groups[folder]; ok {
+		return group
+	}
+
+	parentPath, name := "", folder
+	if i := strings.LastIndex(folder, "/"); i >= 0 {
+		parentPath, name = folder[:i], folder[i+1:]
+	}
+	parent := keePassGroup(groups, parentPath)
+
+	group := &kdbx.Group{Name: name}
+	parent.Groups = append(parent.Groups, group)
+	groups[folder] = group
+	return group
+}
+
+// newKeePassEntry converts one entry into a KeePass entry.
+//
+// Args:
+//
+//	user: The entry as returned by queries.FetchUserData.
+//
+// Returns:
+//
+//	The KeePass entry and an error if one occurred.
+func newKeePassEntry(user map[string]string) (*kdbx.Entry, error) {
+	username := user["username"]
+
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		return nil, err
+	}
+	extras, err := queries.FetchEntryExtras(username)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &kdbx.Entry{
+		Fields: []kdbx.Field{
+			{Name: kdbx.FieldTitle, Value: username},
+			{Name: kdbx.FieldUserName, Value: user["login"]},
+			{Name: kdbx.FieldPassword, Value: password, Protected: true},
+			{Name: kdbx.FieldURL, Value: user["url"]},
+			{Name: kdbx.FieldNotes, Value: extras.Notes},
+		},
+		Tags: queries.SplitTags(user["tags"]),
+	}
+	if createdOn, err := queries.ParseTimestamp(user["created_on"]); err == nil {
+		entry.CreationTime = createdOn
+	}
+	if updatedOn, err := queries.ParseTimestamp(user["updated_on"]); err == nil {
+		entry.LastModificationTime = updatedOn
+	}
+
+	if extras.TOTP != "" {
+		entry.Fields = append(entry.Fields, kdbx.Field{Name: kdbx.FieldOTP, Value: otpauthURI(username, extras.TOTP), Protected: true})
+	}
+	used := make(map[string]bool, len(entry.Fields)+len(extras.Fields))
+	for _, field := range entry.Fields {
+		used[field.Name] = true
+	}
+	extraURLs := 0
+	for _, field := range extras.Fields {
+		name := field.Name
+		if name == bitwarden.ExtraURLField && !field.Hidden {
+			name = kdbx.FieldExtraURL
+			if extraURLs > 0 {
+				name += "_" + strconv.Itoa(extraURLs)
+			}
+			extraURLs++
+		}
+		name = uniqueFieldName(name, used)
+		used[name] = true
+		entry.Fields = append(entry.Fields, kdbx.Field{Name: name, Value: field.Value, Protected: field.Hidden})
+	}
+	for _, attachment := range extras.Attachments {
+		entry.Attachments = append(entry.Attachments, kdbx.Attachment{Name: attachment.Name, Data: attachment.Data})
+	}
+
+	for _, change := range extras.History {
+		entry.History = append(entry.History, &kdbx.Entry{
+			Fields: []kdbx.Field{
+				{Name: kdbx.FieldTitle, Value: username},
+				{Name: kdbx.FieldUserName, Value: user["login"]},
+				{Name: kdbx.FieldPassword, Value: change.Password, Protected: true},
+				{Name: kdbx.FieldURL, Value: user["url"]},
+			},
+			CreationTime:         entry.CreationTime,
+			LastModificationTime: change.ChangedOn,
+		})
+	}
+
+	return entry, nil
+}
+
+// uniqueFieldName keeps a custom field from clashing with a standard field or
+// another custom field, since KeePass field names are unique per entry.
+//
+// Args:
+//
+//	name: The field name.
+//	used: The field names the entry already has.
+//
+// Returns:
+//
+//	The name, with a number appended if it is taken.
+func uniqueFieldName(name string, used map[string]bool) string {
+	if !used[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		numbered := fmt.Sprintf("%s (%d)", name, i)
+		if !used[numbered] {
+			return numbered
+		}
+	}
+}
+
+// otpauthURI turns a TOTP secret into the otpauth:// URI KeePassXC expects.
+// Values that already are URIs are kept.
+//
+// Args:
+//
+//	name: The entry name, used as the account label.
+//	totp: The TOTP secret or URI.
+//
+// Returns:
+//
+//	The URI.
+func otpauthURI(name, totp string) string {
+	if strings.HasPrefix(totp, "otpauth://") {
+		return totp
+	}
+
+	secret := strings.ToUpper(strings.Join(strings.Fields(totp), ""))
+	return "otpauth://totp/" + url.PathEscape(name) + "?" + url.Values{"secret": {secret}}.Encode()
+}
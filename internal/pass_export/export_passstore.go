@@ -0,0 +1,152 @@
+package pass_export
+
+import (
+	"aegis/internal/passstore"
+	"aegis/internal/queries"
+
+	"fmt"
+	"strings"
+)
+
+// ExportPassStore writes the chosen entries as a new password store,
+// encrypted to the given public keys. Folders become directories and each
+// entry a file named after it. The password is the first line, followed by
+// login, url and tags lines, the custom fields as "name: value" lines, the
+// TOTP setting as an otpauth:// URI and the notes. Custom fields that span
+// several lines are added to the notes. Password history and attachments
+// have no place in a store and are left out.
+//
+// Args:
+//
+//	dir: The directory to create the store in; it must not exist or be empty.
+//	recipients: The public keys to encrypt the entries to.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	passstore.ErrNotEmpty if the directory is in use, or another error if
+//	one occurred.
+func ExportPassStore(dir string, recipients *passstore.KeyRing, filter Filter) error {
+	users, err := filterUsers(filter)
+	if err != nil {
+		return fmt.Errorf("error fetching entries: %w", err)
+	}
+
+	writer, err := passstore.NewWriter(dir, recipients)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool, len(users))
+	for _, user := range users {
+		entry, err := newPassStoreEntry(user)
+		if err != nil {
+			return err
+		}
+		entry.Path = uniquePassStorePath(user["folder"], user["username"], paths)
+		paths[strings.ToLower(entry.Path)] = true
+
+		if err := writer.Write(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newPassStoreEntry converts one entry into a pass entry, without its path.
+//
+// Args:
+//
+//	user: The entry as returned by queries.FetchUserData.
+//
+// Returns:
+//
+//	The pass entry and an error if one occurred.
+func newPassStoreEntry(user map[string]string) (passstore.Entry, error) {
+	username := user["username"]
+
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		return passstore.Entry{}, err
+	}
+	if strings.ContainsAny(password, "\r\n") {
+		return passstore.Entry{}, fmt.Errorf("the password of %q spans several lines, which pass cannot hold", username)
+	}
+	extras, err := queries.FetchEntryExtras(username)
+	if err != nil {
+		return passstore.Entry{}, err
+	}
+
+	entry := passstore.Entry{Password: password}
+	for _, field := range []passstore.Field{
+		{Name: "login", Value: user["login"]},
+		{Name: "url", Value: user["url"]},
+		{Name: "tags", Value: user["tags"]},
+	} {
+		if field.Value != "" {
+			entry.Fields = append(entry.Fields, field)
+		}
+	}
+
+	var notes []string
+	for _, field := range extras.Fields {
+		if strings.ContainsAny(field.Name+field.Value, "\r\n") || strings.Contains(field.Name, ": ") || strings.TrimSpace(field.Name) == "" {
+			notes = append(notes, field.Name+":\n"+field.Value)
+			continue
+		}
+		entry.Fields = append(entry.Fields, passstore.Field{Name: field.Name, Value: field.Value})
+	}
+	if extras.TOTP != "" {
+		entry.OTP = otpauthURI(username, extras.TOTP)
+	}
+	if extras.Notes != "" {
+		notes = append([]string{extras.Notes}, notes...)
+	}
+	entry.Notes = strings.Join(notes, "\n")
+
+	return entry, nil
+}
+
+// uniquePassStorePath builds the path of an entry in the store. Slashes in
+// the name would make directories and a leading dot would hide the file
+// from pass, so they are replaced. Paths are compared ignoring case, so the
+// store can be copied to file systems that do.
+//
+// Args:
+//
+//	folder: The folder of the entry.
+//	name: The entry name.
+//	taken: The paths already used, in lower case.
+//
+// Returns:
+//
+//	The path, with a number appended if it is taken.
+func uniquePassStorePath(folder, name string, taken map[string]bool) string {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "/", "-")
+	if strings.HasPrefix(name, ".") || name == "" {
+		name = "_" + name
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(queries.NormaliseFolder(folder), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, ".") {
+			segment = "_" + segment
+		}
+		segments = append(segments, segment)
+	}
+	base := strings.Join(append(segments, name), "/")
+
+	if !taken[strings.ToLower(base)] {
+		return base
+	}
+	for i := 2; ; i++ {
+		numbered := fmt.Sprintf("%s (%d)", base, i)
+		if !taken[strings.ToLower(numbered)] {
+			return numbered
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package pass_export
+
+import (
+	"aegis/internal/queries"
+
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// Formats of a plaintext export.
+const (
+	PlaintextCSV  = "csv"
+	PlaintextJSON = "json"
+)
+
+// PlaintextFields are the fields a plaintext export can hold besides the
+// entry name, in the order they are written.
+var PlaintextFields = []string{"password", "url", "login", "folder", "tags", "notes", "totp", "fields", "created_on", "updated_on"}
+
+// PlaintextOptions choose what a plaintext export holds and how it is
+// written.
+type PlaintextOptions struct {
+	// Format is PlaintextCSV or PlaintextJSON.
+	Format string
+	// Fields are the fields to write besides the name, nil for all of
+	// PlaintextFields.
+	Fields []string
+	// Passphrase, if set, wraps the export in an age envelope encrypted with
+	// it, which `age --decrypt` opens.
+	Passphrase []byte
+}
+
+// plaintextEntry is an entry of a plaintext JSON export. Fields that were
+// not chosen are left out.
+type plaintextEntry struct {
+	Name      string                `json:"name"`
+	Password  string                `json:"password,omitempty"`
+	URL       string                `json:"url,omitempty"`
+	Login     string                `json:"login,omitempty"`
+	Folder    string                `json:"folder,omitempty"`
+	Tags      []string              `json:"tags,omitempty"`
+	Notes     string                `json:"notes,omitempty"`
+	TOTP      string                `json:"totp,omitempty"`
+	Fields    []queries.CustomField `json:"fields,omitempty"`
+	CreatedOn string                `json:"created_on,omitempty"`
+	UpdatedOn string                `json:"updated_on,omitempty"`
+}
+
+// ExportPlaintext writes the chosen entries and fields, decrypted, to a file
+// readable only by the current user. The export is written to a temporary
+// file next to filePath and renamed over it once complete, so a failed
+// export leaves neither a partial file nor plaintext behind.
+//
+// Args:
+//
+//	filePath: The path to the file to be created.
+//	options: What to export and how.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func ExportPlaintext(filePath string, options PlaintextOptions, filter Filter) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	// Once renamed, the temporary name no longer exists and this does nothing.
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return fmt.Errorf("error restricting file permissions: %w", err)
+	}
+	if err := WritePlaintext(file, options, filter); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	return nil
+}
+
+// WritePlaintext writes the chosen entries and fields, decrypted, as CSV or
+// JSON. Unless a passphrase is given, everything chosen is written in
+// plaintext.
+//
+// Args:
+//
+//	w: The writer to write the export to.
+//	options: What to export and how.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func WritePlaintext(w io.Writer, options PlaintextOptions, filter Filter) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	if options.Passphrase == nil {
+		return writePlaintextEntries(w, options, filter)
+	}
+
+	recipient, err := age.NewScryptRecipient(string(options.Passphrase))
+	if err != nil {
+		return fmt.Errorf("error creating envelope: %w", err)
+	}
+	envelope, err := age.Encrypt(w, recipient)
+	if err != nil {
+		return fmt.Errorf("error creating envelope: %w", err)
+	}
+	if err := writePlaintextEntries(envelope, options, filter); err != nil {
+		return err
+	}
+	return envelope.Close()
+}
+
+// validate checks the format and fields of the options.
+//
+// Returns:
+//
+//	An error naming the first unknown format or field.
+func (o PlaintextOptions) validate() error {
+	if o.Format != PlaintextCSV && o.Format != PlaintextJSON {
+		return fmt.Errorf("unknown plaintext format %q", o.Format)
+	}
+	for _, field := range o.Fields {
+		if !slices.Contains(PlaintextFields, field) {
+			return fmt.Errorf("unknown field %q; choose from %s", field, strings.Join(PlaintextFields, ", "))
+		}
+	}
+	if o.Passphrase != nil && len(o.Passphrase) == 0 {
+		return errors.New("the envelope passphrase cannot be empty")
+	}
+	return nil
+}
+
+// fields returns the chosen fields in PlaintextFields order.
+//
+// Returns:
+//
+//	The fields.
+func (o PlaintextOptions) fields() []string {
+	if o.Fields == nil {
+		return PlaintextFields
+	}
+	return slices.DeleteFunc(slices.Clone(PlaintextFields), func(field string) bool {
+		return !slices.Contains(o.Fields, field)
+	})
+}
+
+// writePlaintextEntries decrypts the chosen entries one at a time and
+// writes them in the chosen format.
+//
+// Args:
+//
+//	w: The writer to write the export to.
+//	options: What to export and how.
+//	filter: The entries to export; the zero Filter exports every entry.
+//
+// Returns:
+//
+//	An error if one occurred.
+func writePlaintextEntries(w io.Writer, options PlaintextOptions, filter Filter) error {
+	users, err := filterUsers(filter)
+	if err != nil {
+		return fmt.Errorf("error fetching entries: %w", err)
+	}
+
+	fields := options.fields()
+	var writeEntry func(entry plaintextEntry) error
+	var finish func() error
+
+	if options.Format == PlaintextCSV {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(append([]string{"name"}, fields...)); err != nil {
+			return fmt.Errorf("writer error: %w", err)
+		}
+		writeEntry = func(entry plaintextEntry) error {
+			return writer.Write(entry.record(fields))
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		written := 0
+		writeEntry = func(entry plaintextEntry) error {
+			data, err := json.MarshalIndent(entry, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			prefix := ",\n  "
+			if written == 0 {
+				prefix = "[\n  "
+			}
+			written++
+			_, err = io.WriteString(w, prefix+string(data))
+			return err
+		}
+		finish = func() error {
+			end := "\n]\n"
+			if written == 0 {
+				end = "[]\n"
+			}
+			_, err := io.WriteString(w, end)
+			return err
+		}
+	}
+
+	for _, user := range users {
+		entry, err := newPlaintextEntry(user, fields)
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(entry); err != nil {
+			return fmt.Errorf("error writing entry %q: %w", entry.Name, err)
+		}
+	}
+
+	return finish()
+}
+
+// newPlaintextEntry decrypts the chosen fields of an entry. The password and
+// extras are only decrypted if one of their fields is chosen.
+//
+// Args:
+//
+//	user: The entry as returned by queries.FetchUserData.
+//	fields: The chosen fields.
+//
+// Returns:
+//
+//	The entry and an error if it could not be decrypted.
+func newPlaintextEntry(user map[string]string, fields []string) (plaintextEntry, error) {
+	username := user["username"]
+	entry := plaintextEntry{Name: username}
+	chosen := func(field string) bool { return slices.Contains(fields, field) }
+
+	if chosen("password") {
+		password, err := queries.FetchPassword(username)
+		if err != nil {
+			return plaintextEntry{}, err
+		}
+		entry.Password = password
+	}
+	if chosen("notes") || chosen("totp") || chosen("fields") {
+		extras, err := queries.FetchEntryExtras(username)
+		if err != nil {
+			return plaintextEntry{}, err
+		}
+		if chosen("notes") {
+			entry.Notes = extras.Notes
+		}
+		if chosen("totp") {
+			entry.TOTP = extras.TOTP
+		}
+		if chosen("fields") {
+			entry.Fields = extras.Fields
+		}
+	}
+
+	if chosen("url") {
+		entry.URL = user["url"]
+	}
+	if chosen("login") {
+		entry.Login = user["login"]
+	}
+	if chosen("folder") {
+		entry.Folder = user["folder"]
+	}
+	if chosen("tags") {
+		entry.Tags = queries.SplitTags(user["tags"])
+	}
+	if chosen("created_on") {
+		entry.CreatedOn = formatPlaintextTime(user["created_on"])
+	}
+	if chosen("updated_on") {
+		entry.UpdatedOn = formatPlaintextTime(user["updated_on"])
+	}
+
+	return entry, nil
+}
+
+// record returns the CSV record of an entry. Custom fields are written one
+// per line as "name: value".
+//
+// Args:
+//
+//	fields: The chosen fields, in column order.
+//
+// Returns:
+//
+//	The record, starting with the name.
+func (e plaintextEntry) record(fields []string) []string {
+	record := make([]string, 0, len(fields)+1)
+	record = append(record, e.Name)
+	for _, field := range fields {
+		var value string
+		switch field {
+		case "password":
+			value = e.Password
+		case "url":
+			value = e.URL
+		case "login":
+			value = e.Login
+		case "folder":
+			value = e.Folder
+		case "tags":
+			value = queries.JoinTags(e.Tags)
+		case "notes":
+			value = e.Notes
+		case "totp":
+			value = e.TOTP
+		case "fields":
+			lines := make([]string, len(e.Fields))
+			for i, f := range e.Fields {
+				lines[i] = f.Name + ": " + f.Value
+			}
+			value = strings.Join(lines, "\n")
+		case "created_on":
+			value = e.CreatedOn
+		case "updated_on":
+			value = e.UpdatedOn
+		}
+		record = append(record, value)
+	}
+	return record
+}
+
+// formatPlaintextTime writes a timestamp from the database in RFC 3339 form.
+//
+// Args:
+//
+//	s: The timestamp as stored.
+//
+// Returns:
+//
+//	The timestamp, or s unchanged if it cannot be parsed.
+func formatPlaintextTime(s string) string {
+	t, err := queries.ParseTimestamp(s)
+	if err != nil {
+		return s
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,170 @@
+package pass_export
+
+import (
+	"aegis/internal/queries"
+
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter chooses the entries an export holds. Every set criterion must
+// match; the zero Filter matches every entry.
+type Filter struct {
+	// Folders matches entries in one of these folders or below them. ""
+	// stands for the entries without a folder.
+	Folders []string
+	// Tags matches entries with at least one of these tags, ignoring case.
+	Tags []string
+	// CreatedAfter and CreatedBefore bound when entries were created:
+	// at or after CreatedAfter and strictly before CreatedBefore. Zero
+	// times leave that end open.
+	CreatedAfter, CreatedBefore time.Time
+	// UpdatedAfter and UpdatedBefore bound when entries were last changed,
+	// in the same way.
+	UpdatedAfter, UpdatedBefore time.Time
+	// Query matches entries whose name, URL, login, folder or tags contain
+	// it, ignoring case.
+	Query string
+}
+
+// IsZero reports whether the filter matches every entry.
+//
+// Returns:
+//
+//	True if no criterion is set.
+func (f Filter) IsZero() bool {
+	return len(f.Folders) == 0 && len(f.Tags) == 0 && f.Query == "" &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero() &&
+		f.UpdatedAfter.IsZero() && f.UpdatedBefore.IsZero()
+}
+
+// Matches reports whether an entry passes the filter.
+//
+// Args:
+//
+//	user: The entry as returned by queries.FetchUserData.
+//
+// Returns:
+//
+//	True if the entry is to be exported.
+func (f Filter) Matches(user map[string]string) bool {
+	if len(f.Folders) > 0 && !slices.ContainsFunc(f.Folders, func(parent string) bool {
+		return inFolder(user["folder"], queries.NormaliseFolder(parent))
+	}) {
+		return false
+	}
+
+	tags := queries.SplitTags(user["tags"])
+	if len(f.Tags) > 0 && !slices.ContainsFunc(f.Tags, func(tag string) bool {
+		return slices.ContainsFunc(tags, func(entryTag string) bool {
+			return strings.EqualFold(entryTag, strings.TrimSpace(tag))
+		})
+	}) {
+		return false
+	}
+
+	if !inRange(user["created_on"], f.CreatedAfter, f.CreatedBefore) ||
+		!inRange(user["updated_on"], f.UpdatedAfter, f.UpdatedBefore) {
+		return false
+	}
+
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		return slices.ContainsFunc([]string{user["username"], user["url"], user["login"], user["folder"], user["tags"]}, func(value string) bool {
+			return strings.Contains(strings.ToLower(value), query)
+		})
+	}
+	return true
+}
+
+// inFolder reports whether a folder is another folder or below it.
+//
+// Args:
+//
+//	folder: The folder to check.
+//	parent: The folder it may be in, "" for the entries without a folder.
+//
+// Returns:
+//
+//	True if folder is parent or one of its subfolders.
+func inFolder(folder, parent string) bool {
+	if parent == "" {
+		return folder == ""
+	}
+	return folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+// inRange reports whether a timestamp is within the bounds of a filter.
+//
+// Args:
+//
+//	timestamp: The timestamp as stored.
+//	after: The earliest time allowed, or zero for no bound.
+//	before: The time it must be before, or zero for no bound.
+//
+// Returns:
+//
+//	True if there are no bounds, or the timestamp parses and is within them.
+func inRange(timestamp string, after, before time.Time) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+
+	t, err := queries.ParseTimestamp(timestamp)
+	if err != nil {
+		return false
+	}
+	return (after.IsZero() || !t.Before(after)) && (before.IsZero() || t.Before(before))
+}
+
+// filterUsers returns the entries of the vault that pass a filter, sorted
+// by name.
+//
+// Args:
+//
+//	filter: The filter.
+//
+// Returns:
+//
+//	The entries as returned by queries.FetchUserData, and an error if they
+//	could not be read.
+func filterUsers(filter Filter) ([]map[string]string, error) {
+	users, err := queries.FetchUserData()
+	if err != nil {
+		return nil, err
+	}
+
+	users = slices.DeleteFunc(users, func(user map[string]string) bool {
+		return !filter.Matches(user)
+	})
+	slices.SortFunc(users, func(a, b map[string]string) int {
+		return strings.Compare(a["username"], b["username"])
+	})
+	return users, nil
+}
+
+// CountMatches counts the entries of the vault that pass a filter.
+//
+// Args:
+//
+//	filter: The filter.
+//
+// Returns:
+//
+//	The number of matching entries, the number of entries and an error if
+//	they could not be read.
+func CountMatches(filter Filter) (int, int, error) {
+	users, err := queries.FetchUserData()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	matches := 0
+	for _, user := range users {
+		if filter.Matches(user) {
+			matches++
+		}
+	}
+	return matches, len(users), nil
+}
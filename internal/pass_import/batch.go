@@ -0,0 +1,159 @@
+package pass_import
+
+import (
+	"aegis/internal/queries"
+
+	"errors"
+	"fmt"
+	"time"
+)
+
+// batch imports the entries of a file that has no preview, such as a
+// Bitwarden export or a KeePass database, in one transaction. Like applying
+// a preview, it undoes the whole import or only the failing entry, reports
+// its progress and counts what it did.
+type batch struct {
+	tx       *queries.Tx
+	mode     ImportMode
+	progress func(done, total int)
+	total    int
+	done     int
+	report   Report
+}
+
+// runBatch takes a snapshot of the vault and runs an import without a
+// preview in one transaction.
+//
+// Args:
+//
+//	mode: Whether an entry that cannot be stored undoes the whole import or
+//	  only itself.
+//	progress: Called after each entry with the number done and the total,
+//	  or nil.
+//	total: The number of entries to import.
+//	fn: Imports the entries through the batch.
+//
+// Returns:
+//
+//	What was done, and an error if the import was undone or could not be
+//	committed.
+func runBatch(mode ImportMode, progress func(done, total int), total int, fn func(b *batch) error) (Report, error) {
+	if err := snapshotBeforeImport(); err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	err := queries.WithTransaction(func(tx *queries.Tx) error {
+		b := &batch{tx: tx, mode: mode, progress: progress, total: total}
+		if err := fn(b); err != nil {
+			return err
+		}
+		report = b.report
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("nothing was imported: %w", err)
+	}
+
+	return report, nil
+}
+
+// add stores one entry. An entry whose name is taken is skipped; in lenient
+// mode, one that cannot be stored is undone alone and counted as failed.
+//
+// Args:
+//
+//	name: The entry name, for the report.
+//	store: Stores the entry in the transaction.
+//
+// Returns:
+//
+//	An error if the entry could not be stored in strict mode.
+func (b *batch) add(name string, store func(tx *queries.Tx) error) error {
+	var err error
+	if b.mode == ModeStrict {
+		err = store(b.tx)
+	} else {
+		err = b.tx.WithSavepoint(func() error { return store(b.tx) })
+	}
+
+	switch {
+	case err == nil:
+		b.report.Added++
+	case errors.Is(err, queries.ErrEntryExists):
+		b.report.Skipped++
+		b.report.Notes = append(b.report.Notes, fmt.Sprintf("%q: skipped, the name is taken", name))
+	default:
+		return b.fail(name, err)
+	}
+
+	b.step()
+	return nil
+}
+
+// fail counts an entry that could not be read or stored.
+//
+// Args:
+//
+//	name: The entry name, for the report.
+//	err: Why it failed.
+//
+// Returns:
+//
+//	The error in strict mode, which undoes the import.
+func (b *batch) fail(name string, err error) error {
+	if b.mode == ModeStrict {
+		return fmt.Errorf("could not import %q: %w", name, err)
+	}
+
+	b.report.Failed++
+	b.report.Failures = append(b.report.Failures, fmt.Sprintf("%q: %v", name, err))
+	b.step()
+	return nil
+}
+
+// invalid counts an entry the format allows but Aegis cannot import, such
+// as a Bitwarden card.
+//
+// Args:
+//
+//	name: The entry name, for the report.
+//	reason: Why it cannot be imported.
+func (b *batch) invalid(name, reason string) {
+	b.report.Invalid++
+	b.report.Notes = append(b.report.Notes, fmt.Sprintf("%q: %s", name, reason))
+	b.step()
+}
+
+// step reports the progress after an entry.
+func (b *batch) step() {
+	b.done++
+	if b.progress != nil {
+		b.progress(b.done, b.total)
+	}
+}
+
+// keepTimestamps gives an imported entry the creation and modification
+// times from the file. A file that has only one of them uses it for both.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name.
+//	createdOn: When the file says the entry was created, or the zero time.
+//	updatedOn: When the file says the entry last changed, or the zero time.
+//
+// Returns:
+//
+//	An error if one occurred.
+func keepTimestamps(tx *queries.Tx, name string, createdOn, updatedOn time.Time) error {
+	switch {
+	case createdOn.IsZero() && updatedOn.IsZero():
+		return nil
+	case createdOn.IsZero():
+		createdOn = updatedOn
+	case updatedOn.IsZero():
+		updatedOn = createdOn
+	}
+	return tx.SetEntryTimestamps(name, createdOn, updatedOn)
+}
@@ -0,0 +1,312 @@
+package pass_import
+
+import (
+	"aegis/internal/bitwarden"
+	"aegis/internal/queries"
+
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfileAegis is the id of the profile for CSV files written by Aegis
+// itself, whose passwords are already encrypted.
+const ProfileAegis = "aegis"
+
+// ProfilePlaintext is the id of the profile for the decrypted CSV files
+// written by `aegis export --decrypt`.
+const ProfilePlaintext = "plaintext"
+
+// lastPassSecureNoteURL is the URL LastPass gives secure notes.
+const lastPassSecureNoteURL = "http://sn"
+
+// ErrUnknownCSV is returned when a CSV header matches no import profile.
+var ErrUnknownCSV = errors.New("the CSV format was not recognised; choose an import profile")
+
+// CSVProfile describes the CSV export of a password manager: how to
+// recognise it and which of its columns hold which entry field. Column names
+// are lowercase; an empty name means the export has no such column.
+type CSVProfile struct {
+	ID       string
+	Name     string
+	detect   []string
+	title    string
+	url      string
+	login    string
+	password string
+	notes    string
+	totp     string
+	folder   string
+	tags     string
+	favorite string
+	// fields holds custom fields, one per line as "name: value".
+	fields string
+	// changed holds when the password was last changed, in milliseconds
+	// since the Unix epoch.
+	changed string
+	// created and updated hold when the entry was created and last
+	// changed, as timestamps.
+	created string
+	updated string
+}
+
+// CSVProfiles lists the supported CSV formats, in the order they are tried
+// when detecting the format of a file.
+var CSVProfiles = []CSVProfile{
+	{
+		ID:     ProfileAegis,
+		Name:   "Aegis",
+		detect: []string{"username", "password_hash", "password_ciphertext", "nonce", "salt"},
+	},
+	{
+		ID:       ProfilePlaintext,
+		Name:     "Aegis plaintext",
+		detect:   []string{"name", "password", "login"},
+		title:    "name",
+		url:      "url",
+		login:    "login",
+		password: "password",
+		notes:    "notes",
+		totp:     "totp",
+		folder:   "folder",
+		tags:     "tags",
+		fields:   "fields",
+		created:  "created_on",
+		updated:  "updated_on",
+	},
+	{
+		ID:       "firefox",
+		Name:     "Firefox",
+		detect:   []string{"url", "username", "password", "httprealm", "guid"},
+		url:      "url",
+		login:    "username",
+		password: "password",
+		changed:  "timepasswordchanged",
+	},
+	{
+		ID:       "lastpass",
+		Name:     "LastPass",
+		detect:   []string{"url", "username", "password", "extra", "name", "grouping"},
+		title:    "name",
+		url:      "url",
+		login:    "username",
+		password: "password",
+		notes:    "extra",
+		totp:     "totp",
+		folder:   "grouping",
+		favorite: "fav",
+	},
+	{
+		ID:       "1password",
+		Name:     "1Password",
+		detect:   []string{"title", "url", "username", "password", "otpauth", "archived"},
+		title:    "title",
+		url:      "url",
+		login:    "username",
+		password: "password",
+		notes:    "notes",
+		totp:     "otpauth",
+		tags:     "tags",
+		favorite: "favorite",
+	},
+	{
+		ID:       "safari",
+		Name:     "Safari",
+		detect:   []string{"title", "url", "username", "password", "otpauth"},
+		title:    "title",
+		url:      "url",
+		login:    "username",
+		password: "password",
+		notes:    "notes",
+		totp:     "otpauth",
+	},
+	{
+		ID:       "chrome",
+		Name:     "Chrome",
+		detect:   []string{"name", "url", "username", "password"},
+		title:    "name",
+		url:      "url",
+		login:    "username",
+		password: "password",
+		notes:    "note",
+	},
+}
+
+// CSVProfileByID looks up an import profile.
+//
+// Args:
+//
+//	id: The profile id, such as "chrome".
+//
+// Returns:
+//
+//	The profile and false if there is none with that id.
+func CSVProfileByID(id string) (CSVProfile, bool) {
+	for _, profile := range CSVProfiles {
+		if profile.ID == strings.ToLower(id) {
+			return profile, true
+		}
+	}
+	return CSVProfile{}, false
+}
+
+// DetectCSVProfile picks the import profile whose columns a CSV header has.
+//
+// Args:
+//
+//	header: The first row of the file.
+//
+// Returns:
+//
+//	The profile and ErrUnknownCSV if none matches.
+func DetectCSVProfile(header []string) (CSVProfile, error) {
+	columns := normaliseHeader(header)
+	for _, profile := range CSVProfiles {
+		if !slices.ContainsFunc(profile.detect, func(column string) bool { return !slices.Contains(columns, column) }) {
+			return profile, nil
+		}
+	}
+	return CSVProfile{}, ErrUnknownCSV
+}
+
+// normaliseHeader lowercases the column names of a CSV header and drops the
+// byte order mark some tools put in front of the file.
+//
+// Args:
+//
+//	header: The first row of the file.
+//
+// Returns:
+//
+//	The normalised column names.
+func normaliseHeader(header []string) []string {
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+	}
+	return columns
+}
+
+// profileDecoder returns a decoder for the records of a plaintext CSV
+// export.
+//
+// Args:
+//
+//	header: The file's header.
+//	profile: The profile describing the columns.
+//
+// Returns:
+//
+//	The decoder.
+func profileDecoder(header []string, profile CSVProfile) recordDecoder {
+	columns := normaliseHeader(header)
+	column := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		return slices.Index(columns, name)
+	}
+	titleColumn, urlColumn, loginColumn := column(profile.title), column(profile.url), column(profile.login)
+	passwordColumn, notesColumn, totpColumn := column(profile.password), column(profile.notes), column(profile.totp)
+	folderColumn, tagsColumn, favoriteColumn := column(profile.folder), column(profile.tags), column(profile.favorite)
+	fieldsColumn, changedColumn := column(profile.fields), column(profile.changed)
+	createdColumn, updatedColumn := column(profile.created), column(profile.updated)
+
+	return func(row []string, _ decodeMode) decodedRecord {
+		entry := candidate{
+			password: optionalField(row, passwordColumn),
+			details: queries.EntryDetails{
+				URL:    strings.TrimSpace(optionalField(row, urlColumn)),
+				Login:  optionalField(row, loginColumn),
+				Folder: queries.NormaliseFolder(strings.ReplaceAll(optionalField(row, folderColumn), "\\", "/")),
+				Tags:   splitCSVTags(optionalField(row, tagsColumn)),
+			},
+			extras: queries.EntryExtras{
+				Notes:  optionalField(row, notesColumn),
+				TOTP:   strings.TrimSpace(optionalField(row, totpColumn)),
+				Fields: parseCSVFields(optionalField(row, fieldsColumn)),
+			},
+		}
+		if entry.details.URL == lastPassSecureNoteURL {
+			entry.details.URL = ""
+		}
+		if favorite := strings.ToLower(optionalField(row, favoriteColumn)); favorite == "1" || favorite == "true" {
+			entry.details.Tags = append(entry.details.Tags, bitwarden.FavoriteTag)
+		}
+		if millis, err := strconv.ParseInt(optionalField(row, changedColumn), 10, 64); err == nil && millis > 0 {
+			entry.updatedOn = time.UnixMilli(millis).UTC()
+		}
+		if createdOn, err := queries.ParseTimestamp(optionalField(row, createdColumn)); err == nil {
+			entry.createdOn = createdOn
+		}
+		if updatedOn, err := queries.ParseTimestamp(optionalField(row, updatedColumn)); err == nil {
+			entry.updatedOn = updatedOn
+		}
+
+		title := entryTitle(optionalField(row, titleColumn), entry.details)
+		if entry.password == "" && entry.extras.IsZero() {
+			return decodedRecord{title: title, invalid: "the row has no password, notes or TOTP secret"}
+		}
+		return decodedRecord{title: title, entry: entry}
+	}
+}
+
+// entryTitle names an imported entry. Exports without a name column, or
+// rows with an empty name, fall back to the site's host name.
+//
+// Args:
+//
+//	title: The name from the file, possibly empty.
+//	details: The entry's URL and login.
+//
+// Returns:
+//
+//	The name, or "" if there is nothing to name the entry after.
+func entryTitle(title string, details queries.EntryDetails) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	if parsed, err := url.Parse(details.URL); err == nil && parsed.Hostname() != "" {
+		return strings.TrimPrefix(parsed.Hostname(), "www.")
+	}
+	return details.URL
+}
+
+// splitCSVTags splits a tag list separated by commas or semicolons.
+//
+// Args:
+//
+//	tags: The tag list.
+//
+// Returns:
+//
+//	The tags.
+func splitCSVTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ';' })
+}
+
+// parseCSVFields reads custom fields written one per line as "name: value".
+// A line without a separator is a field with no value.
+//
+// Args:
+//
+//	fields: The column's value.
+//
+// Returns:
+//
+//	The fields, or nil if there are none.
+func parseCSVFields(fields string) []queries.CustomField {
+	var parsed []queries.CustomField
+	for line := range strings.Lines(fields) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		parsed = append(parsed, queries.CustomField{Name: name, Value: value})
+	}
+	return parsed
+}
@@ -0,0 +1,93 @@
+package pass_import
+
+import (
+	"aegis/internal/aegisbak"
+	"aegis/internal/queries"
+
+	"fmt"
+	"os"
+)
+
+// ImportAegisBackup restores the entries of an .aegisbak backup, encrypting
+// them with the current master password. Entries whose name is already
+// taken are skipped.
+//
+// Args:
+//
+//	filePath: The path to the backup.
+//	password: The backup password.
+//	mode: Whether an entry that cannot be stored undoes the whole restore.
+//	progress: Called after each entry with the number done and the total, or nil.
+//
+// Returns:
+//
+//	What was restored, and aegisbak.ErrWrongPassword if the password does
+//	not open the backup, or another error if one occurred.
+func ImportAegisBackup(filePath string, password []byte, mode ImportMode, progress func(done, total int)) (Report, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("cannot open backup: %w", err)
+	}
+
+	backup, err := aegisbak.Open(data, password)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return restoreBackup(backup, mode, progress)
+}
+
+// restoreBackup stores the entries of a decrypted backup or share in one
+// transaction, skipping entries whose name is taken.
+//
+// Args:
+//
+//	backup: The decrypted entries.
+//	mode: Whether an entry that cannot be stored undoes the whole restore.
+//	progress: Called after each entry, or nil.
+//
+// Returns:
+//
+//	What was restored, and an error if the restore was undone.
+func restoreBackup(backup aegisbak.Backup, mode ImportMode, progress func(done, total int)) (Report, error) {
+	return runBatch(mode, progress, len(backup.Entries), func(b *batch) error {
+		for _, entry := range backup.Entries {
+			if err := b.add(entry.Name, func(tx *queries.Tx) error { return restoreEntry(tx, entry) }); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// restoreEntry stores one backed-up entry.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	entry: The entry from the backup.
+//
+// Returns:
+//
+//	queries.ErrEntryExists if the name is taken, or another error if one occurred.
+func restoreEntry(tx *queries.Tx, entry aegisbak.Entry) error {
+	if err := tx.AddNewPassword(entry.Name, entry.Password); err != nil {
+		return err
+	}
+
+	details := queries.EntryDetails{URL: entry.URL, Login: entry.Login, Folder: entry.Folder, Tags: entry.Tags}
+	if err := tx.SetEntryDetails(entry.Name, details); err != nil {
+		return err
+	}
+	if !entry.CreatedOn.IsZero() && !entry.UpdatedOn.IsZero() {
+		if err := tx.SetEntryTimestamps(entry.Name, entry.CreatedOn, entry.UpdatedOn); err != nil {
+			return err
+		}
+	}
+	if !entry.Extras.IsZero() {
+		return tx.SetEntryExtras(entry.Name, entry.Extras)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package pass_import
+
+import (
+	"aegis/internal/ageshare"
+
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+)
+
+// ImportAgeShare decrypts an age share and stores its entries, encrypting
+// them with the current master password. Entries whose name is already
+// taken are skipped.
+//
+// Args:
+//
+//	filePath: The path to the share.
+//	identities: The age identities to open the share with.
+//	mode: Whether an entry that cannot be stored undoes the whole import.
+//	progress: Called after each entry with the number done and the total, or nil.
+//
+// Returns:
+//
+//	What was imported, and ageshare.ErrNoMatchingIdentity if the share is
+//	not encrypted to any of the identities, or another error if one occurred.
+func ImportAgeShare(filePath string, identities []age.Identity, mode ImportMode, progress func(done, total int)) (Report, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("cannot open share: %w", err)
+	}
+	defer file.Close()
+
+	backup, err := ageshare.Open(file, identities)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return restoreBackup(backup, mode, progress)
+}
@@ -0,0 +1,179 @@
+package pass_import
+
+import (
+	"aegis/internal/bitwarden"
+	"aegis/internal/queries"
+
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportBitwardenJSON imports the logins and secure notes of a Bitwarden JSON
+// export, unencrypted or password protected. Folders, the first login URI,
+// the username, notes, TOTP secret, custom fields and dates are kept;
+// further URIs become custom fields. Cards, identities and SSH keys are counted as
+// invalid, and items whose name is taken are skipped.
+//
+// Args:
+//
+//	filePath: The path to the export.
+//	password: The export password, or nil if the export is not password protected.
+//	mode: Whether an item that cannot be stored undoes the whole import.
+//	progress: Called after each item with the number done and the total, or nil.
+//
+// Returns:
+//
+//	What was imported, and bitwarden.ErrPasswordRequired if the export needs
+//	a password, or another error if one occurred.
+func ImportBitwardenJSON(filePath string, password []byte, mode ImportMode, progress func(done, total int)) (Report, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("cannot open Bitwarden export: %w", err)
+	}
+
+	export, err := bitwarden.Decode(raw, password)
+	if err != nil {
+		return Report{}, err
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	return runBatch(mode, progress, len(export.Items), func(b *batch) error {
+		names := make(map[string]bool, len(export.Items))
+		for _, item := range export.Items {
+			if item.Type != bitwarden.TypeLogin && item.Type != bitwarden.TypeSecureNote {
+				b.invalid(item.Name, "only logins and secure notes can be imported")
+				continue
+			}
+
+			login := ""
+			if item.Login != nil {
+				login = item.Login.Username
+			}
+			name := uniqueName(item.Name, login, names)
+			names[name] = true
+
+			err := b.add(name, func(tx *queries.Tx) error { return importBitwardenItem(tx, name, item, folders) })
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// importBitwardenItem stores one Bitwarden item as an Aegis entry.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name to use.
+//	item: The Bitwarden login or secure note.
+//	folders: The export's folder names by id.
+//
+// Returns:
+//
+//	queries.ErrEntryExists if the name is taken, or another error if one occurred.
+func importBitwardenItem(tx *queries.Tx, name string, item bitwarden.Item, folders map[string]string) error {
+	var details queries.EntryDetails
+	extras := queries.EntryExtras{Notes: item.Notes}
+	password := ""
+
+	if item.FolderID != nil {
+		details.Folder = folders[*item.FolderID]
+	}
+	if item.Favorite {
+		details.Tags = []string{bitwarden.FavoriteTag}
+	}
+
+	if login := item.Login; login != nil {
+		password = login.Password
+		details.Login = login.Username
+		extras.TOTP = login.TOTP
+		for i, uri := range login.URIs {
+			if i == 0 {
+				details.URL = uri.URI
+				continue
+			}
+			extras.Fields = append(extras.Fields, queries.CustomField{Name: bitwarden.ExtraURLField, Value: uri.URI})
+		}
+	}
+
+	for _, field := range item.Fields {
+		switch field.Type {
+		case bitwarden.FieldLinked:
+			// Linked fields only point at other fields of the item.
+			continue
+		case bitwarden.FieldBoolean:
+			value, _ := strconv.ParseBool(field.Value)
+			extras.Fields = append(extras.Fields, queries.CustomField{Name: field.Name, Value: strconv.FormatBool(value)})
+		default:
+			extras.Fields = append(extras.Fields, queries.CustomField{Name: field.Name, Value: field.Value, Hidden: field.Type == bitwarden.FieldHidden})
+		}
+	}
+
+	if err := tx.AddNewPassword(name, password); err != nil {
+		return err
+	}
+	if err := tx.SetEntryDetails(name, details); err != nil {
+		return err
+	}
+	if !extras.IsZero() {
+		if err := tx.SetEntryExtras(name, extras); err != nil {
+			return err
+		}
+	}
+
+	var createdOn, updatedOn time.Time
+	if item.CreationDate != nil {
+		createdOn = item.CreationDate.UTC()
+	}
+	if item.RevisionDate != nil {
+		updatedOn = item.RevisionDate.UTC()
+	}
+	return keepTimestamps(tx, name, createdOn, updatedOn)
+}
+
+// uniqueName picks an entry name for an imported item. Bitwarden and KeePass
+// allow several items with the same name, so later ones get the login or a
+// number appended.
+//
+// Args:
+//
+//	name: The item name.
+//	login: The item's login, or "".
+//	taken: The names already used by this import.
+//
+// Returns:
+//
+//	A name not in taken.
+func uniqueName(name, login string, taken map[string]bool) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Untitled"
+	}
+	if !taken[name] {
+		return name
+	}
+
+	if login != "" {
+		withLogin := fmt.Sprintf("%s (%s)", name, login)
+		if !taken[withLogin] {
+			return withLogin
+		}
+	}
+
+	for i := 2; ; i++ {
+		numbered := fmt.Sprintf("%s (%d)", name, i)
+		if !taken[numbered] {
+			return numbered
+		}
+	}
+}
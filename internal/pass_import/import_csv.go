@@ -1,120 +1,390 @@
 package pass_import
 
 import (
+	"aegis/internal/aegiscsv"
 	"aegis/internal/queries"
-	"database/sql"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 )
 
-// ImportPasswordsCsv imports passwords from a CSV file into the database.
+// csvFile is a CSV file to import and the profile describing it. The file
+// is read once for the preview and again when the preview is applied, so
+// its entries are never all held in memory.
+type csvFile struct {
+	path    string
+	profile CSVProfile
+}
+
+// decodedRecord is a record of an import file turned into an entry.
+type decodedRecord struct {
+	// title is the entry name the record asks for.
+	title string
+	entry candidate
+	// invalid says why the record cannot be imported, "" if it can.
+	invalid string
+	// err is set if encrypting the entry failed.
+	err error
+}
+
+// decodeMode says what a recordDecoder does with the encrypted columns of
+// an Aegis export. Plaintext exports ignore it.
+type decodeMode int
+
+const (
+	// decodeEncrypted keeps the encrypted columns as they are.
+	decodeEncrypted decodeMode = iota
+	// decodeVerified keeps them, but checks that the password decrypts with
+	// the master password, so an entry that could never be read is not
+	// added.
+	decodeVerified
+	// decodePlaintext decrypts the password and extras.
+	decodePlaintext
+)
+
+// anotherMasterPassword is why a row of an Aegis export whose password does
+// not decrypt is invalid.
+const anotherMasterPassword = "the password was encrypted with another master password"
+
+// recordDecoder turns a record of an import file into an entry. It runs on
+// several goroutines at once.
+type recordDecoder func(record []string, mode decodeMode) decodedRecord
+
+// ImportCsv imports a CSV file written by Aegis or exported from another
+// password manager, as described by CSVProfiles, resolving every conflict
+// with one strategy.
 //
 // Args:
 //
 //	filePath: The path to the CSV file to be imported.
+//	profileID: The id of the import profile, or "" to detect it from the header.
+//	strategy: What to do with rows whose name is in the vault with other contents.
+//	mode: Whether a row that cannot be stored undoes the whole import.
 //
 // Returns:
 //
-//	An error if one occurred.
-func ImportPasswordsCsv(filePath string) error {
-	file, err := os.Open(filePath)
+//	What was imported, and ErrUnknownCSV if the format cannot be detected,
+//	or another error if one occurred.
+func ImportCsv(filePath, profileID string, strategy Strategy, mode ImportMode) (Report, error) {
+	preview, err := PreviewCsv(filePath, profileID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	preview.SetStrategy(strategy)
+	return preview.Apply(mode, nil)
+}
+
+// PreviewCsv reads a CSV file written by Aegis or exported from another
+// password manager and compares it with the vault, without changing the
+// vault. The file is read one record at a time.
+//
+// Args:
+//
+//	filePath: The path to the CSV file to be imported.
+//	profileID: The id of the import profile, or "" to detect it from the header.
+//
+// Returns:
+//
+//	The preview, and ErrUnknownCSV if the format cannot be detected, or
+//	another error if one occurred.
+func PreviewCsv(filePath, profileID string) (*Preview, error) {
+	file, reader, header, err := openCsv(filePath)
 	if err != nil {
-		return fmt.Errorf("Cannot open CSV: %w", err)
+		return nil, err
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	profile, err := DetectCSVProfile(header)
+	if profileID != "" {
+		var ok bool
+		if profile, ok = CSVProfileByID(profileID); !ok {
+			return nil, fmt.Errorf("unknown import profile %q", profileID)
+		}
+	} else if err != nil {
+		return nil, err
+	}
 
-	records, err := reader.ReadAll()
+	source := csvFile{path: filePath, profile: profile}
+	decode, err := source.decoder(header)
 	if err != nil {
-		return fmt.Errorf("Failed to read CSV: %w", err)
+		return nil, err
 	}
-	if len(records) < 2 {
-		return fmt.Errorf("CSV must contain at least 1 row of data")
+	preview, err := newPreview(source, reader, decode)
+	if err != nil {
+		return nil, err
+	}
+	if len(preview.Rows) == 0 {
+		return nil, fmt.Errorf("CSV must contain at least 1 row of data")
 	}
 
-	preparedStmt, err := queries.InsertNewPasswordsFromFile()
+	return preview, nil
+}
+
+// openCsv opens a CSV file and reads its header.
+//
+// Args:
+//
+//	filePath: The path to the CSV file.
+//
+// Returns:
+//
+//	The open file, to be closed by the caller, a reader positioned after the
+//	header, the header and an error if one occurred.
+func openCsv(filePath string) (*os.File, *csv.Reader, []string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("Error preparing while preparing statement: %w", err)
+		return nil, nil, nil, fmt.Errorf("Cannot open CSV: %w", err)
 	}
-	defer preparedStmt.Close()
 
-	writeRecords(records, preparedStmt)
+	reader := csv.NewReader(file)
+	// Exports of other tools do not always give every row every column.
+	reader.FieldsPerRecord = -1
 
-	return nil
+	header, err := reader.Read()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("Failed to read CSV: %w", err)
+	}
+
+	return file, reader, header, nil
 }
 
-// writeRecords writes password records to the database.
+// decoder returns the decoder for the records of the file.
 //
 // Args:
 //
-//	records: A 2D string slice containing the password records.
-//	stmt: The prepared statement to use for inserting the records.
+//	header: The file's header.
 //
 // Returns:
 //
-//	An error if one occurred.
-func writeRecords(records [][]string, stmt *sql.Stmt) error {
-	for _, row := range records[1:] {
-		username := row[0]
+//	The decoder and an error if the header cannot be read.
+func (f csvFile) decoder(header []string) (recordDecoder, error) {
+	if f.profile.ID == ProfileAegis {
+		return aegisDecoder(header)
+	}
+	return profileDecoder(header, f.profile), nil
+}
 
-		hash, err := parseByteArray(row[1])
-		if err != nil {
-			log.Printf("invalid hash: %v", err)
-			continue
+// namer returns the function that names the valid records of the file, in
+// file order. Plaintext exports can hold several records with one name, so
+// later ones get the login or a number appended; the names in an Aegis
+// export are kept, and repeats are reported as invalid by the preview. The
+// names are copied, since a field of a CSV record shares its memory with
+// the whole record.
+//
+// Returns:
+//
+//	The naming function.
+func (f csvFile) namer() func(title, login string) string {
+	if f.profile.ID == ProfileAegis {
+		return func(title, _ string) string { return strings.Clone(title) }
+	}
+
+	names := make(map[string]bool)
+	return func(title, login string) string {
+		name := strings.Clone(uniqueName(title, login, names))
+		names[name] = true
+		return name
+	}
+}
+
+// aegisDecoder returns a decoder for the records of an Aegis CSV export.
+// Columns are found by name; exports made by older versions lack the later
+// columns and the format version.
+//
+// Args:
+//
+//	header: The file's header.
+//
+// Returns:
+//
+//	The decoder and an error if the header lacks a required column or has
+//	an unsupported format version.
+func aegisDecoder(header []string) (recordDecoder, error) {
+	columns := normaliseHeader(header)
+	version, err := aegiscsv.HeaderVersion(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	column := func(name string) int { return slices.Index(columns, name) }
+	nameColumn := column("username")
+	if nameColumn < 0 {
+		return nil, errors.New("the CSV has no username column")
+	}
+	urlColumn, loginColumn, folderColumn, tagsColumn := column("url"), column("login"), column("folder"), column("tags")
+	createdColumn, updatedColumn := column("created_on"), column("updated_on")
+	var encryptedColumns [7]int
+	for i, name := range []string{"password_hash", "password_ciphertext", "nonce", "salt", "extras_ciphertext", "extras_nonce", "extras_salt"} {
+		encryptedColumns[i] = column(name)
+		if encryptedColumns[i] < 0 && i < 4 {
+			return nil, fmt.Errorf("the CSV has no %s column", name)
 		}
-		cipher, err := parseByteArray(row[2])
-		if err != nil {
-			log.Printf("invalid cipher: %v", err)
-			continue
+	}
+
+	verified := &verifiedPasswords{}
+	return func(record []string, mode decodeMode) decodedRecord {
+		title := optionalField(record, nameColumn)
+		entry := candidate{
+			details: queries.EntryDetails{
+				URL:    optionalField(record, urlColumn),
+				Login:  optionalField(record, loginColumn),
+				Folder: optionalField(record, folderColumn),
+				Tags:   queries.SplitTags(optionalField(record, tagsColumn)),
+			},
 		}
-		nonce, err := parseByteArray(row[3])
+		entry.createdOn, _ = queries.ParseTimestamp(optionalField(record, createdColumn))
+		entry.updatedOn, _ = queries.ParseTimestamp(optionalField(record, updatedColumn))
+
+		encrypted, err := parseEncryptedColumns(record, version, encryptedColumns)
 		if err != nil {
-			log.Printf("invalid nonce: %v", err)
-			continue
+			return decodedRecord{title: title, invalid: err.Error()}
 		}
-		salt, err := parseByteArray(row[4])
-		if err != nil {
-			log.Printf("invalid salt: %v", err)
-			continue
+		if title == "" {
+			return decodedRecord{title: title, invalid: "the row has no name"}
+		}
+		if mode == decodeVerified && !verified.check(encrypted) {
+			return decodedRecord{title: title, invalid: anotherMasterPassword}
+		}
+		if mode != decodePlaintext {
+			entry.encrypted = &encrypted
+			return decodedRecord{title: title, entry: entry}
 		}
 
-		_, err = stmt.Exec(username, hash, cipher, nonce, salt)
+		password, err := queries.DecryptWithMasterPass(encrypted.PasswordCiphertext, encrypted.Nonce, encrypted.Salt)
 		if err != nil {
-			log.Printf("insert error: %v", err)
+			return decodedRecord{title: title, invalid: anotherMasterPassword}
 		}
-	}
+		entry.password = string(password)
+		if entry.extras, err = decryptExtras(encrypted); err != nil {
+			return decodedRecord{title: title, invalid: fmt.Sprintf("invalid extras: %v", err)}
+		}
+
+		return decodedRecord{title: title, entry: entry}
+	}, nil
+}
 
-	return nil
+// verifiedPasswords checks that the encrypted passwords of an Aegis export
+// decrypt with the master password. Each check derives a key, so the
+// password last found to decrypt is remembered, and rows that carry the
+// very same ciphertext, as copies of one entry do, are not checked again.
+type verifiedPasswords struct {
+	mu   sync.Mutex
+	last string
 }
 
-// parseByteArray parses a string representation of a byte array into a byte slice.
+// check decrypts the password of a record, unless it was the last one
+// found to decrypt.
 //
 // Args:
 //
-//	s: The string to parse.
+//	encrypted: The record's encrypted columns.
 //
 // Returns:
 //
-//	The parsed byte slice and an error if one occurred.
-func parseByteArray(s string) ([]byte, error) {
-	s = strings.Trim(s, "[]")
-	if s == "" {
-		return []byte{}, nil
+//	True if the password decrypts with the master password.
+func (v *verifiedPasswords) check(encrypted queries.EncryptedEntry) bool {
+	key := string(encrypted.Salt) + "\x00" + string(encrypted.Nonce) + "\x00" + string(encrypted.PasswordCiphertext)
+
+	v.mu.Lock()
+	known := v.last == key
+	v.mu.Unlock()
+	if known {
+		return true
 	}
 
-	parts := strings.Fields(s)
-	result := make([]byte, len(parts))
-	for i, part := range parts {
-		n, err := strconv.Atoi(part)
+	if _, err := queries.DecryptWithMasterPass(encrypted.PasswordCiphertext, encrypted.Nonce, encrypted.Salt); err != nil {
+		return false
+	}
+
+	v.mu.Lock()
+	v.last = key
+	v.mu.Unlock()
+	return true
+}
+
+// parseEncryptedColumns reads the encrypted password and extras of an Aegis
+// CSV record.
+//
+// Args:
+//
+//	record: The CSV record.
+//	version: The format version of the file.
+//	columns: The indexes of the hash, ciphertext, nonce, salt and extras
+//	ciphertext, nonce and salt columns, -1 for missing extras columns.
+//
+// Returns:
+//
+//	The encrypted entry and an error saying why the record is invalid.
+func parseEncryptedColumns(record []string, version int, columns [7]int) (queries.EncryptedEntry, error) {
+	var fields [7][]byte
+	names := []string{"hash", "cipher", "nonce", "salt", "extras", "extras nonce", "extras salt"}
+	for i, column := range columns {
+		if i < 4 && column >= len(record) {
+			return queries.EncryptedEntry{}, fmt.Errorf("the row has %d columns", len(record))
+		}
+		value, err := aegiscsv.ParseBytes(version, optionalField(record, column))
 		if err != nil {
-			return nil, fmt.Errorf("invalid byte value %q: %w", part, err)
+			return queries.EncryptedEntry{}, fmt.Errorf("invalid %s: %w", names[i], err)
 		}
-		result[i] = byte(n)
+		fields[i] = value
+	}
+
+	entry := queries.EncryptedEntry{PasswordHash: fields[0], PasswordCiphertext: fields[1], Nonce: fields[2], Salt: fields[3]}
+	// Entries without extras get NULL columns, as if they had been added locally.
+	if len(fields[4]) > 0 {
+		entry.ExtrasCiphertext, entry.ExtrasNonce, entry.ExtrasSalt = fields[4], fields[5], fields[6]
+	}
+	return entry, nil
+}
+
+// decryptExtras decrypts the extras of an Aegis CSV record.
+//
+// Args:
+//
+//	encrypted: The record's encrypted columns.
+//
+// Returns:
+//
+//	The extras, empty if the record has none, and an error if they could not
+//	be decrypted.
+func decryptExtras(encrypted queries.EncryptedEntry) (queries.EntryExtras, error) {
+	if encrypted.ExtrasCiphertext == nil {
+		return queries.EntryExtras{}, nil
+	}
+
+	plaintext, err := queries.DecryptWithMasterPass(encrypted.ExtrasCiphertext, encrypted.ExtrasNonce, encrypted.ExtrasSalt)
+	if err != nil {
+		return queries.EntryExtras{}, errors.New("they were encrypted with another master password")
+	}
+
+	var extras queries.EntryExtras
+	if err := json.Unmarshal(plaintext, &extras); err != nil {
+		return queries.EntryExtras{}, err
+	}
+	return extras, nil
+}
+
+// optionalField returns a field of a CSV row, or an empty string when the
+// column is missing.
+//
+// Args:
+//
+//	row: The CSV row.
+//	column: The column index, or -1 if the file has no such column.
+//
+// Returns:
+//
+//	The field value.
+func optionalField(row []string, column int) string {
+	if column < 0 || column >= len(row) {
+		return ""
 	}
-	return result, nil
+	return row[column]
 }
@@ -0,0 +1,201 @@
+package pass_import
+
+import (
+	"aegis/internal/bitwarden"
+	"aegis/internal/kdbx"
+	"aegis/internal/queries"
+
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ImportKeePassKDBX imports every entry of a KeePass KDBX 4 database. Groups
+// become folders, and the notes, TOTP settings, custom string fields,
+// password history, attachments and creation and modification times are
+// kept; additional URLs become "URL" fields as in the Bitwarden import. The
+// recycle bin is left out, and entries whose name is taken are skipped.
+//
+// Args:
+//
+//	filePath: The path to the database.
+//	key: The master password and key file of the database.
+//	mode: Whether an entry that cannot be stored undoes the whole import.
+//	progress: Called after each entry with the number done and the total, or nil.
+//
+// Returns:
+//
+//	What was imported, and kdbx.ErrWrongKey if the key does not open the
+//	database, or another error if one occurred.
+func ImportKeePassKDBX(filePath string, key kdbx.Key, mode ImportMode, progress func(done, total int)) (Report, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("cannot open KeePass database: %w", err)
+	}
+	defer file.Close()
+
+	db, err := kdbx.Read(file, key)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return runBatch(mode, progress, countKeePassEntries(db.Root), func(b *batch) error {
+		return importKeePassGroup(b, db.Root, "", make(map[string]bool))
+	})
+}
+
+// countKeePassEntries counts the entries of a group and its subgroups.
+//
+// Args:
+//
+//	group: The group.
+//
+// Returns:
+//
+//	The number of entries.
+func countKeePassEntries(group *kdbx.Group) int {
+	count := len(group.Entries)
+	for _, sub := range group.Groups {
+		count += countKeePassEntries(sub)
+	}
+	return count
+}
+
+// importKeePassGroup imports the entries of a group and its subgroups.
+//
+// Args:
+//
+//	b: The import.
+//	group: The group.
+//	folder: The folder its entries go in; "" for the root group.
+//	names: The names already used by this import, added to.
+//
+// Returns:
+//
+//	An error if an entry could not be stored in strict mode.
+func importKeePassGroup(b *batch, group *kdbx.Group, folder string, names map[string]bool) error {
+	for _, entry := range group.Entries {
+		name := uniqueName(entry.Get(kdbx.FieldTitle), entry.Get(kdbx.FieldUserName), names)
+		names[name] = true
+
+		if err := b.add(name, func(tx *queries.Tx) error { return importKeePassEntry(tx, name, folder, entry) }); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range group.Groups {
+		if err := importKeePassGroup(b, sub, queries.NormaliseFolder(folder+"/"+sub.Name), names); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importKeePassEntry stores one KeePass entry as an Aegis entry.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name to use.
+//	folder: The folder of the entry's group.
+//	entry: The KeePass entry.
+//
+// Returns:
+//
+//	queries.ErrEntryExists if the name is taken, or another error if one occurred.
+func importKeePassEntry(tx *queries.Tx, name, folder string, entry *kdbx.Entry) error {
+	details := queries.EntryDetails{
+		URL:    entry.Get(kdbx.FieldURL),
+		Login:  entry.Get(kdbx.FieldUserName),
+		Folder: folder,
+		Tags:   entry.Tags,
+	}
+	extras := queries.EntryExtras{
+		Notes:   entry.Get(kdbx.FieldNotes),
+		TOTP:    totpSecret(entry.Get(kdbx.FieldOTP)),
+		History: passwordHistory(entry),
+	}
+
+	for _, field := range entry.Fields {
+		switch field.Name {
+		case kdbx.FieldTitle, kdbx.FieldUserName, kdbx.FieldPassword, kdbx.FieldURL, kdbx.FieldNotes, kdbx.FieldOTP:
+			continue
+		}
+		name := field.Name
+		if strings.HasPrefix(name, kdbx.FieldExtraURL) && !field.Protected {
+			name = bitwarden.ExtraURLField
+		}
+		extras.Fields = append(extras.Fields, queries.CustomField{Name: name, Value: field.Value, Hidden: field.Protected})
+	}
+	for _, attachment := range entry.Attachments {
+		extras.Attachments = append(extras.Attachments, queries.Attachment{Name: attachment.Name, Data: attachment.Data})
+	}
+
+	if err := tx.AddNewPassword(name, entry.Get(kdbx.FieldPassword)); err != nil {
+		return err
+	}
+	if err := tx.SetEntryDetails(name, details); err != nil {
+		return err
+	}
+	if !extras.IsZero() {
+		if err := tx.SetEntryExtras(name, extras); err != nil {
+			return err
+		}
+	}
+
+	return keepTimestamps(tx, name, entry.CreationTime, entry.LastModificationTime)
+}
+
+// totpSecret undoes what a KeePass export does to a bare TOTP secret: a URI
+// that holds nothing but the secret, as Aegis writes, is turned back into the
+// secret. URIs with an issuer, period or other settings are kept whole.
+//
+// Args:
+//
+//	otp: The entry's otp field.
+//
+// Returns:
+//
+//	The TOTP secret or URI to store.
+func totpSecret(otp string) string {
+	parsed, err := url.Parse(otp)
+	if err != nil || parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		return otp
+	}
+	query := parsed.Query()
+	if len(query) != 1 || len(query["secret"]) != 1 || query.Get("secret") == "" {
+		return otp
+	}
+	return query.Get("secret")
+}
+
+// passwordHistory collects the earlier passwords from the history of a
+// KeePass entry. KeePass keeps a version for every edit, so versions that
+// did not change the password are dropped.
+//
+// Args:
+//
+//	entry: The KeePass entry.
+//
+// Returns:
+//
+//	The earlier passwords, oldest first.
+func passwordHistory(entry *kdbx.Entry) []queries.PasswordChange {
+	var history []queries.PasswordChange
+	previous := ""
+	for _, version := range entry.History {
+		password := version.Get(kdbx.FieldPassword)
+		if password == "" || password == previous {
+			continue
+		}
+		previous = password
+		history = append(history, queries.PasswordChange{Password: password, ChangedOn: version.LastModificationTime})
+	}
+
+	if n := len(history); n > 0 && history[n-1].Password == entry.Get(kdbx.FieldPassword) {
+		history = history[:n-1]
+	}
+	return history
+}
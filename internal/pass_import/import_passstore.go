@@ -0,0 +1,134 @@
+package pass_import
+
+import (
+	"aegis/internal/passstore"
+	"aegis/internal/queries"
+
+	"path"
+	"slices"
+	"strings"
+)
+
+// passStoreLoginKeys and passStoreURLKeys are the metadata keys, in lower
+// case, that the tools around pass read as the login and the URL.
+var (
+	passStoreLoginKeys = []string{"login", "username", "user", "email"}
+	passStoreURLKeys   = []string{"url", "website", "site"}
+)
+
+// passStoreTagsKey is the metadata key the Aegis pass export writes the tags
+// under.
+const passStoreTagsKey = "tags"
+
+// ImportPassStore imports every entry of a password store. The directories
+// of an entry become its folder and its file name its name. The first line
+// is the password; login, URL and tags metadata lines fill those fields,
+// an otpauth:// line becomes the TOTP setting, other "key: value" lines
+// become custom fields and the remaining lines the notes. Entries whose
+// name is taken are skipped; in lenient mode, entries that cannot be
+// decrypted are reported and the others imported.
+//
+// Args:
+//
+//	dir: The root directory of the store.
+//	keys: The secret keys the entries are encrypted to, unlocked.
+//	mode: Whether an entry that cannot be read or stored undoes the whole import.
+//	progress: Called after each entry with the number done and the total, or nil.
+//
+// Returns:
+//
+//	What was imported, and passstore.ErrNotStore or passstore.ErrNoSecretKey
+//	if the store cannot be read with the keys, or another error if one
+//	occurred.
+func ImportPassStore(dir string, keys *passstore.KeyRing, mode ImportMode, progress func(done, total int)) (Report, error) {
+	paths, err := passstore.List(dir)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return runBatch(mode, progress, len(paths), func(b *batch) error {
+		names := make(map[string]bool, len(paths))
+		for _, entryPath := range paths {
+			entry, err := passstore.Read(dir, entryPath, keys)
+			if err != nil {
+				if err := b.fail(entryPath, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			folder, base := path.Split(entry.Path)
+			details, extras := passStoreEntryDetails(entry)
+			details.Folder = queries.NormaliseFolder(folder)
+
+			name := uniqueName(base, details.Login, names)
+			names[name] = true
+
+			err = b.add(name, func(tx *queries.Tx) error { return importPassStoreEntry(tx, name, entry.Password, details, extras) })
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// passStoreEntryDetails sorts the metadata of a pass entry into Aegis fields.
+// The first login and URL lines are used; later ones are kept as custom
+// fields.
+//
+// Args:
+//
+//	entry: The pass entry.
+//
+// Returns:
+//
+//	The details, without the folder, and the extras of the entry.
+func passStoreEntryDetails(entry passstore.Entry) (queries.EntryDetails, queries.EntryExtras) {
+	var details queries.EntryDetails
+	extras := queries.EntryExtras{Notes: entry.Notes, TOTP: entry.OTP}
+
+	for _, field := range entry.Fields {
+		key := strings.ToLower(field.Name)
+		switch {
+		case details.Login == "" && slices.Contains(passStoreLoginKeys, key):
+			details.Login = field.Value
+		case details.URL == "" && slices.Contains(passStoreURLKeys, key):
+			details.URL = field.Value
+		case key == passStoreTagsKey:
+			details.Tags = append(details.Tags, strings.Split(field.Value, ",")...)
+		default:
+			extras.Fields = append(extras.Fields, queries.CustomField{Name: field.Name, Value: field.Value})
+		}
+	}
+
+	return details, extras
+}
+
+// importPassStoreEntry stores one pass entry as an Aegis entry.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name to use.
+//	password: The password.
+//	details: The URL, login, folder and tags.
+//	extras: The notes, TOTP setting and custom fields.
+//
+// Returns:
+//
+//	queries.ErrEntryExists if the name is taken, or another error if one occurred.
+func importPassStoreEntry(tx *queries.Tx, name, password string, details queries.EntryDetails, extras queries.EntryExtras) error {
+	if err := tx.AddNewPassword(name, password); err != nil {
+		return err
+	}
+	if err := tx.SetEntryDetails(name, details); err != nil {
+		return err
+	}
+	if !extras.IsZero() {
+		return tx.SetEntryExtras(name, extras)
+	}
+
+	return nil
+}
@@ -0,0 +1,744 @@
+package pass_import
+
+import (
+	"aegis/internal/queries"
+
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RowStatus says how a row of an import file relates to the vault.
+type RowStatus int
+
+const (
+	// StatusNew is a row whose name is not in the vault yet.
+	StatusNew RowStatus = iota
+	// StatusIdentical is a row the vault already holds unchanged.
+	StatusIdentical
+	// StatusConflict is a row whose name is in the vault with other contents.
+	StatusConflict
+	// StatusInvalid is a row that cannot be imported.
+	StatusInvalid
+)
+
+// String names the status.
+//
+// Returns:
+//
+//	"new", "identical", "conflict" or "invalid".
+func (s RowStatus) String() string {
+	switch s {
+	case StatusNew:
+		return "new"
+	case StatusIdentical:
+		return "identical"
+	case StatusConflict:
+		return "conflict"
+	default:
+		return "invalid"
+	}
+}
+
+// Strategy decides what importing a conflicting row does.
+type Strategy int
+
+const (
+	// StrategySkip keeps the vault's entry and drops the row.
+	StrategySkip Strategy = iota
+	// StrategyOverwrite replaces the vault's entry with the row. The replaced
+	// password is kept in the entry's password history.
+	StrategyOverwrite
+	// StrategyKeepBoth adds the row as a new entry with a name of its own.
+	StrategyKeepBoth
+	// StrategyNewer overwrites the vault's entry if the row's password was
+	// changed more recently, and skips the row otherwise, including when the
+	// file does not say when it was changed.
+	StrategyNewer
+)
+
+// Strategies lists the conflict strategies in the order they are offered.
+var Strategies = []Strategy{StrategySkip, StrategyOverwrite, StrategyKeepBoth, StrategyNewer}
+
+// String names the strategy.
+//
+// Returns:
+//
+//	"skip", "overwrite", "keep-both" or "newer".
+func (s Strategy) String() string {
+	switch s {
+	case StrategyOverwrite:
+		return "overwrite"
+	case StrategyKeepBoth:
+		return "keep-both"
+	case StrategyNewer:
+		return "newer"
+	default:
+		return "skip"
+	}
+}
+
+// ParseStrategy looks up a conflict strategy by name.
+//
+// Args:
+//
+//	name: The name, as returned by Strategy.String.
+//
+// Returns:
+//
+//	The strategy and an error if there is none with that name.
+func ParseStrategy(name string) (Strategy, error) {
+	for _, strategy := range Strategies {
+		if strategy.String() == strings.ToLower(name) {
+			return strategy, nil
+		}
+	}
+	return StrategySkip, fmt.Errorf("unknown conflict strategy %q", name)
+}
+
+// candidate is an entry read from an import file.
+type candidate struct {
+	password  string
+	details   queries.EntryDetails
+	extras    queries.EntryExtras
+	createdOn time.Time
+	updatedOn time.Time
+	// encrypted holds the password and extras encrypted with the master
+	// password, when they already are; the plaintext fields are then unset.
+	encrypted *queries.EncryptedEntry
+}
+
+// PreviewRow is one row of an import file and what importing it would do.
+type PreviewRow struct {
+	// Row is the record number in the file, the header being 1.
+	Row    int
+	Name   string
+	Status RowStatus
+	// Reason says why an invalid row cannot be imported, or what differs
+	// between a conflicting row and the vault's entry.
+	Reason string
+	// Strategy is applied to the row if it is a conflict.
+	Strategy Strategy
+
+	existing map[string]string
+}
+
+// Preview is the outcome of reading an import file before anything is
+// written to the vault. It holds no passwords; applying it reads the file
+// again.
+type Preview struct {
+	Rows []*PreviewRow
+
+	source csvFile
+}
+
+// errFileChanged is returned when the file of a preview changed before the
+// preview was applied.
+var errFileChanged = errors.New("the file changed since it was previewed; preview it again")
+
+// ImportMode says what happens when a row of an import cannot be stored.
+type ImportMode int
+
+const (
+	// ModeStrict undoes the whole import.
+	ModeStrict ImportMode = iota
+	// ModeLenient undoes the failing row alone and imports the others.
+	ModeLenient
+)
+
+// Report sums up what applying a preview, or another import, did.
+type Report struct {
+	Added       int
+	Overwritten int
+	KeptBoth    int
+	Skipped     int
+	Identical   int
+	Invalid     int
+	// Failed counts the rows a lenient import could not store, and Failures
+	// says why.
+	Failed   int
+	Failures []string
+	// Notes says which entries of an import without a preview were skipped
+	// or invalid, and why.
+	Notes []string
+}
+
+// String sums up the report in one line.
+//
+// Returns:
+//
+//	The counts, such as "3 added, 1 overwritten, 0 kept both, 2 skipped,
+//	4 identical, 1 invalid", followed by the failed rows if there are any.
+func (r Report) String() string {
+	summary := fmt.Sprintf("%d added, %d overwritten, %d kept both, %d skipped, %d identical, %d invalid",
+		r.Added, r.Overwritten, r.KeptBoth, r.Skipped, r.Identical, r.Invalid)
+	if r.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed", r.Failed)
+	}
+	return summary
+}
+
+// Count counts the rows with a status.
+//
+// Args:
+//
+//	status: The status to count.
+//
+// Returns:
+//
+//	The number of rows.
+func (p *Preview) Count(status RowStatus) int {
+	n := 0
+	for _, row := range p.Rows {
+		if row.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// SetStrategy applies one strategy to every conflicting row.
+//
+// Args:
+//
+//	strategy: The strategy.
+func (p *Preview) SetStrategy(strategy Strategy) {
+	for _, row := range p.Rows {
+		if row.Status == StatusConflict {
+			row.Strategy = strategy
+		}
+	}
+}
+
+// invalidRow records a row that cannot be imported.
+//
+// Args:
+//
+//	row: The record number in the file.
+//	name: The entry name, if the row has one.
+//	reason: Why the row is invalid.
+//
+// Returns:
+//
+//	The preview row.
+func invalidRow(row int, name, reason string) *PreviewRow {
+	return &PreviewRow{Row: row, Name: name, Status: StatusInvalid, Reason: reason}
+}
+
+// newPreview reads the records of an import file and compares each with
+// the vault, marking it as new, identical, conflicting or invalid. Records
+// that repeat an earlier record's name are invalid. The first pass decrypts
+// nothing; compare then decrypts, on the worker pool, the records whose name
+// is in the vault and the passwords of the new records of an Aegis export.
+//
+// Args:
+//
+//	source: The file.
+//	reader: The reader of the file, positioned after the header.
+//	decode: The decoder for its records.
+//
+// Returns:
+//
+//	The preview, and queries.ErrWrongMasterPass if the file was encrypted
+//	with another master password, or another error if the file or the vault
+//	could not be read.
+func newPreview(source csvFile, reader *csv.Reader, decode recordDecoder) (*Preview, error) {
+	preview := &Preview{source: source}
+	name := source.namer()
+	seen := make(map[string]int)
+	pending := 0
+
+	err := streamRecords(reader, func(_ int, record []string) decodedRecord {
+		return decode(record, decodeEncrypted)
+	}, func(index int, record decodedRecord) error {
+		row, err := classify(index+2, name, record, seen)
+		if err != nil {
+			return err
+		}
+		if preview.needsCompare(row) {
+			pending++
+		}
+
+		preview.Rows = append(preview.Rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if pending > 0 {
+		if err := preview.compare(decode); err != nil {
+			return nil, err
+		}
+	}
+
+	return preview, nil
+}
+
+// classify looks up the name of one record of an import file in the vault.
+// A record whose name is taken is left for compare, with the entry it
+// would change.
+//
+// Args:
+//
+//	rowNumber: The record number in the file, the header being 1.
+//	name: Names the valid records, in file order.
+//	record: The decoded record.
+//	seen: The names of the earlier records and their record numbers, added to.
+//
+// Returns:
+//
+//	The preview row and an error if the vault could not be read.
+func classify(rowNumber int, name func(title, login string) string, record decodedRecord, seen map[string]int) (*PreviewRow, error) {
+	if record.invalid != "" {
+		return invalidRow(rowNumber, strings.Clone(record.title), record.invalid), nil
+	}
+
+	row := &PreviewRow{Row: rowNumber, Name: name(record.title, record.entry.details.Login)}
+	if first, ok := seen[row.Name]; ok {
+		return invalidRow(rowNumber, row.Name, fmt.Sprintf("the name is already used by row %d", first)), nil
+	}
+	seen[row.Name] = rowNumber
+
+	existing, err := queries.FetchUserEntry(row.Name)
+	if errors.Is(err, queries.ErrNotFound) {
+		row.Status = StatusNew
+		return row, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	row.Status = StatusConflict
+	row.existing = existing
+	return row, nil
+}
+
+// comparison is the outcome of comparing a record with the entry of the
+// same name, or of checking the password of a new record.
+type comparison struct {
+	compared bool
+	changed  []string
+	invalid  string
+	err      error
+}
+
+// needsCompare reports whether compare must decrypt a row: rows whose name
+// is in the vault are compared with their entry, and new rows of an Aegis
+// export, which are added still encrypted, are checked to decrypt with the
+// master password.
+//
+// Args:
+//
+//	row: The row, as classified.
+//
+// Returns:
+//
+//	True if compare decrypts the row.
+func (p *Preview) needsCompare(row *PreviewRow) bool {
+	return row.existing != nil || (row.Status == StatusNew && p.source.profile.ID == ProfileAegis)
+}
+
+// compare reads the file of a preview again, on the worker pool, and
+// decrypts the rows needsCompare picks. Rows whose name is in the vault are
+// marked as identical or conflicting, and rows that cannot be decrypted as
+// invalid. If no row of an Aegis export decrypts, the file is refused.
+//
+// Args:
+//
+//	decode: The decoder of the file.
+//
+// Returns:
+//
+//	queries.ErrWrongMasterPass if the file was encrypted with another
+//	master password, or another error if the file or the vault could not be
+//	read.
+func (p *Preview) compare(decode recordDecoder) error {
+	file, reader, _, err := openCsv(p.source.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pending := 0
+	for _, row := range p.Rows {
+		if p.needsCompare(row) {
+			pending++
+		}
+	}
+	decrypted, undecryptable := 0, 0
+
+	err = streamRecords(reader, func(index int, record []string) comparison {
+		if index >= len(p.Rows) {
+			return comparison{}
+		}
+		row := p.Rows[index]
+		if !p.needsCompare(row) {
+			return comparison{}
+		}
+
+		if row.existing == nil {
+			decoded := decode(record, decodeVerified)
+			return comparison{compared: true, invalid: decoded.invalid}
+		}
+		decoded := decode(record, decodePlaintext)
+		if decoded.invalid != "" {
+			return comparison{compared: true, invalid: decoded.invalid}
+		}
+		changed, err := differences(row.Name, row.existing, decoded.entry)
+		return comparison{compared: true, changed: changed, err: err}
+	}, func(index int, result comparison) error {
+		if index >= len(p.Rows) {
+			return errFileChanged
+		}
+		if result.err != nil {
+			return result.err
+		}
+		if !result.compared {
+			return nil
+		}
+		pending--
+		if result.invalid == anotherMasterPassword {
+			undecryptable++
+		} else {
+			decrypted++
+		}
+
+		row := p.Rows[index]
+		switch {
+		case result.invalid != "":
+			*row = *invalidRow(row.Row, row.Name, result.invalid)
+		case row.existing == nil:
+			// A new row whose password decrypts stays new.
+		case len(result.changed) == 0:
+			row.Status = StatusIdentical
+		default:
+			row.Reason = "differs in " + strings.Join(result.changed, ", ")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return errFileChanged
+	}
+	if undecryptable > 0 && decrypted == 0 && p.source.profile.ID == ProfileAegis {
+		return fmt.Errorf("%w: the file was exported from a vault with another master password", queries.ErrWrongMasterPass)
+	}
+	return nil
+}
+
+// differences lists what importing a row would change in an entry. The
+// password history is not compared, since overwriting keeps it.
+//
+// Args:
+//
+//	name: The entry name.
+//	existing: The entry as returned by queries.FetchUserEntry.
+//	entry: The row's contents.
+//
+// Returns:
+//
+//	The names of the differing fields and an error if the entry could not
+//	be read.
+func differences(name string, existing map[string]string, entry candidate) ([]string, error) {
+	samePassword, err := queries.PasswordMatches(name, entry.password)
+	if err != nil {
+		return nil, err
+	}
+	extras, err := queries.FetchEntryExtras(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []string
+	differ := func(field string, equal bool) {
+		if !equal {
+			differences = append(differences, field)
+		}
+	}
+	differ("password", samePassword)
+	differ("URL", existing["url"] == entry.details.URL)
+	differ("login", existing["login"] == entry.details.Login)
+	differ("folder", existing["folder"] == queries.NormaliseFolder(entry.details.Folder))
+	differ("tags", existing["tags"] == queries.JoinTags(entry.details.Tags))
+	differ("notes", extras.Notes == entry.extras.Notes)
+	differ("TOTP", extras.TOTP == entry.extras.TOTP)
+	differ("custom fields", slices.Equal(extras.Fields, entry.extras.Fields))
+	differ("attachments", slices.EqualFunc(extras.Attachments, entry.extras.Attachments, func(a, b queries.Attachment) bool {
+		return a.Name == b.Name && string(a.Data) == string(b.Data)
+	}))
+
+	return differences, nil
+}
+
+// Apply imports the rows of a preview in one transaction: new rows are
+// added, identical and invalid rows are left out, and conflicting rows
+// follow their strategy. The file is read again one record at a time, and
+// the entries to add are encrypted by a bounded pool of workers.
+//
+// Args:
+//
+//	mode: Whether a row that cannot be stored undoes the whole import or
+//	only itself.
+//	progress: Called after each row with the number of rows done and the
+//	total, or nil.
+//
+// Returns:
+//
+//	What was done, and an error if the import was undone or could not be
+//	committed.
+func (p *Preview) Apply(mode ImportMode, progress func(done, total int)) (Report, error) {
+	var report Report
+	if err := snapshotBeforeImport(); err != nil {
+		return report, err
+	}
+
+	err := queries.WithTransaction(func(tx *queries.Tx) error {
+		usernames, err := tx.FetchUsernames()
+		if err != nil {
+			return fmt.Errorf("error fetching entries: %w", err)
+		}
+		taken := make(map[string]bool, len(usernames)+len(p.Rows))
+		for _, username := range usernames {
+			taken[username] = true
+		}
+		for _, row := range p.Rows {
+			taken[row.Name] = true
+		}
+
+		file, reader, header, err := openCsv(p.source.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		decode, err := p.source.decoder(header)
+		if err != nil {
+			return err
+		}
+		name := p.source.namer()
+
+		return streamRecords(reader, func(index int, record []string) decodedRecord {
+			if index >= len(p.Rows) {
+				return decodedRecord{}
+			}
+			return prepareRecord(p.Rows[index], record, decode)
+		}, func(index int, record decodedRecord) error {
+			if index >= len(p.Rows) {
+				return errFileChanged
+			}
+			row := p.Rows[index]
+			if record.invalid == "" && name(record.title, record.entry.details.Login) != row.Name {
+				return errFileChanged
+			}
+
+			err := record.err
+			if err == nil {
+				if mode == ModeStrict {
+					err = applyRow(tx, row, record.entry, taken, &report)
+				} else {
+					err = tx.WithSavepoint(func() error { return applyRow(tx, row, record.entry, taken, &report) })
+				}
+			}
+			if err != nil {
+				if mode == ModeStrict {
+					return err
+				}
+				report.Failed++
+				report.Failures = append(report.Failures, fmt.Sprintf("row %d: %v", row.Row, err))
+			}
+
+			if progress != nil {
+				progress(index+1, len(p.Rows))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("nothing was imported: %w", err)
+	}
+
+	return report, nil
+}
+
+// prepareRecord decodes a record for applying its preview row, encrypting
+// the entry if it is to be added. It runs on the worker pool.
+//
+// Args:
+//
+//	row: The record's preview row.
+//	record: The record.
+//	decode: The decoder of the file.
+//
+// Returns:
+//
+//	The decoded record, with err set if it could not be encrypted.
+func prepareRecord(row *PreviewRow, record []string, decode recordDecoder) decodedRecord {
+	overwrites := row.Status == StatusConflict && (row.Strategy == StrategyOverwrite || row.Strategy == StrategyNewer)
+	adds := row.Status == StatusNew || (row.Status == StatusConflict && row.Strategy == StrategyKeepBoth)
+
+	mode := decodeEncrypted
+	if overwrites {
+		mode = decodePlaintext
+	}
+	decoded := decode(record, mode)
+	if decoded.invalid != "" || !adds || decoded.entry.encrypted != nil {
+		return decoded
+	}
+
+	encrypted, err := queries.EncryptEntry(decoded.entry.password, decoded.entry.extras)
+	if err != nil {
+		decoded.err = fmt.Errorf("could not encrypt %q: %w", row.Name, err)
+		return decoded
+	}
+	decoded.entry.encrypted = &encrypted
+	return decoded
+}
+
+// applyRow imports one row of a preview and counts it in the report.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	row: The row.
+//	entry: The row's contents, read from the file again.
+//	taken: The entry names in use, for rows kept under a new name.
+//	report: The report to count the row in.
+//
+// Returns:
+//
+//	An error if the row could not be stored.
+func applyRow(tx *queries.Tx, row *PreviewRow, entry candidate, taken map[string]bool, report *Report) error {
+	switch row.Status {
+	case StatusInvalid:
+		report.Invalid++
+		return nil
+	case StatusIdentical:
+		report.Identical++
+		return nil
+	case StatusNew:
+		err := addEntry(tx, row.Name, entry)
+		if errors.Is(err, queries.ErrEntryExists) {
+			report.Skipped++
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not import %q: %w", row.Name, err)
+		}
+		report.Added++
+		return nil
+	}
+
+	strategy := row.Strategy
+	if strategy == StrategyNewer {
+		strategy = StrategySkip
+		updatedOn, err := queries.ParseTimestamp(row.existing["updated_on"])
+		if err == nil && entry.updatedOn.After(updatedOn) {
+			strategy = StrategyOverwrite
+		}
+	}
+
+	switch strategy {
+	case StrategyOverwrite:
+		if err := overwriteEntry(tx, row.Name, row.existing, entry); err != nil {
+			return fmt.Errorf("could not overwrite %q: %w", row.Name, err)
+		}
+		report.Overwritten++
+	case StrategyKeepBoth:
+		name := uniqueName(row.Name, entry.details.Login, taken)
+		taken[name] = true
+		if err := addEntry(tx, name, entry); err != nil {
+			return fmt.Errorf("could not import %q as %q: %w", row.Name, name, err)
+		}
+		report.KeptBoth++
+	default:
+		report.Skipped++
+	}
+	return nil
+}
+
+// addEntry stores a row as a new entry.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name.
+//	entry: The row's contents.
+//
+// Returns:
+//
+//	queries.ErrEntryExists if the name is taken, or another error if one
+//	occurred.
+func addEntry(tx *queries.Tx, name string, entry candidate) error {
+	encrypted := entry.encrypted
+	if encrypted == nil {
+		e, err := queries.EncryptEntry(entry.password, entry.extras)
+		if err != nil {
+			return err
+		}
+		encrypted = &e
+	}
+
+	if err := tx.AddEncryptedEntry(name, *encrypted); err != nil {
+		return err
+	}
+	if err := tx.SetEntryDetails(name, entry.details); err != nil {
+		return err
+	}
+	if !entry.createdOn.IsZero() && !entry.updatedOn.IsZero() {
+		return tx.SetEntryTimestamps(name, entry.createdOn, entry.updatedOn)
+	}
+	return nil
+}
+
+// overwriteEntry replaces an entry with a row. The entry keeps its password
+// history, and its current password joins the history if the row changes it.
+//
+// Args:
+//
+//	tx: The import's transaction.
+//	name: The entry name.
+//	existing: The entry as returned by queries.FetchUserEntry.
+//	entry: The row's contents.
+//
+// Returns:
+//
+//	An error if one occurred.
+func overwriteEntry(tx *queries.Tx, name string, existing map[string]string, entry candidate) error {
+	password, err := tx.FetchPassword(name)
+	if err != nil {
+		return err
+	}
+	current, err := tx.FetchEntryExtras(name)
+	if err != nil {
+		return err
+	}
+
+	extras := entry.extras
+	extras.History = current.History
+	if password != entry.password {
+		changedOn, _ := queries.ParseTimestamp(existing["updated_on"])
+		extras.History = append(extras.History, queries.PasswordChange{Password: password, ChangedOn: changedOn})
+		if err := tx.EditUserPassword(entry.password, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.SetEntryDetails(name, entry.details); err != nil {
+		return err
+	}
+	if !entry.updatedOn.IsZero() {
+		createdOn, err := queries.ParseTimestamp(existing["created_on"])
+		if err != nil {
+			createdOn = entry.updatedOn
+		}
+		if err := tx.SetEntryTimestamps(name, createdOn, entry.updatedOn); err != nil {
+			return err
+		}
+	}
+	return tx.SetEntryExtras(name, extras)
+}
@@ -0,0 +1,21 @@
+package pass_import
+
+import (
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+
+	"fmt"
+)
+
+// snapshotBeforeImport takes a snapshot of the vault before an import
+// changes it, unless automatic snapshots are turned off.
+//
+// Returns:
+//
+//	An error if the snapshot could not be taken.
+func snapshotBeforeImport() error {
+	if err := snapshot.TakeBefore(queries.DB, snapshot.ReasonImport); err != nil {
+		return fmt.Errorf("could not back up the vault before importing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pass_import
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// decodeWorkers bounds how many records are decrypted or encrypted at once.
+// Each key derivation takes 32 MiB, so this also bounds the memory an import
+// needs, whatever the size of the file.
+var decodeWorkers = runtime.NumCPU()
+
+// streamRecords reads the data records of a CSV file one at a time and runs
+// decode on up to decodeWorkers of them at once, handing the results to
+// consume in file order. Only a few records are held in memory at a time.
+//
+// Args:
+//
+//	reader: The CSV reader, positioned after the header.
+//	decode: Does the CPU-heavy work for one record; index counts data
+//	records from 0. It runs on several goroutines at once.
+//	consume: Receives the decoded records in order. Returning an error
+//	stops the stream.
+//
+// Returns:
+//
+//	The first error of reader or consume.
+func streamRecords[T any](reader *csv.Reader, decode func(index int, record []string) T, consume func(index int, result T) error) error {
+	type job struct {
+		index  int
+		record []string
+		result chan T
+	}
+
+	jobs := make(chan job)
+	ordered := make(chan job, 2*decodeWorkers)
+	done := make(chan struct{})
+	defer close(done)
+
+	for range decodeWorkers {
+		go func() {
+			for j := range jobs {
+				j.result <- decode(j.index, j.record)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+
+		for index := 0; ; index++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				readErr <- nil
+				return
+			}
+			if err != nil {
+				readErr <- fmt.Errorf("Failed to read CSV: %w", err)
+				return
+			}
+
+			j := job{index: index, record: record, result: make(chan T, 1)}
+			select {
+			case ordered <- j:
+			case <-done:
+				readErr <- nil
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-done:
+				readErr <- nil
+				return
+			}
+		}
+	}()
+
+	for j := range ordered {
+		if err := consume(j.index, <-j.result); err != nil {
+			return err
+		}
+	}
+	return <-readErr
+}
@@ -0,0 +1,204 @@
+package pass_import
+
+import (
+	"aegis/internal/pass_export"
+	"aegis/internal/queries"
+
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamEntries is the number of entries the streaming round trip moves.
+const streamEntries = 100_000
+
+// streamAttachmentSize is the size of the attachment each entry carries, so
+// that holding every entry in memory at once would far exceed
+// streamHeapLimit.
+const streamAttachmentSize = 2048
+
+// streamHeapLimit bounds how much the heap may grow while a file of
+// streamEntries entries is imported. The preview keeps a small row per
+// entry; the entries themselves, about 300 MiB in the file, must not be
+// held.
+const streamHeapLimit = 96 << 20
+
+// openTestVault points the queries package at an empty vault in a
+// temporary directory, unlocked with a fixed master password, and keeps
+// snapshots in that directory too.
+//
+// Args:
+//
+//	t: The test.
+func openTestVault(t testing.TB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "pm.sqlite")+"?_journal_mode=WAL&_busy_timeout=10000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := queries.DB
+	queries.DB = db
+	t.Cleanup(func() {
+		db.Close()
+		queries.DB = previous
+	})
+
+	queries.CreatePasswordsTable()
+	queries.SetMasterPass([]byte("stream-test-master"))
+	t.Cleanup(queries.ClearMasterPass)
+}
+
+// seedVault stores synthetic entries that share one encrypted password and
+// one encrypted extras document, since encrypting each would take a key
+// derivation per entry.
+//
+// Args:
+//
+//	t: The test.
+//	count: The number of entries.
+//	extras: The extras every entry gets.
+func seedVault(t testing.TB, count int, extras queries.EntryExtras) {
+	t.Helper()
+
+	encrypted, err := queries.EncryptEntry("synthetic-password", extras)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = queries.WithTransaction(func(tx *queries.Tx) error {
+		for i := range count {
+			if err := tx.AddEncryptedEntry(fmt.Sprintf("entry-%06d", i), encrypted); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// peakHeap samples the heap while fn runs.
+//
+// Args:
+//
+//	fn: The work to measure.
+//
+// Returns:
+//
+//	How far the heap grew above its size before fn, at most.
+func peakHeap(fn func()) uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	fn()
+	close(done)
+	wg.Wait()
+
+	if peak < base {
+		return 0
+	}
+	return peak - base
+}
+
+// TestStreamingRoundTrip exports a large vault to an Aegis CSV file and
+// imports it into an empty vault, checking that every entry arrives intact
+// and that the import's memory does not grow with the file.
+func TestStreamingRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("moves 100k entries")
+	}
+
+	attachment := make([]byte, streamAttachmentSize)
+	for i := range attachment {
+		attachment[i] = byte(i)
+	}
+	extras := queries.EntryExtras{
+		Notes:       "synthetic entry",
+		Attachments: []queries.Attachment{{Name: "blob.bin", Data: attachment}},
+	}
+
+	openTestVault(t)
+	seedVault(t, streamEntries, extras)
+
+	csvPath := filepath.Join(t.TempDir(), "export.csv")
+	if err := pass_export.ExportPasswordsCsv(csvPath, pass_export.Filter{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// The second vault uses the same master password, as an Aegis CSV file
+	// can only be imported by the vault it was encrypted for.
+	openTestVault(t)
+
+	var report Report
+	var importErr error
+	grown := peakHeap(func() {
+		report, importErr = ImportCsv(csvPath, ProfileAegis, StrategySkip, ModeStrict)
+	})
+	if importErr != nil {
+		t.Fatalf("import: %v", importErr)
+	}
+	t.Logf("heap grew by %d MiB importing %d entries", grown>>20, streamEntries)
+
+	if report.Added != streamEntries || report.Invalid != 0 || report.Failed != 0 {
+		t.Fatalf("report = %s, want %d added", report, streamEntries)
+	}
+	usernames, err := queries.FetchUsernames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usernames) != streamEntries {
+		t.Fatalf("the vault holds %d entries, want %d", len(usernames), streamEntries)
+	}
+
+	for _, name := range []string{"entry-000000", fmt.Sprintf("entry-%06d", streamEntries-1)} {
+		password, err := queries.FetchPassword(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password != "synthetic-password" {
+			t.Errorf("%s: password = %q", name, password)
+		}
+		got, err := queries.FetchEntryExtras(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Notes != extras.Notes || len(got.Attachments) != 1 || string(got.Attachments[0].Data) != string(attachment) {
+			t.Errorf("%s: the extras did not survive the round trip", name)
+		}
+	}
+
+	if grown > streamHeapLimit {
+		t.Errorf("the heap grew by %d MiB, more than the %d MiB limit", grown>>20, streamHeapLimit>>20)
+	}
+}
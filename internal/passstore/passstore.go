@@ -0,0 +1,447 @@
+// Package passstore reads and writes password stores, the directory trees of
+// pass, the standard Unix password manager. Each entry is a file ending in
+// .gpg, encrypted with OpenPGP to the keys listed in the .gpg-id file of the
+// store. By convention the first line of an entry is the password and the
+// lines after it hold "key: value" metadata, an otpauth:// URI for pass-otp
+// and free-form notes.
+package passstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// Extension is the file name extension of entries.
+const Extension = ".gpg"
+
+// gpgIDFile lists the keys the entries of a store are encrypted to, one
+// fingerprint, key ID or email address per line.
+const gpgIDFile = ".gpg-id"
+
+// otpauthPrefix starts the TOTP URI line pass-otp adds to an entry.
+const otpauthPrefix = "otpauth://"
+
+var (
+	// ErrNotStore is returned for a directory without a .gpg-id file.
+	ErrNotStore = errors.New("not a password store: the directory has no .gpg-id file")
+	// ErrNoSecretKey is returned when an entry is encrypted to none of the given keys.
+	ErrNoSecretKey = errors.New("the entry is not encrypted to any of the given secret keys")
+	// ErrWrongPassphrase is returned when the passphrase does not unlock the secret keys.
+	ErrWrongPassphrase = errors.New("wrong passphrase for the OpenPGP secret key")
+	// ErrNoKeys is returned when a key file holds no OpenPGP keys.
+	ErrNoKeys = errors.New("the key file holds no OpenPGP keys")
+	// ErrNotEmpty is returned when a store would be written into a directory that is in use.
+	ErrNotEmpty = errors.New("the directory is not empty")
+)
+
+// Entry is one entry of a store.
+type Entry struct {
+	// Path is the path of the entry in the store, slash-separated and
+	// without the .gpg extension, such as "email/example.com".
+	Path string
+	// Password is the first line of the entry.
+	Password string
+	// Fields are the "key: value" lines, in order.
+	Fields []Field
+	// OTP is the first otpauth:// URI line, or "".
+	OTP string
+	// Notes are the other lines.
+	Notes string
+}
+
+// Field is a "key: value" line of an entry.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// KeyRing holds the OpenPGP keys a store is read or written with.
+type KeyRing struct {
+	entities openpgp.EntityList
+}
+
+// ReadKeyRing reads the OpenPGP keys of a file, armored or binary, as
+// written by `gpg --export` or `gpg --export-secret-keys`.
+//
+// Args:
+//
+//	filePath: The path to the key file.
+//
+// Returns:
+//
+//	The keys and ErrNoKeys or another error if the file cannot be read.
+func ReadKeyRing(filePath string) (*KeyRing, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	var entities openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+	if len(entities) == 0 {
+		return nil, ErrNoKeys
+	}
+	return &KeyRing{entities: entities}, nil
+}
+
+// Locked reports whether any secret key of the ring is protected by a
+// passphrase.
+//
+// Returns:
+//
+//	True if Unlock must be called before the keys can decrypt.
+func (k *KeyRing) Locked() bool {
+	for _, entity := range k.entities {
+		if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+			return true
+		}
+		for _, sub := range entity.Subkeys {
+			if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unlock decrypts the secret keys of the ring with a passphrase.
+//
+// Args:
+//
+//	passphrase: The passphrase of the keys.
+//
+// Returns:
+//
+//	ErrWrongPassphrase if it does not unlock every key.
+func (k *KeyRing) Unlock(passphrase []byte) error {
+	for _, entity := range k.entities {
+		if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+			return ErrWrongPassphrase
+		}
+	}
+	return nil
+}
+
+// Fingerprints lists the fingerprints of the keys of the ring, as written
+// to a .gpg-id file.
+//
+// Returns:
+//
+//	The fingerprints in upper-case hex.
+func (k *KeyRing) Fingerprints() []string {
+	fingerprints := make([]string, len(k.entities))
+	for i, entity := range k.entities {
+		fingerprints[i] = fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	}
+	return fingerprints
+}
+
+// Walk decrypts every entry of a store in path order. Hidden files and
+// directories, such as the .git directory, are skipped.
+//
+// Args:
+//
+//	dir: The root directory of the store.
+//	keys: The secret keys, unlocked.
+//	fn: Called with each entry; an error stops the walk and is returned.
+//
+// Returns:
+//
+//	ErrNotStore, ErrNoSecretKey or another error if one occurred.
+func Walk(dir string, keys *KeyRing, fn func(Entry) error) error {
+	paths, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entryPath := range paths {
+		entry, err := Read(dir, entryPath, keys)
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %w", entryPath, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List finds the entries of a store without decrypting them. Hidden files
+// and directories, such as the .git directory, are skipped.
+//
+// Args:
+//
+//	dir: The root directory of the store.
+//
+// Returns:
+//
+//	The entry paths, such as "work/github", in path order, and ErrNotStore
+//	or another error if one occurred.
+func List(dir string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(dir, gpgIDFile)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotStore
+		}
+		return nil, err
+	}
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), Extension) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, strings.TrimSuffix(filepath.ToSlash(rel), Extension))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// Read decrypts one entry of a store.
+//
+// Args:
+//
+//	dir: The root directory of the store.
+//	entryPath: The entry path, as returned by List.
+//	keys: The secret keys, unlocked.
+//
+// Returns:
+//
+//	The entry and ErrNoSecretKey or another error if one occurred.
+func Read(dir, entryPath string, keys *KeyRing) (Entry, error) {
+	text, err := decryptFile(filepath.Join(dir, filepath.FromSlash(entryPath)+Extension), keys)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Parse(text)
+	entry.Path = entryPath
+	return entry, nil
+}
+
+// decryptFile decrypts one entry file.
+//
+// Args:
+//
+//	filePath: The path to the file.
+//	keys: The secret keys, unlocked.
+//
+// Returns:
+//
+//	The plaintext and ErrNoSecretKey or another error if one occurred.
+func decryptFile(filePath string, keys *KeyRing) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	md, err := openpgp.ReadMessage(file, keys.entities, nil, nil)
+	if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+		return "", ErrNoSecretKey
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The integrity of the message is only checked once it is read to the end.
+	text, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// Parse reads the text of an entry. The first line is the password and the
+// "key: value" lines directly after it are fields; the block of fields ends
+// at the first other line, so later lines such as "Note: rotate monthly"
+// stay in the notes. The first otpauth:// line is the TOTP URI and every
+// other line belongs to the notes.
+//
+// Args:
+//
+//	text: The decrypted entry.
+//
+// Returns:
+//
+//	The entry, without its path.
+func Parse(text string) Entry {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	entry := Entry{Password: lines[0]}
+	var notes []string
+	inFields := true
+	for _, line := range lines[1:] {
+		if entry.OTP == "" && strings.HasPrefix(strings.TrimSpace(line), otpauthPrefix) {
+			entry.OTP = strings.TrimSpace(line)
+			inFields = false
+			continue
+		}
+		if field, ok := parseField(line); ok && inFields {
+			entry.Fields = append(entry.Fields, field)
+			continue
+		}
+		inFields = false
+		notes = append(notes, line)
+	}
+	entry.Notes = strings.Trim(strings.Join(notes, "\n"), "\n")
+	return entry
+}
+
+// parseField reads a "key: value" line.
+//
+// Args:
+//
+//	line: The line.
+//
+// Returns:
+//
+//	The field and false if the line is not a field.
+func parseField(line string) (Field, bool) {
+	name, value, ok := strings.Cut(line, ": ")
+	if !ok || strings.TrimSpace(name) == "" {
+		return Field{}, false
+	}
+	return Field{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)}, true
+}
+
+// Format writes the text of an entry in the layout Parse reads: the
+// password, the fields, the TOTP URI and then the notes. Notes that start
+// with a "key: value" line are set off by an empty line when no TOTP URI
+// separates them from the fields.
+//
+// Returns:
+//
+//	The text, ending with a newline.
+func (e Entry) Format() string {
+	var b strings.Builder
+	b.WriteString(e.Password + "\n")
+	for _, field := range e.Fields {
+		b.WriteString(field.Name + ": " + field.Value + "\n")
+	}
+	if e.OTP != "" {
+		b.WriteString(e.OTP + "\n")
+	}
+	if notes := strings.Trim(e.Notes, "\n"); notes != "" {
+		first, _, _ := strings.Cut(notes, "\n")
+		if _, ok := parseField(first); ok && e.OTP == "" {
+			b.WriteString("\n")
+		}
+		b.WriteString(notes + "\n")
+	}
+	return b.String()
+}
+
+// Writer writes the entries of a new store.
+type Writer struct {
+	dir        string
+	recipients *KeyRing
+}
+
+// NewWriter starts a store in a directory that does not exist or is empty,
+// writing a .gpg-id file with the fingerprints of the recipients.
+//
+// Args:
+//
+//	dir: The root directory of the store.
+//	recipients: The public keys to encrypt the entries to.
+//
+// Returns:
+//
+//	The writer and ErrNotEmpty or another error if one occurred.
+func NewWriter(dir string, recipients *KeyRing) (*Writer, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, ErrNotEmpty
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating directory: %w", err)
+	}
+	gpgID := strings.Join(recipients.Fingerprints(), "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, gpgIDFile), []byte(gpgID), 0600); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", gpgIDFile, err)
+	}
+
+	return &Writer{dir: dir, recipients: recipients}, nil
+}
+
+// Write encrypts an entry to the recipients of the store and writes it,
+// creating its directories as needed.
+//
+// Args:
+//
+//	entry: The entry; its path must be relative, must not leave the store
+//	and must not be taken.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (w *Writer) Write(entry Entry) error {
+	clean := path.Clean(entry.Path)
+	if entry.Path == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid entry path %q", entry.Path)
+	}
+
+	filePath := filepath.Join(w.dir, filepath.FromSlash(clean)+Extension)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating entry: %w", err)
+	}
+
+	plaintext, err := openpgp.Encrypt(file, w.recipients.entities, nil, nil, nil)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error encrypting %q: %w", entry.Path, err)
+	}
+	if _, err := io.WriteString(plaintext, entry.Format()); err != nil {
+		file.Close()
+		return fmt.Errorf("error encrypting %q: %w", entry.Path, err)
+	}
+	if err := plaintext.Close(); err != nil {
+		file.Close()
+		return fmt.Errorf("error encrypting %q: %w", entry.Path, err)
+	}
+
+	return file.Close()
+}
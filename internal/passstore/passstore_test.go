@@ -0,0 +1,169 @@
+package passstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The fixtures in testdata were made with gpg. key.asc is a throwaway key
+// without a passphrase, an ed25519 primary key with a cv25519 encryption
+// subkey:
+//
+//	gpg --batch --passphrase '' --quick-gen-key 'Aegis Test <test@aegis.invalid>' ed25519 sign never
+//	gpg --batch --passphrase '' --quick-add-key FINGERPRINT cv25519 encr never
+//	gpg --armor --export-secret-keys FINGERPRINT > testdata/key.asc
+//
+// testdata/store is a store whose entries were encrypted to it by gpg, as
+// pass does:
+//
+//	printf '...' | gpg --trust-model always -e -r FINGERPRINT -o testdata/store/work/example.gpg
+
+// readTestKeys reads the key of the fixtures.
+//
+// Args:
+//
+//	t: The test.
+//
+// Returns:
+//
+//	The key ring.
+func readTestKeys(t *testing.T) *KeyRing {
+	t.Helper()
+
+	keys, err := ReadKeyRing(filepath.Join("testdata", "key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Locked() {
+		t.Fatal("the test key should not be protected by a passphrase")
+	}
+	return keys
+}
+
+// walkAll reads every entry of a store.
+//
+// Args:
+//
+//	t: The test.
+//	dir: The root directory of the store.
+//	keys: The secret keys.
+//
+// Returns:
+//
+//	The entries in path order.
+func walkAll(t *testing.T, dir string, keys *KeyRing) []Entry {
+	t.Helper()
+
+	var entries []Entry
+	err := Walk(dir, keys, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// TestWalkGPGStore reads a store written by gpg.
+func TestWalkGPGStore(t *testing.T) {
+	keys := readTestKeys(t)
+
+	want := []Entry{
+		{
+			Path:     "notes",
+			Password: "correct horse",
+			Notes:    "Note: rotate monthly\nsecond line",
+		},
+		{
+			Path:     "work/example",
+			Password: "hunter2",
+			Fields:   []Field{{Name: "login", Value: "alice"}, {Name: "url", Value: "https://example.com"}},
+			OTP:      "otpauth://totp/example?secret=JBSWY3DPEHPK3PXP",
+			Notes:    "Note: rotate monthly",
+		},
+	}
+	if got := walkAll(t, filepath.Join("testdata", "store"), keys); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk read\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+// TestWriteRoundTrip writes a store and reads it back.
+func TestWriteRoundTrip(t *testing.T) {
+	keys := readTestKeys(t)
+	dir := filepath.Join(t.TempDir(), "store")
+
+	entries := []Entry{
+		{
+			Path:     "email/example.com",
+			Password: "p@ss: word",
+			Fields:   []Field{{Name: "login", Value: "alice@example.com"}, {Name: "tags", Value: "mail,work"}},
+			OTP:      "otpauth://totp/example.com?secret=JBSWY3DPEHPK3PXP",
+			Notes:    "recovery codes\nin the safe",
+		},
+		{
+			Path:     "notes-only",
+			Password: "",
+			Notes:    "Note: rotate monthly\nOwner: IT",
+		},
+		{
+			Path:     "z/deep/nested",
+			Password: "secret",
+			Fields:   []Field{{Name: "url", Value: "https://nested.example"}},
+			Notes:    "Note: after the fields",
+		},
+	}
+
+	writer, err := NewWriter(dir, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Write(entries[0]); err == nil {
+		t.Error("Write replaced an existing entry")
+	}
+	if err := writer.Write(Entry{Path: "../outside"}); err == nil {
+		t.Error("Write accepted a path outside the store")
+	}
+
+	if got := walkAll(t, dir, keys); !reflect.DeepEqual(got, entries) {
+		t.Errorf("Walk read\n%#v\nwant\n%#v", got, entries)
+	}
+}
+
+// TestParseFields checks that only the lines directly after the password
+// are read as fields.
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		text string
+		want Entry
+	}{
+		{
+			text: "pw\nlogin: alice\nurl: https://example.com\n",
+			want: Entry{Password: "pw", Fields: []Field{{Name: "login", Value: "alice"}, {Name: "url", Value: "https://example.com"}}},
+		},
+		{
+			text: "pw\nlogin: alice\n\nNote: rotate monthly\n",
+			want: Entry{Password: "pw", Fields: []Field{{Name: "login", Value: "alice"}}, Notes: "Note: rotate monthly"},
+		},
+		{
+			text: "pw\nfree text\nNote: rotate monthly\n",
+			want: Entry{Password: "pw", Notes: "free text\nNote: rotate monthly"},
+		},
+		{
+			text: "pw\r\nlogin: alice\r\notpauth://totp/x?secret=ABC\r\nurl: later\r\n",
+			want: Entry{Password: "pw", Fields: []Field{{Name: "login", Value: "alice"}}, OTP: "otpauth://totp/x?secret=ABC", Notes: "url: later"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := Parse(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", test.text, got, test.want)
+		}
+	}
+}
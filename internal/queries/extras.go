@@ -0,0 +1,159 @@
+package queries
+
+import (
+	"aegis/internal/crypto"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CustomField is a named value stored with an entry, such as a PIN or a
+// security question.
+type CustomField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Hidden bool   `json:"hidden,omitempty"`
+}
+
+// PasswordChange is an earlier password of an entry and when it was set,
+// kept from an imported history.
+type PasswordChange struct {
+	Password  string    `json:"password"`
+	ChangedOn time.Time `json:"changed_on"`
+}
+
+// Attachment is a file stored with an entry.
+type Attachment struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// EntryExtras holds the secret details of an entry besides its password.
+// They are encrypted with the master password like the password itself.
+type EntryExtras struct {
+	Notes       string           `json:"notes,omitempty"`
+	TOTP        string           `json:"totp,omitempty"`
+	Fields      []CustomField    `json:"fields,omitempty"`
+	History     []PasswordChange `json:"history,omitempty"`
+	Attachments []Attachment     `json:"attachments,omitempty"`
+}
+
+// IsZero reports whether no extras are set.
+//
+// Returns:
+//
+//	True if there are no notes, TOTP secret, custom fields, password history
+//	or attachments.
+func (e EntryExtras) IsZero() bool {
+	return e.Notes == "" && e.TOTP == "" && len(e.Fields) == 0 && len(e.History) == 0 && len(e.Attachments) == 0
+}
+
+// SetEntryExtras replaces the extras of an entry. Empty extras clear them.
+// The change does not count as a password change.
+//
+// Args:
+//
+//	username: The entry to update.
+//	extras: The new extras.
+//
+// Returns:
+//
+//	ErrNotFound if there is no such entry, or another error if one occurred.
+func SetEntryExtras(username string, extras EntryExtras) error {
+	return setEntryExtras(DB, username, extras)
+}
+
+// setEntryExtras is SetEntryExtras on db, the database or a transaction.
+func setEntryExtras(db execer, username string, extras EntryExtras) error {
+	cipherText, nonce, salt, err := encryptExtras(extras)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`UPDATE pwds SET extras_ciphertext = ?, extras_nonce = ?, extras_salt = ? WHERE username = ?`,
+		cipherText, nonce, salt, username)
+	if err != nil {
+		return fmt.Errorf("failed to update entry extras: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+
+	return nil
+}
+
+// encryptExtras encrypts extras with the master password.
+//
+// Args:
+//
+//	extras: The extras.
+//
+// Returns:
+//
+//	The ciphertext, nonce and salt, all nil for empty extras, and an error if
+//	one occurred.
+func encryptExtras(extras EntryExtras) ([]byte, []byte, []byte, error) {
+	if extras.IsZero() {
+		return nil, nil, nil, nil
+	}
+
+	plaintext, err := json.Marshal(extras)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p := crypto.NewPasswordManager(plaintext, getMasterPass())
+	return p.EncryptPassword()
+}
+
+// FetchEntryExtras decrypts the extras of an entry.
+//
+// Args:
+//
+//	username: The entry to read.
+//
+// Returns:
+//
+//	The extras, empty if none are set, and ErrNotFound, ErrWrongMasterPass or
+//	another error if one occurred.
+func FetchEntryExtras(username string) (EntryExtras, error) {
+	return fetchEntryExtras(DB, username)
+}
+
+// fetchEntryExtras is FetchEntryExtras on db, the database or a transaction.
+func fetchEntryExtras(db execer, username string) (EntryExtras, error) {
+	row := db.QueryRow(`SELECT extras_ciphertext, extras_nonce, extras_salt FROM pwds WHERE username = ?`, username)
+
+	var cipherText, nonce, salt []byte
+	err := row.Scan(&cipherText, &nonce, &salt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EntryExtras{}, fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	if err != nil {
+		return EntryExtras{}, fmt.Errorf("failed to fetch entry extras: %w", err)
+	}
+	if cipherText == nil {
+		return EntryExtras{}, nil
+	}
+
+	p := crypto.NewPasswordManager([]byte{}, getMasterPass())
+	plaintext, err := p.DecryptPassword(cipherText, nonce, salt)
+	if err != nil {
+		return EntryExtras{}, fmt.Errorf("%w: extras of %s could not be decrypted", ErrWrongMasterPass, username)
+	}
+
+	var extras EntryExtras
+	if err := json.Unmarshal(plaintext, &extras); err != nil {
+		return EntryExtras{}, fmt.Errorf("extras of %s are corrupt: %w", username, err)
+	}
+
+	return extras, nil
+}
@@ -0,0 +1,109 @@
+package queries
+
+import (
+	"aegis/internal/crypto"
+
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Keys of the vault's age identity in the meta table. The identity is
+// encrypted with the master password; its public recipient is not secret
+// and is kept in plaintext so it can be shown without decrypting anything.
+const (
+	ageIdentityCiphertextKey = "age_identity_ciphertext"
+	ageIdentityNonceKey      = "age_identity_nonce"
+	ageIdentitySaltKey       = "age_identity_salt"
+	ageRecipientKey          = "age_recipient"
+)
+
+// ErrNoAgeIdentity is returned when the vault has no age identity yet.
+var ErrNoAgeIdentity = errors.New("the vault has no age identity; create one with \"aegis age keygen\"")
+
+// SetAgeIdentity stores the vault's age identity, replacing any earlier one.
+//
+// Args:
+//
+//	identity: The secret identity, as "AGE-SECRET-KEY-1...".
+//	recipient: Its public recipient, as "age1...".
+//
+// Returns:
+//
+//	An error if one occurred.
+func SetAgeIdentity(identity, recipient string) error {
+	p := crypto.NewPasswordManager([]byte(identity), getMasterPass())
+	cipherText, nonce, salt, err := p.EncryptPassword()
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?), (?, ?), (?, ?), (?, ?)`
+	_, err = DB.Exec(stmt,
+		ageIdentityCiphertextKey, cipherText,
+		ageIdentityNonceKey, nonce,
+		ageIdentitySaltKey, salt,
+		ageRecipientKey, []byte(recipient),
+	)
+	if err != nil {
+		return fmt.Errorf("could not store the age identity: %w", err)
+	}
+	return nil
+}
+
+// FetchAgeIdentity decrypts the vault's age identity.
+//
+// Returns:
+//
+//	The secret identity, and ErrNoAgeIdentity, ErrWrongMasterPass or another
+//	error if one occurred.
+func FetchAgeIdentity() (string, error) {
+	values := make(map[string][]byte)
+	for _, key := range []string{ageIdentityCiphertextKey, ageIdentityNonceKey, ageIdentitySaltKey} {
+		value, err := fetchAgeIdentityValue(key)
+		if err != nil {
+			return "", err
+		}
+		values[key] = value
+	}
+
+	identity, err := DecryptWithMasterPass(values[ageIdentityCiphertextKey], values[ageIdentityNonceKey], values[ageIdentitySaltKey])
+	if err != nil {
+		return "", err
+	}
+	return string(identity), nil
+}
+
+// FetchAgeRecipient reads the public recipient of the vault's age identity.
+//
+// Returns:
+//
+//	The recipient, and ErrNoAgeIdentity or another error if one occurred.
+func FetchAgeRecipient() (string, error) {
+	value, err := fetchAgeIdentityValue(ageRecipientKey)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// fetchAgeIdentityValue reads one value of the age identity from the meta table.
+//
+// Args:
+//
+//	key: The meta key.
+//
+// Returns:
+//
+//	The value, and ErrNoAgeIdentity if it is not set or another error.
+func fetchAgeIdentityValue(key string) ([]byte, error) {
+	var value []byte
+	err := DB.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoAgeIdentity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the age identity: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,263 @@
+package queries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// metaGroups are the meta keys that are only ever written together. A group
+// with some of its keys missing cannot be used and its other rows are
+// orphaned.
+var metaGroups = [][]string{
+	{"verifier_ciphertext", "verifier_nonce", "verifier_salt"},
+	{ageIdentityCiphertextKey, ageIdentityNonceKey, ageIdentitySaltKey, ageRecipientKey},
+}
+
+// StoredEntry is an entry exactly as it is stored, still encrypted, used to
+// check rows that may be damaged.
+type StoredEntry struct {
+	// RowID identifies the row even when its name is missing or repeated.
+	RowID    int64
+	Username string
+	EncryptedEntry
+}
+
+// QuarantinedEntry is an entry set aside by QuarantineEntry.
+type QuarantinedEntry struct {
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Reason        string    `json:"reason"`
+	QuarantinedOn time.Time `json:"quarantined_on"`
+}
+
+// CheckIntegrity runs SQLite's integrity check over the whole database file.
+//
+// Returns:
+//
+//	The problems found, none if the file is intact, and an error if the
+//	check could not run.
+func CheckIntegrity() ([]string, error) {
+	rows, err := DB.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("could not run the integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+
+	return problems, rows.Err()
+}
+
+// FetchStoredEntries reads every entry as stored, without decrypting it.
+//
+// Returns:
+//
+//	The entries and an error if one occurred.
+func FetchStoredEntries() ([]StoredEntry, error) {
+	rows, err := DB.Query(`
+		SELECT rowid, username, password_hash, password_ciphertext, nonce, salt,
+			extras_ciphertext, extras_nonce, extras_salt
+		FROM pwds ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []StoredEntry
+	for rows.Next() {
+		var entry StoredEntry
+		var username sql.NullString
+		err := rows.Scan(&entry.RowID, &username, &entry.PasswordHash, &entry.PasswordCiphertext, &entry.Nonce, &entry.Salt,
+			&entry.ExtrasCiphertext, &entry.ExtrasNonce, &entry.ExtrasSalt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Username = username.String
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// QuarantineEntry moves an entry out of the vault into the quarantine table
+// within the transaction, unchanged, so it no longer breaks listing, exports or the GUI but can
+// still be recovered by hand.
+//
+// Args:
+//
+//	rowID: The row of the entry, as in StoredEntry.
+//	reason: Why the entry is set aside.
+//
+// Returns:
+//
+//	ErrNotFound if there is no such row, or another error if one occurred.
+func (t *Tx) QuarantineEntry(rowID int64, reason string) error {
+	stmt := `
+		INSERT INTO quarantine (username, password_hash, password_ciphertext, nonce, salt,
+			created_on, updated_on, url, login, folder, tags,
+			extras_ciphertext, extras_nonce, extras_salt, reason)
+		SELECT COALESCE(username, ''), password_hash, password_ciphertext, nonce, salt,
+			created_on, updated_on, url, login, folder, tags,
+			extras_ciphertext, extras_nonce, extras_salt, ?
+		FROM pwds WHERE rowid = ?`
+	result, err := t.tx.Exec(stmt, reason, rowID)
+	if err != nil {
+		return fmt.Errorf("could not quarantine the entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: row %d", ErrNotFound, rowID)
+	}
+
+	if _, err := t.tx.Exec(`DELETE FROM pwds WHERE rowid = ?`, rowID); err != nil {
+		return fmt.Errorf("could not quarantine the entry: %w", err)
+	}
+	return nil
+}
+
+// FetchQuarantine lists the quarantined entries, oldest first.
+//
+// Returns:
+//
+//	The entries and an error if one occurred.
+func FetchQuarantine() ([]QuarantinedEntry, error) {
+	rows, err := DB.Query(`SELECT id, username, reason, quarantined_on FROM quarantine ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []QuarantinedEntry
+	for rows.Next() {
+		var entry QuarantinedEntry
+		if err := rows.Scan(&entry.ID, &entry.Username, &entry.Reason, &entry.QuarantinedOn); err != nil {
+			return nil, err
+		}
+		entry.QuarantinedOn = entry.QuarantinedOn.UTC()
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// ReleaseQuarantined moves a quarantined entry back into the vault as it
+// was, in its own transaction, for example after the vault it was encrypted
+// for has been found.
+//
+// Args:
+//
+//	id: The ID of the quarantined entry.
+//
+// Returns:
+//
+//	ErrNotFound if there is no such entry, ErrEntryExists if its name is
+//	taken, or another error if one occurred.
+func ReleaseQuarantined(id int64) error {
+	return WithTransaction(func(t *Tx) error { return releaseQuarantined(t.tx, id) })
+}
+
+// releaseQuarantined is ReleaseQuarantined inside a transaction.
+func releaseQuarantined(tx *sql.Tx, id int64) error {
+	var username string
+	err := tx.QueryRow(`SELECT username FROM quarantine WHERE id = ?`, id).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: quarantined entry %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pwds WHERE username = ?)`, username).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", ErrEntryExists, username)
+	}
+
+	stmt := `
+		INSERT INTO pwds (username, password_hash, password_ciphertext, nonce, salt,
+			created_on, updated_on, url, login, folder, tags,
+			extras_ciphertext, extras_nonce, extras_salt)
+		SELECT username, COALESCE(password_hash, x''), COALESCE(password_ciphertext, x''),
+			COALESCE(nonce, x''), COALESCE(salt, x''),
+			COALESCE(created_on, CURRENT_TIMESTAMP), COALESCE(updated_on, CURRENT_TIMESTAMP),
+			COALESCE(url, ''), COALESCE(login, ''), COALESCE(folder, ''), COALESCE(tags, ''),
+			extras_ciphertext, extras_nonce, extras_salt
+		FROM quarantine WHERE id = ?`
+	if _, err := tx.Exec(stmt, id); err != nil {
+		return fmt.Errorf("could not release the entry: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM quarantine WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("could not release the entry: %w", err)
+	}
+	return nil
+}
+
+// FindOrphanedMeta finds meta rows that belong to a group of keys whose
+// other rows are missing, such as half of the age identity.
+//
+// Returns:
+//
+//	The keys of the orphaned rows and an error if one occurred.
+func FindOrphanedMeta() ([]string, error) {
+	var orphaned []string
+	for _, group := range metaGroups {
+		var present []string
+		for _, key := range group {
+			var exists bool
+			if err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM meta WHERE key = ?)`, key).Scan(&exists); err != nil {
+				return nil, err
+			}
+			if exists {
+				present = append(present, key)
+			}
+		}
+		if len(present) > 0 && len(present) < len(group) {
+			orphaned = append(orphaned, present...)
+		}
+	}
+
+	return orphaned, nil
+}
+
+// DeleteMeta removes rows from the meta table within the transaction.
+//
+// Args:
+//
+//	keys: The keys of the rows.
+//
+// Returns:
+//
+//	An error if one occurred.
+func (t *Tx) DeleteMeta(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	if _, err := t.tx.Exec(`DELETE FROM meta WHERE key IN (`+placeholders+`)`, args...); err != nil {
+		return fmt.Errorf("could not remove meta rows: %w", err)
+	}
+	return nil
+}
@@ -1,38 +1,159 @@
 package queries
 
 import (
+	"aegis/internal/config"
 	"aegis/internal/crypto"
 	"aegis/internal/mpass"
+	"aegis/internal/snapshot"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"errors"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
-	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 )
 
-var masterPass = mpass.GetMasterPass()
+// verifierPlaintext is encrypted with the master password when a vault is
+// initialised, so the password can be checked before any entry is touched.
+const verifierPlaintext = "aegis-master-password-verifier"
+
+var (
+	// ErrNotFound is returned when no entry exists for a username.
+	ErrNotFound = errors.New("entry not found")
+	// ErrEntryExists is returned when adding a username that is already stored.
+	ErrEntryExists = errors.New("entry already exists")
+	// ErrWrongMasterPass is returned when the master password does not open the vault.
+	ErrWrongMasterPass = errors.New("wrong master password")
+	// ErrVaultInitialised is returned when initialising a vault that already has a master password.
+	ErrVaultInitialised = errors.New("vault is already initialised")
+)
+
+// migrations upgrade the schema one version at a time. The version a vault
+// is at is kept in SQLite's user_version; never edit or reorder a migration
+// once released, only append new ones.
+var migrations = []string{
+	// 1: a URL and a login name per entry, used to match web and Git credentials.
+	`
+	ALTER TABLE pwds ADD COLUMN url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pwds ADD COLUMN login TEXT NOT NULL DEFAULT '';
+	`,
+	// 2: folders and tags to organise entries, and tokens for the local API
+	// that are scoped to them.
+	`
+	ALTER TABLE pwds ADD COLUMN folder TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pwds ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+	CREATE TABLE api_tokens (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		token_mac BLOB NOT NULL,
+		folders TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '',
+		all_entries INTEGER NOT NULL DEFAULT 0,
+		can_write INTEGER NOT NULL DEFAULT 0,
+		expires_on DATETIME,
+		created_on DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_on DATETIME
+	);
+	`,
+	// 3: notes, a TOTP secret and custom fields per entry, kept together as
+	// one encrypted JSON document.
+	`
+	ALTER TABLE pwds ADD COLUMN extras_ciphertext BLOB;
+	ALTER TABLE pwds ADD COLUMN extras_nonce BLOB;
+	ALTER TABLE pwds ADD COLUMN extras_salt BLOB;
+	`,
+	// 4: entries set aside by "aegis doctor" because they cannot be read,
+	// kept as they were stored. The columns accept anything a damaged row
+	// may hold.
+	`
+	CREATE TABLE quarantine (
+		id INTEGER PRIMARY KEY,
+		username TEXT NOT NULL,
+		password_hash BLOB,
+		password_ciphertext BLOB,
+		nonce BLOB,
+		salt BLOB,
+		created_on DATETIME,
+		updated_on DATETIME,
+		url TEXT,
+		login TEXT,
+		folder TEXT,
+		tags TEXT,
+		extras_ciphertext BLOB,
+		extras_nonce BLOB,
+		extras_salt BLOB,
+		reason TEXT NOT NULL,
+		quarantined_on DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`,
+}
+
+var masterPass []byte
 var DB *sql.DB
 
 func init() {
-	configDir, err := os.UserConfigDir()
+	aegisConfigDir, err := config.Dir()
 	if err != nil {
-		log.Fatal("Could not get user config dir:", err)
+		log.Fatal(err)
 	}
 
-	aegisConfigDir := filepath.Join(configDir, "aegis")
+	DBPath := filepath.Join(aegisConfigDir, "pm.sqlite")
 
-	err = os.MkdirAll(aegisConfigDir, 0700)
+	// WAL lets reads, such as API token checks, go on while an import holds
+	// the write lock; writers wait up to the busy timeout for each other.
+	// Transactions take the write lock when they begin, so one that reads
+	// first cannot fail later when it starts writing.
+	DB, err = sql.Open("sqlite3", "file:"+DBPath+"?_journal_mode=WAL&_busy_timeout=10000&_txlock=immediate")
 	if err != nil {
-		log.Fatalf("Failed to create config dir: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
+}
 
-	DBPath := filepath.Join(aegisConfigDir, "pm.sqlite")
+// SetMasterPass sets the master password used to encrypt and decrypt entries.
+// Without it the password is read from AEGIS_MASTER_PASS on first use.
+//
+// Args:
+//
+//	password: The master password.
+func SetMasterPass(password []byte) {
+	masterPass = password
+}
 
-	DB, err = sql.Open("sqlite3", DBPath)
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+// ClearMasterPass wipes the master password from memory, locking the vault
+// until SetMasterPass is called again.
+func ClearMasterPass() {
+	for i := range masterPass {
+		masterPass[i] = 0
 	}
+	masterPass = nil
+}
+
+// IsUnlocked reports whether a master password has been set.
+//
+// Returns:
+//
+//	True if SetMasterPass was called and the password not cleared since.
+func IsUnlocked() bool {
+	return masterPass != nil
+}
+
+// getMasterPass returns the master password, falling back to the environment.
+//
+// Returns:
+//
+//	The master password as a byte slice.
+func getMasterPass() []byte {
+	if masterPass == nil {
+		masterPass = mpass.GetMasterPass()
+	}
+
+	return masterPass
 }
 
 // CreatePasswordsTable creates the passwords table in the database if it does not already exist.
@@ -52,6 +173,188 @@ func CreatePasswordsTable() {
 	if err != nil {
 		log.Fatalf("Failed to create table %v", err)
 	}
+
+	createMetaTableSQL := `
+	CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value BLOB NOT NULL
+	);
+	`
+	_, err = DB.Exec(createMetaTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create table %v", err)
+	}
+
+	if err := migrate(); err != nil {
+		log.Fatalf("Failed to migrate database %v", err)
+	}
+}
+
+// migrate applies the migrations the database has not seen yet, each in its
+// own transaction together with the user_version bump.
+//
+// Returns:
+//
+//	An error if one occurred.
+func migrate() error {
+	var version int
+	if err := DB.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	if version < len(migrations) {
+		var hasEntries bool
+		if err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM pwds)`).Scan(&hasEntries); err != nil {
+			return err
+		}
+		if hasEntries {
+			if err := snapshot.TakeBefore(DB, snapshot.ReasonMigration); err != nil {
+				return fmt.Errorf("could not back up the vault before migrating it: %w", err)
+			}
+		}
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := DB.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InitVault stores a verifier for the master password so later sessions can
+// check it. Entries already in the vault must decrypt with the password.
+//
+// Returns:
+//
+//	ErrVaultInitialised if a verifier is already stored, ErrWrongMasterPass
+//	if existing entries do not decrypt, or another error if one occurred.
+func InitVault() error {
+	_, _, _, err := fetchVerifier()
+	switch {
+	case err == nil:
+		return ErrVaultInitialised
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	if err := verifyAgainstFirstEntry(); err != nil {
+		return err
+	}
+
+	p := crypto.NewPasswordManager([]byte(verifierPlaintext), getMasterPass())
+	cipherText, nonce, salt, err := p.EncryptPassword()
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO meta (key, value) VALUES (?, ?), (?, ?), (?, ?)`
+	_, err = DB.Exec(stmt,
+		"verifier_ciphertext", cipherText,
+		"verifier_nonce", nonce,
+		"verifier_salt", salt,
+	)
+	return err
+}
+
+// VerifyMasterPass checks the master password against the stored verifier.
+// Vaults created before verifiers existed are checked by decrypting one entry.
+//
+// Returns:
+//
+//	ErrWrongMasterPass if the password is wrong, or another error if one occurred.
+func VerifyMasterPass() error {
+	cipherText, nonce, salt, err := fetchVerifier()
+	if errors.Is(err, sql.ErrNoRows) {
+		return verifyAgainstFirstEntry()
+	}
+	if err != nil {
+		return err
+	}
+
+	p := crypto.NewPasswordManager([]byte{}, getMasterPass())
+	if _, err := p.DecryptPassword(cipherText, nonce, salt); err != nil {
+		return ErrWrongMasterPass
+	}
+
+	return nil
+}
+
+// ConfirmMasterPass checks a password typed again against the master
+// password the vault was unlocked with, before an action that exposes
+// secrets.
+//
+// Args:
+//
+//	password: The password typed again.
+//
+// Returns:
+//
+//	ErrWrongMasterPass if it differs.
+func ConfirmMasterPass(password []byte) error {
+	if subtle.ConstantTimeCompare(password, getMasterPass()) != 1 {
+		return ErrWrongMasterPass
+	}
+	return nil
+}
+
+// fetchVerifier reads the master password verifier from the meta table.
+//
+// Returns:
+//
+//	The verifier ciphertext, nonce, salt, and sql.ErrNoRows if the vault has none.
+func fetchVerifier() ([]byte, []byte, []byte, error) {
+	values := make(map[string][]byte)
+	for _, key := range []string{"verifier_ciphertext", "verifier_nonce", "verifier_salt"} {
+		var value []byte
+		if err := DB.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value); err != nil {
+			return nil, nil, nil, err
+		}
+		values[key] = value
+	}
+
+	return values["verifier_ciphertext"], values["verifier_nonce"], values["verifier_salt"], nil
+}
+
+// verifyAgainstFirstEntry checks the master password by decrypting the first
+// stored entry. An empty vault accepts any password.
+//
+// Returns:
+//
+//	ErrWrongMasterPass if the entry does not decrypt, or another error if one occurred.
+func verifyAgainstFirstEntry() error {
+	row := DB.QueryRow(`SELECT password_ciphertext, nonce, salt FROM pwds LIMIT 1`)
+
+	var cipherText, nonce, salt []byte
+	err := row.Scan(&cipherText, &nonce, &salt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	p := crypto.NewPasswordManager([]byte{}, getMasterPass())
+	if _, err := p.DecryptPassword(cipherText, nonce, salt); err != nil {
+		return ErrWrongMasterPass
+	}
+
+	return nil
 }
 
 // hashPassword hashes a password using SHA256.
@@ -68,49 +371,163 @@ func hashPassword(password string) []byte {
 	return h[:]
 }
 
+// PasswordMatches reports whether an entry's password is the given one by
+// comparing hashes, without decrypting anything.
+//
+// Args:
+//
+//	username: The entry.
+//	password: The password to compare with.
+//
+// Returns:
+//
+//	True if the passwords match, and ErrNotFound or another error if one
+//	occurred.
+func PasswordMatches(username, password string) (bool, error) {
+	return passwordMatches(DB, username, password)
+}
+
+// passwordMatches is PasswordMatches on db, the database or a transaction.
+func passwordMatches(db execer, username, password string) (bool, error) {
+	var passwordHash []byte
+	err := db.QueryRow(`SELECT password_hash FROM pwds WHERE username = ?`, username).Scan(&passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch password hash: %w", err)
+	}
+
+	return string(passwordHash) == string(hashPassword(password)), nil
+}
+
+// EncryptedEntry is the password and extras of an entry encrypted with the
+// master password, as they are stored.
+type EncryptedEntry struct {
+	PasswordHash       []byte
+	PasswordCiphertext []byte
+	Nonce              []byte
+	Salt               []byte
+	// The extras columns are nil for an entry without extras.
+	ExtrasCiphertext []byte
+	ExtrasNonce      []byte
+	ExtrasSalt       []byte
+}
+
+// EncryptEntry encrypts a password and extras with the master password. It
+// does not touch the database, so imports can encrypt many entries at once.
+//
+// Args:
+//
+//	password: The password.
+//	extras: The extras, possibly empty.
+//
+// Returns:
+//
+//	The encrypted entry and an error if one occurred.
+func EncryptEntry(password string, extras EntryExtras) (EncryptedEntry, error) {
+	p := crypto.NewPasswordManager([]byte(password), getMasterPass())
+
+	cipherText, nonce, salt, err := p.EncryptPassword()
+	if err != nil {
+		return EncryptedEntry{}, err
+	}
+	entry := EncryptedEntry{PasswordHash: hashPassword(password), PasswordCiphertext: cipherText, Nonce: nonce, Salt: salt}
+
+	entry.ExtrasCiphertext, entry.ExtrasNonce, entry.ExtrasSalt, err = encryptExtras(extras)
+	if err != nil {
+		return EncryptedEntry{}, err
+	}
+
+	return entry, nil
+}
+
 // AddNewPassword adds a new password to the database.
 //
 // Args:
 //
 //	username: The username for the new password.
 //	password: The password to add.
-func AddNewPassword(username, password string) {
-	userPassword := []byte(password)
-	passwordHash := hashPassword(password)
-
-	p := crypto.NewPasswordManager(userPassword, masterPass)
+//
+// Returns:
+//
+//	ErrEntryExists if the username is already stored, or another error if one occurred.
+func AddNewPassword(username, password string) error {
+	return addNewPassword(DB, username, password)
+}
 
-	cipherText, nonce, salt, err := p.EncryptPassword()
+// addNewPassword is AddNewPassword on db, the database or a transaction.
+func addNewPassword(db execer, username, password string) error {
+	entry, err := EncryptEntry(password, EntryExtras{})
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 
+	return addEncryptedEntry(db, username, entry)
+}
+
+// AddEncryptedEntry adds a new entry whose password and extras are already
+// encrypted with the master password, by EncryptEntry or in an Aegis CSV
+// export of this vault.
+//
+// Args:
+//
+//	username: The username for the new entry.
+//	entry: The encrypted password and extras.
+//
+// Returns:
+//
+//	ErrEntryExists if the username is already stored, or another error if one occurred.
+func AddEncryptedEntry(username string, entry EncryptedEntry) error {
+	return addEncryptedEntry(DB, username, entry)
+}
+
+// addEncryptedEntry is AddEncryptedEntry on db, the database or a transaction.
+func addEncryptedEntry(db execer, username string, entry EncryptedEntry) error {
 	stmt := `
-        INSERT INTO pwds (username, password_hash, password_ciphertext, nonce, salt)
-        VALUES (?, ?, ?, ?, ?);
+        INSERT INTO pwds (username, password_hash, password_ciphertext, nonce, salt,
+            extras_ciphertext, extras_nonce, extras_salt)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (username) DO NOTHING;
     `
-	_, err = DB.Exec(stmt, username, passwordHash, cipherText, nonce, salt)
+	result, err := db.Exec(stmt, username, entry.PasswordHash, entry.PasswordCiphertext, entry.Nonce, entry.Salt,
+		entry.ExtrasCiphertext, entry.ExtrasNonce, entry.ExtrasSalt)
+	if err != nil {
+		return fmt.Errorf("password could not be added in the database: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Fatalf("Password could not be added in the database: %v", err)
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrEntryExists, username)
 	}
+
+	return nil
 }
 
-// InsertNewPasswordsFromFile prepares a statement for inserting new passwords from a file.
+// DecryptWithMasterPass decrypts a value encrypted with the master password,
+// such as the password or extras columns of an Aegis CSV export.
+//
+// Args:
+//
+//	cipherText: The encrypted value.
+//	nonce: Its nonce.
+//	salt: Its salt.
 //
 // Returns:
 //
-//	A prepared statement and an error if one occurred.
-func InsertNewPasswordsFromFile() (*sql.Stmt, error) {
-	stmt, err := DB.Prepare(`
-        INSERT INTO pwds (username, password_hash, password_ciphertext, nonce, salt)
-        VALUES (?, ?, ?, ?, ?);
-    `)
-
+//	The plaintext and ErrWrongMasterPass if it could not be decrypted.
+func DecryptWithMasterPass(cipherText, nonce, salt []byte) ([]byte, error) {
+	p := crypto.NewPasswordManager([]byte{}, getMasterPass())
+	plaintext, err := p.DecryptPassword(cipherText, nonce, salt)
 	if err != nil {
-		return nil, err
+		return nil, ErrWrongMasterPass
 	}
 
-	return stmt, nil
+	return plaintext, nil
 }
 
 // FetchPassword fetches a password from the database and decrypts it.
@@ -121,23 +538,99 @@ func InsertNewPasswordsFromFile() (*sql.Stmt, error) {
 //
 // Returns:
 //
-//	The decrypted password.
-func FetchPassword(username string) string {
-	row := DB.QueryRow(`SELECT password_ciphertext, nonce, salt FROM pwds WHERE username = ?`, username)
+//	The decrypted password, and ErrNotFound, ErrWrongMasterPass or another
+//	error if one occurred.
+func FetchPassword(username string) (string, error) {
+	return fetchPassword(DB, username)
+}
+
+// fetchPassword is FetchPassword on db, the database or a transaction.
+func fetchPassword(db execer, username string) (string, error) {
+	row := db.QueryRow(`SELECT password_ciphertext, nonce, salt FROM pwds WHERE username = ?`, username)
 
 	var cipherText, nonce, salt []byte
 	err := row.Scan(&cipherText, &nonce, &salt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
 	if err != nil {
-		log.Fatalf("Failed to fetch password data: %v", err)
+		return "", fmt.Errorf("failed to fetch password data: %w", err)
 	}
 
-	p := crypto.NewPasswordManager([]byte{}, masterPass)
+	p := crypto.NewPasswordManager([]byte{}, getMasterPass())
 	pass, err := p.DecryptPassword(cipherText, nonce, salt)
 	if err != nil {
-		log.Fatalf("Password could not be decrypted: %v", err)
+		return "", fmt.Errorf("%w: password for %s could not be decrypted", ErrWrongMasterPass, username)
 	}
 
-	return string(pass)
+	return string(pass), nil
+}
+
+// FetchUserEntry fetches the stored details of one entry, without its password.
+//
+// Args:
+//
+//	username: The username of the entry.
+//
+// Returns:
+//
+//	A map with the username, url, login, folder, tags, created_on and
+//	updated_on values, and ErrNotFound or another error if one occurred.
+func FetchUserEntry(username string) (map[string]string, error) {
+	return fetchUserEntry(DB, username)
+}
+
+// fetchUserEntry is FetchUserEntry on db, the database or a transaction.
+func fetchUserEntry(db execer, username string) (map[string]string, error) {
+	row := db.QueryRow(`SELECT url, login, folder, tags, created_on, updated_on FROM pwds WHERE username = ?`, username)
+
+	var url, login, folder, tags, createdOn, updatedOn string
+	err := row.Scan(&url, &login, &folder, &tags, &createdOn, &updatedOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"username":   username,
+		"url":        url,
+		"login":      login,
+		"folder":     folder,
+		"tags":       tags,
+		"created_on": createdOn,
+		"updated_on": updatedOn,
+	}, nil
+}
+
+// FetchUsernames lists the names of all entries.
+//
+// Returns:
+//
+//	The names and an error if one occurred.
+func FetchUsernames() ([]string, error) {
+	return fetchUsernames(DB)
+}
+
+// fetchUsernames is FetchUsernames on db, the database or a transaction.
+func fetchUsernames(db execer) ([]string, error) {
+	rows, err := db.Query(`SELECT username FROM pwds`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, rows.Err()
 }
 
 // FetchUserData fetches all user data from the database.
@@ -146,7 +639,7 @@ func FetchPassword(username string) string {
 //
 //	A slice of maps containing user data and an error if one occurred.
 func FetchUserData() ([]map[string]string, error) {
-	rows, err := DB.Query(`SELECT username, password_ciphertext, password_hash, created_on, updated_on FROM pwds`)
+	rows, err := DB.Query(`SELECT username, password_ciphertext, password_hash, url, login, folder, tags, created_on, updated_on FROM pwds`)
 	if err != nil {
 		return nil, err
 	}
@@ -155,11 +648,11 @@ func FetchUserData() ([]map[string]string, error) {
 	var results []map[string]string
 
 	for rows.Next() {
-		var username, createdOn, updatedOn string
+		var username, url, login, folder, tags, createdOn, updatedOn string
 		var passwordCiphertext []byte
 		var passwordHash []byte
 
-		err := rows.Scan(&username, &passwordCiphertext, &passwordHash, &createdOn, &updatedOn)
+		err := rows.Scan(&username, &passwordCiphertext, &passwordHash, &url, &login, &folder, &tags, &createdOn, &updatedOn)
 		if err != nil {
 			return nil, err
 		}
@@ -167,6 +660,10 @@ func FetchUserData() ([]map[string]string, error) {
 		userMap := make(map[string]string)
 		userMap["username"] = username
 		userMap["password_hash"] = string(passwordHash)
+		userMap["url"] = url
+		userMap["login"] = login
+		userMap["folder"] = folder
+		userMap["tags"] = tags
 		userMap["created_on"] = createdOn
 		userMap["updated_on"] = updatedOn
 		userMap["password_ciphertext"] = string(passwordCiphertext)
@@ -186,22 +683,33 @@ func FetchUserData() ([]map[string]string, error) {
 // Args:
 //
 //	username: The username of the user to delete.
-func DeleteUserByPasswordHash(username string) {
+//
+// Returns:
+//
+//	ErrNotFound if no entry matched, or another error if one occurred.
+func DeleteUserByPasswordHash(username string) error {
+	return deleteUserByPasswordHash(DB, username)
+}
+
+// deleteUserByPasswordHash is DeleteUserByPasswordHash on db, the database or a transaction.
+func deleteUserByPasswordHash(db execer, username string) error {
 	stmt := `DELETE FROM pwds WHERE username = ?`
 
-	result, err := DB.Exec(stmt, username)
+	result, err := db.Exec(stmt, username)
 	if err != nil {
-		log.Printf("failed to delete user by username: %s", err)
+		return fmt.Errorf("failed to delete user by username: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("failed to check rows affected: %s", err)
+		return fmt.Errorf("failed to check rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		log.Printf("no user found with the given username")
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
 	}
+
+	return nil
 }
 
 // EditUserPassword updates a user's password in the database.
@@ -210,7 +718,16 @@ func DeleteUserByPasswordHash(username string) {
 //
 //	newPassword: The new password.
 //	username: The username of the user to update.
-func EditUserPassword(newPassword, username string) {
+//
+// Returns:
+//
+//	ErrNotFound if no entry matched, or another error if one occurred.
+func EditUserPassword(newPassword, username string) error {
+	return editUserPassword(DB, newPassword, username)
+}
+
+// editUserPassword is EditUserPassword on db, the database or a transaction.
+func editUserPassword(db execer, newPassword, username string) error {
 	stmt := `
 		UPDATE pwds
 		SET password_ciphertext = ?, nonce = ?, salt = ?, password_hash = ?, updated_on = datetime('now')
@@ -219,41 +736,208 @@ func EditUserPassword(newPassword, username string) {
 
 	userPassword := []byte(newPassword)
 
-	p := crypto.NewPasswordManager(userPassword, masterPass)
+	p := crypto.NewPasswordManager(userPassword, getMasterPass())
 
 	cipherText, nonce, salt, err := p.EncryptPassword()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 
 	newPasswordHash := hashPassword(newPassword)
 
-	result, err := DB.Exec(stmt, cipherText, nonce, salt, newPasswordHash, username)
+	result, err := db.Exec(stmt, cipherText, nonce, salt, newPasswordHash, username)
+	if err != nil {
+		return fmt.Errorf("failed to update password by username: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+
+	return nil
+}
+
+// EntryDetails holds the descriptive fields of an entry, everything except
+// its name and password.
+type EntryDetails struct {
+	URL    string
+	Login  string
+	Folder string
+	Tags   []string
+}
+
+// SetEntryDetails sets the URL, login, folder and tags of an entry. The
+// password and its age are left alone.
+//
+// Args:
+//
+//	username: The entry to change.
+//	details: The new details; empty fields are cleared.
+//
+// Returns:
+//
+//	ErrNotFound if no entry matched, or another error if one occurred.
+func SetEntryDetails(username string, details EntryDetails) error {
+	return setEntryDetails(DB, username, details)
+}
+
+// setEntryDetails is SetEntryDetails on db, the database or a transaction.
+func setEntryDetails(db execer, username string, details EntryDetails) error {
+	result, err := db.Exec(`UPDATE pwds SET url = ?, login = ?, folder = ?, tags = ? WHERE username = ?`,
+		details.URL, details.Login, NormaliseFolder(details.Folder), JoinTags(details.Tags), username)
 	if err != nil {
-		log.Printf("failed to update password by username: %s", err)
+		return fmt.Errorf("failed to update entry details: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("could not check affected rows: %s", err)
+		return fmt.Errorf("could not check affected rows: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		log.Printf("no entry found with the given username")
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
 	}
+
+	return nil
+}
+
+// SetEntryTimestamps sets when an entry was created and its password last
+// changed, so entries restored from a backup keep their age.
+//
+// Args:
+//
+//	username: The entry to change.
+//	createdOn: The creation time.
+//	updatedOn: The time of the last password change.
+//
+// Returns:
+//
+//	ErrNotFound if no entry matched, or another error if one occurred.
+func SetEntryTimestamps(username string, createdOn, updatedOn time.Time) error {
+	return setEntryTimestamps(DB, username, createdOn, updatedOn)
+}
+
+// setEntryTimestamps is SetEntryTimestamps on db, the database or a transaction.
+func setEntryTimestamps(db execer, username string, createdOn, updatedOn time.Time) error {
+	// The same form as CURRENT_TIMESTAMP, so the column sorts consistently.
+	const layout = "2006-01-02 15:04:05"
+
+	result, err := db.Exec(`UPDATE pwds SET created_on = ?, updated_on = ? WHERE username = ?`,
+		createdOn.UTC().Format(layout), updatedOn.UTC().Format(layout), username)
+	if err != nil {
+		return fmt.Errorf("failed to update entry timestamps: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+
+	return nil
+}
+
+// NormaliseFolder cleans up a folder path such as "/work//ci/" to "work/ci".
+//
+// Args:
+//
+//	folder: The folder path.
+//
+// Returns:
+//
+//	The folder path without empty segments.
+func NormaliseFolder(folder string) string {
+	var segments []string
+	for _, segment := range strings.Split(folder, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// JoinTags stores a set of tags as one sorted, comma-separated string.
+//
+// Args:
+//
+//	tags: The tags; blanks and duplicates are dropped.
+//
+// Returns:
+//
+//	The stored form.
+func JoinTags(tags []string) string {
+	var cleaned []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(strings.ReplaceAll(tag, ",", " "))
+		if tag != "" && !slices.Contains(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	sort.Strings(cleaned)
+	return strings.Join(cleaned, ",")
+}
+
+// SplitTags reads tags stored by JoinTags.
+//
+// Args:
+//
+//	tags: The stored form.
+//
+// Returns:
+//
+//	The tags, or nil if there are none.
+func SplitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
 }
 
 // FetchAllUsers fetches all users from the database.
 //
 // Returns:
 //
-//	An sql.Rows object containing all users.
-func FetchAllUsers() *sql.Rows {
+//	An sql.Rows object containing all users and an error if one occurred.
+func FetchAllUsers() (*sql.Rows, error) {
 	stmt := `SELECT * FROM pwds`
-	rows, err := DB.Query(stmt)
-	if err != nil {
-		log.Fatalln(err)
+	return DB.Query(stmt)
+}
+
+// ParseTimestamp parses a created_on or updated_on value read from the
+// database. SQLite stores CURRENT_TIMESTAMP as text, while the driver may hand
+// DATETIME columns back in RFC 3339 form.
+//
+// Args:
+//
+//	s: The timestamp string.
+//
+// Returns:
+//
+//	The parsed time in UTC and an error if no known layout matched.
+func ParseTimestamp(s string) (time.Time, error) {
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04:05.999999999-07:00",
+		// time.Time.String, as written by Aegis CSV exports.
+		"2006-01-02 15:04:05.999999999 -0700 MST",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
 	}
 
-	return rows
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", s)
 }
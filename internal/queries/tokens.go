@@ -0,0 +1,260 @@
+package queries
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// tokenPrefix starts every API token so they are easy to spot in logs and
+// secret scanners.
+const tokenPrefix = "aegis_"
+
+// ErrTokenInvalid is returned when an API token is unknown, malformed or expired.
+var ErrTokenInvalid = errors.New("invalid or expired API token")
+
+// APIToken describes a token for the local API. The secret part of the token
+// is only known when it is created; the database keeps a MAC of it.
+type APIToken struct {
+	ID         string
+	Name       string
+	Folders    []string
+	Tags       []string
+	All        bool
+	Write      bool
+	ExpiresOn  time.Time
+	CreatedOn  time.Time
+	LastUsedOn time.Time
+}
+
+// Expired reports whether the token has passed its expiry time.
+//
+// Args:
+//
+//	now: The current time.
+//
+// Returns:
+//
+//	True if the token expires and that time has passed.
+func (t APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresOn.IsZero() && !now.Before(t.ExpiresOn)
+}
+
+// tokenMAC authenticates a token with a key only the master password holder
+// has, so a row written straight into the database cannot grant access.
+//
+// Args:
+//
+//	token: The full token.
+//
+// Returns:
+//
+//	The MAC to store or compare.
+func tokenMAC(token string) []byte {
+	key := sha256.Sum256(append([]byte("aegis-api-token:"), getMasterPass()...))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
+
+// CreateAPIToken stores a new API token.
+//
+// Args:
+//
+//	t: The token's name, scope, permission and expiry. Its ID and
+//	timestamps are filled in.
+//
+// Returns:
+//
+//	The token to hand to the client, the stored description and an error if
+//	one occurred.
+func CreateAPIToken(t APIToken) (string, APIToken, error) {
+	idBytes := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", APIToken{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIToken{}, err
+	}
+
+	t.ID = hex.EncodeToString(idBytes)
+	t.CreatedOn = time.Now().UTC().Truncate(time.Second)
+	t.LastUsedOn = time.Time{}
+	token := tokenPrefix + t.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	var expiresOn sql.NullTime
+	if !t.ExpiresOn.IsZero() {
+		t.ExpiresOn = t.ExpiresOn.UTC().Truncate(time.Second)
+		expiresOn = sql.NullTime{Time: t.ExpiresOn, Valid: true}
+	}
+
+	var folders []string
+	for _, folder := range t.Folders {
+		if strings.Contains(folder, ",") {
+			return "", APIToken{}, fmt.Errorf("folder %q: token scopes cannot name folders containing commas", folder)
+		}
+		if folder = NormaliseFolder(folder); folder != "" {
+			folders = append(folders, folder)
+		}
+	}
+	t.Folders = folders
+	t.Tags = SplitTags(JoinTags(t.Tags))
+
+	_, err := DB.Exec(`
+		INSERT INTO api_tokens (id, name, token_mac, folders, tags, all_entries, can_write, expires_on, created_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.Name, tokenMAC(token), strings.Join(t.Folders, ","), JoinTags(t.Tags), t.All, t.Write, expiresOn, t.CreatedOn)
+	if err != nil {
+		return "", APIToken{}, fmt.Errorf("could not store API token: %w", err)
+	}
+
+	return token, t, nil
+}
+
+// FetchAPITokens lists every API token, oldest first.
+//
+// Returns:
+//
+//	The tokens and an error if one occurred.
+func FetchAPITokens() ([]APIToken, error) {
+	rows, err := DB.Query(`
+		SELECT id, name, folders, tags, all_entries, can_write, expires_on, created_on, last_used_on
+		FROM api_tokens ORDER BY created_on, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t, _, err := scanAPIToken(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes an API token.
+//
+// Args:
+//
+//	id: The token ID.
+//
+// Returns:
+//
+//	ErrNotFound if no token has that ID, or another error if one occurred.
+func RevokeAPIToken(id string) error {
+	result, err := DB.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: token %s", ErrNotFound, id)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIToken checks a token presented by a client and records its
+// use without waiting for the write.
+//
+// Args:
+//
+//	token: The full token.
+//
+// Returns:
+//
+//	The token's description and ErrTokenInvalid or another error if one occurred.
+func AuthenticateAPIToken(token string) (APIToken, error) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return APIToken{}, ErrTokenInvalid
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return APIToken{}, ErrTokenInvalid
+	}
+
+	row := DB.QueryRow(`
+		SELECT id, name, folders, tags, all_entries, can_write, expires_on, created_on, last_used_on, token_mac
+		FROM api_tokens WHERE id = ?
+	`, id)
+	t, mac, err := scanAPIToken(row, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrTokenInvalid
+	}
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	now := time.Now().UTC()
+	if !hmac.Equal(mac, tokenMAC(token)) || t.Expired(now) {
+		return APIToken{}, ErrTokenInvalid
+	}
+
+	// The use is recorded in the background: while an import holds the
+	// write lock the update waits, and the client should not wait with it.
+	go func() {
+		if _, err := DB.Exec(`UPDATE api_tokens SET last_used_on = ? WHERE id = ?`, now.Truncate(time.Second), id); err != nil {
+			log.Printf("could not record the use of API token %s: %v", id, err)
+		}
+	}()
+	t.LastUsedOn = now
+
+	return t, nil
+}
+
+// scanAPIToken reads an api_tokens row selected with the columns used by
+// FetchAPITokens, followed by token_mac when withMAC is set.
+//
+// Args:
+//
+//	row: The row or rows to scan.
+//	withMAC: Whether the query selected token_mac last.
+//
+// Returns:
+//
+//	The token, its MAC if selected and an error if one occurred.
+func scanAPIToken(row interface{ Scan(...any) error }, withMAC bool) (APIToken, []byte, error) {
+	var t APIToken
+	var folders, tags string
+	var expiresOn, lastUsedOn sql.NullTime
+	var mac []byte
+
+	dest := []any{&t.ID, &t.Name, &folders, &tags, &t.All, &t.Write, &expiresOn, &t.CreatedOn, &lastUsedOn}
+	if withMAC {
+		dest = append(dest, &mac)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return APIToken{}, nil, err
+	}
+
+	if folders != "" {
+		t.Folders = strings.Split(folders, ",")
+	}
+	t.Tags = SplitTags(tags)
+	t.ExpiresOn = expiresOn.Time
+	t.LastUsedOn = lastUsedOn.Time
+	t.CreatedOn = t.CreatedOn.UTC()
+
+	return t, mac, nil
+}
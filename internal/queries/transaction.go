@@ -0,0 +1,154 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// execer runs statements, either directly on DB or in a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// txMu lets only one transaction of this process run at a time, so a long
+// import does not make a shorter one give up on SQLite's busy timeout.
+var txMu sync.Mutex
+
+// Tx is a transaction opened by WithTransaction. Only the queries made
+// through its methods belong to it; the package's functions keep running on
+// DB, so an edit made elsewhere while an import runs is neither part of the
+// import nor undone with it.
+type Tx struct {
+	tx *sql.Tx
+	// savepoints numbers the savepoints set so far, to name each uniquely.
+	savepoints int
+}
+
+// WithTransaction runs fn inside a single transaction, so the changes fn
+// makes through tx are kept together or not at all. Other transactions wait
+// for this one to finish; fn must not call WithTransaction itself.
+//
+// Args:
+//
+//	fn: The changes to make, given the transaction.
+//
+// Returns:
+//
+//	fn's error after rolling back, or an error if the transaction could not
+//	be opened or committed.
+func WithTransaction(fn func(tx *Tx) error) error {
+	txMu.Lock()
+	defer txMu.Unlock()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start a transaction: %w", err)
+	}
+
+	if err := fn(&Tx{tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit the transaction: %w", err)
+	}
+	return nil
+}
+
+// WithSavepoint runs fn inside a savepoint of the transaction, undoing fn's
+// changes alone if it fails. Savepoints may be nested.
+//
+// Args:
+//
+//	fn: The changes to make.
+//
+// Returns:
+//
+//	fn's error after undoing its changes, or an error if the savepoint could
+//	not be set or released.
+func (t *Tx) WithSavepoint(fn func() error) error {
+	t.savepoints++
+	name := fmt.Sprintf("sp%d", t.savepoints)
+
+	if _, err := t.tx.Exec(`SAVEPOINT ` + name); err != nil {
+		return fmt.Errorf("could not set a savepoint: %w", err)
+	}
+
+	if err := fn(); err != nil {
+		if _, rollbackErr := t.tx.Exec(`ROLLBACK TO ` + name); rollbackErr != nil {
+			return fmt.Errorf("%w; undoing it failed: %v", err, rollbackErr)
+		}
+		t.tx.Exec(`RELEASE ` + name)
+		return err
+	}
+
+	if _, err := t.tx.Exec(`RELEASE ` + name); err != nil {
+		return fmt.Errorf("could not release the savepoint: %w", err)
+	}
+	return nil
+}
+
+// AddNewPassword is AddNewPassword inside the transaction.
+func (t *Tx) AddNewPassword(username, password string) error {
+	return addNewPassword(t.tx, username, password)
+}
+
+// AddEncryptedEntry is AddEncryptedEntry inside the transaction.
+func (t *Tx) AddEncryptedEntry(username string, entry EncryptedEntry) error {
+	return addEncryptedEntry(t.tx, username, entry)
+}
+
+// EditUserPassword is EditUserPassword inside the transaction.
+func (t *Tx) EditUserPassword(newPassword, username string) error {
+	return editUserPassword(t.tx, newPassword, username)
+}
+
+// DeleteUserByPasswordHash is DeleteUserByPasswordHash inside the transaction.
+func (t *Tx) DeleteUserByPasswordHash(username string) error {
+	return deleteUserByPasswordHash(t.tx, username)
+}
+
+// SetEntryDetails is SetEntryDetails inside the transaction.
+func (t *Tx) SetEntryDetails(username string, details EntryDetails) error {
+	return setEntryDetails(t.tx, username, details)
+}
+
+// SetEntryExtras is SetEntryExtras inside the transaction.
+func (t *Tx) SetEntryExtras(username string, extras EntryExtras) error {
+	return setEntryExtras(t.tx, username, extras)
+}
+
+// SetEntryTimestamps is SetEntryTimestamps inside the transaction.
+func (t *Tx) SetEntryTimestamps(username string, createdOn, updatedOn time.Time) error {
+	return setEntryTimestamps(t.tx, username, createdOn, updatedOn)
+}
+
+// FetchPassword is FetchPassword inside the transaction.
+func (t *Tx) FetchPassword(username string) (string, error) {
+	return fetchPassword(t.tx, username)
+}
+
+// FetchEntryExtras is FetchEntryExtras inside the transaction.
+func (t *Tx) FetchEntryExtras(username string) (EntryExtras, error) {
+	return fetchEntryExtras(t.tx, username)
+}
+
+// FetchUserEntry is FetchUserEntry inside the transaction.
+func (t *Tx) FetchUserEntry(username string) (map[string]string, error) {
+	return fetchUserEntry(t.tx, username)
+}
+
+// FetchUsernames is FetchUsernames inside the transaction.
+func (t *Tx) FetchUsernames() ([]string, error) {
+	return fetchUsernames(t.tx)
+}
+
+// PasswordMatches is PasswordMatches inside the transaction.
+func (t *Tx) PasswordMatches(username, password string) (bool, error) {
+	return passwordMatches(t.tx, username, password)
+}
@@ -0,0 +1,134 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scoring weights for fuzzy matches. Matches that start words or continue a
+// run of matched characters rank higher than scattered ones.
+const (
+	scoreMatch       = 16
+	bonusConsecutive = 16
+	bonusWordStart   = 12
+	bonusFirstChar   = 8
+	penaltyGap       = 1
+)
+
+// Match is one candidate that matched a query.
+type Match struct {
+	Index     int
+	Text      string
+	Score     int
+	Positions []int
+}
+
+// Score fuzzy-matches a query against a candidate. Every character of the
+// query must appear in the candidate in order, ignoring case.
+//
+// Args:
+//
+//	query: The search text.
+//	candidate: The text to match against.
+//
+// Returns:
+//
+//	The match score, the rune positions of the matched characters and
+//	whether the candidate matched at all.
+func Score(query, candidate string) (int, []int, bool) {
+	q := []rune(strings.ToLower(strings.TrimSpace(query)))
+	c := []rune(candidate)
+	if len(q) == 0 {
+		return 0, nil, true
+	}
+
+	positions := make([]int, 0, len(q))
+	score := 0
+	qi := 0
+	last := -1
+
+	for ci := 0; ci < len(c) && qi < len(q); ci++ {
+		if unicode.ToLower(c[ci]) != q[qi] {
+			continue
+		}
+
+		score += scoreMatch
+		switch {
+		case ci == 0:
+			score += bonusFirstChar + bonusWordStart
+		case isWordStart(c, ci):
+			score += bonusWordStart
+		}
+		if last >= 0 {
+			if ci == last+1 {
+				score += bonusConsecutive
+			} else {
+				score -= penaltyGap * (ci - last - 1)
+			}
+		}
+
+		positions = append(positions, ci)
+		last = ci
+		qi++
+	}
+
+	if qi < len(q) {
+		return 0, nil, false
+	}
+
+	// Prefer shorter candidates when the query matches equally well.
+	score -= len(c) - len(q)
+
+	return score, positions, true
+}
+
+// Filter returns the candidates matching a query, best match first. An empty
+// query matches everything in alphabetical order.
+//
+// Args:
+//
+//	query: The search text.
+//	candidates: The texts to search.
+//
+// Returns:
+//
+//	The matching candidates.
+func Filter(query string, candidates []string) []Match {
+	matches := make([]Match, 0, len(candidates))
+	for i, candidate := range candidates {
+		score, positions, ok := Score(query, candidate)
+		if !ok {
+			continue
+		}
+		matches = append(matches, Match{Index: i, Text: candidate, Score: score, Positions: positions})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return strings.ToLower(matches[i].Text) < strings.ToLower(matches[j].Text)
+	})
+
+	return matches
+}
+
+// isWordStart reports whether the rune at i begins a word: it follows a
+// separator or is an uppercase letter after a lowercase one.
+//
+// Args:
+//
+//	runes: The candidate text.
+//	i: The index to check, greater than zero.
+//
+// Returns:
+//
+//	True if a word starts at i.
+func isWordStart(runes []rune, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
@@ -0,0 +1,564 @@
+// Package snapshot takes consistent copies of the vault database with
+// VACUUM INTO, on a schedule and before migrations, imports and restores,
+// and keeps the newest snapshot of each of the last few days and weeks.
+// Snapshots are plain SQLite files, so entries in them stay encrypted with
+// the master password. A snapshot is restored into the open vault with the
+// SQLite online backup API.
+package snapshot
+
+import (
+	"aegis/internal/config"
+
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Reasons a snapshot is taken, recorded in its file name.
+const (
+	ReasonScheduled = "scheduled"
+	ReasonManual    = "manual"
+	ReasonMigration = "migration"
+	ReasonImport    = "import"
+	ReasonRestore   = "restore"
+	ReasonRepair    = "repair"
+)
+
+// Defaults for the zero values of config.BackupSettings.
+const (
+	DefaultInterval   = 24 * time.Hour
+	DefaultKeepDaily  = 7
+	DefaultKeepWeekly = 4
+)
+
+// File names are "aegis-<time>-<reason>.sqlite", the time in UTC.
+const (
+	filePrefix    = "aegis-"
+	fileExtension = ".sqlite"
+	timeLayout    = "20060102T150405.000Z"
+)
+
+// checkInterval is how often RunScheduled checks whether a snapshot is due.
+const checkInterval = time.Hour
+
+// Restores wait for other connections to the vault for at most
+// restoreAttempts steps of restoreRetryDelay.
+const (
+	restoreAttempts   = 100
+	restoreRetryDelay = 50 * time.Millisecond
+)
+
+// ErrNotFound is returned when no snapshot has the given name.
+var ErrNotFound = errors.New("no such snapshot")
+
+// Snapshot is one snapshot file.
+type Snapshot struct {
+	// Name is the file name.
+	Name string
+	// Path is the full path of the file.
+	Path string
+	// TakenOn is when the snapshot was taken.
+	TakenOn time.Time
+	// Reason is why it was taken, such as ReasonScheduled.
+	Reason string
+	// Size is the file size in bytes.
+	Size int64
+}
+
+// Settings reads the backup settings and fills in the defaults.
+//
+// Returns:
+//
+//	The settings, the snapshot directory and the interval, and an error if
+//	the settings cannot be read or are invalid.
+func Settings() (config.BackupSettings, string, time.Duration, error) {
+	c, err := config.Load()
+	if err != nil {
+		return config.BackupSettings{}, "", 0, err
+	}
+	settings := c.Backups
+
+	dir := settings.Dir
+	if dir == "" {
+		configDir, err := config.Dir()
+		if err != nil {
+			return config.BackupSettings{}, "", 0, err
+		}
+		dir = filepath.Join(configDir, "backups")
+	}
+
+	interval := DefaultInterval
+	if settings.Interval != "" {
+		interval, err = time.ParseDuration(settings.Interval)
+		if err != nil || interval <= 0 {
+			return config.BackupSettings{}, "", 0, fmt.Errorf("invalid backup interval %q", settings.Interval)
+		}
+	}
+	if settings.KeepDaily <= 0 {
+		settings.KeepDaily = DefaultKeepDaily
+	}
+	if settings.KeepWeekly <= 0 {
+		settings.KeepWeekly = DefaultKeepWeekly
+	}
+
+	return settings, dir, interval, nil
+}
+
+// List lists the snapshots in the snapshot directory, newest first.
+//
+// Returns:
+//
+//	The snapshots and an error if the directory cannot be read.
+func List() ([]Snapshot, error) {
+	_, dir, _, err := Settings()
+	if err != nil {
+		return nil, err
+	}
+	return listDir(dir)
+}
+
+// listDir lists the snapshots in a directory, newest first. Files that are
+// not named like snapshots are ignored.
+//
+// Args:
+//
+//	dir: The snapshot directory.
+//
+// Returns:
+//
+//	The snapshots, none if the directory does not exist, and an error if it
+//	cannot be read.
+func listDir(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the backup directory: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		snapshot, ok := parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			snapshot.Size = info.Size()
+		}
+		snapshot.Path = filepath.Join(dir, snapshot.Name)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].TakenOn.After(snapshots[j].TakenOn) })
+	return snapshots, nil
+}
+
+// parseName reads the time and reason of a snapshot from its file name.
+//
+// Args:
+//
+//	name: The file name.
+//
+// Returns:
+//
+//	The snapshot without its path and size, and false if the name is not
+//	that of a snapshot.
+func parseName(name string) (Snapshot, bool) {
+	rest, ok := strings.CutPrefix(name, filePrefix)
+	if !ok {
+		return Snapshot{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, fileExtension)
+	if !ok || len(rest) < len(timeLayout)+2 || rest[len(timeLayout)] != '-' {
+		return Snapshot{}, false
+	}
+
+	takenOn, err := time.Parse(timeLayout, rest[:len(timeLayout)])
+	if err != nil {
+		return Snapshot{}, false
+	}
+	return Snapshot{Name: name, TakenOn: takenOn, Reason: rest[len(timeLayout)+1:]}, true
+}
+
+// Take writes a snapshot of the vault and removes the snapshots the
+// retention rules no longer keep.
+//
+// Args:
+//
+//	db: The vault database; it must not be inside a transaction.
+//	reason: Why the snapshot is taken, such as ReasonManual.
+//
+// Returns:
+//
+//	The snapshot and an error if one occurred.
+func Take(db *sql.DB, reason string) (Snapshot, error) {
+	snapshot, err := write(db, reason)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	settings, dir, _, err := Settings()
+	if err != nil {
+		return snapshot, err
+	}
+	if err := prune(dir, settings); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// write writes a snapshot of the vault with VACUUM INTO, which gives a
+// consistent copy while other connections keep using the vault.
+//
+// Args:
+//
+//	db: The vault database; it must not be inside a transaction.
+//	reason: Why the snapshot is taken.
+//
+// Returns:
+//
+//	The snapshot and an error if one occurred.
+func write(db *sql.DB, reason string) (Snapshot, error) {
+	_, dir, _, err := Settings()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Snapshot{}, fmt.Errorf("cannot create the backup directory: %w", err)
+	}
+
+	takenOn := time.Now().UTC()
+	name := filePrefix + takenOn.Format(timeLayout) + "-" + reason + fileExtension
+	path := filepath.Join(dir, name)
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return Snapshot{}, fmt.Errorf("could not snapshot the vault: %w", err)
+	}
+	// VACUUM INTO creates the file with the default permissions.
+	if err := os.Chmod(path, 0600); err != nil {
+		return Snapshot{}, fmt.Errorf("could not restrict the snapshot permissions: %w", err)
+	}
+
+	snapshot := Snapshot{Name: name, Path: path, TakenOn: takenOn, Reason: reason}
+	if info, err := os.Stat(path); err == nil {
+		snapshot.Size = info.Size()
+	}
+	return snapshot, nil
+}
+
+// TakeBefore takes a snapshot before an operation that changes many
+// entries at once, unless automatic snapshots are turned off.
+//
+// Args:
+//
+//	db: The vault database; it must not be inside a transaction.
+//	reason: The operation, such as ReasonImport.
+//
+// Returns:
+//
+//	An error if the snapshot could not be taken.
+func TakeBefore(db *sql.DB, reason string) error {
+	settings, _, _, err := Settings()
+	if err != nil {
+		return err
+	}
+	if settings.Disabled {
+		return nil
+	}
+
+	_, err = Take(db, reason)
+	return err
+}
+
+// TakeIfDue takes a scheduled snapshot if the newest snapshot is older than
+// the backup interval, unless automatic snapshots are turned off.
+//
+// Args:
+//
+//	db: The vault database; it must not be inside a transaction.
+//
+// Returns:
+//
+//	True if a snapshot was taken, and an error if one occurred.
+func TakeIfDue(db *sql.DB) (bool, error) {
+	settings, dir, interval, err := Settings()
+	if err != nil {
+		return false, err
+	}
+	if settings.Disabled {
+		return false, nil
+	}
+
+	snapshots, err := listDir(dir)
+	if err != nil {
+		return false, err
+	}
+	if len(snapshots) > 0 && time.Since(snapshots[0].TakenOn) < interval {
+		return false, nil
+	}
+
+	if _, err := Take(db, ReasonScheduled); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RunScheduled takes scheduled snapshots for as long as the process runs,
+// checking once an hour whether one is due. Failures are logged.
+//
+// Args:
+//
+//	db: The vault database.
+func RunScheduled(db *sql.DB) {
+	for {
+		if _, err := TakeIfDue(db); err != nil {
+			log.Printf("Scheduled backup failed: %s", err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// prune removes the snapshots the retention rules no longer keep.
+//
+// Args:
+//
+//	dir: The snapshot directory.
+//	settings: The backup settings, with the defaults filled in.
+//
+// Returns:
+//
+//	An error if a snapshot could not be removed.
+func prune(dir string, settings config.BackupSettings) error {
+	snapshots, err := listDir(dir)
+	if err != nil {
+		return err
+	}
+
+	keep := retained(snapshots, settings.KeepDaily, settings.KeepWeekly)
+	for _, snapshot := range snapshots {
+		if keep[snapshot.Name] {
+			continue
+		}
+		if err := os.Remove(snapshot.Path); err != nil {
+			return fmt.Errorf("could not remove old snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// retained chooses the snapshots to keep: every snapshot of today, so one
+// taken by hand or before an import is not lost to the next, and the newest
+// of each of the last keepDaily days that have one and of each of the last
+// keepWeekly weeks, in local time.
+//
+// Args:
+//
+//	snapshots: The snapshots, newest first.
+//	keepDaily: How many days keep a snapshot.
+//	keepWeekly: How many weeks keep a snapshot.
+//
+// Returns:
+//
+//	The names of the snapshots to keep.
+func retained(snapshots []Snapshot, keepDaily, keepWeekly int) map[string]bool {
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	today := time.Now().Format(time.DateOnly)
+
+	for _, snapshot := range snapshots {
+		local := snapshot.TakenOn.Local()
+		day := local.Format(time.DateOnly)
+		if day == today {
+			keep[snapshot.Name] = true
+		}
+		year, week := local.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[snapshot.Name] = true
+		}
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep[snapshot.Name] = true
+		}
+	}
+	return keep
+}
+
+// Restore replaces the content of the vault with a snapshot, after checking
+// the snapshot and taking a snapshot of the vault as it was. Connections to
+// the vault stay open and see the restored content; callers should run the
+// migrations again, since the snapshot may predate some.
+//
+// Args:
+//
+//	db: The vault database; it must not be inside a transaction.
+//	name: The file name of the snapshot.
+//
+// Returns:
+//
+//	ErrNotFound or another error if one occurred.
+func Restore(db *sql.DB, name string) error {
+	snapshots, err := List()
+	if err != nil {
+		return err
+	}
+	var snapshot *Snapshot
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			snapshot = &snapshots[i]
+		}
+	}
+	if snapshot == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+snapshot.Path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot: %w", err)
+	}
+	defer src.Close()
+	if err := check(src); err != nil {
+		return fmt.Errorf("the snapshot cannot be restored: %w", err)
+	}
+
+	// The old snapshots are pruned only once the copy is done, since the
+	// one being restored could be among them.
+	if _, err := write(db, ReasonRestore); err != nil {
+		return fmt.Errorf("could not back up the vault before restoring: %w", err)
+	}
+	if err := copyDatabase(db, src); err != nil {
+		return err
+	}
+
+	settings, dir, _, err := Settings()
+	if err != nil {
+		return err
+	}
+	return prune(dir, settings)
+}
+
+// check verifies that a database is intact and holds an Aegis vault.
+//
+// Args:
+//
+//	db: The database.
+//
+// Returns:
+//
+//	An error describing the first problem found.
+func check(db *sql.DB) error {
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pwds`).Scan(&count); err != nil {
+		return fmt.Errorf("not an Aegis vault: %w", err)
+	}
+	return nil
+}
+
+// copyDatabase copies every page of one database into another with the
+// SQLite online backup API, waiting while the destination is busy.
+//
+// Args:
+//
+//	dest: The database to overwrite.
+//	src: The database to copy.
+//
+// Returns:
+//
+//	An error if one occurred.
+func copyDatabase(dest, src *sql.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			d, ok := destDriver.(*sqlite3.SQLiteConn)
+			s, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("the vault is not an SQLite database")
+			}
+
+			backup, err := d.Backup("main", s, "main")
+			if err != nil {
+				return fmt.Errorf("could not start the restore: %w", err)
+			}
+			for range restoreAttempts {
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Finish()
+					return fmt.Errorf("could not restore: %w", err)
+				}
+				if done {
+					return backup.Finish()
+				}
+				time.Sleep(restoreRetryDelay)
+			}
+			backup.Finish()
+			return errors.New("could not restore: the vault is busy")
+		})
+	})
+}
+
+// HumanSize formats the size of the snapshot for display.
+//
+// Returns:
+//
+//	The size in B, KiB or MiB.
+func (s Snapshot) HumanSize() string {
+	switch {
+	case s.Size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(s.Size)/(1<<20))
+	case s.Size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(s.Size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", s.Size)
+}
+
+// FormatInterval writes a backup interval without trailing zero units, so
+// a day is "24h" rather than "24h0m0s".
+//
+// Args:
+//
+//	d: The interval.
+//
+// Returns:
+//
+//	The interval.
+func FormatInterval(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package strength
+
+import "strings"
+
+// Keyboard layouts, drawn the way the keys sit on the physical keyboard.
+// Each row of a slanted layout is shifted one column to the right of the row
+// above it, which is how the adjacency between rows is worked out.
+const (
+	qwertyLayout = `
+` + "`~" + ` 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+
+    qQ wW eE rR tT yY uU iI oO pP [{ ]} \|
+     aA sS dD fF gG hH jJ kK lL ;: '"
+      zZ xX cC vV bB nN mM ,< .> /?
+`
+
+	dvorakLayout = `
+` + "`~" + ` 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) [{ ]}
+    '" ,< .> pP yY fF gG cC rR lL /? =+ \|
+     aA oO eE uU iI dD hH tT nN sS -_
+      ;: qQ jJ kK xX bB mM wW vV zZ
+`
+
+	keypadLayout = `
+  / * -
+7 8 9 +
+4 5 6
+1 2 3
+  0 .
+`
+
+	macKeypadLayout = `
+  = / *
+7 8 9 -
+4 5 6 +
+1 2 3
+  0 .
+`
+)
+
+// adjacencyGraph maps a key to its neighbours, one slot per direction. Empty
+// strings mark directions without a neighbouring key.
+type adjacencyGraph map[rune][]string
+
+// keyboardGraph describes one keyboard layout used by the spatial matcher.
+type keyboardGraph struct {
+	name              string
+	graph             adjacencyGraph
+	startingPositions float64
+	averageDegree     float64
+}
+
+var keyboardGraphs = []keyboardGraph{
+	newKeyboardGraph("qwerty", buildAdjacencyGraph(qwertyLayout, true)),
+	newKeyboardGraph("dvorak", buildAdjacencyGraph(dvorakLayout, true)),
+	newKeyboardGraph("keypad", buildAdjacencyGraph(keypadLayout, false)),
+	newKeyboardGraph("mac_keypad", buildAdjacencyGraph(macKeypadLayout, false)),
+}
+
+// newKeyboardGraph precomputes the statistics needed to score spatial matches.
+//
+// Args:
+//
+//	name: The layout name.
+//	graph: The layout's adjacency graph.
+//
+// Returns:
+//
+//	The keyboard graph description.
+func newKeyboardGraph(name string, graph adjacencyGraph) keyboardGraph {
+	var neighbours int
+	for _, adjacent := range graph {
+		for _, key := range adjacent {
+			if key != "" {
+				neighbours++
+			}
+		}
+	}
+
+	return keyboardGraph{
+		name:              name,
+		graph:             graph,
+		startingPositions: float64(len(graph)),
+		averageDegree:     float64(neighbours) / float64(len(graph)),
+	}
+}
+
+// buildAdjacencyGraph turns a drawn keyboard layout into an adjacency graph.
+//
+// Args:
+//
+//	layout: The layout drawing, one keyboard row per line.
+//	slanted: Whether rows are offset from each other like a typewriter
+//	  keyboard, as opposed to aligned like a keypad.
+//
+// Returns:
+//
+//	The adjacency graph of the layout.
+func buildAdjacencyGraph(layout string, slanted bool) adjacencyGraph {
+	type coord struct{ x, y int }
+
+	positions := make(map[coord]string)
+	tokenSize := len(strings.Fields(layout)[0])
+	xUnit := tokenSize + 1
+
+	for y, line := range strings.Split(layout, "\n") {
+		slant := 0
+		if slanted {
+			slant = y - 1
+		}
+
+		for x := 0; x < len(line); {
+			if line[x] == ' ' {
+				x++
+				continue
+			}
+			token := line[x : x+tokenSize]
+			positions[coord{(x - slant) / xUnit, y}] = token
+			x += tokenSize
+		}
+	}
+
+	neighbours := func(x, y int) []coord {
+		if slanted {
+			return []coord{{x - 1, y}, {x, y - 1}, {x + 1, y - 1}, {x + 1, y}, {x, y + 1}, {x - 1, y + 1}}
+		}
+		return []coord{{x - 1, y}, {x - 1, y - 1}, {x, y - 1}, {x + 1, y - 1}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}, {x - 1, y + 1}}
+	}
+
+	graph := make(adjacencyGraph)
+	for pos, token := range positions {
+		for _, char := range token {
+			adjacent := make([]string, 0, 8)
+			for _, n := range neighbours(pos.x, pos.y) {
+				adjacent = append(adjacent, positions[n])
+			}
+			graph[char] = adjacent
+		}
+	}
+
+	return graph
+}
@@ -0,0 +1,79 @@
+package strength
+
+import (
+	"embed"
+	"strings"
+)
+
+// Dictionary names used in matches and feedback.
+const (
+	dictPasswords = "passwords"
+	dictEnglish   = "english"
+	dictNames     = "names"
+	dictSurnames  = "surnames"
+	dictUser      = "user_inputs"
+)
+
+//go:embed data/*.txt
+var dataFS embed.FS
+
+// dictionary is a word -> rank lookup table. Ranks start at 1 for the most
+// frequent word in the list.
+type dictionary struct {
+	ranks  map[string]int
+	maxLen int
+}
+
+// rankedDictionaries holds the embedded frequency lists by name.
+var rankedDictionaries = map[string]dictionary{
+	dictPasswords: newDictionary(loadRankedList("data/passwords.txt")),
+	dictEnglish:   newDictionary(loadRankedList("data/english.txt")),
+	dictNames:     newDictionary(loadRankedList("data/names.txt")),
+	dictSurnames:  newDictionary(loadRankedList("data/surnames.txt")),
+}
+
+// newDictionary wraps a ranked word list for lookups.
+//
+// Args:
+//
+//	ranks: A map from word to its rank.
+//
+// Returns:
+//
+//	The dictionary.
+func newDictionary(ranks map[string]int) dictionary {
+	d := dictionary{ranks: ranks}
+	for word := range ranks {
+		if n := len([]rune(word)); n > d.maxLen {
+			d.maxLen = n
+		}
+	}
+	return d
+}
+
+// loadRankedList reads an embedded frequency list ordered from the most to the
+// least common word.
+//
+// Args:
+//
+//	name: The path of the list inside the embedded data directory.
+//
+// Returns:
+//
+//	A map from word to its 1-based rank.
+func loadRankedList(name string) map[string]int {
+	data, err := dataFS.ReadFile(name)
+	if err != nil {
+		panic("strength: missing embedded dictionary " + name)
+	}
+
+	words := strings.Fields(string(data))
+	ranked := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := ranked[word]; !ok {
+			ranked[word] = i + 1
+		}
+	}
+
+	return ranked
+}
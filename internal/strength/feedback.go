@@ -0,0 +1,161 @@
+package strength
+
+import "strings"
+
+// buildFeedback explains a score by looking at the weakest part of the
+// password.
+//
+// Args:
+//
+//	score: The password's score.
+//	sequence: The optimal match sequence.
+//
+// Returns:
+//
+//	The feedback to show the user.
+func buildFeedback(score int, sequence []*Match) Feedback {
+	if len(sequence) == 0 {
+		return Feedback{
+			Suggestions: []string{
+				"Use a few words, avoid common phrases",
+				"No need for symbols, digits, or uppercase letters",
+			},
+		}
+	}
+
+	if score > 2 {
+		return Feedback{Suggestions: []string{}}
+	}
+
+	longest := sequence[0]
+	for _, m := range sequence[1:] {
+		if len([]rune(m.Token)) > len([]rune(longest.Token)) {
+			longest = m
+		}
+	}
+
+	const extra = "Add another word or two. Uncommon words are better."
+
+	feedback, ok := matchFeedback(longest, len(sequence) == 1)
+	if !ok {
+		return Feedback{Suggestions: []string{extra}}
+	}
+	feedback.Suggestions = append([]string{extra}, feedback.Suggestions...)
+
+	return feedback
+}
+
+// matchFeedback returns the warning and suggestions for a single match.
+//
+// Args:
+//
+//	m: The match to explain.
+//	isSoleMatch: Whether the match covers the whole password.
+//
+// Returns:
+//
+//	The feedback and whether the match's pattern has any.
+func matchFeedback(m *Match, isSoleMatch bool) (Feedback, bool) {
+	switch m.Pattern {
+	case patternDictionary:
+		return dictionaryFeedback(m, isSoleMatch), true
+
+	case patternSpatial:
+		warning := "Short keyboard patterns are easy to guess"
+		if m.Turns == 1 {
+			warning = "Straight rows of keys are easy to guess"
+		}
+		return Feedback{
+			Warning:     warning,
+			Suggestions: []string{"Use a longer keyboard pattern with more turns"},
+		}, true
+
+	case patternRepeat:
+		warning := `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`
+		if len([]rune(m.BaseToken)) == 1 {
+			warning = `Repeats like "aaa" are easy to guess`
+		}
+		return Feedback{
+			Warning:     warning,
+			Suggestions: []string{"Avoid repeated words and characters"},
+		}, true
+
+	case patternSequence:
+		return Feedback{
+			Warning:     "Sequences like abc or 6543 are easy to guess",
+			Suggestions: []string{"Avoid sequences"},
+		}, true
+
+	case patternRegex:
+		if m.RegexName == "recent_year" {
+			return Feedback{
+				Warning:     "Recent years are easy to guess",
+				Suggestions: []string{"Avoid recent years", "Avoid years that are associated with you"},
+			}, true
+		}
+
+	case patternDate:
+		return Feedback{
+			Warning:     "Dates are often easy to guess",
+			Suggestions: []string{"Avoid dates and years that are associated with you"},
+		}, true
+	}
+
+	return Feedback{}, false
+}
+
+// dictionaryFeedback returns the feedback for a dictionary match.
+//
+// Args:
+//
+//	m: The dictionary match.
+//	isSoleMatch: Whether the match covers the whole password.
+//
+// Returns:
+//
+//	The feedback for the match.
+func dictionaryFeedback(m *Match, isSoleMatch bool) Feedback {
+	var warning string
+
+	switch m.DictionaryName {
+	case dictPasswords:
+		switch {
+		case isSoleMatch && !m.L33t && !m.Reversed && m.Rank <= 10:
+			warning = "This is a top-10 common password"
+		case isSoleMatch && !m.L33t && !m.Reversed && m.Rank <= 100:
+			warning = "This is a top-100 common password"
+		case isSoleMatch && !m.L33t && !m.Reversed:
+			warning = "This is a very common password"
+		case m.GuessesLog10 <= 4:
+			warning = "This is similar to a commonly used password"
+		}
+	case dictEnglish:
+		if isSoleMatch {
+			warning = "A word by itself is easy to guess"
+		}
+	case dictNames, dictSurnames:
+		if isSoleMatch {
+			warning = "Names and surnames by themselves are easy to guess"
+		} else {
+			warning = "Common names and surnames are easy to guess"
+		}
+	case dictUser:
+		warning = "Passwords based on the entry's own name are easy to guess"
+	}
+
+	var suggestions []string
+	switch {
+	case startUpperRx.MatchString(m.Token):
+		suggestions = append(suggestions, "Capitalization doesn't help very much")
+	case allUpperRx.MatchString(m.Token) && strings.ToLower(m.Token) != m.Token:
+		suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+	}
+	if m.Reversed && len([]rune(m.Token)) >= 4 {
+		suggestions = append(suggestions, "Reversed words aren't much harder to guess")
+	}
+	if m.L33t {
+		suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+	}
+
+	return Feedback{Warning: warning, Suggestions: suggestions}
+}
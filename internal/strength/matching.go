@@ -0,0 +1,933 @@
+package strength
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Match patterns.
+const (
+	patternDictionary = "dictionary"
+	patternSpatial    = "spatial"
+	patternRepeat     = "repeat"
+	patternSequence   = "sequence"
+	patternRegex      = "regex"
+	patternDate       = "date"
+	patternBruteforce = "bruteforce"
+)
+
+// Match describes a part of a password that follows a guessable pattern.
+// I and J are inclusive rune offsets into the password.
+type Match struct {
+	Pattern string
+	I, J    int
+	Token   string
+
+	// Dictionary matches.
+	MatchedWord    string
+	Rank           int
+	DictionaryName string
+	Reversed       bool
+	L33t           bool
+	Sub            map[rune]rune
+
+	// Spatial matches.
+	Graph        string
+	Turns        int
+	ShiftedCount int
+
+	// Repeat matches.
+	BaseToken   string
+	BaseGuesses float64
+	RepeatCount int
+
+	// Sequence matches.
+	SequenceName  string
+	SequenceSpace int
+	Ascending     bool
+
+	// Regex matches.
+	RegexName string
+
+	// Date matches.
+	Separator        string
+	Year, Month, Day int
+
+	Guesses      float64
+	GuessesLog10 float64
+}
+
+// l33tTable lists the common substitutions for each letter.
+var l33tTable = map[rune][]rune{
+	'a': {'4', '@'},
+	'b': {'8'},
+	'c': {'(', '{', '[', '<'},
+	'e': {'3'},
+	'g': {'6', '9'},
+	'i': {'1', '!', '|'},
+	'l': {'1', '|', '7'},
+	'o': {'0'},
+	's': {'$', '5'},
+	't': {'+', '7'},
+	'x': {'%'},
+	'z': {'2'},
+}
+
+// maxL33tSubs caps how many substitution tables are tried per password so a
+// password full of ambiguous symbols can't blow up the search.
+const maxL33tSubs = 256
+
+var (
+	recentYearRx = regexp.MustCompile(`19\d\d|20[0-4]\d`)
+	shiftedRx    = regexp.MustCompile(`[~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:"ZXCVBNM<>?]`)
+	dateRx       = regexp.MustCompile(`^(\d{1,4})([\s/\\_.-])(\d{1,2})([\s/\\_.-])(\d{1,4})$`)
+	digitsRx     = regexp.MustCompile(`^\d+$`)
+	lowerRx      = regexp.MustCompile(`^[a-z]+$`)
+	upperRx      = regexp.MustCompile(`^[A-Z]+$`)
+)
+
+// dateSplits lists where to cut a separator-less date of a given length into
+// its three numeric parts.
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+const (
+	dateMinYear     = 1000
+	dateMaxYear     = 2050
+	sequenceMaxStep = 5
+)
+
+// omnimatch runs every matcher over the password.
+//
+// Args:
+//
+//	password: The password as runes.
+//	userInputs: The ranked user input dictionary.
+//
+// Returns:
+//
+//	All matches found, sorted by position.
+func omnimatch(password []rune, userInputs map[string]int) []*Match {
+	dictionaries := rankedDictionaries
+	if len(userInputs) > 0 {
+		dictionaries = make(map[string]dictionary, len(rankedDictionaries)+1)
+		for name, dict := range rankedDictionaries {
+			dictionaries[name] = dict
+		}
+		dictionaries[dictUser] = newDictionary(userInputs)
+	}
+
+	var matches []*Match
+	matches = append(matches, dictionaryMatch(password, dictionaries)...)
+	matches = append(matches, reverseDictionaryMatch(password, dictionaries)...)
+	matches = append(matches, l33tMatch(password, dictionaries)...)
+	matches = append(matches, spatialMatch(password)...)
+	matches = append(matches, repeatMatch(password, userInputs)...)
+	matches = append(matches, sequenceMatch(password)...)
+	matches = append(matches, regexMatch(password)...)
+	matches = append(matches, dateMatch(password)...)
+
+	sortMatches(matches)
+	return matches
+}
+
+// sortMatches orders matches by start offset, then end offset.
+//
+// Args:
+//
+//	matches: The matches to sort in place.
+func sortMatches(matches []*Match) {
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].I != matches[b].I {
+			return matches[a].I < matches[b].I
+		}
+		return matches[a].J < matches[b].J
+	})
+}
+
+// dictionaryMatch finds every substring of the password that appears in one
+// of the frequency dictionaries.
+//
+// Args:
+//
+//	password: The password as runes.
+//	dictionaries: The ranked dictionaries to search.
+//
+// Returns:
+//
+//	The dictionary matches.
+func dictionaryMatch(password []rune, dictionaries map[string]dictionary) []*Match {
+	var matches []*Match
+	lower := []rune(strings.ToLower(string(password)))
+	if len(lower) != len(password) {
+		lower = password
+	}
+
+	for name, dict := range dictionaries {
+		for i := range password {
+			for j := i; j < len(password) && j-i < dict.maxLen; j++ {
+				word := string(lower[i : j+1])
+				rank, ok := dict.ranks[word]
+				if !ok {
+					continue
+				}
+				matches = append(matches, &Match{
+					Pattern:        patternDictionary,
+					I:              i,
+					J:              j,
+					Token:          string(password[i : j+1]),
+					MatchedWord:    word,
+					Rank:           rank,
+					DictionaryName: name,
+				})
+			}
+		}
+	}
+
+	return matches
+}
+
+// reverseDictionaryMatch finds dictionary words spelled backwards.
+//
+// Args:
+//
+//	password: The password as runes.
+//	dictionaries: The ranked dictionaries to search.
+//
+// Returns:
+//
+//	The reversed dictionary matches.
+func reverseDictionaryMatch(password []rune, dictionaries map[string]dictionary) []*Match {
+	reversed := reverseRunes(password)
+
+	matches := dictionaryMatch(reversed, dictionaries)
+	for _, m := range matches {
+		m.Token = string(reverseRunes([]rune(m.Token)))
+		m.Reversed = true
+		m.I, m.J = len(password)-1-m.J, len(password)-1-m.I
+	}
+
+	return matches
+}
+
+// l33tMatch finds dictionary words written with common character
+// substitutions, e.g. "p4ssw0rd".
+//
+// Args:
+//
+//	password: The password as runes.
+//	dictionaries: The ranked dictionaries to search.
+//
+// Returns:
+//
+//	The l33t dictionary matches.
+func l33tMatch(password []rune, dictionaries map[string]dictionary) []*Match {
+	var matches []*Match
+
+	for _, sub := range enumerateL33tSubs(relevantL33tTable(password)) {
+		if len(sub) == 0 {
+			continue
+		}
+
+		subbed := make([]rune, len(password))
+		for i, r := range password {
+			if letter, ok := sub[r]; ok {
+				subbed[i] = letter
+			} else {
+				subbed[i] = r
+			}
+		}
+
+		for _, m := range dictionaryMatch(subbed, dictionaries) {
+			token := password[m.I : m.J+1]
+			if strings.ToLower(string(token)) == m.MatchedWord {
+				// Nothing was substituted inside this token.
+				continue
+			}
+
+			used := make(map[rune]rune)
+			for _, r := range token {
+				if letter, ok := sub[r]; ok {
+					used[r] = letter
+				}
+			}
+			if len(used) == 0 || len(token) <= 1 {
+				continue
+			}
+
+			m.Token = string(token)
+			m.L33t = true
+			m.Sub = used
+			matches = append(matches, m)
+		}
+	}
+
+	return dedupeMatches(matches)
+}
+
+// relevantL33tTable narrows the l33t table down to substitutions that
+// actually occur in the password.
+//
+// Args:
+//
+//	password: The password as runes.
+//
+// Returns:
+//
+//	A map from letter to the substitute characters present in the password.
+func relevantL33tTable(password []rune) map[rune][]rune {
+	present := make(map[rune]bool, len(password))
+	for _, r := range password {
+		present[r] = true
+	}
+
+	table := make(map[rune][]rune)
+	for letter, subs := range l33tTable {
+		for _, s := range subs {
+			if present[s] {
+				table[letter] = append(table[letter], s)
+			}
+		}
+	}
+
+	return table
+}
+
+// enumerateL33tSubs lists every way of mapping the substitute characters back
+// to letters. A substitute character maps to exactly one letter in each
+// table, e.g. "1" is either "i" or "l".
+//
+// Args:
+//
+//	table: The relevant l33t table.
+//
+// Returns:
+//
+//	The possible substitution tables, keyed by substitute character.
+func enumerateL33tSubs(table map[rune][]rune) []map[rune]rune {
+	letters := make([]rune, 0, len(table))
+	for letter := range table {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(a, b int) bool { return letters[a] < letters[b] })
+
+	subs := []map[rune]rune{{}}
+	for _, letter := range letters {
+		var next []map[rune]rune
+		for _, sub := range subs {
+			for _, char := range table[letter] {
+				if _, taken := sub[char]; taken {
+					// Keep the existing mapping and also try this letter instead.
+					alt := copySub(sub)
+					alt[char] = letter
+					next = append(next, sub, alt)
+					continue
+				}
+				extended := copySub(sub)
+				extended[char] = letter
+				next = append(next, extended)
+			}
+		}
+		subs = dedupeSubs(next)
+		if len(subs) > maxL33tSubs {
+			subs = subs[:maxL33tSubs]
+		}
+	}
+
+	return subs
+}
+
+// copySub returns a copy of a substitution table.
+//
+// Args:
+//
+//	sub: The table to copy.
+//
+// Returns:
+//
+//	The copied table.
+func copySub(sub map[rune]rune) map[rune]rune {
+	c := make(map[rune]rune, len(sub)+1)
+	for k, v := range sub {
+		c[k] = v
+	}
+	return c
+}
+
+// dedupeSubs removes duplicate substitution tables.
+//
+// Args:
+//
+//	subs: The tables to deduplicate.
+//
+// Returns:
+//
+//	The unique tables in their original order.
+func dedupeSubs(subs []map[rune]rune) []map[rune]rune {
+	seen := make(map[string]bool, len(subs))
+	unique := subs[:0]
+
+	for _, sub := range subs {
+		keys := make([]string, 0, len(sub))
+		for k, v := range sub {
+			keys = append(keys, string([]rune{k, v}))
+		}
+		sort.Strings(keys)
+		label := strings.Join(keys, ",")
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		unique = append(unique, sub)
+	}
+
+	return unique
+}
+
+// dedupeMatches drops matches that cover the same span with the same word.
+//
+// Args:
+//
+//	matches: The matches to deduplicate.
+//
+// Returns:
+//
+//	The unique matches.
+func dedupeMatches(matches []*Match) []*Match {
+	seen := make(map[string]bool, len(matches))
+	unique := matches[:0]
+
+	for _, m := range matches {
+		key := strconv.Itoa(m.I) + ":" + strconv.Itoa(m.J) + ":" + m.DictionaryName + ":" + m.MatchedWord
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, m)
+	}
+
+	return unique
+}
+
+// spatialMatch finds runs of adjacent keys on the supported keyboards.
+//
+// Args:
+//
+//	password: The password as runes.
+//
+// Returns:
+//
+//	The spatial matches.
+func spatialMatch(password []rune) []*Match {
+	var matches []*Match
+	for _, kb := range keyboardGraphs {
+		matches = append(matches, spatialMatchGraph(password, kb)...)
+	}
+	return matches
+}
+
+// spatialMatchGraph finds keyboard runs on a single layout.
+//
+// Args:
+//
+//	password: The password as runes.
+//	kb: The keyboard layout.
+//
+// Returns:
+//
+//	The spatial matches on this layout.
+func spatialMatchGraph(password []rune, kb keyboardGraph) []*Match {
+	var matches []*Match
+	typewriter := kb.name == "qwerty" || kb.name == "dvorak"
+
+	for i := 0; i < len(password)-1; {
+		j := i + 1
+		lastDirection := -1
+		turns := 0
+		shifted := 0
+		if typewriter && shiftedRx.MatchString(string(password[i])) {
+			shifted = 1
+		}
+
+		for {
+			found := false
+			if j < len(password) {
+				cur := string(password[j])
+				for direction, adjacent := range kb.graph[password[j-1]] {
+					idx := strings.Index(adjacent, cur)
+					if adjacent == "" || idx < 0 {
+						continue
+					}
+					found = true
+					if idx == 1 {
+						shifted++
+					}
+					if lastDirection != direction {
+						turns++
+						lastDirection = direction
+					}
+					break
+				}
+			}
+
+			if found {
+				j++
+				continue
+			}
+
+			if j-i > 2 {
+				matches = append(matches, &Match{
+					Pattern:      patternSpatial,
+					I:            i,
+					J:            j - 1,
+					Token:        string(password[i:j]),
+					Graph:        kb.name,
+					Turns:        turns,
+					ShiftedCount: shifted,
+				})
+			}
+			i = j
+			break
+		}
+	}
+
+	return matches
+}
+
+// repeatMatch finds repeated blocks such as "aaa" or "abcabcabc".
+//
+// Args:
+//
+//	password: The password as runes.
+//	userInputs: The ranked user input dictionary, used when scoring the
+//	  repeated block.
+//
+// Returns:
+//
+//	The repeat matches.
+func repeatMatch(password []rune, userInputs map[string]int) []*Match {
+	var matches []*Match
+
+	for i := 0; i < len(password); {
+		bestBase, bestCount := 0, 0
+		for base := 1; i+2*base <= len(password); base++ {
+			count := 1
+			for i+(count+1)*base <= len(password) &&
+				string(password[i+count*base:i+(count+1)*base]) == string(password[i:i+base]) {
+				count++
+			}
+			if count < 2 {
+				continue
+			}
+			if base*count > bestBase*bestCount {
+				bestBase, bestCount = base, count
+			}
+		}
+
+		if bestCount < 2 {
+			i++
+			continue
+		}
+
+		span := bestBase * bestCount
+		base := minimalPeriod(password[i : i+bestBase])
+		baseToken := string(base)
+		count := span / len(base)
+
+		baseMatches := omnimatch(base, userInputs)
+		baseGuesses, _ := mostGuessableMatchSequence(base, baseMatches, false)
+
+		matches = append(matches, &Match{
+			Pattern:     patternRepeat,
+			I:           i,
+			J:           i + span - 1,
+			Token:       string(password[i : i+span]),
+			BaseToken:   baseToken,
+			BaseGuesses: baseGuesses,
+			RepeatCount: count,
+		})
+		i += span
+	}
+
+	return matches
+}
+
+// minimalPeriod returns the shortest block that repeats to form s, e.g.
+// "abab" becomes "ab".
+//
+// Args:
+//
+//	s: The block to reduce.
+//
+// Returns:
+//
+//	The shortest repeating unit of s.
+func minimalPeriod(s []rune) []rune {
+	for p := 1; p < len(s); p++ {
+		if len(s)%p != 0 {
+			continue
+		}
+		ok := true
+		for k := p; k < len(s); k++ {
+			if s[k] != s[k-p] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return s[:p]
+		}
+	}
+	return s
+}
+
+// sequenceMatch finds runs of characters with a constant code point step,
+// such as "abcd", "9753" or "ACEG".
+//
+// Args:
+//
+//	password: The password as runes.
+//
+// Returns:
+//
+//	The sequence matches.
+func sequenceMatch(password []rune) []*Match {
+	if len(password) <= 1 {
+		return nil
+	}
+
+	var matches []*Match
+	update := func(i, j, delta int) {
+		if j-i > 1 || abs(delta) == 1 {
+			if delta == 0 || abs(delta) > sequenceMaxStep {
+				return
+			}
+			token := string(password[i : j+1])
+			name, space := "unicode", 26
+			switch {
+			case lowerRx.MatchString(token):
+				name, space = "lower", 26
+			case upperRx.MatchString(token):
+				name, space = "upper", 26
+			case digitsRx.MatchString(token):
+				name, space = "digits", 10
+			}
+			matches = append(matches, &Match{
+				Pattern:       patternSequence,
+				I:             i,
+				J:             j,
+				Token:         token,
+				SequenceName:  name,
+				SequenceSpace: space,
+				Ascending:     delta > 0,
+			})
+		}
+	}
+
+	i := 0
+	lastDelta := 0
+	haveDelta := false
+	for k := 1; k < len(password); k++ {
+		delta := int(password[k]) - int(password[k-1])
+		if !haveDelta {
+			lastDelta, haveDelta = delta, true
+		}
+		if delta == lastDelta {
+			continue
+		}
+		j := k - 1
+		update(i, j, lastDelta)
+		i = j
+		lastDelta = delta
+	}
+	update(i, len(password)-1, lastDelta)
+
+	return matches
+}
+
+// regexMatch finds recent years.
+//
+// Args:
+//
+//	password: The password as runes.
+//
+// Returns:
+//
+//	The regex matches.
+func regexMatch(password []rune) []*Match {
+	var matches []*Match
+	s := string(password)
+
+	for _, loc := range recentYearRx.FindAllStringIndex(s, -1) {
+		i := len([]rune(s[:loc[0]]))
+		token := s[loc[0]:loc[1]]
+		matches = append(matches, &Match{
+			Pattern:   patternRegex,
+			I:         i,
+			J:         i + len([]rune(token)) - 1,
+			Token:     token,
+			RegexName: "recent_year",
+		})
+	}
+
+	return matches
+}
+
+// dateMatch finds dates written with or without separators, e.g. "13.05.1991"
+// or "130591".
+//
+// Args:
+//
+//	password: The password as runes.
+//
+// Returns:
+//
+//	The date matches.
+func dateMatch(password []rune) []*Match {
+	var matches []*Match
+
+	// Dates without separators: between 4 and 8 digits.
+	for i := 0; i <= len(password)-4; i++ {
+		for j := i + 3; j <= i+7 && j < len(password); j++ {
+			token := string(password[i : j+1])
+			if !digitsRx.MatchString(token) {
+				continue
+			}
+
+			var best *dmy
+			for _, split := range dateSplits[len(token)] {
+				k, l := split[0], split[1]
+				ints := []int{atoi(token[:k]), atoi(token[k:l]), atoi(token[l:])}
+				candidate := mapIntsToDMY(ints)
+				if candidate == nil {
+					continue
+				}
+				if best == nil || abs(candidate.year-referenceYear) < abs(best.year-referenceYear) {
+					best = candidate
+				}
+			}
+			if best == nil {
+				continue
+			}
+
+			matches = append(matches, &Match{
+				Pattern: patternDate,
+				I:       i,
+				J:       j,
+				Token:   token,
+				Year:    best.year,
+				Month:   best.month,
+				Day:     best.day,
+			})
+		}
+	}
+
+	// Dates with separators: between 6 and 10 characters.
+	for i := 0; i <= len(password)-6; i++ {
+		for j := i + 5; j <= i+9 && j < len(password); j++ {
+			token := string(password[i : j+1])
+			parts := dateRx.FindStringSubmatch(token)
+			if parts == nil || parts[2] != parts[4] {
+				continue
+			}
+
+			candidate := mapIntsToDMY([]int{atoi(parts[1]), atoi(parts[3]), atoi(parts[5])})
+			if candidate == nil {
+				continue
+			}
+
+			matches = append(matches, &Match{
+				Pattern:   patternDate,
+				I:         i,
+				J:         j,
+				Token:     token,
+				Separator: parts[2],
+				Year:      candidate.year,
+				Month:     candidate.month,
+				Day:       candidate.day,
+			})
+		}
+	}
+
+	// Drop dates that sit entirely inside a longer date match.
+	filtered := matches[:0]
+	for _, m := range matches {
+		inside := false
+		for _, other := range matches {
+			if m == other {
+				continue
+			}
+			if other.I <= m.I && other.J >= m.J {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			filtered = append(filtered, m)
+		}
+	}
+
+	return filtered
+}
+
+// dmy holds a parsed calendar date.
+type dmy struct {
+	day, month, year int
+}
+
+// mapIntsToDMY tries to read three integers as a day, month and year in any
+// common order.
+//
+// Args:
+//
+//	ints: The three integers in password order.
+//
+// Returns:
+//
+//	The parsed date or nil if the integers can't form a plausible date.
+func mapIntsToDMY(ints []int) *dmy {
+	if ints[1] > 31 || ints[1] <= 0 {
+		return nil
+	}
+
+	over12, over31, under1 := 0, 0, 0
+	for _, n := range ints {
+		if (n > 99 && n < dateMinYear) || n > dateMaxYear {
+			return nil
+		}
+		if n > 31 {
+			over31++
+		}
+		if n > 12 {
+			over12++
+		}
+		if n <= 0 {
+			under1++
+		}
+	}
+	if over31 >= 2 || over12 == 3 || under1 >= 2 {
+		return nil
+	}
+
+	yearSplits := []struct {
+		year int
+		rest []int
+	}{
+		{ints[2], ints[:2]},
+		{ints[0], ints[1:]},
+	}
+
+	for _, split := range yearSplits {
+		if split.year >= dateMinYear && split.year <= dateMaxYear {
+			day, month, ok := mapIntsToDM(split.rest)
+			if !ok {
+				// A four digit year was found but the rest isn't a day and
+				// month, so this can't be a date.
+				return nil
+			}
+			return &dmy{day: day, month: month, year: split.year}
+		}
+	}
+
+	for _, split := range yearSplits {
+		day, month, ok := mapIntsToDM(split.rest)
+		if ok {
+			return &dmy{day: day, month: month, year: twoToFourDigitYear(split.year)}
+		}
+	}
+
+	return nil
+}
+
+// mapIntsToDM reads two integers as a day and month in either order.
+//
+// Args:
+//
+//	ints: The two integers.
+//
+// Returns:
+//
+//	The day, the month and whether the integers form a valid pair.
+func mapIntsToDM(ints []int) (int, int, bool) {
+	for _, pair := range [][2]int{{ints[0], ints[1]}, {ints[1], ints[0]}} {
+		d, m := pair[0], pair[1]
+		if d >= 1 && d <= 31 && m >= 1 && m <= 12 {
+			return d, m, true
+		}
+	}
+	return 0, 0, false
+}
+
+// twoToFourDigitYear expands a two digit year the way people usually mean it.
+//
+// Args:
+//
+//	year: The year to expand.
+//
+// Returns:
+//
+//	The four digit year.
+func twoToFourDigitYear(year int) int {
+	switch {
+	case year > 99:
+		return year
+	case year > 50:
+		return 1900 + year
+	default:
+		return 2000 + year
+	}
+}
+
+// reverseRunes returns a reversed copy of a rune slice.
+//
+// Args:
+//
+//	s: The runes to reverse.
+//
+// Returns:
+//
+//	The reversed copy.
+func reverseRunes(s []rune) []rune {
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[len(s)-1-i] = c
+	}
+	return r
+}
+
+// atoi converts a string of digits to an int, ignoring errors.
+//
+// Args:
+//
+//	s: The digits to convert.
+//
+// Returns:
+//
+//	The integer value.
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// abs returns the absolute value of n.
+//
+// Args:
+//
+//	n: The value.
+//
+// Returns:
+//
+//	The absolute value.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
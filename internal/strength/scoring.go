@@ -0,0 +1,459 @@
+package strength
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	bruteforceCardinality             = 10
+	minGuessesBeforeGrowingSequence   = 10000
+	minSubmatchGuessesSingleChar      = 10
+	minSubmatchGuessesMultiChar       = 50
+	minYearSpace                      = 20
+	keyboardStartingPositionsFallback = 94
+	keyboardAverageDegreeFallback     = 4.6
+)
+
+// referenceYear is the year recent-year and date guesses are measured from.
+var referenceYear = time.Now().Year()
+
+var (
+	startUpperRx = regexp.MustCompile(`^[A-Z][^A-Z]+$`)
+	endUpperRx   = regexp.MustCompile(`^[^A-Z]+[A-Z]$`)
+	allUpperRx   = regexp.MustCompile(`^[^a-z]+$`)
+	allLowerRx   = regexp.MustCompile(`^[^A-Z]+$`)
+)
+
+// mostGuessableMatchSequence searches for the combination of non-overlapping
+// matches that covers the password with the fewest total guesses. Gaps
+// between matches are filled with bruteforce matches.
+//
+// Args:
+//
+//	password: The password as runes.
+//	matches: The candidate matches, as returned by omnimatch.
+//	excludeAdditive: Whether to leave out the penalty for longer sequences.
+//
+// Returns:
+//
+//	The estimated number of guesses and the optimal match sequence.
+func mostGuessableMatchSequence(password []rune, matches []*Match, excludeAdditive bool) (float64, []*Match) {
+	n := len(password)
+	if n == 0 {
+		return 1, nil
+	}
+
+	matchesByJ := make([][]*Match, n)
+	for _, m := range matches {
+		matchesByJ[m.J] = append(matchesByJ[m.J], m)
+	}
+
+	// For each end position k and sequence length l, the best match ending at
+	// k, the product of guesses along that sequence and the total guesses.
+	optM := make([]map[int]*Match, n)
+	optPi := make([]map[int]float64, n)
+	optG := make([]map[int]float64, n)
+	for k := 0; k < n; k++ {
+		optM[k] = make(map[int]*Match)
+		optPi[k] = make(map[int]float64)
+		optG[k] = make(map[int]float64)
+	}
+
+	update := func(m *Match, l int) {
+		k := m.J
+		pi := estimateGuesses(m, password)
+		if l > 1 {
+			pi *= optPi[m.I-1][l-1]
+		}
+		g := factorial(l) * pi
+		if !excludeAdditive {
+			g += math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		}
+
+		for competingL, competingG := range optG[k] {
+			if competingL > l {
+				continue
+			}
+			if competingG <= g {
+				return
+			}
+		}
+
+		optG[k][l] = g
+		optM[k][l] = m
+		optPi[k][l] = pi
+	}
+
+	bruteforceMatch := func(i, j int) *Match {
+		return &Match{
+			Pattern: patternBruteforce,
+			I:       i,
+			J:       j,
+			Token:   string(password[i : j+1]),
+		}
+	}
+
+	bruteforceUpdate := func(k int) {
+		update(bruteforceMatch(0, k), 1)
+		for i := 1; i <= k; i++ {
+			m := bruteforceMatch(i, k)
+			for l, last := range optM[i-1] {
+				if last.Pattern == patternBruteforce {
+					// Two adjacent bruteforce matches are never better than one.
+					continue
+				}
+				update(m, l+1)
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range matchesByJ[k] {
+			if m.I > 0 {
+				for l := range optM[m.I-1] {
+					update(m, l+1)
+				}
+			} else {
+				update(m, 1)
+			}
+		}
+		bruteforceUpdate(k)
+	}
+
+	// Unwind the optimal sequence from the end of the password.
+	k := n - 1
+	bestL := 0
+	bestG := math.Inf(1)
+	for l, g := range optG[k] {
+		if g < bestG || (g == bestG && l < bestL) {
+			bestL, bestG = l, g
+		}
+	}
+
+	sequence := make([]*Match, bestL)
+	for l := bestL; k >= 0 && l > 0; l-- {
+		m := optM[k][l]
+		sequence[l-1] = m
+		k = m.I - 1
+	}
+
+	return bestG, sequence
+}
+
+// estimateGuesses estimates how many guesses an attacker needs for a match
+// and caches the result on the match.
+//
+// Args:
+//
+//	m: The match to estimate.
+//	password: The full password as runes.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func estimateGuesses(m *Match, password []rune) float64 {
+	if m.Guesses > 0 {
+		return m.Guesses
+	}
+
+	minGuesses := 1.0
+	tokenLen := len([]rune(m.Token))
+	if tokenLen < len(password) {
+		if tokenLen == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		} else {
+			minGuesses = minSubmatchGuessesMultiChar
+		}
+	}
+
+	var guesses float64
+	switch m.Pattern {
+	case patternBruteforce:
+		guesses = bruteforceGuesses(m)
+	case patternDictionary:
+		guesses = dictionaryGuesses(m)
+	case patternSpatial:
+		guesses = spatialGuesses(m)
+	case patternRepeat:
+		guesses = m.BaseGuesses * float64(m.RepeatCount)
+	case patternSequence:
+		guesses = sequenceGuesses(m)
+	case patternRegex:
+		guesses = regexGuesses(m)
+	case patternDate:
+		guesses = dateGuesses(m)
+	}
+
+	m.Guesses = math.Max(guesses, minGuesses)
+	m.GuessesLog10 = math.Log10(m.Guesses)
+	return m.Guesses
+}
+
+// bruteforceGuesses estimates guesses for a token with no known pattern.
+//
+// Args:
+//
+//	m: The bruteforce match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func bruteforceGuesses(m *Match) float64 {
+	tokenLen := len([]rune(m.Token))
+	guesses := math.Pow(bruteforceCardinality, float64(tokenLen))
+	if math.IsInf(guesses, 1) {
+		guesses = math.MaxFloat64
+	}
+
+	minGuesses := float64(minSubmatchGuessesSingleChar + 1)
+	if tokenLen > 1 {
+		minGuesses = minSubmatchGuessesMultiChar + 1
+	}
+
+	return math.Max(guesses, minGuesses)
+}
+
+// dictionaryGuesses estimates guesses for a dictionary word, accounting for
+// capitalisation, l33t substitutions and reversal.
+//
+// Args:
+//
+//	m: The dictionary match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func dictionaryGuesses(m *Match) float64 {
+	guesses := float64(m.Rank) * uppercaseVariations(m.Token) * l33tVariations(m)
+	if m.Reversed {
+		guesses *= 2
+	}
+	return guesses
+}
+
+// uppercaseVariations counts the capitalisation patterns an attacker would
+// try to reach the token's casing.
+//
+// Args:
+//
+//	word: The token as written in the password.
+//
+// Returns:
+//
+//	The number of variations.
+func uppercaseVariations(word string) float64 {
+	if allLowerRx.MatchString(word) || strings.ToLower(word) == word {
+		return 1
+	}
+	if startUpperRx.MatchString(word) || endUpperRx.MatchString(word) || allUpperRx.MatchString(word) {
+		return 2
+	}
+
+	upper, lower := 0, 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+
+	var variations float64
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += nCk(upper+lower, i)
+	}
+	return math.Max(variations, 1)
+}
+
+// l33tVariations counts the substitution patterns an attacker would try to
+// reach the token's l33t spelling.
+//
+// Args:
+//
+//	m: The dictionary match.
+//
+// Returns:
+//
+//	The number of variations.
+func l33tVariations(m *Match) float64 {
+	if !m.L33t {
+		return 1
+	}
+
+	variations := 1.0
+	lower := strings.ToLower(m.Token)
+	for subbed, unsubbed := range m.Sub {
+		s := strings.Count(lower, string(subbed))
+		u := strings.Count(lower, string(unsubbed))
+		if s == 0 || u == 0 {
+			variations *= 2
+			continue
+		}
+
+		var possibilities float64
+		for i := 1; i <= min(u, s); i++ {
+			possibilities += nCk(u+s, i)
+		}
+		variations *= possibilities
+	}
+
+	return variations
+}
+
+// spatialGuesses estimates guesses for a keyboard pattern from its length,
+// number of turns and shifted keys.
+//
+// Args:
+//
+//	m: The spatial match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func spatialGuesses(m *Match) float64 {
+	s := float64(keyboardStartingPositionsFallback)
+	d := keyboardAverageDegreeFallback
+	for _, kb := range keyboardGraphs {
+		if kb.name == m.Graph {
+			s, d = kb.startingPositions, kb.averageDegree
+			break
+		}
+	}
+
+	var guesses float64
+	tokenLen := len([]rune(m.Token))
+	for i := 2; i <= tokenLen; i++ {
+		possibleTurns := min(m.Turns, i-1)
+		for j := 1; j <= possibleTurns; j++ {
+			guesses += nCk(i-1, j-1) * s * math.Pow(d, float64(j))
+		}
+	}
+
+	if m.ShiftedCount > 0 {
+		shifted := m.ShiftedCount
+		unshifted := tokenLen - shifted
+		if shifted == 0 || unshifted == 0 {
+			guesses *= 2
+		} else {
+			var variations float64
+			for i := 1; i <= min(shifted, unshifted); i++ {
+				variations += nCk(shifted+unshifted, i)
+			}
+			guesses *= variations
+		}
+	}
+
+	return guesses
+}
+
+// sequenceGuesses estimates guesses for a character sequence.
+//
+// Args:
+//
+//	m: The sequence match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func sequenceGuesses(m *Match) float64 {
+	first := []rune(m.Token)[0]
+
+	var base float64
+	switch {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case first >= '0' && first <= '9':
+		base = 10
+	default:
+		base = 26
+	}
+	if !m.Ascending {
+		base *= 2
+	}
+
+	return base * float64(len([]rune(m.Token)))
+}
+
+// regexGuesses estimates guesses for a regex match.
+//
+// Args:
+//
+//	m: The regex match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func regexGuesses(m *Match) float64 {
+	year, err := strconv.Atoi(m.Token)
+	if err != nil {
+		return bruteforceGuesses(m)
+	}
+	return float64(max(abs(year-referenceYear), minYearSpace))
+}
+
+// dateGuesses estimates guesses for a date.
+//
+// Args:
+//
+//	m: The date match.
+//
+// Returns:
+//
+//	The estimated number of guesses.
+func dateGuesses(m *Match) float64 {
+	yearSpace := max(abs(m.Year-referenceYear), minYearSpace)
+	guesses := float64(yearSpace) * 365
+	if m.Separator != "" {
+		guesses *= 4
+	}
+	return guesses
+}
+
+// nCk returns the binomial coefficient "n choose k".
+//
+// Args:
+//
+//	n: The set size.
+//	k: The subset size.
+//
+// Returns:
+//
+//	The binomial coefficient.
+func nCk(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	if k == 0 {
+		return 1
+	}
+
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+	return r
+}
+
+// factorial returns n! as a float.
+//
+// Args:
+//
+//	n: The value.
+//
+// Returns:
+//
+//	The factorial of n.
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
@@ -0,0 +1,140 @@
+// Package strength estimates how hard a password is to guess.
+//
+// The estimator follows the approach popularised by zxcvbn: the password is
+// broken into overlapping matches (dictionary words, keyboard patterns,
+// repeats, sequences, years and dates), the cheapest combination of those
+// matches is searched for, and the resulting guess count is turned into a
+// 0-4 score, crack-time estimates and user facing feedback. Everything runs
+// offline against frequency lists embedded in the binary.
+package strength
+
+import (
+	"math"
+	"strings"
+)
+
+// MaxScore is the highest score Estimate returns.
+const MaxScore = 4
+
+// maxMatchedRunes is how much of a password is searched for patterns. The
+// search grows much faster than the password, so, as in zxcvbn, the rest is
+// counted as brute force; a password that long is very strong either way.
+const maxMatchedRunes = 100
+
+// Score labels indexed by Result.Score.
+var scoreLabels = [MaxScore + 1]string{"Very weak", "Weak", "Fair", "Strong", "Very strong"}
+
+// Result holds the outcome of a password strength estimation.
+type Result struct {
+	Password     string     `json:"-"`
+	Guesses      float64    `json:"guesses"`
+	GuessesLog10 float64    `json:"guesses_log10"`
+	Score        int        `json:"score"`
+	CrackTimes   CrackTimes `json:"crack_times"`
+	Feedback     Feedback   `json:"feedback"`
+	Sequence     []*Match   `json:"-"`
+}
+
+// Feedback contains a warning and suggestions explaining a weak score.
+type Feedback struct {
+	Warning     string   `json:"warning"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// Label returns a human readable description of the result's score.
+//
+// Returns:
+//
+//	The label matching the score, e.g. "Weak" or "Strong".
+func (r Result) Label() string {
+	return ScoreLabel(r.Score)
+}
+
+// ScoreLabel returns a human readable description of a 0-4 score.
+//
+// Args:
+//
+//	score: The score to describe.
+//
+// Returns:
+//
+//	The label matching the score.
+func ScoreLabel(score int) string {
+	if score < 0 {
+		score = 0
+	}
+	if score >= len(scoreLabels) {
+		score = len(scoreLabels) - 1
+	}
+
+	return scoreLabels[score]
+}
+
+// Estimate estimates the strength of a password. Only the first
+// maxMatchedRunes runes are searched for patterns; the rest is scored as
+// brute force, so the estimate stays fast enough to run on every keystroke.
+//
+// Args:
+//
+//	password: The password to evaluate.
+//	userInputs: Extra words that should be treated as easy to guess,
+//	  such as the entry's username or site name.
+//
+// Returns:
+//
+//	The estimation result.
+func Estimate(password string, userInputs ...string) Result {
+	ranked := rankedUserInputs(userInputs)
+
+	runes := []rune(password)
+	matched := runes[:min(len(runes), maxMatchedRunes)]
+
+	matches := omnimatch(matched, ranked)
+	guesses, sequence := mostGuessableMatchSequence(matched, matches, false)
+	if len(runes) > len(matched) {
+		rest := &Match{
+			Pattern: patternBruteforce,
+			I:       len(matched),
+			J:       len(runes) - 1,
+			Token:   string(runes[len(matched):]),
+		}
+		guesses = math.Min(guesses*estimateGuesses(rest, runes), math.MaxFloat64)
+		sequence = append(sequence, rest)
+	}
+
+	score := guessesToScore(guesses)
+
+	return Result{
+		Password:     password,
+		Guesses:      guesses,
+		GuessesLog10: math.Log10(guesses),
+		Score:        score,
+		CrackTimes:   estimateCrackTimes(guesses),
+		Feedback:     buildFeedback(score, sequence),
+		Sequence:     sequence,
+	}
+}
+
+// rankedUserInputs builds a frequency dictionary from user supplied words.
+//
+// Args:
+//
+//	userInputs: The words to rank in the order they were given.
+//
+// Returns:
+//
+//	A map from lowercased word to its rank.
+func rankedUserInputs(userInputs []string) map[string]int {
+	ranked := make(map[string]int, len(userInputs))
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		if _, ok := ranked[input]; !ok {
+			ranked[input] = len(ranked) + 1
+		}
+	}
+
+	return ranked
+}
@@ -0,0 +1,124 @@
+package strength
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEstimatePatterns checks that passwords made of one known pattern are
+// recognised as that pattern and scored as weak.
+func TestEstimatePatterns(t *testing.T) {
+	tests := []struct {
+		password string
+		pattern  string
+		maxScore int
+	}{
+		{"password", patternDictionary, 0},
+		{"P@ssw0rd", patternDictionary, 1},
+		{"drowssap", patternDictionary, 1},
+		{"poiuytrew", patternSpatial, 1},
+		{"hjkl;'", patternSpatial, 1},
+		{"abcdefghij", patternSequence, 1},
+		{"9876543210", patternSequence, 1},
+		{"aaaaaaaaaa", patternRepeat, 0},
+		{"abcabcabcabc", patternRepeat, 1},
+		{"1987", patternRegex, 1},
+		{"13.05.1987", patternDate, 2},
+	}
+
+	for _, test := range tests {
+		result := Estimate(test.password)
+		if len(result.Sequence) != 1 || result.Sequence[0].Pattern != test.pattern {
+			t.Errorf("Estimate(%q) matched %v, want a single %s match", test.password, patterns(result.Sequence), test.pattern)
+		}
+		if result.Score > test.maxScore {
+			t.Errorf("Estimate(%q).Score = %d, want at most %d", test.password, result.Score, test.maxScore)
+		}
+	}
+}
+
+// TestEstimateScores checks the score of passwords at both ends of the
+// scale.
+func TestEstimateScores(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"123456", 0, 0},
+		{"monkey1", 0, 1},
+		{"correcthorsebatterystaple", 3, MaxScore},
+		{"Xq7#vR2!mK9$wL4@", MaxScore, MaxScore},
+	}
+
+	for _, test := range tests {
+		result := Estimate(test.password)
+		if result.Score < test.min || result.Score > test.max {
+			t.Errorf("Estimate(%q).Score = %d, want %d to %d", test.password, result.Score, test.min, test.max)
+		}
+		if result.Label() != ScoreLabel(result.Score) {
+			t.Errorf("Estimate(%q).Label() = %q, want %q", test.password, result.Label(), ScoreLabel(result.Score))
+		}
+	}
+}
+
+// TestEstimateUserInputs checks that words given as user inputs, such as
+// the entry name, make a password that contains them weak.
+func TestEstimateUserInputs(t *testing.T) {
+	const password = "zorblaxquintev"
+
+	without := Estimate(password)
+	with := Estimate(password, "  ZorblaxQuintev ", "alice")
+	if with.Score >= without.Score {
+		t.Errorf("user inputs did not lower the score: %d with, %d without", with.Score, without.Score)
+	}
+	if len(with.Sequence) != 1 || with.Sequence[0].DictionaryName != dictUser {
+		t.Errorf("Estimate(%q) matched %v, want the user input", password, patterns(with.Sequence))
+	}
+	if with.Feedback.Warning == "" {
+		t.Error("a password made of a user input got no warning")
+	}
+}
+
+// TestEstimateLengthCap checks that a very long password is estimated
+// quickly, with only its start searched for patterns.
+func TestEstimateLengthCap(t *testing.T) {
+	password := strings.Repeat("password", 250)
+
+	started := time.Now()
+	result := Estimate(password)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Estimate of %d runes took %s", len(password), elapsed)
+	}
+
+	last := result.Sequence[len(result.Sequence)-1]
+	if last.Pattern != patternBruteforce || last.I != maxMatchedRunes || last.J != len(password)-1 {
+		t.Errorf("the last match is %s over %d-%d, want brute force over %d-%d", last.Pattern, last.I, last.J, maxMatchedRunes, len(password)-1)
+	}
+	if result.Score != MaxScore {
+		t.Errorf("Score = %d, want %d", result.Score, MaxScore)
+	}
+
+	head := Estimate(password[:maxMatchedRunes])
+	if result.Guesses <= head.Guesses {
+		t.Errorf("the runes past the cap added no guesses: %g, %g for the first %d", result.Guesses, head.Guesses, maxMatchedRunes)
+	}
+}
+
+// patterns lists the patterns of a match sequence, for error messages.
+//
+// Args:
+//
+//	sequence: The matches.
+//
+// Returns:
+//
+//	The pattern of each match.
+func patterns(sequence []*Match) []string {
+	names := make([]string, len(sequence))
+	for i, m := range sequence {
+		names[i] = m.Pattern
+	}
+	return names
+}
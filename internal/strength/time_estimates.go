@@ -0,0 +1,123 @@
+package strength
+
+import (
+	"fmt"
+	"math"
+)
+
+// CrackTime is the estimated time to guess a password in one attack scenario.
+type CrackTime struct {
+	Seconds float64 `json:"seconds"`
+	Display string  `json:"display"`
+}
+
+// CrackTimes holds crack-time estimates for the common attack scenarios.
+type CrackTimes struct {
+	// OnlineThrottled is an online attack against a service that rate limits
+	// to 100 guesses per hour.
+	OnlineThrottled CrackTime `json:"online_throttling_100_per_hour"`
+	// OnlineUnthrottled is an online attack at 10 guesses per second.
+	OnlineUnthrottled CrackTime `json:"online_no_throttling_10_per_second"`
+	// OfflineSlowHash is an offline attack against a slow hash such as
+	// scrypt or bcrypt, at 10k guesses per second.
+	OfflineSlowHash CrackTime `json:"offline_slow_hashing_1e4_per_second"`
+	// OfflineFastHash is an offline attack against a fast hash such as
+	// SHA-256, at 10B guesses per second.
+	OfflineFastHash CrackTime `json:"offline_fast_hashing_1e10_per_second"`
+}
+
+// estimateCrackTimes converts a guess count into crack times.
+//
+// Args:
+//
+//	guesses: The estimated number of guesses.
+//
+// Returns:
+//
+//	The crack-time estimates.
+func estimateCrackTimes(guesses float64) CrackTimes {
+	crackTime := func(perSecond float64) CrackTime {
+		seconds := guesses / perSecond
+		return CrackTime{Seconds: seconds, Display: displayTime(seconds)}
+	}
+
+	return CrackTimes{
+		OnlineThrottled:   crackTime(100.0 / 3600),
+		OnlineUnthrottled: crackTime(10),
+		OfflineSlowHash:   crackTime(1e4),
+		OfflineFastHash:   crackTime(1e10),
+	}
+}
+
+// guessesToScore maps a guess count onto the 0-4 score scale.
+//
+// Args:
+//
+//	guesses: The estimated number of guesses.
+//
+// Returns:
+//
+//	The score, from 0 (too guessable) to 4 (very unguessable).
+func guessesToScore(guesses float64) int {
+	const delta = 5
+
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// displayTime formats a duration in seconds for people, e.g. "3 hours".
+//
+// Args:
+//
+//	seconds: The duration in seconds.
+//
+// Returns:
+//
+//	The formatted duration.
+func displayTime(seconds float64) string {
+	const (
+		minute  = 60.0
+		hour    = minute * 60
+		day     = hour * 24
+		month   = day * 31
+		year    = month * 12
+		century = year * 100
+	)
+
+	unit := func(n float64, name string) string {
+		rounded := math.Round(n)
+		if rounded == 1 {
+			return fmt.Sprintf("1 %s", name)
+		}
+		return fmt.Sprintf("%.0f %ss", rounded, name)
+	}
+
+	switch {
+	case seconds < 1:
+		return "less than a second"
+	case seconds < minute:
+		return unit(seconds, "second")
+	case seconds < hour:
+		return unit(seconds/minute, "minute")
+	case seconds < day:
+		return unit(seconds/hour, "hour")
+	case seconds < month:
+		return unit(seconds/day, "day")
+	case seconds < year:
+		return unit(seconds/month, "month")
+	case seconds < century:
+		return unit(seconds/year, "year")
+	default:
+		return "centuries"
+	}
+}
@@ -0,0 +1,230 @@
+package tui
+
+import (
+	"aegis/internal/queries"
+	"aegis/internal/search"
+	"aegis/internal/strength"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+var (
+	allEntries     []map[string]string
+	visibleEntries []map[string]string
+	revealed       bool
+)
+
+// reloadEntries reads every entry from the vault and redraws the list.
+func reloadEntries() {
+	userData, err := queries.FetchUserData()
+	if err != nil {
+		setError("Could not load entries: %s", err)
+		return
+	}
+
+	allEntries = userData
+	refreshList()
+}
+
+// refreshList filters the loaded entries with the search query and redraws
+// the list, keeping the selection on the same entry when it is still shown.
+func refreshList() {
+	selected, _ := selectedUsername()
+
+	usernames := make([]string, len(allEntries))
+	for i, user := range allEntries {
+		usernames[i] = user["username"]
+	}
+	matches := search.Filter(searchField.GetText(), usernames)
+
+	visibleEntries = make([]map[string]string, len(matches))
+	entryList.Clear()
+	current := 0
+	for i, match := range matches {
+		visibleEntries[i] = allEntries[match.Index]
+		entryList.AddItem(highlightMatch(match), "", 0, nil)
+		if match.Text == selected {
+			current = i
+		}
+	}
+
+	entryList.SetTitle(fmt.Sprintf(" Entries (%d/%d) ", len(matches), len(allEntries)))
+	if len(matches) > 0 {
+		entryList.SetCurrentItem(current)
+	}
+	showDetails(false)
+}
+
+// highlightMatch renders a username with the characters matched by the
+// search query in bold yellow.
+//
+// Args:
+//
+//	match: The search match.
+//
+// Returns:
+//
+//	The username with tview color tags.
+func highlightMatch(match search.Match) string {
+	matched := make(map[int]bool, len(match.Positions))
+	for _, pos := range match.Positions {
+		matched[pos] = true
+	}
+
+	var b strings.Builder
+	for i, r := range []rune(match.Text) {
+		char := tview.Escape(string(r))
+		if matched[i] {
+			b.WriteString("[yellow::b]" + char + "[-::-]")
+		} else {
+			b.WriteString(char)
+		}
+	}
+
+	return b.String()
+}
+
+// selectedUsername returns the username of the highlighted entry.
+//
+// Returns:
+//
+//	The username and whether an entry is highlighted.
+func selectedUsername() (string, bool) {
+	index := entryList.GetCurrentItem()
+	if index < 0 || index >= len(visibleEntries) {
+		return "", false
+	}
+
+	return visibleEntries[index]["username"], true
+}
+
+// showDetails fills the detail pane for the highlighted entry.
+//
+// Args:
+//
+//	reveal: Whether to decrypt and show the password.
+func showDetails(reveal bool) {
+	revealed = reveal
+	detailView.Clear()
+
+	index := entryList.GetCurrentItem()
+	if index < 0 || index >= len(visibleEntries) {
+		if len(allEntries) == 0 {
+			detailView.SetText("No passwords stored yet. Press [::b]a[::-] to add one.")
+		}
+		return
+	}
+	user := visibleEntries[index]
+
+	fmt.Fprintf(detailView, "[::b]Username[::-]  %s\n", tview.Escape(user["username"]))
+	fmt.Fprintf(detailView, "[::b]Created[::-]   %s\n", formatTimestamp(user["created_on"]))
+	fmt.Fprintf(detailView, "[::b]Updated[::-]   %s\n\n", formatTimestamp(user["updated_on"]))
+
+	if !reveal {
+		fmt.Fprint(detailView, "[::b]Password[::-]  ••••••••  (enter to reveal)\n")
+		return
+	}
+
+	password, err := queries.FetchPassword(user["username"])
+	if err != nil {
+		revealed = false
+		setError("Could not decrypt password: %s", err)
+		return
+	}
+
+	result := strength.Estimate(password, user["username"])
+	fmt.Fprintf(detailView, "[::b]Password[::-]  %s\n", tview.Escape(password))
+	fmt.Fprintf(detailView, "[::b]Strength[::-]  %s\n", result.Label())
+	if result.Feedback.Warning != "" {
+		fmt.Fprintf(detailView, "          %s\n", tview.Escape(result.Feedback.Warning))
+	}
+	if count := breachCount(password); count > 0 {
+		fmt.Fprintf(detailView, "\n[red]Found %d times in known data breaches[-]\n", count)
+	}
+}
+
+// toggleReveal shows or hides the password of the highlighted entry.
+func toggleReveal() {
+	showDetails(!revealed)
+}
+
+// copySelected copies the password of the highlighted entry to the clipboard.
+// The terminal receives it as an OSC 52 sequence, which also works over SSH
+// and inside tmux when set-clipboard is enabled.
+func copySelected() {
+	username, ok := selectedUsername()
+	if !ok {
+		return
+	}
+
+	password, err := queries.FetchPassword(username)
+	if err != nil {
+		setError("Could not decrypt password: %s", err)
+		return
+	}
+
+	screen.SetClipboard([]byte(password))
+	setStatus(fmt.Sprintf("Copied the password of %s", tview.Escape(username)))
+}
+
+// confirmDelete asks before deleting the highlighted entry.
+func confirmDelete() {
+	username, ok := selectedUsername()
+	if !ok {
+		return
+	}
+
+	showConfirm(fmt.Sprintf("Delete %s?", username), "Delete", func() {
+		if err := queries.DeleteUserByPasswordHash(username); err != nil {
+			setError("Could not delete entry: %s", err)
+			return
+		}
+
+		setStatus(fmt.Sprintf("Deleted %s", tview.Escape(username)))
+		reloadEntries()
+	})
+}
+
+// breachCount looks a password up in the configured breach corpus.
+//
+// Args:
+//
+//	password: The plaintext password to check.
+//
+// Returns:
+//
+//	How many times the password appears in known breaches, 0 when it was not
+//	found or no corpus is configured.
+func breachCount(password string) int {
+	if breachCorpus == nil {
+		return 0
+	}
+
+	count, err := breachCorpus.Count(password)
+	if err != nil {
+		setError("Breach check failed: %s", err)
+		return 0
+	}
+
+	return count
+}
+
+// formatTimestamp formats a database timestamp for display.
+//
+// Args:
+//
+//	s: The timestamp as stored.
+//
+// Returns:
+//
+//	The timestamp in local time, or s unchanged if it could not be parsed.
+func formatTimestamp(s string) string {
+	t, err := queries.ParseTimestamp(s)
+	if err != nil {
+		return s
+	}
+
+	return t.Local().Format("2006-01-02 15:04")
+}
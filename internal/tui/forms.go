@@ -0,0 +1,190 @@
+package tui
+
+import (
+	"aegis/internal/generator"
+	"aegis/internal/queries"
+	"aegis/internal/strength"
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// openEntryForm shows the form for adding an entry or changing a password.
+//
+// Args:
+//
+//	username: The entry to edit, or an empty string to add a new entry.
+func openEntryForm(username string) {
+	adding := username == ""
+
+	form := tview.NewForm()
+	messageView := tview.NewTextView().SetDynamicColors(true)
+
+	if adding {
+		form.AddInputField("Username", "", 40, nil, nil)
+		form.SetTitle(" Add New Password ")
+	} else {
+		form.SetTitle(fmt.Sprintf(" Update Password: %s ", tview.Escape(username)))
+	}
+
+	strengthView := tview.NewTextView().SetDynamicColors(true)
+	passwordField := tview.NewInputField().
+		SetLabel("Password").
+		SetFieldWidth(40).
+		SetMaskCharacter('*')
+	passwordField.SetChangedFunc(func(password string) {
+		updateStrength(strengthView, password, entryUsername(form, username))
+	})
+	form.AddFormItem(passwordField)
+
+	form.AddCheckbox("Show password", false, func(checked bool) {
+		if checked {
+			passwordField.SetMaskCharacter(0)
+		} else {
+			passwordField.SetMaskCharacter('*')
+		}
+	})
+
+	form.AddButton("Generate", func() {
+		password, err := generator.Password(generator.DefaultOptions())
+		if err != nil {
+			messageView.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+			return
+		}
+		passwordField.SetText(password)
+	})
+
+	form.AddButton("Save", func() {
+		name := entryUsername(form, username)
+		password := passwordField.GetText()
+		if name == "" || password == "" {
+			messageView.SetText("[red]All fields are required[-]")
+			return
+		}
+
+		save := func() {
+			var err error
+			if adding {
+				err = queries.AddNewPassword(name, password)
+			} else {
+				err = queries.EditUserPassword(password, name)
+			}
+			if err != nil {
+				messageView.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+				return
+			}
+
+			closeDialog()
+			if adding {
+				setStatus(fmt.Sprintf("Added %s", tview.Escape(name)))
+			} else {
+				setStatus(fmt.Sprintf("Updated %s", tview.Escape(name)))
+			}
+			reloadEntries()
+		}
+
+		if count := breachCount(password); count > 0 {
+			message := fmt.Sprintf("This password has appeared %d times in known data breaches.\nSave it anyway?", count)
+			showConfirm(message, "Save", save)
+			return
+		}
+		save()
+	})
+
+	form.AddButton("Cancel", closeDialog)
+	form.SetCancelFunc(closeDialog)
+	form.SetBorder(true)
+
+	// Each form item and the button row take two lines, plus the border.
+	formHeight := 2*(form.GetFormItemCount()+1) + 3
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, formHeight, 0, true).
+		AddItem(strengthView, 2, 0, false).
+		AddItem(messageView, 1, 0, false)
+
+	pages.AddPage(pageDialog, centered(layout, 60, formHeight+3), true, true)
+	app.SetFocus(form)
+}
+
+// entryUsername returns the username an entry form applies to.
+//
+// Args:
+//
+//	form: The entry form.
+//	username: The entry being edited, or an empty string when adding.
+//
+// Returns:
+//
+//	The username.
+func entryUsername(form *tview.Form, username string) string {
+	if username != "" {
+		return username
+	}
+
+	field, ok := form.GetFormItemByLabel("Username").(*tview.InputField)
+	if !ok {
+		return ""
+	}
+	return field.GetText()
+}
+
+// updateStrength shows the estimated strength of a password.
+//
+// Args:
+//
+//	view: The view to write the estimate to.
+//	password: The password to estimate.
+//	username: The entry's username, which makes a password easier to guess.
+func updateStrength(view *tview.TextView, password, username string) {
+	if password == "" {
+		view.SetText("")
+		return
+	}
+
+	result := strength.Estimate(password, username)
+	colors := []string{"red", "red", "orange", "yellow", "green"}
+	text := fmt.Sprintf("Strength: [%s]%s[-]", colors[result.Score], result.Label())
+	if result.Feedback.Warning != "" {
+		text += "\n" + tview.Escape(result.Feedback.Warning)
+	}
+	view.SetText(text)
+}
+
+// showConfirm asks a yes/no question in a modal dialog.
+//
+// Args:
+//
+//	message: The question.
+//	action: The label of the confirming button.
+//	onConfirm: Called when the user confirms.
+func showConfirm(message, action string, onConfirm func()) {
+	previous := app.GetFocus()
+
+	modal := tview.NewModal().
+		SetText(message).
+		AddButtons([]string{action, "Cancel"})
+	modal.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		pages.RemovePage(pageConfirm)
+		if buttonLabel != action {
+			app.SetFocus(previous)
+			return
+		}
+
+		onConfirm()
+		if pages.HasPage(pageDialog) {
+			app.SetFocus(previous)
+		} else {
+			app.SetFocus(entryList)
+		}
+	})
+
+	pages.AddPage(pageConfirm, modal, true, true)
+	app.SetFocus(modal)
+}
+
+// closeDialog closes the open form and returns focus to the entry list.
+func closeDialog() {
+	pages.RemovePage(pageDialog)
+	app.SetFocus(entryList)
+}
@@ -0,0 +1,341 @@
+package tui
+
+import (
+	"aegis/internal/hibp"
+	"aegis/internal/mpass"
+	"aegis/internal/queries"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Page names used with the pages container.
+const (
+	pageLock    = "lock"
+	pageMain    = "main"
+	pageDialog  = "dialog"
+	pageConfirm = "confirm"
+)
+
+// helpText lists the keys available in the entry list.
+const helpText = "[::b]/[::-] search  [::b]enter[::-] reveal  [::b]c[::-] copy  [::b]a[::-] add  [::b]e[::-] edit  [::b]d[::-] delete  [::b]l[::-]/[::b]ctrl-l[::-] lock  [::b]q[::-] quit"
+
+var (
+	app          *tview.Application
+	screen       tcell.Screen
+	pages        *tview.Pages
+	searchField  *tview.InputField
+	entryList    *tview.List
+	detailView   *tview.TextView
+	statusBar    *tview.TextView
+	lockForm     *tview.Form
+	lockPassword *tview.InputField
+	lockMessage  *tview.TextView
+	breachCorpus *hibp.Corpus
+)
+
+// Run starts the full-screen terminal interface and blocks until the user quits.
+// The vault is unlocked with AEGIS_MASTER_PASS when it is set, otherwise the
+// lock screen asks for the master password.
+//
+// Returns:
+//
+//	An error if the terminal could not be used.
+func Run() error {
+	queries.CreatePasswordsTable()
+
+	corpus, err := hibp.OpenConfigured()
+	if err != nil {
+		log.Printf("Could not open breach corpus: %s", err)
+	}
+	breachCorpus = corpus
+	defer func() {
+		if breachCorpus != nil {
+			breachCorpus.Close()
+		}
+	}()
+
+	s, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("could not open terminal: %w", err)
+	}
+
+	return run(s)
+}
+
+// run builds the interface on a terminal screen and runs it until the user quits.
+//
+// Args:
+//
+//	s: The screen to draw on.
+//
+// Returns:
+//
+//	An error if the screen could not be used.
+func run(s tcell.Screen) error {
+	screen = s
+	app = tview.NewApplication().SetScreen(screen)
+	pages = tview.NewPages()
+	pages.AddPage(pageMain, buildMainView(), true, false)
+	pages.AddPage(pageLock, buildLockScreen(), true, false)
+
+	if password, ok := mpass.LookupMasterPass(); ok && unlock(password) == nil {
+		showMainView()
+	} else {
+		showLockScreen("")
+	}
+
+	defer queries.ClearMasterPass()
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlL && queries.IsUnlocked() {
+			lock()
+			return nil
+		}
+		return event
+	})
+
+	return app.SetRoot(pages, true).EnableMouse(true).Run()
+}
+
+// buildMainView creates the search field, entry list, detail pane and status
+// lines of the main view.
+//
+// Returns:
+//
+//	The main view layout.
+func buildMainView() tview.Primitive {
+	searchField = tview.NewInputField().
+		SetLabel("Search: ").
+		SetPlaceholder("type / to search entries")
+	searchField.SetChangedFunc(func(query string) {
+		refreshList()
+	})
+	searchField.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			searchField.SetText("")
+		}
+		app.SetFocus(entryList)
+	})
+
+	entryList = tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true)
+	entryList.SetBorder(true).SetTitle(" Entries ")
+	entryList.SetChangedFunc(func(int, string, string, rune) {
+		showDetails(false)
+	})
+	entryList.SetSelectedFunc(func(int, string, string, rune) {
+		toggleReveal()
+	})
+	entryList.SetInputCapture(handleListKey)
+
+	detailView = tview.NewTextView().SetDynamicColors(true).SetWrap(true)
+	detailView.SetBorder(true).SetTitle(" Details ")
+
+	statusBar = tview.NewTextView().SetDynamicColors(true)
+	helpBar := tview.NewTextView().SetDynamicColors(true).SetText(helpText)
+
+	body := tview.NewFlex().
+		AddItem(entryList, 0, 1, true).
+		AddItem(detailView, 0, 2, false)
+
+	return tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(searchField, 1, 0, false).
+		AddItem(body, 0, 1, true).
+		AddItem(statusBar, 1, 0, false).
+		AddItem(helpBar, 1, 0, false)
+}
+
+// handleListKey handles the single-key commands of the entry list.
+//
+// Args:
+//
+//	event: The key event.
+//
+// Returns:
+//
+//	The event if the list should still handle it, nil if it was consumed.
+func handleListKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEscape:
+		if searchField.GetText() != "" {
+			searchField.SetText("")
+		}
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	switch event.Rune() {
+	case '/':
+		app.SetFocus(searchField)
+	case 'c':
+		copySelected()
+	case 'a':
+		openEntryForm("")
+	case 'e':
+		if username, ok := selectedUsername(); ok {
+			openEntryForm(username)
+		}
+	case 'd':
+		confirmDelete()
+	case 'l':
+		lock()
+	case 'q':
+		app.Stop()
+	case 'j':
+		return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+	case 'k':
+		return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+	default:
+		return event
+	}
+
+	return nil
+}
+
+// buildLockScreen creates the master password prompt shown while the vault is locked.
+//
+// Returns:
+//
+//	The lock screen layout.
+func buildLockScreen() tview.Primitive {
+	lockPassword = tview.NewInputField().
+		SetLabel("Master password ").
+		SetFieldWidth(32).
+		SetMaskCharacter('*')
+	lockMessage = tview.NewTextView().SetTextColor(tcell.ColorRed)
+
+	unlockFunc := func() {
+		err := unlock([]byte(lockPassword.GetText()))
+		switch {
+		case errors.Is(err, queries.ErrWrongMasterPass):
+			showLockScreen("Wrong master password")
+		case err != nil:
+			showLockScreen(err.Error())
+		default:
+			showMainView()
+		}
+	}
+	lockPassword.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEnter {
+			unlockFunc()
+			return nil
+		}
+		return event
+	})
+
+	lockForm = tview.NewForm().
+		AddFormItem(lockPassword).
+		AddButton("Unlock", unlockFunc).
+		AddButton("Quit", app.Stop)
+	lockForm.SetBorder(true).SetTitle(" Aegis is locked ")
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(lockForm, 7, 0, true).
+		AddItem(lockMessage, 1, 0, false)
+
+	return centered(layout, 56, 8)
+}
+
+// showLockScreen hides every view behind the master password prompt.
+//
+// Args:
+//
+//	message: An error to show below the prompt, or an empty string.
+func showLockScreen(message string) {
+	lockPassword.SetText("")
+	lockMessage.SetText(message)
+
+	pages.RemovePage(pageDialog)
+	pages.RemovePage(pageConfirm)
+	pages.HidePage(pageMain)
+	pages.ShowPage(pageLock)
+	lockForm.SetFocus(0)
+	app.SetFocus(lockForm)
+}
+
+// showMainView hides the lock screen and loads the entries.
+func showMainView() {
+	pages.HidePage(pageLock)
+	pages.ShowPage(pageMain)
+	searchField.SetText("")
+	reloadEntries()
+	app.SetFocus(entryList)
+}
+
+// unlock checks a master password and hands it to the repository layer.
+//
+// Args:
+//
+//	password: The master password.
+//
+// Returns:
+//
+//	queries.ErrWrongMasterPass if the password is wrong, or another error if
+//	one occurred.
+func unlock(password []byte) error {
+	queries.SetMasterPass(password)
+	if err := queries.VerifyMasterPass(); err != nil {
+		queries.ClearMasterPass()
+		return err
+	}
+
+	return nil
+}
+
+// lock forgets the master password and the loaded entries and shows the lock screen.
+func lock() {
+	queries.ClearMasterPass()
+	allEntries = nil
+	visibleEntries = nil
+	entryList.Clear()
+	detailView.Clear()
+	setStatus("")
+	showLockScreen("")
+}
+
+// setStatus shows a message in the status line.
+//
+// Args:
+//
+//	message: The message, which may contain tview color tags.
+func setStatus(message string) {
+	statusBar.SetText(message)
+}
+
+// setError shows an error in the status line.
+//
+// Args:
+//
+//	format: A fmt format string.
+//	args: The format arguments.
+func setError(format string, args ...any) {
+	setStatus("[red]" + tview.Escape(fmt.Sprintf(format, args...)) + "[-]")
+}
+
+// centered places a primitive in the middle of the screen at a fixed size.
+//
+// Args:
+//
+//	p: The primitive to center.
+//	width: The width in cells.
+//	height: The height in cells.
+//
+// Returns:
+//
+//	A layout with p in the middle.
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
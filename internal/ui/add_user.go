@@ -6,6 +6,8 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
+
+	"fmt"
 )
 
 // openAddUserWindow opens a new window for adding a new password.
@@ -15,7 +17,7 @@ import (
 //	a: The Fyne application instance.
 func openAddUserWindow(a fyne.App) {
 	addWindow := a.NewWindow("Add New Password")
-	addWindow.Resize(fyne.NewSize(400, 300))
+	addWindow.Resize(fyne.NewSize(400, 420))
 	addWindow.CenterOnScreen()
 
 	titleLabel := widget.NewLabel("Add New Password")
@@ -30,6 +32,14 @@ func openAddUserWindow(a fyne.App) {
 	passwordEntry := widget.NewPasswordEntry()
 	passwordEntry.SetPlaceHolder("Enter password")
 
+	meter := newStrengthMeter()
+	passwordEntry.OnChanged = func(password string) {
+		meter.update(password, usernameEntry.Text)
+	}
+	usernameEntry.OnChanged = func(username string) {
+		meter.update(passwordEntry.Text, username)
+	}
+
 	statusLabel := widget.NewLabel("")
 
 	submitBtn := widget.NewButton("Add Password", func() {
@@ -43,10 +53,17 @@ func openAddUserWindow(a fyne.App) {
 			return
 		}
 
-		queries.AddNewPassword(username, password)
-
-		addWindow.Close()
-		refreshUserList(a)
+		confirmIfBreached(addWindow, password, func() {
+			if err := queries.AddNewPassword(username, password); err != nil {
+				statusLabel.SetText(fmt.Sprintf("Could not add password: %s", err))
+				statusLabel.Importance = widget.DangerImportance
+				statusLabel.Refresh()
+				return
+			}
+
+			addWindow.Close()
+			refreshUserList(a)
+		})
 	})
 	submitBtn.Importance = widget.HighImportance
 
@@ -66,6 +83,7 @@ func openAddUserWindow(a fyne.App) {
 		usernameEntry,
 		passwordLabel,
 		passwordEntry,
+		meter.container(),
 		widget.NewSeparator(),
 		buttonContainer,
 		statusLabel,
@@ -2,10 +2,12 @@ package ui
 
 import (
 	"aegis/internal/queries"
+	"aegis/internal/search"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"log"
+	"strconv"
 )
 
 // Copy copies the given password to the clipboard.
@@ -42,20 +44,58 @@ func buildUserList(a fyne.App) *fyne.Container {
 	}
 
 	if len(userData) == 0 {
-		emptyCard := createEmptyStateCard()
+		emptyCard := createEmptyStateCard("No passwords stored yet", "Click 'Add New Password' to get started")
+		return container.NewVBox(emptyCard)
+	}
+
+	userData = filterUserData(userData, searchQuery)
+	if len(userData) == 0 {
+		emptyCard := createEmptyStateCard("No entries match the search", "Try fewer or different characters")
 		return container.NewVBox(emptyCard)
 	}
 
 	for _, user := range userData {
 		username := user["username"]
-		decryptedPassword := queries.FetchPassword(username)
+		decryptedPassword, err := queries.FetchPassword(username)
+		if err != nil {
+			log.Printf("Could not decrypt password: %s", err)
+			errorCard := createErrorCard("Error decrypting passwords")
+			return container.NewVBox(errorCard)
+		}
 		user["password_ciphertext"] = decryptedPassword
+		user["breach_count"] = strconv.Itoa(breachCount(decryptedPassword))
 	}
 
 	userCards := createUserCards(userData, a)
 	return container.NewVBox(userCards...)
 }
 
+// filterUserData keeps the entries whose username fuzzy-matches the search
+// query, best match first.
+//
+// Args:
+//
+//	userData: The entries to filter.
+//	query: The search text. An empty query keeps every entry.
+//
+// Returns:
+//
+//	The matching entries.
+func filterUserData(userData []map[string]string, query string) []map[string]string {
+	usernames := make([]string, len(userData))
+	for i, user := range userData {
+		usernames[i] = user["username"]
+	}
+
+	matches := search.Filter(query, usernames)
+	filtered := make([]map[string]string, len(matches))
+	for i, match := range matches {
+		filtered[i] = userData[match.Index]
+	}
+
+	return filtered
+}
+
 // refreshUserList refreshes the list of user cards in the UI.
 //
 // Args:
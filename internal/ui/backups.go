@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"aegis/internal/queries"
+	"aegis/internal/snapshot"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// openBackupsWindow opens a window listing the snapshots of the vault, from
+// which one can be taken now or an earlier one restored.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+func openBackupsWindow(a fyne.App) {
+	backupsWindow := a.NewWindow("Backups")
+	backupsWindow.Resize(fyne.NewSize(600, 500))
+	backupsWindow.CenterOnScreen()
+
+	titleLabel := widget.NewLabel("Backups")
+	titleLabel.TextStyle.Bold = true
+	titleLabel.Importance = widget.HighImportance
+
+	dirLabel := widget.NewLabel("")
+	dirLabel.Wrapping = fyne.TextWrapWord
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+
+	setStatus := func(text string, importance widget.Importance) {
+		statusLabel.SetText(text)
+		statusLabel.Importance = importance
+		statusLabel.Refresh()
+	}
+
+	var snapshots []snapshot.Snapshot
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(snapshots) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			s := snapshots[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s    %s    %s", s.TakenOn.Local().Format("2006-01-02 15:04"), s.Reason, s.HumanSize()))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+	}
+	list.OnUnselected = func(widget.ListItemID) {
+		selected = -1
+	}
+
+	reload := func() {
+		settings, dir, interval, err := snapshot.Settings()
+		if err != nil {
+			setStatus(fmt.Sprintf("Could not read the backup settings: %s", err), widget.DangerImportance)
+			return
+		}
+		if settings.Disabled {
+			dirLabel.SetText(fmt.Sprintf("Automatic backups are off. Backups are kept in %s.", dir))
+		} else {
+			dirLabel.SetText(fmt.Sprintf("A backup is taken every %s and before migrations, imports and restores. Backups are kept in %s.", snapshot.FormatInterval(interval), dir))
+		}
+
+		snapshots, err = snapshot.List()
+		if err != nil {
+			setStatus(fmt.Sprintf("Could not list backups: %s", err), widget.DangerImportance)
+		}
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+	}
+
+	backUpBtn := widget.NewButton("Back Up Now", func() {
+		taken, err := snapshot.Take(queries.DB, snapshot.ReasonManual)
+		if err != nil {
+			setStatus(fmt.Sprintf("Backup failed: %s", err), widget.DangerImportance)
+			return
+		}
+		reload()
+		setStatus(fmt.Sprintf("Saved %s", taken.Name), widget.MediumImportance)
+	})
+	backUpBtn.Importance = widget.HighImportance
+
+	restoreBtn := widget.NewButton("Restore", func() {
+		if selected < 0 || selected >= len(snapshots) {
+			setStatus("Select a backup to restore", widget.DangerImportance)
+			return
+		}
+		s := snapshots[selected]
+
+		message := fmt.Sprintf("Replace every entry of the vault with the backup of %s?\nThe vault as it is now is backed up first.", s.TakenOn.Local().Format("2006-01-02 15:04"))
+		dialog.ShowConfirm("Restore Backup", message, func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := snapshot.Restore(queries.DB, s.Name); err != nil {
+				setStatus(fmt.Sprintf("Restore failed: %s", err), widget.DangerImportance)
+				return
+			}
+			queries.CreatePasswordsTable()
+			reload()
+			refreshUserList(a)
+			setStatus(fmt.Sprintf("Restored %s", s.Name), widget.MediumImportance)
+		}, backupsWindow)
+	})
+	restoreBtn.Importance = widget.DangerImportance
+
+	closeBtn := widget.NewButton("Close", func() {
+		backupsWindow.Close()
+	})
+
+	form := container.NewVBox(
+		titleLabel,
+		widget.NewSeparator(),
+		dirLabel,
+		container.NewHBox(backUpBtn, restoreBtn, closeBtn),
+		statusLabel,
+		widget.NewSeparator(),
+	)
+
+	reload()
+
+	content := container.NewStack(
+		windowBg,
+		container.NewPadded(container.NewBorder(form, nil, nil, nil, list)),
+	)
+
+	backupsWindow.SetContent(content)
+	backupsWindow.Show()
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"aegis/internal/config"
+	"aegis/internal/hibp"
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+var breachCorpus *hibp.Corpus
+
+// loadBreachCorpus opens the Pwned Passwords file chosen in the settings, if any.
+func loadBreachCorpus() {
+	corpus, err := hibp.OpenConfigured()
+	if err != nil {
+		log.Printf("Could not open breach corpus: %s", err)
+		return
+	}
+
+	breachCorpus = corpus
+}
+
+// setBreachCorpusFile switches to a new Pwned Passwords file and remembers it
+// in the settings.
+//
+// Args:
+//
+//	path: The path to the sorted corpus file.
+//
+// Returns:
+//
+//	An error if the file could not be opened or the settings not saved.
+func setBreachCorpusFile(path string) error {
+	corpus, err := hibp.Open(path)
+	if err != nil {
+		return err
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		corpus.Close()
+		return err
+	}
+	settings.HIBPFile = path
+	if err := config.Save(settings); err != nil {
+		corpus.Close()
+		return err
+	}
+
+	if breachCorpus != nil {
+		breachCorpus.Close()
+	}
+	breachCorpus = corpus
+
+	return nil
+}
+
+// breachCount looks a password up in the open breach corpus.
+//
+// Args:
+//
+//	password: The plaintext password to check.
+//
+// Returns:
+//
+//	How many times the password appears in known breaches, 0 when it was not
+//	found or no corpus is configured.
+func breachCount(password string) int {
+	if breachCorpus == nil {
+		return 0
+	}
+
+	count, err := breachCorpus.Count(password)
+	if err != nil {
+		log.Printf("Breach check failed: %s", err)
+		return 0
+	}
+
+	return count
+}
+
+// confirmIfBreached runs save straight away unless the password is in the
+// breach corpus, in which case the user has to confirm first.
+//
+// Args:
+//
+//	w: The window to show the confirmation in.
+//	password: The password about to be saved.
+//	save: The function that saves the password.
+func confirmIfBreached(w fyne.Window, password string, save func()) {
+	count := breachCount(password)
+	if count == 0 {
+		save()
+		return
+	}
+
+	message := fmt.Sprintf("This password has appeared %d times in known data breaches.\nSave it anyway?", count)
+	dialog.ShowConfirm("Breached Password", message, func(ok bool) {
+		if ok {
+			save()
+		}
+	}, w)
+}
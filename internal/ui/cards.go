@@ -9,7 +9,9 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"fmt"
 	"image/color"
+	"log"
 )
 
 // createUserCards creates a slice of Fyne canvas objects representing user cards.
@@ -78,7 +80,9 @@ func createUserCard(user map[string]string, a fyne.App) *fyne.Container {
 	})
 
 	deleteBtn := widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
-		queries.DeleteUserByPasswordHash(user["username"])
+		if err := queries.DeleteUserByPasswordHash(user["username"]); err != nil {
+			log.Printf("Could not delete entry: %s", err)
+		}
 		refreshUserList(a)
 	})
 	deleteBtn.Importance = widget.DangerImportance
@@ -93,10 +97,18 @@ func createUserCard(user map[string]string, a fyne.App) *fyne.Container {
 		usernameContainer,
 		container.NewPadded(widget.NewSeparator()),
 		passwordContainer,
-		container.NewPadded(widget.NewSeparator()),
-		buttonContainer,
 	)
 
+	if count := user["breach_count"]; count != "" && count != "0" {
+		breachLabel := widget.NewLabel(fmt.Sprintf("Found %s times in known data breaches", count))
+		breachLabel.Importance = widget.DangerImportance
+		breachIcon := widget.NewIcon(theme.WarningIcon())
+		cardContent.Add(container.NewBorder(nil, nil, breachIcon, nil, breachLabel))
+	}
+
+	cardContent.Add(container.NewPadded(widget.NewSeparator()))
+	cardContent.Add(buttonContainer)
+
 	card := container.NewStack(
 		cardBg,
 		container.NewPadded(cardContent),
@@ -140,10 +152,15 @@ func createErrorCard(message string) *fyne.Container {
 
 // createEmptyStateCard creates a Fyne container representing an empty state card.
 //
+// Args:
+//
+//	message: The main message.
+//	hint: A hint shown below the message.
+//
 // Returns:
 //
 //	A Fyne container representing an empty state card.
-func createEmptyStateCard() *fyne.Container {
+func createEmptyStateCard(message, hint string) *fyne.Container {
 	emptyBg := canvas.NewLinearGradient(
 		color.NRGBA{R: 70, G: 76, B: 90, A: 255},
 		color.NRGBA{R: 60, G: 66, B: 80, A: 255},
@@ -151,10 +168,10 @@ func createEmptyStateCard() *fyne.Container {
 	)
 
 	emptyIcon := widget.NewIcon(theme.InfoIcon())
-	emptyLabel := widget.NewLabel("No passwords stored yet")
+	emptyLabel := widget.NewLabel(message)
 	emptyLabel.Alignment = fyne.TextAlignCenter
 
-	hintLabel := widget.NewLabel("Click 'Add New Password' to get started")
+	hintLabel := widget.NewLabel(hint)
 	hintLabel.Alignment = fyne.TextAlignCenter
 
 	emptyContent := container.NewVBox(
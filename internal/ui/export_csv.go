@@ -1,10 +1,16 @@
 package ui
 
 import (
+	"errors"
 	"fyne.io/fyne/v2/dialog"
 	"log"
+	"strings"
 
+	"aegis/internal/aegisbak"
+	"aegis/internal/ageshare"
+	"aegis/internal/kdbx"
 	"aegis/internal/pass_export"
+	"aegis/internal/passstore"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
@@ -17,14 +23,22 @@ import (
 //	a: The Fyne application instance.
 func openExportPassToFileWindow(a fyne.App) {
 	updateWindow := a.NewWindow("Export DB To CSV")
-	updateWindow.Resize(fyne.NewSize(400, 250))
+	updateWindow.Resize(fyne.NewSize(500, 700))
 	updateWindow.CenterOnScreen()
 
 	titleLabel := widget.NewLabel("Export DB")
 	titleLabel.TextStyle.Bold = true
 	titleLabel.Importance = widget.HighImportance
 
+	filterForm, currentFilter := newExportFilterForm()
+
 	selectCsvBtn := widget.NewButton("Select Path", func() {
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
 		dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
 			if err != nil {
 				log.Println("File open error:", err)
@@ -36,7 +50,10 @@ func openExportPassToFileWindow(a fyne.App) {
 
 			defer writer.Close()
 
-			pass_export.ExportPasswordsCsv(writer.URI().Path())
+			if err := pass_export.ExportPasswordsCsv(writer.URI().Path(), filter); err != nil {
+				log.Printf("Could not export passwords: %s", err)
+				return
+			}
 
 			updateWindow.Close()
 			refreshUserList(a)
@@ -46,6 +63,218 @@ func openExportPassToFileWindow(a fyne.App) {
 		dialog.Show()
 	})
 
+	bitwardenPassword := widget.NewPasswordEntry()
+	bitwardenPassword.SetPlaceHolder("Bitwarden export password (optional)")
+
+	bitwardenBtn := widget.NewButton("Export Bitwarden JSON", func() {
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
+		var password []byte
+		if bitwardenPassword.Text != "" {
+			password = []byte(bitwardenPassword.Text)
+		}
+
+		save := func() {
+			dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					log.Println("File open error:", err)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				writer.Close()
+
+				if err := pass_export.ExportBitwardenJSON(writer.URI().Path(), password, filter); err != nil {
+					dialog.ShowError(err, updateWindow)
+					return
+				}
+
+				updateWindow.Close()
+			}, updateWindow)
+			dialog.SetFileName("bitwarden_export.json")
+			dialog.Show()
+		}
+
+		if password != nil {
+			save()
+			return
+		}
+		dialog.ShowConfirm("Unencrypted Export",
+			"Without a password the export holds every password in plaintext.\nExport anyway?",
+			func(ok bool) {
+				if ok {
+					save()
+				}
+			}, updateWindow)
+	})
+
+	keePassPassword := widget.NewPasswordEntry()
+	keePassPassword.SetPlaceHolder("New KeePass master password")
+
+	keePassBtn := widget.NewButton("Export KeePass Database", func() {
+		if keePassPassword.Text == "" {
+			dialog.ShowError(kdbx.ErrNoKey, updateWindow)
+			return
+		}
+		key := kdbx.Key{Password: []byte(keePassPassword.Text)}
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
+		dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
+
+			if err := pass_export.ExportKeePassKDBX(writer.URI().Path(), key, filter); err != nil {
+				dialog.ShowError(err, updateWindow)
+				return
+			}
+
+			updateWindow.Close()
+		}, updateWindow)
+		dialog.SetFileName("aegis.kdbx")
+		dialog.Show()
+	})
+
+	backupPassword := widget.NewPasswordEntry()
+	backupPassword.SetPlaceHolder("Backup password")
+
+	backupBtn := widget.NewButton("Export Aegis Backup", func() {
+		if backupPassword.Text == "" {
+			dialog.ShowError(errors.New("the backup password cannot be empty"), updateWindow)
+			return
+		}
+		password := []byte(backupPassword.Text)
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
+		dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
+
+			if err := pass_export.ExportAegisBackup(writer.URI().Path(), password, filter); err != nil {
+				dialog.ShowError(err, updateWindow)
+				return
+			}
+
+			updateWindow.Close()
+		}, updateWindow)
+		dialog.SetFileName("aegis" + aegisbak.Extension)
+		dialog.Show()
+	})
+
+	passStoreKeyFile := widget.NewEntry()
+	passStoreKeyFile.SetPlaceHolder("Public keys: gpg --export --armor ID > keys.asc")
+	passStoreBrowseBtn := widget.NewButton("Browse", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			passStoreKeyFile.SetText(reader.URI().Path())
+		}, updateWindow)
+	})
+
+	passStoreBtn := widget.NewButton("Export Password Store", func() {
+		recipients, err := passstore.ReadKeyRing(passStoreKeyFile.Text)
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
+		dialog := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				log.Println("Folder open error:", err)
+				return
+			}
+			if dir == nil {
+				return
+			}
+
+			if err := pass_export.ExportPassStore(dir.Path(), recipients, filter); err != nil {
+				dialog.ShowError(err, updateWindow)
+				return
+			}
+
+			updateWindow.Close()
+		}, updateWindow)
+		dialog.Show()
+	})
+
+	ageRecipients := widget.NewMultiLineEntry()
+	ageRecipients.SetPlaceHolder("age public keys of the recipients, one per line")
+	ageRecipients.SetMinRowsVisible(2)
+
+	ageShareBtn := widget.NewButton("Export age Share", func() {
+		recipients, err := ageshare.ParseRecipients(strings.Fields(ageRecipients.Text))
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+
+		dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
+
+			if err := pass_export.ExportAgeShare(writer.URI().Path(), recipients, filter); err != nil {
+				dialog.ShowError(err, updateWindow)
+				return
+			}
+
+			updateWindow.Close()
+		}, updateWindow)
+		dialog.SetFileName("aegis-share" + ageshare.Extension)
+		dialog.Show()
+	})
+
+	plaintextBtn := widget.NewButton("Plaintext Export...", func() {
+		filter, err := currentFilter()
+		if err != nil {
+			dialog.ShowError(err, updateWindow)
+			return
+		}
+		openPlaintextExportWindow(a, updateWindow, filter)
+	})
+	plaintextBtn.Importance = widget.DangerImportance
+
 	cancelBtn := widget.NewButton("Cancel", func() {
 		updateWindow.Close()
 	})
@@ -58,12 +287,31 @@ func openExportPassToFileWindow(a fyne.App) {
 	form := container.NewVBox(
 		titleLabel,
 		widget.NewSeparator(),
+		filterForm,
+		widget.NewSeparator(),
 		buttonContainer,
+		widget.NewSeparator(),
+		bitwardenPassword,
+		bitwardenBtn,
+		widget.NewSeparator(),
+		keePassPassword,
+		keePassBtn,
+		widget.NewSeparator(),
+		backupPassword,
+		backupBtn,
+		widget.NewSeparator(),
+		container.NewBorder(nil, nil, nil, passStoreBrowseBtn, passStoreKeyFile),
+		passStoreBtn,
+		widget.NewSeparator(),
+		ageRecipients,
+		ageShareBtn,
+		widget.NewSeparator(),
+		plaintextBtn,
 	)
 
 	content := container.NewStack(
 		windowBg,
-		container.NewPadded(form),
+		container.NewPadded(container.NewVScroll(form)),
 	)
 
 	updateWindow.SetContent(content)
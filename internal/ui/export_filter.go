@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"aegis/internal/pass_export"
+	"aegis/internal/queries"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// noFolderLabel stands for the entries without a folder in the folder list.
+const noFolderLabel = "(no folder)"
+
+// newExportFilterForm builds the controls that choose which entries an
+// export holds, with a label counting the entries chosen.
+//
+// Returns:
+//
+//	The controls and a function returning the filter they describe, or an
+//	error if a date cannot be read.
+func newExportFilterForm() (fyne.CanvasObject, func() (pass_export.Filter, error)) {
+	folders, tags, err := vaultFoldersAndTags()
+	if err != nil {
+		log.Printf("Could not list folders and tags: %s", err)
+	}
+
+	foldersCheck := widget.NewCheckGroup(folders, nil)
+	tagsCheck := widget.NewCheckGroup(tags, nil)
+	tagsCheck.Horizontal = true
+
+	dateEntry := func(placeHolder string) *widget.Entry {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder(placeHolder)
+		return entry
+	}
+	createdAfter, createdBefore := dateEntry("On or after YYYY-MM-DD"), dateEntry("Before YYYY-MM-DD")
+	updatedAfter, updatedBefore := dateEntry("On or after YYYY-MM-DD"), dateEntry("Before YYYY-MM-DD")
+
+	queryEntry := widget.NewEntry()
+	queryEntry.SetPlaceHolder("Text in the name, URL, login, folder or tags")
+
+	countLabel := widget.NewLabel("")
+
+	currentFilter := func() (pass_export.Filter, error) {
+		filter := pass_export.Filter{Tags: tagsCheck.Selected, Query: queryEntry.Text}
+		for _, folder := range foldersCheck.Selected {
+			if folder == noFolderLabel {
+				folder = ""
+			}
+			filter.Folders = append(filter.Folders, folder)
+		}
+
+		dates := []struct {
+			name  string
+			entry *widget.Entry
+			into  *time.Time
+		}{
+			{"Created after", createdAfter, &filter.CreatedAfter},
+			{"Created before", createdBefore, &filter.CreatedBefore},
+			{"Updated after", updatedAfter, &filter.UpdatedAfter},
+			{"Updated before", updatedBefore, &filter.UpdatedBefore},
+		}
+		for _, date := range dates {
+			if date.entry.Text == "" {
+				continue
+			}
+			t, err := queries.ParseTimestamp(date.entry.Text)
+			if err != nil {
+				return pass_export.Filter{}, fmt.Errorf("%s: %w", date.name, err)
+			}
+			*date.into = t
+		}
+
+		return filter, nil
+	}
+
+	updateCount := func() {
+		filter, err := currentFilter()
+		if err != nil {
+			countLabel.SetText(err.Error())
+			return
+		}
+		matches, total, err := pass_export.CountMatches(filter)
+		if err != nil {
+			countLabel.SetText(fmt.Sprintf("Could not count the entries: %s", err))
+			return
+		}
+		countLabel.SetText(fmt.Sprintf("%d of %d entries selected", matches, total))
+	}
+	foldersCheck.OnChanged = func([]string) { updateCount() }
+	tagsCheck.OnChanged = func([]string) { updateCount() }
+	for _, entry := range []*widget.Entry{createdAfter, createdBefore, updatedAfter, updatedBefore, queryEntry} {
+		entry.OnChanged = func(string) { updateCount() }
+	}
+	updateCount()
+
+	form := widget.NewForm(
+		widget.NewFormItem("Folders", foldersCheck),
+		widget.NewFormItem("Tags", tagsCheck),
+		widget.NewFormItem("Created", container.NewGridWithColumns(2, createdAfter, createdBefore)),
+		widget.NewFormItem("Updated", container.NewGridWithColumns(2, updatedAfter, updatedBefore)),
+		widget.NewFormItem("Search", queryEntry),
+	)
+
+	return container.NewVBox(
+		widget.NewLabel("Entries to export; with nothing chosen, all of them"),
+		form,
+		countLabel,
+	), currentFilter
+}
+
+// vaultFoldersAndTags lists the folders and tags that hold entries, sorted,
+// with the entries without a folder listed as noFolderLabel.
+//
+// Returns:
+//
+//	The folders, the tags and an error if the entries could not be read.
+func vaultFoldersAndTags() ([]string, []string, error) {
+	users, err := queries.FetchUserData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var folders, tags []string
+	for _, user := range users {
+		folder := user["folder"]
+		if folder == "" {
+			folder = noFolderLabel
+		}
+		if !slices.Contains(folders, folder) {
+			folders = append(folders, folder)
+		}
+		for _, tag := range queries.SplitTags(user["tags"]) {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(folders)
+	slices.Sort(tags)
+	return folders, tags, nil
+}
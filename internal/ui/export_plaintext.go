@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"log"
+	"os"
+
+	"aegis/internal/pass_export"
+	"aegis/internal/queries"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// openPlaintextExportWindow opens a window for exporting chosen fields of
+// the chosen entries decrypted, as CSV or JSON, once the master password is
+// typed again.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	exportWindow: The export window, closed once the export is written.
+//	filter: The entries chosen in the export window.
+func openPlaintextExportWindow(a fyne.App, exportWindow fyne.Window, filter pass_export.Filter) {
+	plaintextWindow := a.NewWindow("Plaintext Export")
+	plaintextWindow.Resize(fyne.NewSize(500, 600))
+	plaintextWindow.CenterOnScreen()
+
+	titleLabel := widget.NewLabel("Plaintext Export")
+	titleLabel.TextStyle.Bold = true
+	titleLabel.Importance = widget.HighImportance
+
+	warningLabel := widget.NewLabel("WARNING: the file will hold your passwords and secrets DECRYPTED. " +
+		"Anyone who can read it can read them. Delete it as soon as it has been imported elsewhere, " +
+		"or protect it with an envelope passphrase.")
+	warningLabel.TextStyle.Bold = true
+	warningLabel.Importance = widget.DangerImportance
+	warningLabel.Wrapping = fyne.TextWrapWord
+
+	formatSelect := widget.NewSelect([]string{"CSV", "JSON"}, nil)
+	formatSelect.SetSelectedIndex(0)
+
+	fieldsCheck := widget.NewCheckGroup(pass_export.PlaintextFields, nil)
+	fieldsCheck.Horizontal = true
+	fieldsCheck.SetSelected(pass_export.PlaintextFields)
+
+	masterPassword := widget.NewPasswordEntry()
+	masterPassword.SetPlaceHolder("Master password, again")
+	passphrase := widget.NewPasswordEntry()
+	passphrase.SetPlaceHolder("Envelope passphrase (optional)")
+
+	exportBtn := widget.NewButton("Export Plaintext", func() {
+		if err := queries.ConfirmMasterPass([]byte(masterPassword.Text)); err != nil {
+			dialog.ShowError(err, plaintextWindow)
+			return
+		}
+
+		options := pass_export.PlaintextOptions{
+			Format: pass_export.PlaintextCSV,
+			Fields: append([]string{}, fieldsCheck.Selected...),
+		}
+		if formatSelect.SelectedIndex() == 1 {
+			options.Format = pass_export.PlaintextJSON
+		}
+		fileName := "aegis_plaintext." + options.Format
+		if passphrase.Text != "" {
+			options.Passphrase = []byte(passphrase.Text)
+			fileName += ".age"
+		}
+
+		dialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			// The dialog has created an empty file, which the export replaces.
+			writer.Close()
+
+			if err := pass_export.ExportPlaintext(writer.URI().Path(), options, filter); err != nil {
+				os.Remove(writer.URI().Path())
+				dialog.ShowError(err, plaintextWindow)
+				return
+			}
+
+			plaintextWindow.Close()
+			exportWindow.Close()
+		}, plaintextWindow)
+		dialog.SetFileName(fileName)
+		dialog.Show()
+	})
+	exportBtn.Importance = widget.DangerImportance
+
+	cancelBtn := widget.NewButton("Cancel", func() {
+		plaintextWindow.Close()
+	})
+
+	form := container.NewVBox(
+		titleLabel,
+		widget.NewSeparator(),
+		warningLabel,
+		widget.NewForm(
+			widget.NewFormItem("Format", formatSelect),
+			widget.NewFormItem("Fields", fieldsCheck),
+			widget.NewFormItem("Confirm", masterPassword),
+			widget.NewFormItem("Envelope", passphrase),
+		),
+		container.NewHBox(exportBtn, cancelBtn),
+	)
+
+	content := container.NewStack(
+		windowBg,
+		container.NewPadded(container.NewVScroll(form)),
+	)
+
+	plaintextWindow.SetContent(content)
+	plaintextWindow.Show()
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"aegis/internal/agent"
+
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// approvalPollInterval is how often the GUI asks the agent for fill requests.
+const approvalPollInterval = time.Second
+
+// watchFillApprovals asks the running agent for browser fill requests and
+// shows a confirmation for each one, for as long as the GUI is open. It does
+// nothing while no agent is running.
+//
+// Args:
+//
+//	w: The window to show the confirmations in.
+func watchFillApprovals(w fyne.Window) {
+	shown := make(map[string]bool)
+
+	for range time.Tick(approvalPollInterval) {
+		client, err := agent.Dial()
+		if err != nil {
+			continue
+		}
+		approvals, err := client.Approvals()
+		client.Close()
+		if err != nil {
+			continue
+		}
+
+		pending := make(map[string]bool, len(approvals))
+		for _, approval := range approvals {
+			pending[approval.ID] = true
+			if shown[approval.ID] {
+				continue
+			}
+
+			fyne.Do(func() {
+				showFillApproval(w, approval)
+			})
+		}
+		shown = pending
+	}
+}
+
+// showFillApproval asks whether a browser may fill an entry and sends the
+// answer to the agent.
+//
+// Args:
+//
+//	w: The window to show the confirmation in.
+//	approval: The pending fill request.
+func showFillApproval(w fyne.Window, approval agent.Approval) {
+	message := fmt.Sprintf("%s wants to fill the password of %s.\nAllow it?", approval.Origin, approval.Username)
+	dialog.ShowConfirm("Browser Autofill", message, func(ok bool) {
+		go func() {
+			client, err := agent.Dial()
+			if err != nil {
+				return
+			}
+			defer client.Close()
+			client.Decide(approval.ID, ok)
+		}()
+	}, w)
+	w.RequestFocus()
+}
@@ -1,15 +1,38 @@
 package ui
 
 import (
+	"errors"
 	"fyne.io/fyne/v2/dialog"
 	"log"
+	"strings"
 
+	"aegis/internal/aegisbak"
+	"aegis/internal/ageshare"
+	"aegis/internal/bitwarden"
+	"aegis/internal/kdbx"
 	"aegis/internal/pass_import"
+	"aegis/internal/passstore"
+	"aegis/internal/queries"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
+
+	"filippo.io/age"
 )
 
+// autoDetectProfile is the CSV profile choice that detects the format from
+// the file's header.
+const autoDetectProfile = "Detect automatically"
+
+// importForm is the import window with the controls shared by the imports
+// that have no preview.
+type importForm struct {
+	window   fyne.Window
+	lenient  *widget.Check
+	progress *widget.ProgressBar
+	buttons  []*widget.Button
+}
+
 // openImportPassFromFile opens a new window for importing passwords from a CSV file.
 //
 // Args:
@@ -25,6 +48,21 @@ func openImportPassFromFile(a fyne.App) {
 	titleLabel.Importance = widget.HighImportance
 	statusLabel := widget.NewLabel("")
 
+	profileNames := []string{autoDetectProfile}
+	for _, profile := range pass_import.CSVProfiles {
+		profileNames = append(profileNames, profile.Name)
+	}
+	profileSelect := widget.NewSelect(profileNames, nil)
+	profileSelect.SetSelectedIndex(0)
+
+	progressBar := widget.NewProgressBar()
+	progressBar.Hide()
+	form := &importForm{
+		window:   updateWindow,
+		lenient:  widget.NewCheck("Import the other entries if one cannot be stored", nil),
+		progress: progressBar,
+	}
+
 	selectCsvBtn := widget.NewButton("Select CSV File", func() {
 		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
 			if err != nil {
@@ -37,11 +75,102 @@ func openImportPassFromFile(a fyne.App) {
 
 			defer reader.Close()
 
-			pass_import.ImportPasswordsCsv(reader.URI().Path())
+			profileID := ""
+			if i := profileSelect.SelectedIndex(); i > 0 {
+				profileID = pass_import.CSVProfiles[i-1].ID
+			}
+			preview, err := pass_import.PreviewCsv(reader.URI().Path(), profileID)
+			if err != nil {
+				dialog.ShowError(err, updateWindow)
+				return
+			}
+
+			openImportPreviewWindow(a, updateWindow, preview)
 
-			updateWindow.Close()
-			refreshUserList(a)
+		}, updateWindow)
+
+		dialog.Show()
+	})
+
+	selectBitwardenBtn := widget.NewButton("Select Bitwarden JSON", func() {
+		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			importBitwarden(a, form, reader.URI().Path(), nil)
+		}, updateWindow)
+
+		dialog.Show()
+	})
+
+	selectKeePassBtn := widget.NewButton("Select KeePass Database", func() {
+		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			importKeePass(a, form, reader.URI().Path(), "Open KeePass Database")
+		}, updateWindow)
+
+		dialog.Show()
+	})
+
+	selectBackupBtn := widget.NewButton("Select Aegis Backup", func() {
+		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			importAegisBackup(a, form, reader.URI().Path(), "Backup Password")
+		}, updateWindow)
+
+		dialog.Show()
+	})
+
+	selectPassStoreBtn := widget.NewButton("Select Password Store", func() {
+		dialog := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				log.Println("Folder open error:", err)
+				return
+			}
+			if dir == nil {
+				return
+			}
+
+			importPassStore(a, form, dir.Path(), "", "Open Password Store")
+		}, updateWindow)
+
+		dialog.Show()
+	})
+
+	selectAgeShareBtn := widget.NewButton("Select age Share", func() {
+		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
 
+			importAgeShare(a, form, reader.URI().Path())
 		}, updateWindow)
 
 		dialog.Show()
@@ -51,23 +180,342 @@ func openImportPassFromFile(a fyne.App) {
 		updateWindow.Close()
 	})
 
+	form.buttons = []*widget.Button{selectCsvBtn, selectBitwardenBtn, selectKeePassBtn, selectBackupBtn, selectPassStoreBtn, selectAgeShareBtn}
 	buttonContainer := container.NewHBox(
 		selectCsvBtn,
+		selectBitwardenBtn,
+		selectKeePassBtn,
+		selectBackupBtn,
+		selectPassStoreBtn,
+		selectAgeShareBtn,
 		cancelBtn,
 	)
 
-	form := container.NewVBox(
+	layout := container.NewVBox(
 		titleLabel,
 		widget.NewSeparator(),
+		widget.NewForm(widget.NewFormItem("CSV from", profileSelect)),
 		buttonContainer,
+		form.lenient,
+		progressBar,
 		statusLabel,
 	)
 
 	content := container.NewStack(
 		windowBg,
-		container.NewPadded(form),
+		container.NewPadded(layout),
 	)
 
 	updateWindow.SetContent(content)
 	updateWindow.Show()
 }
+
+// run imports in the background, showing the progress in the window and
+// the report when the import finishes.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	importEntries: Runs the import in the chosen mode.
+//	retry: Called with the error if the import failed; returns true if it
+//	  handled the error, for example by asking for a password again.
+func (f *importForm) run(a fyne.App, importEntries func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error), retry func(err error) bool) {
+	mode := pass_import.ModeStrict
+	if f.lenient.Checked {
+		mode = pass_import.ModeLenient
+	}
+
+	for _, button := range f.buttons {
+		button.Disable()
+	}
+	f.progress.SetValue(0)
+	f.progress.Show()
+
+	go func() {
+		report, err := importEntries(mode, func(done, total int) {
+			fyne.Do(func() {
+				f.progress.SetValue(float64(done) / float64(total))
+			})
+		})
+
+		fyne.Do(func() {
+			f.progress.Hide()
+			for _, button := range f.buttons {
+				button.Enable()
+			}
+			if err != nil {
+				if !retry(err) {
+					dialog.ShowError(err, f.window)
+				}
+				return
+			}
+
+			refreshUserList(a)
+			finished := dialog.NewInformation("Import Finished", reportMessage(report), f.window)
+			finished.SetOnClosed(f.window.Close)
+			finished.Show()
+		})
+	}()
+}
+
+// reportMessage describes the report of an import for a dialog.
+//
+// Args:
+//
+//	report: The report.
+//
+// Returns:
+//
+//	The counts, followed by the failed and skipped entries.
+func reportMessage(report pass_import.Report) string {
+	message := report.String()
+	if len(report.Failures) > 0 {
+		message += "\n\n" + strings.Join(report.Failures, "\n")
+	}
+	if len(report.Notes) > 0 {
+		message += "\n\n" + strings.Join(report.Notes, "\n")
+	}
+	return message
+}
+
+// importBitwarden imports a Bitwarden JSON export, asking for its password
+// when it is password protected.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	f: The import window.
+//	path: The export file.
+//	password: The export password, or nil if none was asked for yet.
+func importBitwarden(a fyne.App, f *importForm, path string, password []byte) {
+	f.run(a, func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error) {
+		return pass_import.ImportBitwardenJSON(path, password, mode, progress)
+	}, func(err error) bool {
+		if !errors.Is(err, bitwarden.ErrPasswordRequired) && (password == nil || !errors.Is(err, bitwarden.ErrWrongPassword)) {
+			return false
+		}
+
+		passwordEntry := widget.NewPasswordEntry()
+		title := "Bitwarden Export Password"
+		if password != nil {
+			title = "Wrong Password, Try Again"
+		}
+		dialog.ShowForm(title, "Import", "Cancel", []*widget.FormItem{
+			widget.NewFormItem("Password", passwordEntry),
+		}, func(ok bool) {
+			if ok {
+				importBitwarden(a, f, path, []byte(passwordEntry.Text))
+			}
+		}, f.window)
+		return true
+	})
+}
+
+// importKeePass asks for the master password and key file of a KeePass
+// database and imports it, asking again if they do not open it.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	f: The import window.
+//	path: The database file.
+//	title: The title of the password form.
+func importKeePass(a fyne.App, f *importForm, path, title string) {
+	passwordEntry := widget.NewPasswordEntry()
+	keyFileEntry := widget.NewEntry()
+	keyFileEntry.SetPlaceHolder("Optional")
+	browseBtn := widget.NewButton("Browse", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			keyFileEntry.SetText(reader.URI().Path())
+		}, f.window)
+	})
+
+	dialog.ShowForm(title, "Import", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Key file", container.NewBorder(nil, nil, nil, browseBtn, keyFileEntry)),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		retry := func(err error) bool {
+			if !errors.Is(err, kdbx.ErrWrongKey) && !errors.Is(err, kdbx.ErrNoKey) {
+				return false
+			}
+			importKeePass(a, f, path, "Wrong Password or Key File, Try Again")
+			return true
+		}
+
+		key, err := kdbx.NewKey([]byte(passwordEntry.Text), keyFileEntry.Text)
+		if err != nil {
+			if !retry(err) {
+				dialog.ShowError(err, f.window)
+			}
+			return
+		}
+		f.run(a, func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error) {
+			return pass_import.ImportKeePassKDBX(path, key, mode, progress)
+		}, retry)
+	}, f.window)
+}
+
+// importAegisBackup asks for the password of an Aegis backup and restores
+// it, asking again if the password does not open it.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	f: The import window.
+//	path: The backup file.
+//	title: The title of the password form.
+func importAegisBackup(a fyne.App, f *importForm, path, title string) {
+	passwordEntry := widget.NewPasswordEntry()
+
+	dialog.ShowForm(title, "Restore", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Password", passwordEntry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		password := []byte(passwordEntry.Text)
+		f.run(a, func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error) {
+			return pass_import.ImportAegisBackup(path, password, mode, progress)
+		}, func(err error) bool {
+			if !errors.Is(err, aegisbak.ErrWrongPassword) {
+				return false
+			}
+			importAegisBackup(a, f, path, "Wrong Password, Try Again")
+			return true
+		})
+	}, f.window)
+}
+
+// importPassStore asks for the exported OpenPGP secret key of a password
+// store and its passphrase and imports the store, asking again if the
+// passphrase does not unlock the key.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	f: The import window.
+//	dir: The root directory of the store.
+//	keyFile: The key file chosen before, or "".
+//	title: The title of the key form.
+func importPassStore(a fyne.App, f *importForm, dir, keyFile, title string) {
+	keyFileEntry := widget.NewEntry()
+	keyFileEntry.SetPlaceHolder("gpg --export-secret-keys --armor ID > key.asc")
+	keyFileEntry.SetText(keyFile)
+	passphraseEntry := widget.NewPasswordEntry()
+	passphraseEntry.SetPlaceHolder("Empty if the key has none")
+	browseBtn := widget.NewButton("Browse", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			keyFileEntry.SetText(reader.URI().Path())
+		}, f.window)
+	})
+
+	dialog.ShowForm(title, "Import", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Secret key", container.NewBorder(nil, nil, nil, browseBtn, keyFileEntry)),
+		widget.NewFormItem("Passphrase", passphraseEntry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		keys, err := passstore.ReadKeyRing(keyFileEntry.Text)
+		if err == nil && keys.Locked() {
+			err = keys.Unlock([]byte(passphraseEntry.Text))
+		}
+		if errors.Is(err, passstore.ErrWrongPassphrase) {
+			importPassStore(a, f, dir, keyFileEntry.Text, "Wrong Passphrase, Try Again")
+			return
+		}
+		if err != nil {
+			dialog.ShowError(err, f.window)
+			return
+		}
+
+		f.run(a, func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error) {
+			return pass_import.ImportPassStore(dir, keys, mode, progress)
+		}, func(error) bool { return false })
+	}, f.window)
+}
+
+// importAgeShare asks for the age identity file to open a share with,
+// defaulting to the vault's own identity, and imports the share. The form
+// shows the vault's recipient, or creates the identity when there is none.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	f: The import window.
+//	path: The share file.
+func importAgeShare(a fyne.App, f *importForm, path string) {
+	identityEntry := widget.NewEntry()
+	identityEntry.SetPlaceHolder("Empty for this vault's identity")
+	browseBtn := widget.NewButton("Browse", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			identityEntry.SetText(reader.URI().Path())
+		}, f.window)
+	})
+
+	recipientLabel := widget.NewLabel("This vault has no age identity")
+	var identityBtn *widget.Button
+	identityBtn = widget.NewButton("Create Identity", func() {
+		recipient, err := queries.FetchAgeRecipient()
+		if errors.Is(err, queries.ErrNoAgeIdentity) {
+			recipient, err = ageshare.GenerateIdentity(false)
+		}
+		if err != nil {
+			dialog.ShowError(err, f.window)
+			return
+		}
+		recipientLabel.SetText(recipient)
+		identityBtn.SetText("Copy Recipient")
+		a.Clipboard().SetContent(recipient)
+	})
+	if recipient, err := queries.FetchAgeRecipient(); err == nil {
+		recipientLabel.SetText(recipient)
+		identityBtn.SetText("Copy Recipient")
+	}
+
+	dialog.ShowForm("Open age Share", "Import", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Identity file", container.NewBorder(nil, nil, nil, browseBtn, identityEntry)),
+		widget.NewFormItem("This vault", container.NewBorder(nil, nil, nil, identityBtn, recipientLabel)),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		var identities []age.Identity
+		var err error
+		if identityEntry.Text != "" {
+			identities, err = ageshare.ReadIdentities(identityEntry.Text)
+		} else {
+			var identity age.Identity
+			if identity, err = ageshare.VaultIdentity(); err == nil {
+				identities = []age.Identity{identity}
+			}
+		}
+		if err != nil {
+			dialog.ShowError(err, f.window)
+			return
+		}
+
+		f.run(a, func(mode pass_import.ImportMode, progress func(done, total int)) (pass_import.Report, error) {
+			return pass_import.ImportAgeShare(path, identities, mode, progress)
+		}, func(error) bool { return false })
+	}, f.window)
+}
@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+
+	"aegis/internal/pass_import"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// strategyLabels are the names the conflict strategies are offered under, in
+// the order of pass_import.Strategies.
+var strategyLabels = []string{"Skip", "Overwrite", "Keep both", "Keep newer"}
+
+// openImportPreviewWindow shows what importing a file would do, row by row,
+// lets the user pick a strategy for each conflict and imports on request.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+//	importWindow: The import window, closed once the import is done.
+//	preview: The preview of the file.
+func openImportPreviewWindow(a fyne.App, importWindow fyne.Window, preview *pass_import.Preview) {
+	previewWindow := a.NewWindow("Import Preview")
+	previewWindow.Resize(fyne.NewSize(700, 500))
+	previewWindow.CenterOnScreen()
+
+	titleLabel := widget.NewLabel("Import Preview")
+	titleLabel.TextStyle.Bold = true
+	titleLabel.Importance = widget.HighImportance
+
+	summaryLabel := widget.NewLabel(fmt.Sprintf("%d new, %d identical, %d conflicting, %d invalid",
+		preview.Count(pass_import.StatusNew), preview.Count(pass_import.StatusIdentical),
+		preview.Count(pass_import.StatusConflict), preview.Count(pass_import.StatusInvalid)))
+
+	rowList := widget.NewList(
+		func() int {
+			return len(preview.Rows)
+		},
+		func() fyne.CanvasObject {
+			statusLabel := widget.NewLabel("identical")
+			statusLabel.TextStyle.Bold = true
+			detailLabel := widget.NewLabel("")
+			detailLabel.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, statusLabel, widget.NewSelect(strategyLabels, nil), detailLabel)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			row := preview.Rows[id]
+			border := item.(*fyne.Container)
+			detailLabel := border.Objects[0].(*widget.Label)
+			statusLabel := border.Objects[1].(*widget.Label)
+			strategySelect := border.Objects[2].(*widget.Select)
+
+			statusLabel.SetText(row.Status.String())
+			switch row.Status {
+			case pass_import.StatusConflict:
+				statusLabel.Importance = widget.WarningImportance
+			case pass_import.StatusInvalid:
+				statusLabel.Importance = widget.DangerImportance
+			default:
+				statusLabel.Importance = widget.MediumImportance
+			}
+			statusLabel.Refresh()
+
+			detail := fmt.Sprintf("Row %d: %s", row.Row, row.Name)
+			if row.Reason != "" {
+				detail += " (" + row.Reason + ")"
+			}
+			detailLabel.SetText(detail)
+
+			strategySelect.OnChanged = nil
+			if row.Status != pass_import.StatusConflict {
+				strategySelect.Hide()
+				return
+			}
+			strategySelect.SetSelectedIndex(int(row.Strategy))
+			strategySelect.OnChanged = func(string) {
+				row.Strategy = pass_import.Strategies[strategySelect.SelectedIndex()]
+			}
+			strategySelect.Show()
+		},
+	)
+
+	allConflictsSelect := widget.NewSelect(strategyLabels, func(string) {})
+	allConflictsSelect.SetSelectedIndex(int(pass_import.StrategySkip))
+	allConflictsSelect.OnChanged = func(string) {
+		preview.SetStrategy(pass_import.Strategies[allConflictsSelect.SelectedIndex()])
+		rowList.Refresh()
+	}
+
+	lenientCheck := widget.NewCheck("Import the other rows if one cannot be stored", nil)
+	progressBar := widget.NewProgressBar()
+	progressBar.Hide()
+
+	var importBtn *widget.Button
+	importBtn = widget.NewButton("Import", func() {
+		mode := pass_import.ModeStrict
+		if lenientCheck.Checked {
+			mode = pass_import.ModeLenient
+		}
+
+		importBtn.Disable()
+		progressBar.SetValue(0)
+		progressBar.Show()
+
+		go func() {
+			report, err := preview.Apply(mode, func(done, total int) {
+				fyne.Do(func() {
+					progressBar.SetValue(float64(done) / float64(total))
+				})
+			})
+
+			fyne.Do(func() {
+				refreshUserList(a)
+				progressBar.Hide()
+				if err != nil {
+					importBtn.Enable()
+					dialog.ShowError(err, previewWindow)
+					return
+				}
+
+				previewWindow.Close()
+				finished := dialog.NewInformation("Import Finished", reportMessage(report), importWindow)
+				finished.SetOnClosed(importWindow.Close)
+				finished.Show()
+			})
+		}()
+	})
+	importBtn.Importance = widget.HighImportance
+
+	cancelBtn := widget.NewButton("Cancel", func() {
+		previewWindow.Close()
+	})
+
+	header := container.NewVBox(
+		titleLabel,
+		widget.NewSeparator(),
+		summaryLabel,
+		widget.NewForm(widget.NewFormItem("All conflicts", allConflictsSelect)),
+	)
+	footer := container.NewVBox(
+		lenientCheck,
+		progressBar,
+		container.NewHBox(importBtn, cancelBtn),
+	)
+
+	content := container.NewStack(
+		windowBg,
+		container.NewPadded(container.NewBorder(header, footer, nil, nil, rowList)),
+	)
+
+	previewWindow.SetContent(content)
+	previewWindow.Show()
+}
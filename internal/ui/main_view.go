@@ -2,6 +2,7 @@ package ui
 
 import (
 	"aegis/internal/queries"
+	"aegis/internal/snapshot"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -15,6 +16,7 @@ import (
 
 var userListContainer *fyne.Container
 var scrollContainer *container.Scroll
+var searchQuery string
 
 // RunUI runs the main user interface for the Aegis Password Manager.
 func RunUI() {
@@ -22,6 +24,7 @@ func RunUI() {
 	defer db.Close()
 
 	queries.CreatePasswordsTable()
+	loadBreachCorpus()
 	a := app.New()
 	w := a.NewWindow("Aegis Password Manager")
 	w.CenterOnScreen()
@@ -52,10 +55,32 @@ func RunUI() {
 		openAddUserWindow(a)
 	})
 	addButton.Importance = widget.HighImportance
+	auditButton := widget.NewButton("Security Audit", func() {
+		openSecurityAuditWindow(a)
+	})
+	auditButton.Importance = widget.HighImportance
+	backupsButton := widget.NewButton("Backups", func() {
+		openBackupsWindow(a)
+	})
+	backupsButton.Importance = widget.HighImportance
+	doctorButton := widget.NewButton("Check Vault", func() {
+		openVaultDoctorWindow(a)
+	})
+	doctorButton.Importance = widget.HighImportance
+
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Search entries")
+	searchEntry.OnChanged = func(query string) {
+		searchQuery = query
+		refreshUserList(a)
+	}
 
 	buttonBar := container.NewHBox(
 		importCsvButton,
 		exportCsvButton,
+		auditButton,
+		backupsButton,
+		doctorButton,
 		addButton,
 	)
 
@@ -80,6 +105,7 @@ func RunUI() {
 	content := container.NewBorder(
 		container.NewVBox(
 			headerWithBg,
+			container.NewPadded(searchEntry),
 			widget.NewSeparator(),
 		),
 		nil, nil, nil,
@@ -87,5 +113,7 @@ func RunUI() {
 	)
 
 	w.SetContent(container.NewStack(bg, content))
+	go watchFillApprovals(w)
+	go snapshot.RunScheduled(queries.DB)
 	w.ShowAndRun()
 }
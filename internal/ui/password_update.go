@@ -6,6 +6,8 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
+
+	"fmt"
 )
 
 // openPasswordUpdateWindow opens a new window for updating a user's password.
@@ -16,7 +18,7 @@ import (
 //	username: The username of the user to update.
 func openPasswordUpdateWindow(a fyne.App, username string) {
 	updateWindow := a.NewWindow("Update Password")
-	updateWindow.Resize(fyne.NewSize(400, 250))
+	updateWindow.Resize(fyne.NewSize(400, 370))
 	updateWindow.CenterOnScreen()
 
 	titleLabel := widget.NewLabel("Update Password for: " + username)
@@ -27,6 +29,11 @@ func openPasswordUpdateWindow(a fyne.App, username string) {
 	passwordEntry := widget.NewPasswordEntry()
 	passwordEntry.SetPlaceHolder("Enter new password")
 
+	meter := newStrengthMeter()
+	passwordEntry.OnChanged = func(password string) {
+		meter.update(password, username)
+	}
+
 	statusLabel := widget.NewLabel("")
 
 	submitBtn := widget.NewButton("Update Password", func() {
@@ -39,10 +46,17 @@ func openPasswordUpdateWindow(a fyne.App, username string) {
 			return
 		}
 
-		queries.EditUserPassword(password, username)
+		confirmIfBreached(updateWindow, password, func() {
+			if err := queries.EditUserPassword(password, username); err != nil {
+				statusLabel.SetText(fmt.Sprintf("Could not update password: %s", err))
+				statusLabel.Importance = widget.DangerImportance
+				statusLabel.Refresh()
+				return
+			}
 
-		updateWindow.Close()
-		refreshUserList(a)
+			updateWindow.Close()
+			refreshUserList(a)
+		})
 	})
 	submitBtn.Importance = widget.HighImportance
 
@@ -60,6 +74,7 @@ func openPasswordUpdateWindow(a fyne.App, username string) {
 		widget.NewSeparator(),
 		passwordLabel,
 		passwordEntry,
+		meter.container(),
 		widget.NewSeparator(),
 		buttonContainer,
 		statusLabel,
@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"aegis/internal/audit"
+	"aegis/internal/config"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// openSecurityAuditWindow opens a window showing the vault health report.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+func openSecurityAuditWindow(a fyne.App) {
+	auditWindow := a.NewWindow("Security Audit")
+	auditWindow.Resize(fyne.NewSize(600, 600))
+	auditWindow.CenterOnScreen()
+
+	titleLabel := widget.NewLabel("Security Audit")
+	titleLabel.TextStyle.Bold = true
+	titleLabel.Importance = widget.HighImportance
+
+	monthsLabel := widget.NewLabel("Flag passwords older than (months):")
+	monthsEntry := widget.NewEntry()
+	monthsEntry.SetText(strconv.Itoa(audit.DefaultMaxAgeMonths))
+
+	statusLabel := widget.NewLabel("")
+	resultsContainer := container.NewVBox()
+
+	corpusLabel := widget.NewLabel(breachCorpusDescription())
+	corpusLabel.Wrapping = fyne.TextWrapWord
+
+	runAudit := func() {
+		months, err := strconv.Atoi(monthsEntry.Text)
+		if err != nil || months < 1 {
+			statusLabel.SetText("Months must be a positive number")
+			statusLabel.Importance = widget.DangerImportance
+			statusLabel.Refresh()
+			return
+		}
+
+		report, err := audit.Run(months, breachCorpus)
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Audit failed: %s", err))
+			statusLabel.Importance = widget.DangerImportance
+			statusLabel.Refresh()
+			return
+		}
+
+		statusLabel.SetText(fmt.Sprintf("%d entries scanned, %d issues found", report.TotalEntries, report.IssueCount()))
+		statusLabel.Importance = widget.MediumImportance
+		statusLabel.Refresh()
+
+		resultsContainer.Objects = buildAuditSections(report)
+		resultsContainer.Refresh()
+	}
+
+	runBtn := widget.NewButton("Run Audit", runAudit)
+	runBtn.Importance = widget.HighImportance
+
+	corpusBtn := widget.NewButton("Select Breach File", func() {
+		dialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("File open error:", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			if err := setBreachCorpusFile(reader.URI().Path()); err != nil {
+				statusLabel.SetText(fmt.Sprintf("Could not use breach file: %s", err))
+				statusLabel.Importance = widget.DangerImportance
+				statusLabel.Refresh()
+				return
+			}
+
+			corpusLabel.SetText(breachCorpusDescription())
+			runAudit()
+			refreshUserList(a)
+		}, auditWindow)
+
+		dialog.Show()
+	})
+
+	closeBtn := widget.NewButton("Close", func() {
+		auditWindow.Close()
+	})
+
+	buttonContainer := container.NewHBox(
+		runBtn,
+		corpusBtn,
+		closeBtn,
+	)
+
+	form := container.NewVBox(
+		titleLabel,
+		widget.NewSeparator(),
+		container.NewBorder(nil, nil, monthsLabel, nil, monthsEntry),
+		corpusLabel,
+		buttonContainer,
+		statusLabel,
+		widget.NewSeparator(),
+	)
+
+	content := container.NewStack(
+		windowBg,
+		container.NewPadded(container.NewBorder(form, nil, nil, nil, container.NewVScroll(resultsContainer))),
+	)
+
+	auditWindow.SetContent(content)
+	auditWindow.Show()
+
+	runAudit()
+}
+
+// buildAuditSections renders each part of a health report as a titled card.
+//
+// Args:
+//
+//	report: The report to render.
+//
+// Returns:
+//
+//	A slice of Fyne canvas objects, one per report section.
+func buildAuditSections(report audit.Report) []fyne.CanvasObject {
+	var reused []string
+	for _, group := range report.Reused {
+		reused = append(reused, strings.Join(group.Usernames, ", "))
+	}
+
+	var weak []string
+	for _, entry := range report.Weak {
+		line := fmt.Sprintf("%s: %s", entry.Username, entry.Label)
+		if entry.Warning != "" {
+			line += " (" + entry.Warning + ")"
+		}
+		weak = append(weak, line)
+	}
+
+	var old []string
+	for _, entry := range report.Old {
+		old = append(old, fmt.Sprintf("%s: last changed %s (%d days ago)",
+			entry.Username, entry.UpdatedOn.Format("2006-01-02"), entry.AgeDays))
+	}
+
+	var sections []fyne.CanvasObject
+	if len(report.Unreadable) > 0 {
+		var unreadable []string
+		for _, entry := range report.Unreadable {
+			unreadable = append(unreadable, fmt.Sprintf("%s: %s", entry.Username, entry.Error))
+		}
+		sections = append(sections, createAuditSection("Unreadable entries, see Check Vault", "", unreadable))
+	}
+
+	sections = append(sections,
+		createAuditSection("Reused passwords", "No passwords are shared between entries", reused),
+		createAuditSection("Weak passwords", "No weak passwords found", weak),
+		createAuditSection(fmt.Sprintf("Unchanged for more than %d months", report.MaxAgeMonths), "All passwords are recent enough", old),
+	)
+
+	if report.BreachCheck {
+		var breached []string
+		for _, entry := range report.Breached {
+			breached = append(breached, fmt.Sprintf("%s: seen %d times in known breaches", entry.Username, entry.Count))
+		}
+		sections = append(sections, createAuditSection("Breached passwords", "No passwords found in the breach file", breached))
+	}
+
+	return sections
+}
+
+// breachCorpusDescription describes which breach file, if any, is in use.
+//
+// Returns:
+//
+//	A short description for the audit window.
+func breachCorpusDescription() string {
+	if breachCorpus == nil {
+		return "Breach check: no Pwned Passwords file selected"
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		return fmt.Sprintf("Breach check: %s corpus", breachCorpus.HashType())
+	}
+
+	return fmt.Sprintf("Breach check: %s (%s)", settings.HIBPFile, breachCorpus.HashType())
+}
+
+// createAuditSection creates a card listing the findings of one report section.
+//
+// Args:
+//
+//	title: The section title.
+//	emptyMessage: The message shown when the section has no findings.
+//	lines: One line per finding.
+//
+// Returns:
+//
+//	A Fyne container representing the section.
+func createAuditSection(title, emptyMessage string, lines []string) *fyne.Container {
+	titleLabel := widget.NewLabel(fmt.Sprintf("%s (%d)", title, len(lines)))
+	titleLabel.TextStyle.Bold = true
+
+	body := container.NewVBox(titleLabel, widget.NewSeparator())
+
+	if len(lines) == 0 {
+		emptyLabel := widget.NewLabel(emptyMessage)
+		emptyLabel.Importance = widget.SuccessImportance
+		body.Add(emptyLabel)
+	}
+
+	for _, line := range lines {
+		lineLabel := widget.NewLabel(line)
+		lineLabel.Wrapping = fyne.TextWrapWord
+		lineLabel.Importance = widget.WarningImportance
+		body.Add(lineLabel)
+	}
+
+	return container.NewPadded(body)
+}
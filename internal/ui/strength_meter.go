@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"aegis/internal/strength"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// strengthMeter shows a live password strength estimate below a password entry.
+type strengthMeter struct {
+	bar      *widget.ProgressBar
+	label    *widget.Label
+	feedback *widget.Label
+}
+
+// newStrengthMeter creates an empty strength meter.
+//
+// Returns:
+//
+//	A new strengthMeter instance.
+func newStrengthMeter() *strengthMeter {
+	m := &strengthMeter{
+		bar:      widget.NewProgressBar(),
+		label:    widget.NewLabel(""),
+		feedback: widget.NewLabel(""),
+	}
+
+	m.bar.Min = 0
+	m.bar.Max = strength.MaxScore
+	m.bar.TextFormatter = func() string { return "" }
+	m.feedback.Wrapping = fyne.TextWrapWord
+
+	return m
+}
+
+// container returns the meter's widgets laid out for a form.
+//
+// Returns:
+//
+//	A Fyne container holding the meter.
+func (m *strengthMeter) container() *fyne.Container {
+	return container.NewVBox(
+		container.NewBorder(nil, nil, nil, m.label, m.bar),
+		m.feedback,
+	)
+}
+
+// update re-estimates the password and refreshes the meter.
+//
+// Args:
+//
+//	password: The password currently typed in the entry.
+//	userInputs: Words such as the username that should count as easy to guess.
+func (m *strengthMeter) update(password string, userInputs ...string) {
+	if password == "" {
+		m.bar.SetValue(0)
+		m.label.SetText("")
+		m.feedback.SetText("")
+		return
+	}
+
+	result := strength.Estimate(password, userInputs...)
+
+	m.bar.SetValue(float64(result.Score))
+	m.label.SetText(result.Label())
+
+	var lines []string
+	if result.Feedback.Warning != "" {
+		lines = append(lines, result.Feedback.Warning)
+	}
+	lines = append(lines, result.Feedback.Suggestions...)
+	lines = append(lines, "Offline crack time: "+result.CrackTimes.OfflineSlowHash.Display)
+
+	m.feedback.SetText(strings.Join(lines, "\n"))
+
+	switch {
+	case result.Score <= 1:
+		m.label.Importance = widget.DangerImportance
+	case result.Score == 2:
+		m.label.Importance = widget.WarningImportance
+	default:
+		m.label.Importance = widget.SuccessImportance
+	}
+	m.label.Refresh()
+}
@@ -0,0 +1,214 @@
+package ui
+
+import (
+	"aegis/internal/doctor"
+	"aegis/internal/queries"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// openVaultDoctorWindow opens a window that checks that every entry of the
+// vault can be read and offers to quarantine those that cannot.
+//
+// Args:
+//
+//	a: The Fyne application instance.
+func openVaultDoctorWindow(a fyne.App) {
+	doctorWindow := a.NewWindow("Check Vault")
+	doctorWindow.Resize(fyne.NewSize(600, 600))
+	doctorWindow.CenterOnScreen()
+
+	titleLabel := widget.NewLabel("Check Vault")
+	titleLabel.TextStyle.Bold = true
+	titleLabel.Importance = widget.HighImportance
+
+	descriptionLabel := widget.NewLabel("Checks the database file, decrypts every entry and looks for damaged or orphaned rows. Repairs are made after a backup is taken.")
+	descriptionLabel.Wrapping = fyne.TextWrapWord
+
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+	progressBar := widget.NewProgressBar()
+	progressBar.Hide()
+	resultsContainer := container.NewVBox()
+
+	setStatus := func(text string, importance widget.Importance) {
+		statusLabel.SetText(text)
+		statusLabel.Importance = importance
+		statusLabel.Refresh()
+	}
+
+	var report doctor.Report
+	var runBtn, quarantineBtn, orphansBtn *widget.Button
+
+	var runCheck func()
+	repair := func(options doctor.RepairOptions) {
+		quarantined, removed, err := doctor.Repair(report, options)
+		if err != nil {
+			setStatus(fmt.Sprintf("Repair failed: %s", err), widget.DangerImportance)
+			return
+		}
+		refreshUserList(a)
+		runCheck()
+		dialog.ShowInformation("Vault Repaired",
+			fmt.Sprintf("Quarantined %d entries and removed %d orphaned rows.", quarantined, removed), doctorWindow)
+	}
+
+	quarantineBtn = widget.NewButton("Quarantine Bad Entries", func() {
+		message := fmt.Sprintf("Move %d entries that cannot be read out of the vault?\nThey are kept in quarantine and can be moved back.", len(report.Entries))
+		dialog.ShowConfirm("Quarantine Entries", message, func(ok bool) {
+			if ok {
+				repair(doctor.RepairOptions{Quarantine: true})
+			}
+		}, doctorWindow)
+	})
+	quarantineBtn.Importance = widget.DangerImportance
+	quarantineBtn.Disable()
+
+	orphansBtn = widget.NewButton("Remove Orphaned Rows", func() {
+		repair(doctor.RepairOptions{RemoveOrphans: true})
+	})
+	orphansBtn.Disable()
+
+	showReport := func() {
+		if report.IssueCount() == 0 {
+			setStatus(fmt.Sprintf("%d entries checked, no problems found", report.TotalEntries), widget.SuccessImportance)
+		} else {
+			setStatus(fmt.Sprintf("%d entries checked, %d problems found", report.TotalEntries, report.IssueCount()), widget.DangerImportance)
+		}
+		if len(report.Entries) > 0 {
+			quarantineBtn.Enable()
+		} else {
+			quarantineBtn.Disable()
+		}
+		if len(report.OrphanedMeta) > 0 {
+			orphansBtn.Enable()
+		} else {
+			orphansBtn.Disable()
+		}
+
+		resultsContainer.Objects = buildDoctorSections(report, func(err error) {
+			if err != nil {
+				setStatus(fmt.Sprintf("Could not move the entry back: %s", err), widget.DangerImportance)
+				return
+			}
+			refreshUserList(a)
+			runCheck()
+		})
+		resultsContainer.Refresh()
+	}
+
+	runCheck = func() {
+		runBtn.Disable()
+		quarantineBtn.Disable()
+		orphansBtn.Disable()
+		progressBar.SetValue(0)
+		progressBar.Show()
+		setStatus("Checking...", widget.MediumImportance)
+
+		go func() {
+			result, err := doctor.Run(func(done, total int) {
+				fyne.Do(func() {
+					progressBar.SetValue(float64(done) / float64(total))
+				})
+			})
+
+			fyne.Do(func() {
+				progressBar.Hide()
+				runBtn.Enable()
+				if err != nil {
+					setStatus(fmt.Sprintf("Check failed: %s", err), widget.DangerImportance)
+					return
+				}
+				report = result
+				showReport()
+			})
+		}()
+	}
+
+	runBtn = widget.NewButton("Run Check", func() {
+		runCheck()
+	})
+	runBtn.Importance = widget.HighImportance
+
+	closeBtn := widget.NewButton("Close", func() {
+		doctorWindow.Close()
+	})
+
+	form := container.NewVBox(
+		titleLabel,
+		widget.NewSeparator(),
+		descriptionLabel,
+		container.NewHBox(runBtn, quarantineBtn, orphansBtn, closeBtn),
+		progressBar,
+		statusLabel,
+		widget.NewSeparator(),
+	)
+
+	content := container.NewStack(
+		windowBg,
+		container.NewPadded(container.NewBorder(form, nil, nil, nil, container.NewVScroll(resultsContainer))),
+	)
+
+	doctorWindow.SetContent(content)
+	doctorWindow.Show()
+
+	runCheck()
+}
+
+// buildDoctorSections renders each part of a vault check report as a titled
+// card, with a button to move each quarantined entry back.
+//
+// Args:
+//
+//	report: The report to render.
+//	released: Called after a quarantined entry is moved back, with the error
+//	  if it could not be.
+//
+// Returns:
+//
+//	A slice of Fyne canvas objects, one per report section.
+func buildDoctorSections(report doctor.Report, released func(error)) []fyne.CanvasObject {
+	var entries []string
+	for _, entry := range report.Entries {
+		name := entry.Username
+		if name == "" {
+			name = fmt.Sprintf("(row %d)", entry.RowID)
+		}
+		entries = append(entries, fmt.Sprintf("%s: %s", name, strings.Join(entry.Problems, "; ")))
+	}
+
+	sections := []fyne.CanvasObject{
+		createAuditSection("Database file", "SQLite found no damage", report.Integrity),
+		createAuditSection("Entries that cannot be read", "Every entry decrypts", entries),
+		createAuditSection("Orphaned meta rows", "No orphaned rows", report.OrphanedMeta),
+	}
+	if len(report.Integrity) > 0 {
+		hint := widget.NewLabel("The database file is damaged. Restore a backup from the Backups window.")
+		hint.Wrapping = fyne.TextWrapWord
+		hint.Importance = widget.DangerImportance
+		sections = append(sections, hint)
+	}
+
+	if len(report.Quarantined) > 0 {
+		titleLabel := widget.NewLabel(fmt.Sprintf("In quarantine (%d)", len(report.Quarantined)))
+		titleLabel.TextStyle.Bold = true
+		quarantine := container.NewVBox(titleLabel, widget.NewSeparator())
+		for _, entry := range report.Quarantined {
+			label := widget.NewLabel(fmt.Sprintf("%s, quarantined %s: %s", entry.Username, entry.QuarantinedOn.Local().Format("2006-01-02"), entry.Reason))
+			label.Wrapping = fyne.TextWrapWord
+			id := entry.ID
+			releaseBtn := widget.NewButton("Move Back", func() {
+				released(queries.ReleaseQuarantined(id))
+			})
+			quarantine.Add(container.NewBorder(nil, nil, nil, releaseBtn, label))
+		}
+		sections = append(sections, container.NewPadded(quarantine))
+	}
+
+	return sections
+}
@@ -0,0 +1,84 @@
+#!/bin/sh
+# Registers aegis-native-host with Chromium-based browsers and Firefox for the
+# current user on Linux.
+#
+# Usage: install.sh [--uninstall] [--chrome-extension ID] [--firefox-extension ID] [HOST_PATH]
+#
+# HOST_PATH defaults to aegis-native-host on $PATH. Browsers only start the
+# host for the extension IDs written into the manifests.
+set -eu
+
+NAME=com.aegis.native_host
+DIR=$(cd "$(dirname "$0")" && pwd)
+CONFIG=${XDG_CONFIG_HOME:-$HOME/.config}
+
+CHROMIUM_DIRS="$CONFIG/google-chrome/NativeMessagingHosts
+$CONFIG/chromium/NativeMessagingHosts
+$CONFIG/BraveSoftware/Brave-Browser/NativeMessagingHosts
+$CONFIG/microsoft-edge/NativeMessagingHosts"
+FIREFOX_DIR="$HOME/.mozilla/native-messaging-hosts"
+
+uninstall=0
+chrome_id=""
+firefox_id=""
+host=""
+
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--uninstall) uninstall=1 ;;
+	--chrome-extension) shift; chrome_id=${1:?--chrome-extension needs an ID} ;;
+	--firefox-extension) shift; firefox_id=${1:?--firefox-extension needs an ID} ;;
+	-h|--help) sed -n '2,8p' "$0" | sed 's/^# \{0,1\}//'; exit 0 ;;
+	-*) echo "install.sh: unknown flag $1" >&2; exit 2 ;;
+	*) host=$1 ;;
+	esac
+	shift
+done
+
+if [ "$uninstall" = 1 ]; then
+	echo "$CHROMIUM_DIRS" | while read -r dir; do
+		rm -f "$dir/$NAME.json"
+	done
+	rm -f "$FIREFOX_DIR/$NAME.json"
+	echo "Removed the $NAME manifests"
+	exit 0
+fi
+
+if [ -z "$chrome_id" ] && [ -z "$firefox_id" ]; then
+	echo "install.sh: give --chrome-extension, --firefox-extension or both" >&2
+	exit 2
+fi
+
+if [ -z "$host" ]; then
+	host=$(command -v aegis-native-host || true)
+fi
+if [ -z "$host" ] || [ ! -x "$host" ]; then
+	echo "install.sh: aegis-native-host not found; pass its path" >&2
+	exit 1
+fi
+# Browsers require an absolute path.
+host=$(cd "$(dirname "$host")" && pwd)/$(basename "$host")
+
+# render TEMPLATE DEST writes a manifest with the placeholders filled in.
+render() {
+	mkdir -p "$(dirname "$2")"
+	sed -e "s|@HOST_PATH@|$host|" \
+		-e "s|@CHROME_EXTENSION_ID@|$chrome_id|" \
+		-e "s|@FIREFOX_EXTENSION_ID@|$firefox_id|" \
+		"$DIR/$1" > "$2"
+	chmod 0644 "$2"
+	echo "Wrote $2"
+}
+
+if [ -n "$chrome_id" ]; then
+	echo "$CHROMIUM_DIRS" | while read -r dir; do
+		# Only register with browsers that are installed.
+		if [ -d "$(dirname "$dir")" ]; then
+			render chromium.json "$dir/$NAME.json"
+		fi
+	done
+fi
+
+if [ -n "$firefox_id" ]; then
+	render firefox.json "$FIREFOX_DIR/$NAME.json"
+fi